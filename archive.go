@@ -0,0 +1,195 @@
+package autoupgrade
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// archiveKind is the container format of a downloaded release asset.
+type archiveKind int
+
+const (
+	notArchive archiveKind = iota
+	tarGzArchive
+	zipArchive
+)
+
+// detectArchive reports the format of the file at name from its magic bytes,
+// falling back to the asset name's extension for an empty or short file.
+func detectArchive(name, assetName string) (archiveKind, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return notArchive, err
+	}
+	defer f.Close()
+	magic := make([]byte, 4)
+	n, _ := io.ReadFull(f, magic)
+	switch magic = magic[:n]; {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return tarGzArchive, nil
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")):
+		return zipArchive, nil
+	case len(magic) < 4:
+		lower := strings.ToLower(assetName)
+		switch {
+		case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+			return tarGzArchive, nil
+		case strings.HasSuffix(lower, ".zip"):
+			return zipArchive, nil
+		}
+	}
+	return notArchive, nil
+}
+
+// archiveEntry is a regular file found in an archive. open is only set for
+// zip entries, which can be read in any order.
+type archiveEntry struct {
+	name string
+	mode fs.FileMode
+	open func() (io.ReadCloser, error)
+}
+
+// maxExtractedSize caps the size of the binary extracted from an archive, so
+// a crafted archive cannot fill the disk. A variable for tests.
+var maxExtractedSize int64 = 1 << 30
+
+// extractBinary extracts the executable for binName from the archive at
+// name into a temporary file in dir and returns its path. The entry whose
+// base name is binName (with or without ".exe") is used, wherever it is
+// nested; failing that, the only executable entry. Its permission bits are
+// kept, with the executable bits added if the archive recorded none.
+func extractBinary(name string, kind archiveKind, binName, dir string) (string, error) {
+	switch kind {
+	case tarGzArchive:
+		// A tar stream can only be read once, so the first pass extracts
+		// the entry named binName as it goes by, and a second pass is only
+		// needed for the fallback to the only executable.
+		var entries []archiveEntry
+		out, err := scanTar(name, dir, func(hdr *tar.Header) bool {
+			entries = append(entries, archiveEntry{name: hdr.Name, mode: hdr.FileInfo().Mode()})
+			return isBinaryName(hdr.Name, binName)
+		})
+		if out != "" || err != nil {
+			return out, err
+		}
+		entry, err := pickBinary(entries, binName)
+		if err != nil {
+			return "", err
+		}
+		return scanTar(name, dir, func(hdr *tar.Header) bool {
+			return hdr.Name == entry.name
+		})
+	case zipArchive:
+		zr, err := zip.OpenReader(name)
+		if err != nil {
+			return "", fmt.Errorf("autoupgrade: reading archive: %w", err)
+		}
+		defer zr.Close()
+		var entries []archiveEntry
+		for _, zf := range zr.File {
+			if !zf.Mode().IsRegular() {
+				continue
+			}
+			entries = append(entries, archiveEntry{name: zf.Name, mode: zf.Mode(), open: zf.Open})
+		}
+		entry, err := pickBinary(entries, binName)
+		if err != nil {
+			return "", err
+		}
+		r, err := entry.open()
+		if err != nil {
+			return "", fmt.Errorf("autoupgrade: reading archive: %w", err)
+		}
+		defer r.Close()
+		return writeBinary(dir, entry, r)
+	}
+	return "", fmt.Errorf("autoupgrade: %s is not an archive", name)
+}
+
+// scanTar reads the regular entries of the tar.gz archive at name in order
+// and extracts the first for which match returns true into dir, as
+// writeBinary does. It returns "" if none matches.
+func scanTar(name, dir string, match func(*tar.Header) bool) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return "", fmt.Errorf("autoupgrade: reading archive: %w", err)
+	}
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return "", nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("autoupgrade: reading archive: %w", err)
+		}
+		if hdr.Typeflag == tar.TypeReg && match(hdr) {
+			return writeBinary(dir, archiveEntry{name: hdr.Name, mode: hdr.FileInfo().Mode()}, tr)
+		}
+	}
+}
+
+// writeBinary copies the contents of entry from r into a temporary file in
+// dir, failing if it exceeds maxExtractedSize, and returns its path.
+func writeBinary(dir string, entry archiveEntry, r io.Reader) (string, error) {
+	f, err := os.CreateTemp(dir, ".autoupgrade-extract-*")
+	if err != nil {
+		return "", err
+	}
+	n, err := io.Copy(f, io.LimitReader(r, maxExtractedSize+1))
+	if err == nil && n > maxExtractedSize {
+		err = fmt.Errorf("larger than %d bytes", maxExtractedSize)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	perm := entry.mode.Perm()
+	if perm&0o111 == 0 {
+		perm |= 0o755
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), perm)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("autoupgrade: extracting %s: %w", entry.name, err)
+	}
+	return f.Name(), nil
+}
+
+// isBinaryName reports whether the archive entry name is the binary binName,
+// ignoring its directory and a ".exe" suffix on either.
+func isBinaryName(name, binName string) bool {
+	base := strings.TrimSuffix(path.Base(name), ".exe")
+	return base == strings.TrimSuffix(binName, ".exe")
+}
+
+// pickBinary chooses the entry to install, as described for extractBinary.
+func pickBinary(entries []archiveEntry, binName string) (archiveEntry, error) {
+	var executables []archiveEntry
+	for _, e := range entries {
+		if isBinaryName(e.name, binName) {
+			return e, nil
+		}
+		if e.mode&0o111 != 0 || strings.HasSuffix(e.name, ".exe") {
+			executables = append(executables, e)
+		}
+	}
+	if len(executables) == 1 {
+		return executables[0], nil
+	}
+	return archiveEntry{}, fmt.Errorf("%w %q (%d other executables)", ErrNoBinaryInArchive, binName, len(executables))
+}
@@ -0,0 +1,136 @@
+package autoupgrade
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+type testEntry struct {
+	name string
+	mode fs.FileMode
+	body string
+}
+
+func writeTarGz(t *testing.T, path string, entries ...testEntry) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, e := range entries {
+		if err := tw.WriteHeader(&tar.Header{Name: e.name, Mode: int64(e.mode), Size: int64(len(e.body)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(e.body))
+	}
+	tw.Close()
+	zw.Close()
+	writeFile(t, path, buf.Bytes())
+}
+
+func writeZip(t *testing.T, path string, entries ...testEntry) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		h := &zip.FileHeader{Name: e.name}
+		h.SetMode(e.mode)
+		w, err := zw.CreateHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(e.body))
+	}
+	zw.Close()
+	writeFile(t, path, buf.Bytes())
+}
+
+func Test_extractBinary(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		write   func(*testing.T, string, ...testEntry)
+		entries []testEntry
+		kind    archiveKind
+		want    string
+		wantErr error
+	}{
+		{"tar nested by name", writeTarGz, []testEntry{
+			{"tool_1.2.3/README.md", 0o644, "docs"},
+			{"tool_1.2.3/helper", 0o755, "helper"},
+			{"tool_1.2.3/bin/tool", 0o750, "binary"},
+		}, tarGzArchive, "binary", nil},
+		{"tar single executable", writeTarGz, []testEntry{
+			{"LICENSE", 0o644, "license"},
+			{"tool-linux", 0o755, "binary"},
+		}, tarGzArchive, "binary", nil},
+		{"zip exe", writeZip, []testEntry{
+			{"dist/tool.exe", 0o644, "binary"},
+			{"dist/README.txt", 0o644, "docs"},
+		}, zipArchive, "binary", nil},
+		{"tar first match", writeTarGz, []testEntry{
+			{"tool", 0o755, "binary"},
+			{"old/tool", 0o755, "old"},
+		}, tarGzArchive, "binary", nil},
+		{"ambiguous", writeTarGz, []testEntry{
+			{"a", 0o755, "a"},
+			{"b", 0o755, "b"},
+		}, tarGzArchive, "", ErrNoBinaryInArchive},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := filepath.Join(dir, tt.name+".archive")
+			tt.write(t, archive, tt.entries...)
+			kind, err := detectArchive(archive, "asset")
+			if err != nil || kind != tt.kind {
+				t.Fatalf("detectArchive() = %v, %v, want %v", kind, err, tt.kind)
+			}
+			got, err := extractBinary(archive, kind, "tool", dir)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("extractBinary() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer os.Remove(got)
+			if data, _ := os.ReadFile(got); string(data) != tt.want {
+				t.Errorf("extracted %q, want %q", data, tt.want)
+			}
+			if fi, err := os.Stat(got); runtime.GOOS != "windows" && (err != nil || fi.Mode().Perm()&0o100 == 0) {
+				t.Errorf("extracted file mode = %v, %v, want executable", fi.Mode(), err)
+			}
+		})
+	}
+}
+
+func Test_extractBinary_sizeLimit(t *testing.T) {
+	old := maxExtractedSize
+	maxExtractedSize = 4
+	t.Cleanup(func() { maxExtractedSize = old })
+
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "tool.tar.gz")
+	writeTarGz(t, archive, testEntry{"tool", 0o755, "binary"})
+	if _, err := extractBinary(archive, tarGzArchive, "tool", dir); err == nil || !strings.Contains(err.Error(), "larger than 4 bytes") {
+		t.Errorf("extractBinary() error = %v, want size limit", err)
+	}
+	if left, _ := filepath.Glob(filepath.Join(dir, ".autoupgrade-extract-*")); len(left) != 0 {
+		t.Errorf("left behind %v", left)
+	}
+}
+
+func Test_detectArchive_bare(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tool")
+	writeFile(t, path, []byte("\x7fELF binary"))
+	if kind, err := detectArchive(path, "tool_linux_amd64.tar.gz"); err != nil || kind != notArchive {
+		t.Errorf("detectArchive() = %v, %v, want notArchive", kind, err)
+	}
+}
@@ -3,11 +3,18 @@ package autoupgrade
 import (
 	"context"
 	"debug/buildinfo"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
-	"os/exec"
-	"path"
+	"path/filepath"
 	"runtime/debug"
+	"sort"
+	"strings"
 	"sync"
+	"time"
+
+	"golang.org/x/mod/module"
 )
 
 // UpgradeResult contains the result of an upgrade operation.
@@ -16,96 +23,1009 @@ import (
 type UpgradeResult struct {
 	CurrentInfo *debug.BuildInfo // Current build information of the running process, if available
 	ExitError   error            // Error encountered during the upgrade process, if any
-	once        sync.Once
-	newInfo     *debug.BuildInfo
-	newInfoErr  error
+	SkipReason  SkipReason       // Why the upgrade was skipped, empty if it was attempted
+	Decision    Decision         // Inputs the skip or install decision was based on
+	// InstalledPath is the path the new binary was written to, empty if
+	// nothing was installed.
+	InstalledPath string
+	// ToolchainVersion is the Go version that built the installed binary,
+	// such as "go1.22.1", which differs from the running binary's when
+	// GOTOOLCHAIN switched toolchains. It is empty if go install did not run.
+	ToolchainVersion string
+	// ToolchainDownloaded reports whether the go command downloaded a Go
+	// toolchain, named by DownloadedToolchain, to run the install, as
+	// GOTOOLCHAIN does when the new version requires a release that is not
+	// yet in the module cache. Switching to a toolchain already there
+	// changes ToolchainVersion without setting it. It is best-effort, read
+	// from the go command's "go: downloading go1.x.y" line.
+	ToolchainDownloaded bool
+	DownloadedToolchain string
+	// InstalledSize and InstalledModTime describe the installed file, and
+	// are zero if nothing was installed.
+	InstalledSize    int64
+	InstalledModTime time.Time
+	// ModulePath is the module path the upgrade used: the running binary's,
+	// or the WithFallbackModulePaths entry tried after it failed.
+	ModulePath string
+	// DryRunCommands holds the commands go install -n printed with
+	// WithGoInstallDryRun.
+	DryRunCommands string
+	// Backend is the install mechanism that ran, empty if the upgrade was
+	// skipped before installing. With BackendGitHub, ReleaseTag and
+	// ReleaseAsset name the release and asset downloaded.
+	Backend      Backend
+	ReleaseTag   string
+	ReleaseAsset string
+	// VerifyInconclusive is set when the WithVerifyCommand run timed out
+	// under WithVerifyTimeout.
+	VerifyInconclusive bool
+	// RestartError is the error from restarting into the new binary under
+	// RunBackground with WithRestart; after a successful restart there is
+	// no result to receive.
+	RestartError error
+	// StagedFor is the path the binary at InstalledPath is meant to replace
+	// under WithReplaceRunning(false), empty when it was installed in place.
+	StagedFor string
+	// Warnings flag problems with a completed upgrade that do not fail it,
+	// such as WarnInstallDirNotOnPath.
+	Warnings []Warning
+	// BuildTags are the build tags passed to go install under
+	// WithPreserveBuildTags, as read from the running binary.
+	BuildTags []string
+	// NewerPrereleaseAvailable is, with WithReportPrereleases, the newest
+	// prerelease above the running version when the upgrade was skipped as
+	// already at @latest, which selects only releases. It is empty when
+	// there is none, and it is never installed without a channel that
+	// accepts prereleases.
+	NewerPrereleaseAvailable string
+	// Tail holds the last lines of go install output, oldest first, under
+	// WithTail.
+	Tail []string
+	// Downloaded lists the modules go install reported downloading, as
+	// "path@version", under WithTrackDownloads. It is best-effort, read from
+	// the go command's "go: downloading" lines.
+	Downloaded []string
+	// CacheCleanError is the error from cleaning the build cache under
+	// WithCacheSizeLimit, which does not fail the upgrade.
+	CacheCleanError error
+	// Start and End are when Upgrade began and returned.
+	Start, End time.Time
+	// CorrelationID is the ID set with WithCorrelationID or
+	// ContextWithCorrelationID, if any.
+	CorrelationID string
+
+	mu               sync.Mutex
+	loaded           bool
+	execPath         string
+	rolling          bool
+	newInfo          *debug.BuildInfo
+	newInfoErr       error
+	installedVersion string
+	phases           []Phase
+	installArg       string
+	latestVersion    string // what the pre-check found @latest to be
+	onPhase          func(Phase)
+}
+
+// Target returns the package argument Upgrade passed to go install, such as
+// "example.com/tool/cmd/tool@v1.2.3", or would have passed when it was
+// skipped once the target was resolved. It is empty when Upgrade stopped
+// before resolving a target, and with WithGitHubRelease.
+func (u *UpgradeResult) Target() string {
+	return u.installArg
+}
+
+// setInstalled records that the new binary was written to path.
+func (u *UpgradeResult) setInstalled(path string) {
+	u.InstalledPath = path
+	if fi, err := os.Stat(path); err == nil {
+		u.InstalledSize = fi.Size()
+		u.InstalledModTime = fi.ModTime()
+	}
+}
+
+// setToolchainDownload records on u the toolchain the go command reported
+// downloading in stderr, if any.
+func (u *UpgradeResult) setToolchainDownload(stderr []byte) {
+	if v := parseToolchainDownload(stderr); v != "" {
+		u.ToolchainDownloaded, u.DownloadedToolchain = true, v
+	}
+}
+
+// readBuildInfo returns the build information of the running process. It is
+// immutable for the life of the process, so it is read once and shared. It is
+// a variable so tests can stand in for a released build.
+var readBuildInfo = sync.OnceValues(debug.ReadBuildInfo)
+
+// isTestBinary reports whether the process is a test binary built by 'go
+// test'. It is a variable so the package's own tests can exercise Upgrade.
+var isTestBinary = sync.OnceValue(func() bool {
+	// testing.Init registers the test.* flags, without this package having
+	// to import testing.
+	if flag.Lookup("test.v") != nil {
+		return true
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return false
+	}
+	exe = strings.TrimSuffix(exe, ".exe")
+	return strings.HasSuffix(exe, ".test")
+})
+
+// CurrentBuildInfo returns the build information of the running process, as
+// debug.ReadBuildInfo does, caching it for the life of the process. It is what
+// Upgrade and the proxy helpers consult to find the current module and
+// version.
+func CurrentBuildInfo() (*debug.BuildInfo, bool) {
+	return readBuildInfo()
 }
 
 // Upgrade attempts to upgrade the current binary to the latest version using
 // 'go install'. The packagePath parameter specifies the relative path from the
 // module root to the package. Upgrade is skipped if the current version is a
-// development build or build info is unavailable.
+// development build, build info is unavailable, or the process is a test
+// binary built by 'go test'. Missing build info is also reported as an
+// ExitError wrapping ErrNoBuildInfo, with SkipNoBuildInfo.
 // Context cancellation can be used to kill the go install process.
-func Upgrade(ctx context.Context, packagePath string) *UpgradeResult {
-	info, ok := debug.ReadBuildInfo()
+//
+// Upgrade is safe to call concurrently and early in process startup, including
+// from init functions via UpgradeBackground. Concurrent installs are
+// serialized; see WithMutex.
+func Upgrade(ctx context.Context, packagePath string, opts ...Option) *UpgradeResult {
+	cfg := newConfig(opts)
+	// A local module has no version to compare, so it is treated like a
+	// rolling channel
+	rolling := cfg.rolling || cfg.localModule != ""
+	if cfg.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.timeout)
+		defer cancel()
+	}
+	// Fix the ID for the log prefix; requests would also find it on ctx.
+	cfg.correlation = cfg.correlationID(ctx)
+	res := &UpgradeResult{execPath: cfg.execPath, rolling: rolling, Start: time.Now(), CorrelationID: cfg.correlation, onPhase: cfg.onPhase}
+	defer func() { res.End = time.Now() }()
+	if cfg.expvarName != "" {
+		defer cfg.recordExpvar(res)
+	}
+	defer cfg.logOutcome(res)
+
+	info, ok := CurrentBuildInfo()
 	if !ok {
-		return &UpgradeResult{}
+		res.SkipReason = SkipNoBuildInfo
+		res.ExitError = fmt.Errorf("%w: the binary was not built with module support", ErrNoBuildInfo)
+		return res
+	}
+	res.CurrentInfo = info
+	d := &res.Decision
+	d.CurrentVersion = info.Main.Version
+	d.Channel = cfg.channel
+	if ch := cfg.inferredChannel(info.Main.Version); ch != "" {
+		d.Channel = ch
 	}
+	d.Devel = cfg.isDevel(info)
+	d.Rolling = rolling
+	d.TestBinary = isTestBinary()
 
-	// Don't upgrade if the current version is a development version
-	if info.Main.Version == "(devel)" {
-		return &UpgradeResult{CurrentInfo: info}
+	// Never shell out to go install from a test run
+	if d.TestBinary {
+		res.SkipReason = SkipTestBinary
+		return res
+	}
+
+	// Don't upgrade if the current version is a development version, unless
+	// following a rolling channel where any build can move to the target
+	if d.Devel && !rolling {
+		res.SkipReason = SkipDevelBuild
+		return res
+	}
+	if cfg.requireVCS && !hasSetting(info, "vcs.revision") {
+		res.SkipReason = SkipNoVCSInfo
+		return res
 	}
 
 	modulePath := info.Main.Path
 	if modulePath == "" {
-		return &UpgradeResult{CurrentInfo: info}
+		res.SkipReason = SkipNoBuildInfo
+		res.ExitError = fmt.Errorf("%w: no main module path, as for a binary built with 'go run file.go' or in GOPATH mode", ErrNoBuildInfo)
+		return res
+	}
+	res.ModulePath = modulePath
+	if cfg.hooks != nil {
+		var end func()
+		ctx, end = cfg.startHooks(ctx, res)
+		defer end()
+	}
+
+	if err := cfg.validate(); err != nil {
+		res.ExitError = err
+		return res
+	}
+	if err := validatePackagePath(packagePath); err != nil {
+		res.ExitError = err
+		return res
+	}
+	if cfg.stateFile != "" {
+		st, err := readState(cfg.stateFile)
+		if err != nil {
+			res.ExitError = fmt.Errorf("autoupgrade: reading state file: %w", err)
+			return res
+		}
+		if st.inBackoff(time.Now(), cfg.failureBackoff) {
+			res.SkipReason = SkipBackoff
+			return res
+		}
+		defer func() {
+			// The outcome is best-effort bookkeeping; failing to save it
+			// must not mask the upgrade's own result. An attempt cut short
+			// by its context says nothing about the upgrade, so it must
+			// not start a backoff.
+			if errors.Is(res.ExitError, context.Canceled) || errors.Is(res.ExitError, context.DeadlineExceeded) {
+				return
+			}
+			st.record(time.Now(), res.ExitError)
+			_ = writeState(cfg.stateFile, st)
+		}()
+	}
+	if cfg.upgradeLog != "" {
+		defer func() {
+			if res.ExitError != nil || res.InstalledPath == "" || res.Decision.AlreadyLatest {
+				return
+			}
+			// Like the state file, the log must not fail the upgrade
+			if err := appendUpgradeLog(cfg.upgradeLog, newUpgradeLogEntry(time.Now(), res)); err != nil {
+				cfg.logf("writing upgrade log: %v", err)
+			}
+		}()
+	}
+	if cfg.github == nil && cfg.localModule == "" {
+		gomod, err := toolGoMod(cfg, importPath(modulePath, packagePath))
+		if err != nil {
+			res.ExitError = err
+			return res
+		}
+		if d.ToolGoMod = gomod; gomod != "" && !cfg.goGetTool {
+			cfg.logf("running as a tool dependency of %s; use WithGoGetTool to update it", gomod)
+			res.SkipReason = SkipToolDependency
+			return res
+		}
+	}
+	// A tool dependency is run from the build cache, not the install
+	// target, so the checks on where go install writes do not apply.
+	if cfg.requireInGoBin && cfg.github == nil && d.ToolGoMod == "" {
+		inGoBin, err := runningFromInstallTarget(cfg, modulePath, packagePath)
+		if err != nil {
+			res.ExitError = err
+			return res
+		}
+		if !inGoBin {
+			res.SkipReason = SkipNotInGoBin
+			return res
+		}
+	}
+	// A build from WithLocalModule is the developer's own, wherever the
+	// system keeps its copy.
+	if !cfg.allowSystemDir && d.ToolGoMod == "" && cfg.localModule == "" {
+		dst := cfg.execPath
+		var err error
+		switch {
+		case cfg.github == nil:
+			dst, err = installTarget(cfg, modulePath, packagePath)
+		case dst == "":
+			// A release replaces the running executable by default.
+			dst, err = executablePath()
+		}
+		if err != nil {
+			res.ExitError = err
+			return res
+		}
+		if path := systemManaged([]string{dst}, systemDirs()); path != "" {
+			cfg.logf("%s is managed by the system or a package manager; use WithAllowSystemDir to upgrade it", path)
+			res.SkipReason = SkipSystemManaged
+			return res
+		}
+	}
+	if err := checkCacheDirs(cfg); err != nil {
+		res.ExitError = err
+		return res
+	}
+	if err := validatePlatform(ctx, cfg); err != nil {
+		res.ExitError = err
+		return res
+	}
+
+	if cfg.github != nil {
+		installRelease(ctx, cfg, res, modulePath)
+		return res
+	}
+	if cfg.localModule != "" {
+		install(ctx, cfg, res, modulePath, packagePath, "")
+		return res
 	}
 
-	cmd := exec.CommandContext(ctx, "go", "install", fullPath(modulePath, packagePath, "latest"))
-	// Suppress standard output and error
-	cmd.Stdout = nil
-	cmd.Stderr = nil
+	// underCeiling records whether a version newer than the current one
+	// was within WithMaxVersion, to tell SkipCeilingReached apart.
+	underCeiling := false
+	if accept, ceiling := cfg.versionFilter, cfg.maxVersion; accept != nil || ceiling != "" {
+		current := res.CurrentInfo.Main.Version
+		cfg.versionFilter = func(v string) bool {
+			newer := semverCompare(v, current) > 0
+			if ceiling != "" {
+				if semverCompare(v, ceiling) > 0 {
+					if newer {
+						d.block(v, PolicyMaxVersion)
+					}
+					return false
+				}
+				underCeiling = underCeiling || newer
+			}
+			if accept == nil {
+				return true
+			}
+			ok := accept(v)
+			if !ok {
+				d.Rejected = append(d.Rejected, v)
+				if newer {
+					d.block(v, PolicyVersionFilter)
+				}
+			}
+			return ok
+		}
+	}
+	// Each module path starts from the same decision inputs
+	base := res.Decision
+	tried := map[string]bool{}
+	for _, path := range append([]string{modulePath}, cfg.fallbackModulePaths...) {
+		if tried[path] {
+			continue
+		}
+		if len(tried) > 0 {
+			cfg.logf("upgrade from %s failed, trying %s: %v", res.ModulePath, path, res.ExitError)
+			res.ExitError, res.SkipReason, res.Decision, res.Backend = nil, "", base, ""
+		}
+		tried[path] = true
+		res.ModulePath = path
+		underCeiling = false
+		upgradeModule(ctx, cfg, res, path, packagePath)
+		if res.SkipReason == SkipNoAcceptableVersion && cfg.maxVersion != "" && !underCeiling {
+			res.SkipReason = SkipCeilingReached
+		}
+		if res.ExitError == nil || ctx.Err() != nil {
+			break
+		}
+	}
+	if res.ExitError != nil && ctx.Err() == nil && (isNotFound(res.ExitError) || errors.Is(res.ExitError, ErrModuleMoved)) {
+		res.ExitError = checkModuleMoved(ctx, cfg, modulePath, info.Main.Version, res.ExitError)
+	}
+	return res
+}
+
+// upgradeModule resolves the target version of modulePath and installs it
+// with go install, unless the running binary is already at it.
+func upgradeModule(ctx context.Context, cfg *config, res *UpgradeResult, modulePath, packagePath string) {
+	endResolve := res.phase("resolve")
+	target, err := resolveUpgrade(ctx, cfg, res, modulePath)
+	endResolve()
+	var block *policyBlock
+	if errors.As(err, &block) {
+		res.Decision.block(block.version, block.policy)
+		res.SkipReason = SkipBlockedByPolicy
+		return
+	}
+	if errors.Is(err, errNoAcceptableVersion) {
+		res.SkipReason = SkipNoAcceptableVersion
+		return
+	}
+	if errors.Is(err, errToolchainTooOld) {
+		res.SkipReason = SkipToolchainTooOld
+		return
+	}
+	if errors.Is(err, errTooFresh) {
+		res.SkipReason = SkipTooFresh
+		return
+	}
+	if errors.Is(err, errNoVersionFile) {
+		res.SkipReason = SkipNoVersionFile
+		return
+	}
+	if errors.Is(err, errNoVersionSatisfiesConstraint) {
+		res.SkipReason = SkipNoVersionSatisfiesConstraint
+		return
+	}
+	if err != nil {
+		res.ExitError = err
+		return
+	}
+	res.installArg = fullPath(modulePath, packagePath, target)
+	if res.Decision.AlreadyLatest {
+		skipAlreadyLatest(cfg, res)
+		return
+	}
+	if err := cfg.runPreUpgrade(res, target); err != nil {
+		res.ExitError = err
+		return
+	}
+	if res.Decision.ToolGoMod != "" {
+		getTool(ctx, cfg, res, modulePath, packagePath, target)
+		return
+	}
+
+	install(ctx, cfg, res, modulePath, packagePath, target)
+	// A query such as @latest can resolve to the running version after
+	// all, when the pre-check was skipped or could not answer.
+	if res.ExitError == nil && res.SkipReason == "" && res.InstalledPath != "" && !res.DidUpgrade() {
+		cfg.logf("installed %s, the version already running", res.installedVersion)
+		skipAlreadyLatest(cfg, res)
+	}
+}
+
+// skipAlreadyLatest records that the running binary is already at the target:
+// as SkipAlreadyLatest, or as a clean no-op with WithAlreadyLatestAsSuccess.
+func skipAlreadyLatest(cfg *config, res *UpgradeResult) {
+	res.Decision.AlreadyLatest = true
+	if !cfg.alreadyLatestOK {
+		res.SkipReason = SkipAlreadyLatest
+	}
+}
+
+// runPreUpgrade calls the WithPreUpgrade function, if any, with the running
+// version and target, the version @latest was found to be when known.
+func (c *config) runPreUpgrade(res *UpgradeResult, target string) error {
+	if c.preUpgrade == nil || c.goInstallDryRun {
+		return nil
+	}
+	if target == "latest" && res.latestVersion != "" {
+		target = res.latestVersion
+	}
+	if err := c.preUpgrade(res.CurrentInfo.Main.Version, target); err != nil {
+		return fmt.Errorf("autoupgrade: pre-upgrade hook: %w", err)
+	}
+	return nil
+}
 
-	err := cmd.Run()
-	return &UpgradeResult{
-		CurrentInfo: info,
-		ExitError:   err,
+// resolveUpgrade returns the version query to install for modulePath and
+// records on res.Decision whether the running binary is already at it.
+func resolveUpgrade(ctx context.Context, cfg *config, res *UpgradeResult, modulePath string) (string, error) {
+	current := res.CurrentInfo.Main.Version
+	d := &res.Decision
+	target, proxy, allow, err := resolveTarget(ctx, cfg, modulePath, current)
+	if err != nil {
+		return "", err
+	}
+	d.Target, d.Proxy = target, proxy
+	cfg.logf("current version %s, target %s", current, target)
+	d.AlreadyLatest = target == current
+	if cfg.resolvedVersion != "" {
+		// The caller resolved the target; asking the proxy again for the
+		// checks below could disagree with what it decided.
+		if semverValid(current) && semverCompare(target, current) < 0 && !cfg.allowDowngrade {
+			return "", &policyBlock{target, PolicyDowngrade}
+		}
+		return target, nil
+	}
+	var latest *VersionInfo
+	if target == "latest" && !cfg.skipPreCheck {
+		// Ask the proxy first, which saves a build when already current.
+		// If it cannot answer, go install resolves @latest itself.
+		info, err := latestInfo(ctx, cfg, modulePath)
+		if ctx.Err() != nil {
+			return "", err
+		}
+		if err == nil {
+			d.Proxy = info.Proxy
+			latest = info
+			res.latestVersion = info.Version
+		}
+		d.AlreadyLatest = err == nil && info.Version == current
+		// @latest can be older than the running build, such as after a
+		// newer tag was retracted, or for a pseudo-version ahead of the last
+		// tag, which WithPseudoVersionPolicy decides on below.
+		if err == nil && semverValid(current) && semverCompare(info.Version, current) < 0 &&
+			!cfg.allowDowngrade && !(cfg.pseudoPolicy != "" && isPseudoVersion(current)) {
+			cfg.logf("@latest %s is older than %s", info.Version, current)
+			return "", &policyBlock{info.Version, PolicyDowngrade}
+		}
+		if d.AlreadyLatest && cfg.reportPrereleases {
+			res.NewerPrereleaseAvailable = newerPrerelease(ctx, cfg, modulePath, current)
+		}
+	}
+	if cfg.pseudoPolicy != "" && isPseudoVersion(current) && !d.AlreadyLatest {
+		if err := checkPseudoPolicy(ctx, cfg, modulePath, current, target, latest); err != nil {
+			return "", err
+		}
+	}
+	if d.Proxy != "" {
+		cfg.logf("version resolved by proxy %s", d.Proxy)
+	}
+	if cfg.minReleaseAge > 0 && cfg.localModule == "" && !d.AlreadyLatest {
+		if target, err = releaseOldEnough(ctx, cfg, res, modulePath, current, target, allow, time.Now()); err != nil {
+			return "", err
+		}
+		d.Target = target
+	}
+	if cfg.toolchainCompatible && cfg.localModule == "" && !d.AlreadyLatest {
+		if target, err = toolchainCompatible(ctx, cfg, res, modulePath, current, target, allow); err != nil {
+			return "", err
+		}
+		d.Target = target
+	}
+	return target, nil
+}
+
+// newerPrerelease returns the newest prerelease of modulePath above current,
+// or "" if there is none. It is informational, so a failure to list the
+// versions is only logged.
+func newerPrerelease(ctx context.Context, cfg *config, modulePath, current string) string {
+	versions, _, err := listVersions(ctx, cfg, modulePath)
+	if err != nil {
+		cfg.logf("listing versions for prereleases: %v", err)
+		return ""
+	}
+	newest := ""
+	for _, v := range versions {
+		if isPrerelease(v) && !isPseudoVersion(v) && semverCompare(v, current) > 0 && (newest == "" || semverCompare(v, newest) > 0) {
+			newest = v
+		}
+	}
+	if newest != "" {
+		cfg.logf("prerelease %s is newer than %s, but @latest selects only releases", newest, current)
 	}
+	return newest
+}
+
+// DefaultTimeout is the limit UpgradeSimple puts on an upgrade unless
+// WithTimeout is given.
+const DefaultTimeout = 5 * time.Minute
+
+// UpgradeSimple is Upgrade for scripts and main functions without a context.
+// It runs with context.Background, limited to DefaultTimeout or the duration
+// set with WithTimeout.
+func UpgradeSimple(packagePath string, opts ...Option) *UpgradeResult {
+	return Upgrade(context.Background(), packagePath, append([]Option{WithTimeout(DefaultTimeout)}, opts...)...)
+}
+
+// TryUpgrade is like Upgrade but also returns the result's ExitError, for
+// callers that prefer the conventional error return.
+func TryUpgrade(ctx context.Context, packagePath string, opts ...Option) (*UpgradeResult, error) {
+	res := Upgrade(ctx, packagePath, opts...)
+	return res, res.ExitError
+}
+
+// MustUpgrade is like Upgrade but panics if the upgrade fails. It is intended
+// for scripts and tests where a failed upgrade is fatal.
+func MustUpgrade(ctx context.Context, packagePath string, opts ...Option) *UpgradeResult {
+	res := Upgrade(ctx, packagePath, opts...)
+	if res.ExitError != nil {
+		panic(fmt.Sprintf("autoupgrade: upgrade failed: %v", res.ExitError))
+	}
+	return res
+}
+
+// UpgradeAndReport is like Upgrade but returns the version now installed,
+// whether the upgrade happened as DidUpgrade reports, and the result's
+// ExitError. When nothing was upgraded, including on error, newVersion is
+// the running binary's version, empty only if it has no build information.
+func UpgradeAndReport(ctx context.Context, packagePath string, opts ...Option) (newVersion string, upgraded bool, err error) {
+	res := Upgrade(ctx, packagePath, opts...)
+	if res.CurrentInfo != nil {
+		newVersion = res.CurrentInfo.Main.Version
+	}
+	// A skipped upgrade leaves NewBuildInfo to read the running
+	// executable, which may not be the binary the version came from.
+	if res.ExitError != nil || res.SkipReason != "" || !res.DidUpgrade() {
+		return newVersion, false, res.ExitError
+	}
+	if res.Backend == BackendGoGetTool {
+		return res.installedVersion, true, nil
+	}
+	// DidUpgrade has read the new binary's build information.
+	info, _ := res.NewBuildInfo()
+	return info.Main.Version, true, nil
 }
 
 // UpgradeBackground runs Upgrade in a goroutine and returns a channel that will
 // receive the UpgradeResult. The channel is closed after the result is sent.
 // This allows for non-blocking upgrade operations. The context can be used to
-// cancel the upgrade operation.
-func UpgradeBackground(ctx context.Context, packagePath string) <-chan *UpgradeResult {
+// cancel the upgrade operation. It is safe to call from multiple goroutines.
+//
+// If ctx is already done, Upgrade is not run and the result carries
+// SkipCanceled and ctx.Err(), with CurrentInfo filled in as usual.
+func UpgradeBackground(ctx context.Context, packagePath string, opts ...Option) <-chan *UpgradeResult {
 	ch := make(chan *UpgradeResult, 1)
 	go func() {
 		defer close(ch)
-		select {
-		case <-ctx.Done():
-			ch <- &UpgradeResult{
-				ExitError: ctx.Err(),
+		if ctx.Err() != nil {
+			cfg := newConfig(opts)
+			res := &UpgradeResult{
+				ExitError:  ctx.Err(),
+				SkipReason: SkipCanceled,
+				execPath:   cfg.execPath,
+				rolling:    cfg.rolling || cfg.localModule != "",
+			}
+			if info, ok := CurrentBuildInfo(); ok {
+				res.CurrentInfo = info
 			}
-		case ch <- Upgrade(ctx, packagePath):
+			ch <- res
+			return
 		}
+		ch <- Upgrade(ctx, packagePath, opts...)
 	}()
 	return ch
 }
 
+// UpgradeAll runs Upgrade concurrently for each of packagePaths, commands of
+// the running binary's module, and returns their results in the same order:
+// results[i] is always for packagePaths[i]. Installs are still serialized as
+// for concurrent Upgrade calls. The error joins each ExitError, prefixed with
+// its package path, and is nil if none failed.
+func UpgradeAll(ctx context.Context, packagePaths []string, opts ...Option) ([]*UpgradeResult, error) {
+	results := make([]*UpgradeResult, len(packagePaths))
+	var wg sync.WaitGroup
+	for i, p := range packagePaths {
+		wg.Add(1)
+		go func(i int, p string) {
+			defer wg.Done()
+			results[i] = Upgrade(ctx, p, opts...)
+		}(i, p)
+	}
+	wg.Wait()
+	var errs []error
+	for i, res := range results {
+		if res.ExitError != nil {
+			errs = append(errs, fmt.Errorf("package %q: %w", packagePaths[i], res.ExitError))
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// WaitResult waits up to timeout for the result from ch, as returned by
+// UpgradeBackground, and reports whether it arrived in time. On timeout the
+// upgrade carries on in the background; cancel its context to stop it. The
+// result is nil and ok false if ch is closed without sending one.
+func WaitResult(ch <-chan *UpgradeResult, timeout time.Duration) (res *UpgradeResult, ok bool) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case res, ok = <-ch:
+		return res, ok
+	case <-timer.C:
+		return nil, false
+	}
+}
+
 // DidUpgrade returns false if the upgrade did not occur, this can happen when
 // the build information is not available, the current version is a development
 // version, or upgrade was not necessary (e.g., already at latest version).
+//
+// With WithRollingChannel, a current version that is not a tagged release is
+// compared by VCS revision and commit time instead, so moving to a newer
+// pseudo-version counts as an upgrade.
 func (u *UpgradeResult) DidUpgrade() bool {
 	if u.CurrentInfo == nil {
 		return false
 	}
-	if u.CurrentInfo.Main.Version == "(devel)" {
+	devel := u.CurrentInfo.Main.Version == "(devel)"
+	if u.Decision.CurrentVersion != "" {
+		// Upgrade recorded what WithDevelDetector decided.
+		devel = u.Decision.Devel
+	}
+	if devel && !u.rolling {
+		return false
+	}
+	if u.Backend == BackendGoGetTool {
+		// Nothing is installed; the tool runs at the new version the
+		// next time 'go tool' starts it.
+		return u.ExitError == nil && u.installedVersion != "" && u.installedVersion != u.CurrentInfo.Main.Version
+	}
+	newInfo, _ := u.NewBuildInfo()
+	if newInfo == nil {
 		return false
 	}
+	if u.rolling && !isCleanTag(u.CurrentInfo.Main.Version) {
+		return buildChanged(u.CurrentInfo, newInfo)
+	}
+	return newInfo.Main.Version != u.CurrentInfo.Main.Version
+}
+
+// buildChanged reports whether two builds come from different commits,
+// comparing revisions when both are known, then commit times, and finally
+// versions.
+func buildChanged(from, to *debug.BuildInfo) bool {
+	fromRev, fromTime := buildRevision(from)
+	toRev, toTime := buildRevision(to)
+	if fromRev != "" && toRev != "" {
+		return !strings.HasPrefix(fromRev, toRev) && !strings.HasPrefix(toRev, fromRev)
+	}
+	if !fromTime.IsZero() && !toTime.IsZero() {
+		return !fromTime.Equal(toTime)
+	}
+	return from.Main.Version != to.Main.Version
+}
+
+// buildRevision returns the VCS revision and commit time of a build, read
+// from a pseudo-version or else from the vcs.* build settings.
+func buildRevision(info *debug.BuildInfo) (rev string, t time.Time) {
+	if v := info.Main.Version; isPseudoVersion(v) {
+		rev, _ = module.PseudoVersionRev(v)
+		t, _ = module.PseudoVersionTime(v)
+		return rev, t
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			rev = s.Value
+		case "vcs.time":
+			t, _ = time.Parse(time.RFC3339, s.Value)
+		}
+	}
+	return rev, t
+}
+
+// SettingsDiff returns the build settings, such as -ldflags, CGO_ENABLED or
+// vcs.revision, whose values differ between the running binary and the new
+// one, mapped to their current and new values. A setting present in only one
+// build has an empty value for the other. The map is empty when either build
+// information is unavailable.
+func (u *UpgradeResult) SettingsDiff() map[string][2]string {
+	diff := make(map[string][2]string)
 	newInfo, _ := u.NewBuildInfo()
-	return newInfo != nil && newInfo.Main.Version != u.CurrentInfo.Main.Version
+	if u.CurrentInfo == nil || newInfo == nil {
+		return diff
+	}
+	for _, s := range u.CurrentInfo.Settings {
+		diff[s.Key] = [2]string{s.Value, ""}
+	}
+	for _, s := range newInfo.Settings {
+		diff[s.Key] = [2]string{diff[s.Key][0], s.Value}
+	}
+	for k, v := range diff {
+		if v[0] == v[1] {
+			delete(diff, k)
+		}
+	}
+	return diff
 }
 
-// NewBuildInfo returns the build information of the newly installed binary.
-// Returns nil if the executable path cannot be determined or the build info
-// cannot be read.
+// DepChange describes a module dependency that differs between the running
+// binary and the new one. From is empty for an added dependency and To for a
+// removed one.
+type DepChange struct {
+	Path string // module path
+	From string // version in the running binary
+	To   string // version in the new binary
+}
+
+// DependencyChanges returns the module dependencies added, removed or moved to
+// another version by the upgrade, sorted by module path. A replaced
+// dependency is compared by its replacement's version. The slice is empty
+// when either build information is unavailable.
+func (u *UpgradeResult) DependencyChanges() []DepChange {
+	changes := []DepChange{}
+	newInfo, _ := u.NewBuildInfo()
+	if u.CurrentInfo == nil || newInfo == nil {
+		return changes
+	}
+	from := depVersions(u.CurrentInfo)
+	to := depVersions(newInfo)
+	for path, v := range from {
+		if to[path] != v {
+			changes = append(changes, DepChange{Path: path, From: v, To: to[path]})
+		}
+	}
+	for path, v := range to {
+		if _, ok := from[path]; !ok {
+			changes = append(changes, DepChange{Path: path, To: v})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// depVersions maps the module dependencies of info to their versions, taking
+// the version of the replacement for replaced modules.
+func depVersions(info *debug.BuildInfo) map[string]string {
+	versions := make(map[string]string, len(info.Deps))
+	for _, d := range info.Deps {
+		if d == nil {
+			continue
+		}
+		v := d.Version
+		if d.Replace != nil {
+			v = d.Replace.Version
+		}
+		versions[d.Path] = v
+	}
+	return versions
+}
+
+// BuildTags returns the build tags info was built with, from its -tags build
+// setting, such as ["netgo", "osusergo"]. It returns nil if info is nil or the
+// binary was built without tags.
+func BuildTags(info *debug.BuildInfo) []string {
+	if info == nil {
+		return nil
+	}
+	var tags []string
+	for _, s := range info.Settings {
+		if s.Key != "-tags" {
+			continue
+		}
+		for _, tag := range strings.Split(s.Value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// hasSetting reports whether the build settings of info include key with a
+// non-empty value.
+func hasSetting(info *debug.BuildInfo, key string) bool {
+	for _, s := range info.Settings {
+		if s.Key == key && s.Value != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// IsMajorBump reports whether the upgrade crossed a major version boundary.
+// The major version is taken from the module path suffix (e.g. "/v2") when
+// present, falling back to the leading semver digit, so both a path change
+// from "example.com/mod" to "example.com/mod/v2" and a v0 to v1 release count.
+// It returns false if no upgrade occurred.
+func (u *UpgradeResult) IsMajorBump() (bool, error) {
+	if u.CurrentInfo == nil {
+		return false, ErrNoBuildInfo
+	}
+	newInfo, err := u.NewBuildInfo()
+	if err != nil {
+		return false, err
+	}
+	if newInfo == nil {
+		return false, ErrNoBuildInfo
+	}
+	from := moduleMajor(u.CurrentInfo.Main.Path, u.CurrentInfo.Main.Version)
+	if from < 0 {
+		return false, fmt.Errorf("%w: %q", ErrInvalidVersion, u.CurrentInfo.Main.Version)
+	}
+	to := moduleMajor(newInfo.Main.Path, newInfo.Main.Version)
+	if to < 0 {
+		return false, fmt.Errorf("%w: %q", ErrInvalidVersion, newInfo.Main.Version)
+	}
+	return to > from, nil
+}
+
+// NewBuildInfo returns the build information of the newly installed binary,
+// read from WithExecutablePath if given, otherwise InstalledPath, falling back
+// to the running executable when nothing was installed. Returns nil if the
+// build info cannot be read, with an error wrapping
+// ErrExecutablePathUnresolvable if the running executable's path cannot be
+// determined. The result is cached until Reset is called.
 func (u *UpgradeResult) NewBuildInfo() (*debug.BuildInfo, error) {
-	u.once.Do(func() {
-		execPath, err := os.Executable()
-		if err != nil {
-			u.newInfoErr = err
-			return
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if !u.loaded {
+		execPath := u.execPath
+		if execPath == "" {
+			execPath = u.InstalledPath
 		}
-		u.newInfo, u.newInfoErr = buildinfo.ReadFile(execPath)
-	})
+		u.newInfo, u.newInfoErr = readExecutableInfo(execPath)
+		u.loaded = true
+	}
 	return u.newInfo, u.newInfoErr
 }
 
+// Reset discards the cached build information of the new binary, so that the
+// next call to NewBuildInfo reads it again. This is needed when the binary is
+// replaced after the upgrade returned, for example when an install is staged
+// and swapped in on the next launch.
+func (u *UpgradeResult) Reset() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.loaded = false
+	u.newInfo, u.newInfoErr = nil, nil
+}
+
+// Activate moves the binary staged with WithReplaceRunning(false) into place
+// at StagedFor, replacing the binary there, and updates InstalledPath to
+// match. It returns ErrNotStaged if nothing was staged. On Windows, where a
+// running executable cannot be replaced, the error wraps ErrBinaryLocked
+// while the old binary is still running.
+func (u *UpgradeResult) Activate() error {
+	if u.StagedFor == "" || u.InstalledPath == "" {
+		return ErrNotStaged
+	}
+	if err := os.Rename(u.InstalledPath, u.StagedFor); err != nil {
+		if binaryLocked(u.StagedFor) {
+			err = fmt.Errorf("%w: %w", ErrBinaryLocked, err)
+		}
+		return err
+	}
+	u.InstalledPath, u.StagedFor = u.StagedFor, ""
+	return nil
+}
+
+// readExecutableInfo reads the build information of the binary at execPath,
+// or of the running executable when execPath is empty.
+func readExecutableInfo(execPath string) (*debug.BuildInfo, error) {
+	if execPath == "" {
+		var err error
+		execPath, err = executablePath()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buildinfo.ReadFile(execPath)
+}
+
 // fullPath constructs the full module path with version for 'go install'.
 // It combines the module path, package path, and version into the format
-// expected by go install.
+// expected by go install, "<importPath>@<version>". A version query already
+// on modulePath, as in "example.com/tool@v1", is dropped rather than doubled;
+// module paths from options are rejected by validateModulePath first.
 func fullPath(modulePath, packagePath, version string) string {
-	ret := path.Join(modulePath, packagePath+"@"+version)
-	return ret
+	modulePath, _, _ = strings.Cut(modulePath, "@")
+	return importPath(modulePath, packagePath) + "@" + version
+}
+
+// validateModulePath reports an error wrapping ErrInvalidModulePath if
+// modulePath is empty or carries a version query, such as
+// "example.com/tool@v1"; versions are selected separately.
+func validateModulePath(modulePath string) error {
+	switch {
+	case modulePath == "":
+		return fmt.Errorf("%w: empty module path", ErrInvalidModulePath)
+	case strings.Contains(modulePath, "@"):
+		return fmt.Errorf("%w: %q has a version query; select versions with WithChannelConfig", ErrInvalidModulePath, modulePath)
+	}
+	return nil
+}
+
+// validatePackagePath reports whether packagePath is a package path relative
+// to the module root, as Upgrade accepts: empty or "." for the root, or
+// slash-separated elements with an optional leading "./" or trailing slash.
+// An absolute path, a "..", an empty element, a backslash or an "@version"
+// suffix is rejected with an error wrapping ErrInvalidPackagePath.
+func validatePackagePath(packagePath string) error {
+	invalid := func(why string) error {
+		return fmt.Errorf("%w: %q %s", ErrInvalidPackagePath, packagePath, why)
+	}
+	switch {
+	case strings.Contains(packagePath, "@"):
+		return invalid("has a version; select versions with WithChannelConfig")
+	case strings.HasPrefix(packagePath, "/") || filepath.IsAbs(packagePath):
+		return invalid("is absolute; give the path relative to the module root")
+	case strings.Contains(packagePath, `\`):
+		return invalid("contains a backslash; use forward slashes")
+	}
+	p := strings.TrimSuffix(strings.TrimPrefix(packagePath, "./"), "/")
+	if p == "" || p == "." {
+		return nil
+	}
+	for _, elem := range strings.Split(p, "/") {
+		switch elem {
+		case "..":
+			return invalid("leaves the module")
+		case "", ".":
+			return invalid("has an empty element")
+		}
+	}
+	return nil
+}
+
+// importPath returns the import path of packagePath within modulePath. The
+// join is plain concatenation, modulePath + "/" + packagePath, with only a
+// leading "./" and surrounding slashes trimmed from packagePath: the path is
+// not cleaned, so a segment repeating one of the module path, as in
+// "example.com/cmd" with "cmd/cmd", is kept exactly as go install expects. An
+// empty or "." packagePath names the module root.
+func importPath(modulePath, packagePath string) string {
+	packagePath = strings.Trim(strings.TrimPrefix(packagePath, "./"), "/")
+	if packagePath == "" || packagePath == "." {
+		return modulePath
+	}
+	return modulePath + "/" + packagePath
 }
@@ -1,7 +1,19 @@
 package autoupgrade
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime/debug"
+	"strings"
 	"testing"
+	"time"
 )
 
 func Test_fullPath(t *testing.T) {
@@ -10,4 +22,848 @@ func Test_fullPath(t *testing.T) {
 	if actual != expected {
 		t.Errorf("\n--- '%s'\n+++ '%s'", expected, actual)
 	}
+
+	expected = "github.com/melt-inc/autoupgrade@latest"
+	actual = fullPath("github.com/melt-inc/autoupgrade", "", "latest")
+	if actual != expected {
+		t.Errorf("\n--- '%s'\n+++ '%s'", expected, actual)
+	}
+}
+
+func Test_fullPath_collisions(t *testing.T) {
+	tests := []struct {
+		modulePath, packagePath, want string
+	}{
+		{"example.com/cmd", "cmd", "example.com/cmd/cmd@v1.0.0"},
+		{"example.com/cmd", "cmd/cmd", "example.com/cmd/cmd/cmd@v1.0.0"},
+		{"example.com/tool/cmd", "./cmd/tool/", "example.com/tool/cmd/cmd/tool@v1.0.0"},
+		{"example.com/tool", ".", "example.com/tool@v1.0.0"},
+		{"example.com/tool", "/", "example.com/tool@v1.0.0"},
+		{"example.com/tool/v2", "v2", "example.com/tool/v2/v2@v1.0.0"},
+	}
+	for _, tt := range tests {
+		if got := fullPath(tt.modulePath, tt.packagePath, "v1.0.0"); got != tt.want {
+			t.Errorf("fullPath(%q, %q) = %q, want %q", tt.modulePath, tt.packagePath, got, tt.want)
+		}
+	}
+}
+
+func Test_fullPath_versionQuery(t *testing.T) {
+	if got, want := fullPath("example.com/tool@v1", "cmd/tool", "v1.2.0"), "example.com/tool/cmd/tool@v1.2.0"; got != want {
+		t.Errorf("fullPath() = %q, want %q", got, want)
+	}
+	for _, path := range []string{"example.com/tool@v1", "example.com/tool@latest", ""} {
+		if err := validateModulePath(path); !errors.Is(err, ErrInvalidModulePath) {
+			t.Errorf("validateModulePath(%q) error = %v, want %v", path, err, ErrInvalidModulePath)
+		}
+	}
+	if err := validateModulePath("example.com/tool/v2"); err != nil {
+		t.Errorf("validateModulePath() error = %v", err)
+	}
+
+	fakeBuildInfo(t, "example.com/tool", "v1.0.0")
+	res := Upgrade(context.Background(), "", WithFallbackModulePaths("example.com/tool@v1"))
+	if !errors.Is(res.ExitError, ErrInvalidModulePath) || Classify(res.ExitError) != FailurePermanent {
+		t.Errorf("Upgrade() with a versioned fallback error = %v, want %v", res.ExitError, ErrInvalidModulePath)
+	}
+}
+
+func TestUpgradeResult_IsMajorBump(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to debug.Module
+		want     bool
+	}{
+		{"patch", debug.Module{Path: "example.com/mod", Version: "v1.2.3"}, debug.Module{Path: "example.com/mod", Version: "v1.2.4"}, false},
+		{"v0 to v1", debug.Module{Path: "example.com/mod", Version: "v0.9.0"}, debug.Module{Path: "example.com/mod", Version: "v1.0.0"}, true},
+		{"path suffix", debug.Module{Path: "example.com/mod", Version: "v1.9.0"}, debug.Module{Path: "example.com/mod/v2", Version: "v2.0.0"}, true},
+		{"same suffix", debug.Module{Path: "example.com/mod/v2", Version: "v2.0.0"}, debug.Module{Path: "example.com/mod/v2", Version: "v2.1.0"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &UpgradeResult{CurrentInfo: &debug.BuildInfo{Main: tt.from}}
+			u.newInfo, u.loaded = &debug.BuildInfo{Main: tt.to}, true
+			got, err := u.IsMajorBump()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("IsMajorBump() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpgradeResult_NewBuildInfo_executablePath(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	res := Upgrade(context.Background(), "", WithExecutablePath(missing))
+	if _, err := res.NewBuildInfo(); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("NewBuildInfo() error = %v, want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestUpgradeResult_Reset(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	missing := filepath.Join(t.TempDir(), "bin")
+	res := Upgrade(context.Background(), "", WithExecutablePath(missing))
+	if _, err := res.NewBuildInfo(); err == nil {
+		t.Fatal("NewBuildInfo() succeeded before binary exists")
+	}
+
+	// Simulate the binary being swapped in after the first read.
+	data, err := os.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(missing, data, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := res.NewBuildInfo(); err == nil {
+		t.Fatal("NewBuildInfo() not cached")
+	}
+	res.Reset()
+	info, err := res.NewBuildInfo()
+	if err != nil {
+		t.Fatalf("NewBuildInfo() after Reset error = %v", err)
+	}
+	if info.Main.Path != "github.com/melt-inc/autoupgrade" {
+		t.Errorf("Main.Path = %q", info.Main.Path)
+	}
+}
+
+func TestUpgradeResult_DidUpgrade_rolling(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to debug.BuildInfo
+		want     bool
+	}{
+		{
+			name: "newer pseudo-version",
+			from: debug.BuildInfo{Main: debug.Module{Version: "v0.0.0-20240101000000-abcdefabcdef"}},
+			to:   debug.BuildInfo{Main: debug.Module{Version: "v0.0.0-20240201000000-123456123456"}},
+			want: true,
+		},
+		{
+			name: "same revision",
+			from: debug.BuildInfo{
+				Main:     debug.Module{Version: "(devel)"},
+				Settings: []debug.BuildSetting{{Key: "vcs.revision", Value: "abcdefabcdef0123456789"}},
+			},
+			to:   debug.BuildInfo{Main: debug.Module{Version: "v0.0.0-20240101000000-abcdefabcdef"}},
+			want: false,
+		},
+		{
+			name: "devel to tag",
+			from: debug.BuildInfo{Main: debug.Module{Version: "(devel)"}},
+			to:   debug.BuildInfo{Main: debug.Module{Version: "v1.0.0"}},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &UpgradeResult{CurrentInfo: &tt.from, rolling: true}
+			u.newInfo, u.loaded = &tt.to, true
+			if got := u.DidUpgrade(); got != tt.want {
+				t.Errorf("DidUpgrade() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpgradeResult_SettingsDiff(t *testing.T) {
+	u := &UpgradeResult{CurrentInfo: &debug.BuildInfo{Settings: []debug.BuildSetting{
+		{Key: "-ldflags", Value: "-s -w"},
+		{Key: "CGO_ENABLED", Value: "1"},
+		{Key: "GOARCH", Value: "amd64"},
+	}}}
+	u.newInfo, u.loaded = &debug.BuildInfo{Settings: []debug.BuildSetting{
+		{Key: "-ldflags", Value: "-s -w"},
+		{Key: "CGO_ENABLED", Value: "0"},
+		{Key: "vcs.revision", Value: "abc"},
+	}}, true
+	want := map[string][2]string{
+		"CGO_ENABLED":  {"1", "0"},
+		"GOARCH":       {"amd64", ""},
+		"vcs.revision": {"", "abc"},
+	}
+	if got := u.SettingsDiff(); !maps.Equal(got, want) {
+		t.Errorf("SettingsDiff() = %v, want %v", got, want)
+	}
+
+	u.Reset()
+	u.execPath = filepath.Join(t.TempDir(), "missing")
+	if got := u.SettingsDiff(); got == nil || len(got) != 0 {
+		t.Errorf("SettingsDiff() without new build info = %v, want empty map", got)
+	}
+}
+
+func TestUpgradeResult_DependencyChanges(t *testing.T) {
+	u := &UpgradeResult{CurrentInfo: &debug.BuildInfo{Deps: []*debug.Module{
+		{Path: "example.com/kept", Version: "v1.0.0"},
+		{Path: "example.com/bumped", Version: "v1.0.0"},
+		{Path: "example.com/dropped", Version: "v0.1.0"},
+		{Path: "example.com/replaced", Version: "v1.0.0", Replace: &debug.Module{Path: "example.com/fork", Version: "v1.0.1"}},
+	}}}
+	u.newInfo, u.loaded = &debug.BuildInfo{Deps: []*debug.Module{
+		{Path: "example.com/kept", Version: "v1.0.0"},
+		{Path: "example.com/bumped", Version: "v1.1.0"},
+		{Path: "example.com/added", Version: "v2.0.0"},
+		{Path: "example.com/replaced", Version: "v1.0.0", Replace: &debug.Module{Path: "example.com/fork", Version: "v1.0.2"}},
+	}}, true
+	want := []DepChange{
+		{Path: "example.com/added", To: "v2.0.0"},
+		{Path: "example.com/bumped", From: "v1.0.0", To: "v1.1.0"},
+		{Path: "example.com/dropped", From: "v0.1.0"},
+		{Path: "example.com/replaced", From: "v1.0.1", To: "v1.0.2"},
+	}
+	if got := u.DependencyChanges(); !reflect.DeepEqual(got, want) {
+		t.Errorf("DependencyChanges() = %+v, want %+v", got, want)
+	}
+
+	u.Reset()
+	u.execPath = filepath.Join(t.TempDir(), "missing")
+	if got := u.DependencyChanges(); got == nil || len(got) != 0 {
+		t.Errorf("DependencyChanges() without new build info = %v, want empty slice", got)
+	}
+	if got := (&UpgradeResult{}).DependencyChanges(); got == nil || len(got) != 0 {
+		t.Errorf("DependencyChanges() without current build info = %v, want empty slice", got)
+	}
+}
+
+func TestUpgrade_install(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+
+	res := Upgrade(context.Background(), "", m.options()...)
+	if res.ExitError != nil {
+		t.Fatalf("Upgrade() error = %v", res.ExitError)
+	}
+	if !res.DidUpgrade() {
+		t.Fatal("DidUpgrade() = false, want true")
+	}
+	if res.InstalledPath != m.binary() {
+		t.Errorf("InstalledPath = %q, want %q", res.InstalledPath, m.binary())
+	}
+	if res.Backend != BackendGoInstall {
+		t.Errorf("Backend = %q, want %q", res.Backend, BackendGoInstall)
+	}
+	if want := m.path + "@latest"; res.Target() != want {
+		t.Errorf("Target() = %q, want %q", res.Target(), want)
+	}
+	if want := "file://" + filepath.ToSlash(m.proxyDir); res.Decision.Proxy != want {
+		t.Errorf("Decision.Proxy = %q, want %q", res.Decision.Proxy, want)
+	}
+	info, err := res.NewBuildInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Main.Path != m.path || info.Main.Version != "v1.1.0" {
+		t.Errorf("installed %s@%s, want %s@v1.1.0", info.Main.Path, info.Main.Version, m.path)
+	}
+	if res.ToolchainVersion == "" || res.ToolchainVersion != info.GoVersion {
+		t.Errorf("ToolchainVersion = %q, want %q", res.ToolchainVersion, info.GoVersion)
+	}
+	fi, err := os.Stat(m.binary())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.InstalledSize != fi.Size() || !res.InstalledModTime.Equal(fi.ModTime()) {
+		t.Errorf("InstalledSize, InstalledModTime = %d, %v, want %d, %v", res.InstalledSize, res.InstalledModTime, fi.Size(), fi.ModTime())
+	}
+}
+
+func TestUpgrade_verbose(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+
+	var logged bytes.Buffer
+	opts := append(m.options(), WithVerbosity(1), WithLogger(log.New(&logged, "", 0)))
+	res := Upgrade(context.Background(), "", opts...)
+	if res.ExitError != nil {
+		t.Fatalf("Upgrade() error = %v", res.ExitError)
+	}
+	for _, want := range []string{"target latest", "running ", "installed " + m.binary()} {
+		if !strings.Contains(logged.String(), want) {
+			t.Errorf("log %q does not mention %q", logged.String(), want)
+		}
+	}
+}
+
+func TestUpgrade_fallbackModulePaths(t *testing.T) {
+	m := newFakeModule(t, "github.com/org/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, "vanity.example/fake", "v1.0.0")
+
+	res := Upgrade(context.Background(), "", m.options()...)
+	if res.ExitError == nil {
+		t.Fatal("Upgrade() of an unpublished path succeeded")
+	}
+
+	opts := append(m.options(), WithFallbackModulePaths("vanity.example/fake", "github.com/org/fake"))
+	res = Upgrade(context.Background(), "", opts...)
+	if res.ExitError != nil {
+		t.Fatalf("Upgrade() with fallback error = %v", res.ExitError)
+	}
+	if res.ModulePath != m.path || res.InstalledPath != m.binary() {
+		t.Errorf("ModulePath, InstalledPath = %q, %q, want %q, %q", res.ModulePath, res.InstalledPath, m.path, m.binary())
+	}
+	if res.Decision.Target != "latest" {
+		t.Errorf("Decision.Target = %q, want latest", res.Decision.Target)
+	}
+}
+
+func TestUpgrade_noBuildInfo(t *testing.T) {
+	orig, origTest := readBuildInfo, isTestBinary
+	t.Cleanup(func() { readBuildInfo, isTestBinary = orig, origTest })
+	isTestBinary = func() bool { return false }
+
+	for name, info := range map[string]*debug.BuildInfo{
+		"unavailable":    nil,
+		"no module path": {Main: debug.Module{Version: "v1.0.0"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			readBuildInfo = func() (*debug.BuildInfo, bool) { return info, info != nil }
+			res := Upgrade(context.Background(), "")
+			if res.SkipReason != SkipNoBuildInfo || !errors.Is(res.ExitError, ErrNoBuildInfo) {
+				t.Errorf("Upgrade() = %q, %v, want %q, %v", res.SkipReason, res.ExitError, SkipNoBuildInfo, ErrNoBuildInfo)
+			}
+		})
+	}
+}
+
+func TestUpgrade_preCheck(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.1.0")
+
+	res := Upgrade(context.Background(), "", m.options()...)
+	if res.SkipReason != SkipAlreadyLatest {
+		t.Errorf("SkipReason = %q, want %q", res.SkipReason, SkipAlreadyLatest)
+	}
+	if res.InstalledSize != 0 || !res.InstalledModTime.IsZero() || res.Backend != "" {
+		t.Errorf("InstalledSize, InstalledModTime, Backend = %d, %v, %q after skip, want zero", res.InstalledSize, res.InstalledModTime, res.Backend)
+	}
+	if _, err := os.Stat(m.binary()); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("binary installed despite pre-check: %v", err)
+	}
+	if want := m.path + "@latest"; res.Target() != want {
+		t.Errorf("Target() after skip = %q, want %q", res.Target(), want)
+	}
+
+	res = Upgrade(context.Background(), "", append(m.options(), WithAlreadyLatestAsSuccess(true))...)
+	if res.SkipReason != "" || res.ExitError != nil || !res.Decision.AlreadyLatest || res.InstalledPath != "" {
+		t.Errorf("Upgrade() with WithAlreadyLatestAsSuccess = %q, %v, AlreadyLatest %v, InstalledPath %q, want a clean no-op",
+			res.SkipReason, res.ExitError, res.Decision.AlreadyLatest, res.InstalledPath)
+	}
+
+	// Without the pre-check go install runs, but installs the current
+	// version again, which is still not an upgrade.
+	res = Upgrade(context.Background(), "", append(m.options(), WithSkipPreCheck(true))...)
+	if res.SkipReason != SkipAlreadyLatest || res.ExitError != nil {
+		t.Fatalf("Upgrade() with WithSkipPreCheck = %q, %v, want %q", res.SkipReason, res.ExitError, SkipAlreadyLatest)
+	}
+	if res.InstalledPath != m.binary() || res.Backend != BackendGoInstall {
+		t.Errorf("InstalledPath, Backend = %q, %q, want %q, %q", res.InstalledPath, res.Backend, m.binary(), BackendGoInstall)
+	}
+	if !res.Decision.AlreadyLatest || res.DidUpgrade() {
+		t.Errorf("AlreadyLatest, DidUpgrade() = %v, %v, want true, false", res.Decision.AlreadyLatest, res.DidUpgrade())
+	}
+}
+
+func TestUpgrade_reportPrereleases(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0-beta.1", "v1.1.0-beta.2")
+	// @latest prefers the release over the newer prereleases
+	writeFile(t, filepath.Join(m.proxyDir, "example.com", "fake", "@latest"), []byte(`{"Version":"v1.0.0"}`))
+	fakeBuildInfo(t, m.path, "v1.0.0")
+
+	res := Upgrade(context.Background(), "", m.options()...)
+	if res.SkipReason != SkipAlreadyLatest || res.NewerPrereleaseAvailable != "" {
+		t.Errorf("Upgrade() = %q, NewerPrereleaseAvailable %q, want %q without a prerelease", res.SkipReason, res.NewerPrereleaseAvailable, SkipAlreadyLatest)
+	}
+	res = Upgrade(context.Background(), "", append(m.options(), WithReportPrereleases(true))...)
+	if res.SkipReason != SkipAlreadyLatest || res.NewerPrereleaseAvailable != "v1.1.0-beta.2" {
+		t.Errorf("Upgrade() with WithReportPrereleases = %q, NewerPrereleaseAvailable %q, want %q, v1.1.0-beta.2", res.SkipReason, res.NewerPrereleaseAvailable, SkipAlreadyLatest)
+	}
+	if res.InstalledPath != "" {
+		t.Errorf("installed %s", res.InstalledPath)
+	}
+}
+
+func TestUpgrade_failureBackoff(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+	state := filepath.Join(t.TempDir(), "state.json")
+
+	broken := append(m.options(), WithStateFile(state), WithFailureBackoff(time.Hour), WithGoBinary(filepath.Join(t.TempDir(), "missing-go")))
+	res := Upgrade(context.Background(), "", broken...)
+	if res.ExitError == nil {
+		t.Fatal("Upgrade() with a missing go binary succeeded")
+	}
+	res = Upgrade(context.Background(), "", broken...)
+	if res.SkipReason != SkipBackoff {
+		t.Errorf("SkipReason after failure = %q, want %q", res.SkipReason, SkipBackoff)
+	}
+
+	res = Upgrade(context.Background(), "", append(m.options(), WithStateFile(state), WithFailureBackoff(0))...)
+	if res.SkipReason != "" || res.ExitError != nil {
+		t.Fatalf("Upgrade() without backoff = %q, %v", res.SkipReason, res.ExitError)
+	}
+	res = Upgrade(context.Background(), "", broken...)
+	if res.SkipReason == SkipBackoff {
+		t.Error("SkipBackoff after a successful attempt")
+	}
+}
+
+func TestUpgrade_failureBackoffCanceled(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+	state := filepath.Join(t.TempDir(), "state.json")
+	opts := append(m.options(), WithStateFile(state), WithFailureBackoff(time.Hour))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res := Upgrade(ctx, "", opts...)
+	if !errors.Is(res.ExitError, context.Canceled) {
+		t.Fatalf("Upgrade() canceled error = %v, want context.Canceled", res.ExitError)
+	}
+	res = Upgrade(context.Background(), "", opts...)
+	if res.SkipReason == SkipBackoff {
+		t.Error("SkipBackoff after a canceled attempt")
+	}
+}
+
+func TestUpgrade_maxVersion(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.4.0", "v1.4.2", "v1.5.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+
+	res := Upgrade(context.Background(), "", append(m.options(), WithMaxVersion("v1.4.99"))...)
+	if res.ExitError != nil {
+		t.Fatalf("Upgrade() error = %v", res.ExitError)
+	}
+	if res.Decision.Target != "v1.4.2" || len(res.Decision.Rejected) != 0 {
+		t.Errorf("Target = %q, Rejected = %q, want v1.4.2 and none", res.Decision.Target, res.Decision.Rejected)
+	}
+
+	fakeBuildInfo(t, m.path, "v1.4.2")
+	res = Upgrade(context.Background(), "", append(m.options(), WithMaxVersion("v1.4.99"))...)
+	if res.SkipReason != SkipCeilingReached || res.ExitError != nil {
+		t.Errorf("Upgrade() at the ceiling = %q, %v, want %q", res.SkipReason, res.ExitError, SkipCeilingReached)
+	}
+	if res.Decision.Blocked != "v1.5.0" || res.Decision.BlockedBy != PolicyMaxVersion {
+		t.Errorf("Blocked = %q by %q, want v1.5.0 by %q", res.Decision.Blocked, res.Decision.BlockedBy, PolicyMaxVersion)
+	}
+
+	res = Upgrade(context.Background(), "", append(m.options(), WithMaxVersion("1.4.x"))...)
+	if !errors.Is(res.ExitError, ErrInvalidOption) {
+		t.Errorf("Upgrade() with invalid ceiling error = %v, want ErrInvalidOption", res.ExitError)
+	}
+}
+
+func TestUpgrade_decision(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0", "v1.2.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+
+	opts := append(m.options(), WithVersionFilter(func(v string) bool { return v != "v1.2.0" }))
+	res := Upgrade(context.Background(), "", opts...)
+	if res.ExitError != nil {
+		t.Fatalf("Upgrade() error = %v", res.ExitError)
+	}
+	want := Decision{
+		CurrentVersion: "v1.0.0",
+		Target:         "v1.1.0",
+		Proxy:          "file://" + filepath.ToSlash(m.proxyDir),
+		Rejected:       []string{"v1.2.0"},
+		InstallPath:    m.binary(),
+		Writable:       true,
+		Blocked:        "v1.2.0",
+		BlockedBy:      PolicyVersionFilter,
+	}
+	if !reflect.DeepEqual(res.Decision, want) {
+		t.Errorf("Decision = %+v, want %+v", res.Decision, want)
+	}
+
+	fakeBuildInfo(t, m.path, "(devel)")
+	res = Upgrade(context.Background(), "", WithChannel("beta"))
+	if d := res.Decision; !d.Devel || d.CurrentVersion != "(devel)" || d.Channel != "beta" || d.Target != "" {
+		t.Errorf("Decision for devel build = %+v", d)
+	}
+}
+
+func TestTryUpgrade(t *testing.T) {
+	fakeBuildInfo(t, "example.com/fake", "v1.0.0")
+	res, err := TryUpgrade(context.Background(), "", WithTargetPlatform("plan10", "amd64"))
+	if !errors.Is(err, ErrUnsupportedPlatform) {
+		t.Errorf("TryUpgrade() error = %v, want %v", err, ErrUnsupportedPlatform)
+	}
+	if res == nil || res.ExitError != err {
+		t.Errorf("TryUpgrade() result = %+v, want ExitError %v", res, err)
+	}
+}
+
+func TestMustUpgrade(t *testing.T) {
+	fakeBuildInfo(t, "example.com/fake", "v1.0.0")
+	defer func() {
+		if recover() == nil {
+			t.Error("MustUpgrade() did not panic")
+		}
+	}()
+	MustUpgrade(context.Background(), "", WithTargetPlatform("plan10", "amd64"))
+}
+
+func TestUpgrade_versionedName(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+
+	res := Upgrade(context.Background(), "", append(m.options(), WithVersionedName(true))...)
+	if res.ExitError != nil {
+		t.Fatalf("Upgrade() error = %v", res.ExitError)
+	}
+	if want := versionedPath(m.binary(), "v1.1.0"); res.InstalledPath != want {
+		t.Errorf("InstalledPath = %q, want %q", res.InstalledPath, want)
+	}
+	if !res.DidUpgrade() {
+		t.Error("DidUpgrade() = false, want true")
+	}
+	entries, err := os.ReadDir(m.gobin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("GOBIN contains %d entries, want only the versioned binary", len(entries))
+	}
+}
+
+func TestUpgrade_replaceRunningFalse(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+	writeFile(t, m.binary(), []byte("running"))
+
+	res := Upgrade(context.Background(), "", append(m.options(), WithReplaceRunning(false))...)
+	if res.ExitError != nil {
+		t.Fatalf("Upgrade() error = %v", res.ExitError)
+	}
+	if want := stagedPath(m.binary()); res.InstalledPath != want || res.StagedFor != m.binary() {
+		t.Errorf("InstalledPath, StagedFor = %q, %q, want %q, %q", res.InstalledPath, res.StagedFor, want, m.binary())
+	}
+	if data, _ := os.ReadFile(m.binary()); string(data) != "running" {
+		t.Errorf("running binary was replaced")
+	}
+	if !res.DidUpgrade() {
+		t.Error("DidUpgrade() = false, want true")
+	}
+
+	if err := res.Activate(); err != nil {
+		t.Fatalf("Activate() error = %v", err)
+	}
+	if res.InstalledPath != m.binary() || res.StagedFor != "" {
+		t.Errorf("after Activate, InstalledPath, StagedFor = %q, %q", res.InstalledPath, res.StagedFor)
+	}
+	if data, _ := os.ReadFile(m.binary()); string(data) == "running" {
+		t.Error("Activate() left the old binary in place")
+	}
+	if err := res.Activate(); !errors.Is(err, ErrNotStaged) {
+		t.Errorf("second Activate() error = %v, want %v", err, ErrNotStaged)
+	}
+
+	// A staging rename that fails stages nothing.
+	writeFile(t, m.binary(), []byte("running"))
+	if err := os.MkdirAll(filepath.Join(stagedPath(m.binary()), "busy"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	res = Upgrade(context.Background(), "", append(m.options(), WithReplaceRunning(false))...)
+	if res.ExitError == nil || res.StagedFor != "" {
+		t.Errorf("Upgrade() with a blocked staging path = %v, StagedFor %q, want an error and nothing staged", res.ExitError, res.StagedFor)
+	}
+}
+
+func TestUpgrade_requireVCS(t *testing.T) {
+	fakeBuildInfo(t, "example.com/fake", "v1.0.0")
+	res := Upgrade(context.Background(), "", WithRequireVCS(true))
+	if res.SkipReason != SkipNoVCSInfo {
+		t.Errorf("SkipReason = %q, want %q", res.SkipReason, SkipNoVCSInfo)
+	}
+
+	fakeBuildInfo(t, "example.com/fake", "(devel)")
+	res = Upgrade(context.Background(), "", WithRequireVCS(true))
+	if res.SkipReason != SkipDevelBuild {
+		t.Errorf("SkipReason = %q, want %q", res.SkipReason, SkipDevelBuild)
+	}
+}
+
+func TestUpgrade_develDetector(t *testing.T) {
+	devSuffix := WithDevelDetector(func(info *debug.BuildInfo) bool {
+		return strings.HasSuffix(info.Main.Version, "-dev")
+	})
+	fakeBuildInfo(t, "example.com/fake", "v0.0.0-dev")
+	res := Upgrade(context.Background(), "", devSuffix)
+	if res.SkipReason != SkipDevelBuild || !res.Decision.Devel {
+		t.Errorf("SkipReason, Devel = %q, %v, want %q, true", res.SkipReason, res.Decision.Devel, SkipDevelBuild)
+	}
+
+	// The detector replaces the "(devel)" check.
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "(devel)")
+	res = Upgrade(context.Background(), "", append(m.options(), devSuffix)...)
+	if res.ExitError != nil || res.SkipReason != "" {
+		t.Fatalf("Upgrade() = %q, %v, want an install", res.SkipReason, res.ExitError)
+	}
+	if !res.DidUpgrade() {
+		t.Error("DidUpgrade() = false, want true")
+	}
+}
+
+func TestUpgrade_resolvedVersion(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0", "v1.2.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+
+	// v1.1.0 is installed although v1.2.0 is @latest, and the release age
+	// is not looked up.
+	res := Upgrade(context.Background(), "", append(m.options(), WithResolvedVersion("1.1.0"), WithMinReleaseAge(1000*time.Hour))...)
+	if res.ExitError != nil {
+		t.Fatalf("Upgrade() error = %v", res.ExitError)
+	}
+	if res.Decision.Target != "v1.1.0" || res.Decision.Proxy != "" || !res.DidUpgrade() {
+		t.Errorf("Upgrade() target, proxy, upgraded = %q, %q, %v, want v1.1.0 without asking the proxy", res.Decision.Target, res.Decision.Proxy, res.DidUpgrade())
+	}
+
+	fakeBuildInfo(t, m.path, "v1.2.0")
+	res = Upgrade(context.Background(), "", append(m.options(), WithResolvedVersion("v1.1.0"))...)
+	if res.SkipReason != SkipBlockedByPolicy || res.Decision.BlockedBy != PolicyDowngrade {
+		t.Errorf("Upgrade() to an older version = %q, %q, want %q by %q", res.SkipReason, res.Decision.BlockedBy, SkipBlockedByPolicy, PolicyDowngrade)
+	}
+	res = Upgrade(context.Background(), "", append(m.options(), WithResolvedVersion("v1.1.0"), WithAllowDowngrade(true))...)
+	if res.ExitError != nil || res.Decision.Target != "v1.1.0" || res.InstalledPath == "" {
+		t.Errorf("Upgrade() with WithAllowDowngrade = %q, %v, target %q", res.SkipReason, res.ExitError, res.Decision.Target)
+	}
+
+	res = Upgrade(context.Background(), "", append(m.options(), WithResolvedVersion("latest"))...)
+	if !errors.Is(res.ExitError, ErrInvalidOption) {
+		t.Errorf("Upgrade() with WithResolvedVersion(latest) error = %v, want %v", res.ExitError, ErrInvalidOption)
+	}
+}
+
+func TestUpgrade_latestOlderThanCurrent(t *testing.T) {
+	// v1.2.0 was retracted, so @latest is v1.1.0.
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.2.0")
+
+	res := Upgrade(context.Background(), "", m.options()...)
+	if res.ExitError != nil || res.SkipReason != SkipBlockedByPolicy {
+		t.Fatalf("Upgrade() = %q, %v, want %q", res.SkipReason, res.ExitError, SkipBlockedByPolicy)
+	}
+	if res.Decision.Blocked != "v1.1.0" || res.Decision.BlockedBy != PolicyDowngrade {
+		t.Errorf("Blocked, BlockedBy = %q, %q, want v1.1.0, %q", res.Decision.Blocked, res.Decision.BlockedBy, PolicyDowngrade)
+	}
+	if _, err := os.Stat(m.binary()); err == nil {
+		t.Error("go install ran for an older @latest")
+	}
+
+	res = Upgrade(context.Background(), "", append(m.options(), WithAllowDowngrade(true))...)
+	if res.ExitError != nil || res.InstalledPath == "" {
+		t.Errorf("Upgrade() with WithAllowDowngrade = %q, %v, want an install", res.SkipReason, res.ExitError)
+	}
+}
+
+func TestUpgradeAndReport(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+	v, upgraded, err := UpgradeAndReport(context.Background(), "", m.options()...)
+	if v != "v1.1.0" || !upgraded || err != nil {
+		t.Errorf("UpgradeAndReport() = %q, %v, %v, want v1.1.0, true, nil", v, upgraded, err)
+	}
+
+	fakeBuildInfo(t, m.path, "v1.1.0")
+	v, upgraded, err = UpgradeAndReport(context.Background(), "", m.options()...)
+	if v != "v1.1.0" || upgraded || err != nil {
+		t.Errorf("UpgradeAndReport() when already latest = %q, %v, %v, want v1.1.0, false, nil", v, upgraded, err)
+	}
+
+	v, upgraded, err = UpgradeAndReport(context.Background(), "", append(m.options(), WithTargetPlatform("plan10", "amd64"))...)
+	if v != "v1.1.0" || upgraded || !errors.Is(err, ErrUnsupportedPlatform) {
+		t.Errorf("UpgradeAndReport() on failure = %q, %v, %v, want v1.1.0, false, %v", v, upgraded, err, ErrUnsupportedPlatform)
+	}
+}
+
+func TestUpgrade_testBinary(t *testing.T) {
+	if !isTestBinary() {
+		t.Fatal("isTestBinary() = false in a test")
+	}
+	res := Upgrade(context.Background(), "")
+	if res.CurrentInfo != nil && res.SkipReason != SkipTestBinary {
+		t.Errorf("SkipReason = %q, want %q", res.SkipReason, SkipTestBinary)
+	}
+}
+
+func TestUpgradeBackground_canceled(t *testing.T) {
+	fakeBuildInfo(t, "example.com/fake", "v1.0.0")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	res := <-UpgradeBackground(ctx, "")
+	if res.SkipReason != SkipCanceled || !errors.Is(res.ExitError, context.Canceled) {
+		t.Errorf("result = %q, %v, want %q, %v", res.SkipReason, res.ExitError, SkipCanceled, context.Canceled)
+	}
+	if res.CurrentInfo == nil || res.CurrentInfo.Main.Path != "example.com/fake" {
+		t.Errorf("CurrentInfo = %+v, want the running build", res.CurrentInfo)
+	}
+}
+
+func TestWaitResult(t *testing.T) {
+	ch := make(chan *UpgradeResult, 1)
+	if res, ok := WaitResult(ch, time.Millisecond); ok || res != nil {
+		t.Errorf("WaitResult() before send = %v, %v, want nil, false", res, ok)
+	}
+	want := &UpgradeResult{}
+	ch <- want
+	if res, ok := WaitResult(ch, time.Second); !ok || res != want {
+		t.Errorf("WaitResult() = %p, %v, want %p, true", res, ok, want)
+	}
+	close(ch)
+	if res, ok := WaitResult(ch, time.Second); ok || res != nil {
+		t.Errorf("WaitResult() after close = %v, %v, want nil, false", res, ok)
+	}
+}
+
+func TestCurrentBuildInfo(t *testing.T) {
+	info, ok := CurrentBuildInfo()
+	if !ok {
+		t.Skip("build info not available")
+	}
+	if info.Main.Path != "github.com/melt-inc/autoupgrade" {
+		t.Errorf("Main.Path = %q", info.Main.Path)
+	}
+	if again, _ := CurrentBuildInfo(); again != info {
+		t.Error("CurrentBuildInfo() not cached")
+	}
+}
+
+func TestUpgradeAll(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+
+	paths := []string{"nope", "", "cmd/missing"}
+	results, err := UpgradeAll(context.Background(), paths, m.options()...)
+	if len(results) != len(paths) {
+		t.Fatalf("got %d results, want %d", len(results), len(paths))
+	}
+	for i, p := range paths {
+		res := results[i]
+		if want := fullPath(m.path, p, "latest"); res.Target() != want {
+			t.Errorf("results[%d].Target() = %q, want %q", i, res.Target(), want)
+		}
+		if res.Start.IsZero() || res.End.Before(res.Start) {
+			t.Errorf("results[%d] Start = %v, End = %v", i, res.Start, res.End)
+		}
+	}
+	if results[1].ExitError != nil || results[1].InstalledPath != m.binary() || results[1].Backend != BackendGoInstall {
+		t.Errorf("results[1] = %v, %q, %q, want installed with go install", results[1].ExitError, results[1].InstalledPath, results[1].Backend)
+	}
+	for _, i := range []int{0, 2} {
+		if results[i].ExitError == nil || !errors.Is(err, results[i].ExitError) {
+			t.Errorf("results[%d].ExitError = %v, joined error %v", i, results[i].ExitError, err)
+		}
+	}
+	if !strings.Contains(err.Error(), `package "nope"`) || strings.Contains(err.Error(), `package ""`) {
+		t.Errorf("joined error = %v", err)
+	}
+}
+
+func TestUpgradeSimple(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+
+	res := UpgradeSimple("", append(m.options(), WithTimeout(time.Millisecond))...)
+	if !errors.Is(res.ExitError, context.DeadlineExceeded) {
+		t.Errorf("UpgradeSimple() with 1ms timeout error = %v, want %v", res.ExitError, context.DeadlineExceeded)
+	}
+	res = UpgradeSimple("", m.options()...)
+	if res.ExitError != nil || res.InstalledPath == "" {
+		t.Errorf("UpgradeSimple() = %v, installed %q", res.ExitError, res.InstalledPath)
+	}
+}
+
+func Test_validatePackagePath(t *testing.T) {
+	abs := "/home/user/tool"
+	if filepath.Separator == '\\' {
+		abs = `C:\tool`
+	}
+	tests := []struct {
+		packagePath string
+		valid       bool
+	}{
+		{"", true},
+		{".", true},
+		{"./", true},
+		{"cmd/tool", true},
+		{"./cmd/tool/", true},
+		{"/cmd/tool", false},
+		{abs, false},
+		{"cmd/tool@v1.2.0", false},
+		{"@latest", false},
+		{"../other/cmd", false},
+		{"cmd/../../x", false},
+		{"cmd//tool", false},
+		{`cmd\tool`, false},
+	}
+	for _, tt := range tests {
+		err := validatePackagePath(tt.packagePath)
+		if tt.valid && err != nil || !tt.valid && !errors.Is(err, ErrInvalidPackagePath) {
+			t.Errorf("validatePackagePath(%q) = %v, want valid %v", tt.packagePath, err, tt.valid)
+		}
+	}
+
+	fakeBuildInfo(t, "example.com/fake", "v1.0.0")
+	if res := Upgrade(context.Background(), "cmd/tool@v1.2.0"); !errors.Is(res.ExitError, ErrInvalidPackagePath) {
+		t.Errorf("Upgrade() error = %v, want %v", res.ExitError, ErrInvalidPackagePath)
+	}
+	if _, err := ResolveInstallPath("example.com/fake", "../x"); !errors.Is(err, ErrInvalidPackagePath) {
+		t.Errorf("ResolveInstallPath() error = %v, want %v", err, ErrInvalidPackagePath)
+	}
+}
+
+func TestBuildTags(t *testing.T) {
+	info := &debug.BuildInfo{Settings: []debug.BuildSetting{
+		{Key: "-compiler", Value: "gc"},
+		{Key: "-tags", Value: "netgo,osusergo"},
+	}}
+	if got, want := BuildTags(info), []string{"netgo", "osusergo"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("BuildTags() = %q, want %q", got, want)
+	}
+	if got := BuildTags(&debug.BuildInfo{}); got != nil {
+		t.Errorf("BuildTags() without tags = %q, want nil", got)
+	}
+	if got := BuildTags(nil); got != nil {
+		t.Errorf("BuildTags(nil) = %q, want nil", got)
+	}
+}
+
+func TestUpgrade_preserveBuildTags(t *testing.T) {
+	orig, origTest := readBuildInfo, isTestBinary
+	t.Cleanup(func() { readBuildInfo, isTestBinary = orig, origTest })
+	isTestBinary = func() bool { return false }
+	readBuildInfo = func() (*debug.BuildInfo, bool) {
+		return &debug.BuildInfo{
+			Main:     debug.Module{Path: "example.com/fake", Version: "v1.0.0"},
+			Settings: []debug.BuildSetting{{Key: "-tags", Value: "netgo"}},
+		}, true
+	}
+	shim, log := writeGoShim(t, "go1.21.5")
+
+	res := Upgrade(context.Background(), "",
+		WithGoBinary(shim),
+		WithEnv("GOBIN="+t.TempDir()),
+		WithSkipPreCheck(true),
+		WithVerifyModulePath(false),
+		WithPreserveBuildTags(true),
+	)
+	if res.ExitError != nil {
+		t.Fatalf("Upgrade() error = %v", res.ExitError)
+	}
+	if !reflect.DeepEqual(res.BuildTags, []string{"netgo"}) {
+		t.Errorf("BuildTags = %q, want [netgo]", res.BuildTags)
+	}
+	if data, _ := os.ReadFile(log); string(data) != "install -tags=netgo example.com/fake@latest\n" {
+		t.Errorf("go shim ran %q", data)
+	}
 }
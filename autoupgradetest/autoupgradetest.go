@@ -0,0 +1,152 @@
+// Package autoupgradetest helps test programs that use autoupgrade against a
+// module proxy on the local filesystem, so that the go install flow can be
+// exercised with real binaries and without network access.
+package autoupgradetest
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/melt-inc/autoupgrade"
+	"golang.org/x/mod/module"
+)
+
+// Proxy is a module proxy served from a directory through a file:// GOPROXY.
+type Proxy struct {
+	Dir      string // root of the proxy
+	modCache string
+}
+
+// NewProxy returns an empty proxy in a temporary directory removed when the
+// test ends.
+func NewProxy(t testing.TB) *Proxy {
+	t.Helper()
+	return &Proxy{Dir: t.TempDir(), modCache: t.TempDir()}
+}
+
+// Publish adds versions of modulePath to the proxy, each a main package at
+// the module root whose binary exits without doing anything. The last
+// version given becomes @latest.
+func (p *Proxy) Publish(t testing.TB, modulePath string, versions ...string) {
+	t.Helper()
+	escaped, err := module.EscapePath(modulePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(p.Dir, filepath.FromSlash(escaped))
+	dir := filepath.Join(root, "@v")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	gomod := "module " + modulePath + "\n\ngo 1.21\n"
+	list, _ := os.ReadFile(filepath.Join(dir, "list"))
+	for _, v := range versions {
+		info, _ := json.Marshal(autoupgrade.VersionInfo{Version: v, Time: time.Now().UTC()})
+		writeFile(t, filepath.Join(dir, v+".info"), info)
+		writeFile(t, filepath.Join(dir, v+".mod"), []byte(gomod))
+		writeModuleZip(t, filepath.Join(dir, v+".zip"), modulePath+"@"+v, map[string]string{
+			"go.mod":  gomod,
+			"main.go": "package main\n\nfunc main() {}\n",
+		})
+		list = append(list, v+"\n"...)
+		writeFile(t, filepath.Join(root, "@latest"), info)
+	}
+	writeFile(t, filepath.Join(dir, "list"), list)
+}
+
+// Env returns the go environment for installing from the proxy into gobin:
+// GOPROXY, GOBIN and a temporary module cache, with checksum database
+// lookups off, as the published modules are unknown to it, and the local
+// toolchain.
+func (p *Proxy) Env(gobin string) []string {
+	return []string{
+		"GOPROXY=file://" + filepath.ToSlash(p.Dir),
+		"GOBIN=" + gobin,
+		"GOMODCACHE=" + p.modCache,
+		"GOFLAGS=-modcacherw",
+		"GOSUMDB=off",
+		"GOTOOLCHAIN=local",
+	}
+}
+
+// Options returns the autoupgrade options for installing from the proxy
+// into gobin.
+func (p *Proxy) Options(gobin string) []autoupgrade.Option {
+	return []autoupgrade.Option{
+		autoupgrade.WithEnv(p.Env(gobin)...),
+		autoupgrade.WithInsecureSkipChecksum(true),
+	}
+}
+
+// TestInstall publishes version of modulePath to a new Proxy and installs it
+// with go install into gobin, or a temporary directory if gobin is empty. It
+// returns the installed path, failing the test unless the binary is where
+// autoupgrade.ResolveInstallPath expects and its build information, read
+// through UpgradeResult.NewBuildInfo, reports modulePath at version. The
+// test is skipped if the go command is not available.
+func TestInstall(t testing.TB, modulePath, version, gobin string) string {
+	t.Helper()
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not available")
+	}
+	if gobin == "" {
+		gobin = t.TempDir()
+	}
+	p := NewProxy(t)
+	p.Publish(t, modulePath, version)
+	path, err := autoupgrade.ResolveInstallPath(modulePath, "", p.Options(gobin)...)
+	if err != nil {
+		t.Fatalf("ResolveInstallPath() error = %v", err)
+	}
+
+	cmd := exec.Command(goCmd, "install", modulePath+"@"+version)
+	cmd.Dir = t.TempDir()
+	cmd.Env = append(os.Environ(), p.Env(gobin)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go install %s@%s: %v\n%s", modulePath, version, err, out)
+	}
+	res := &autoupgrade.UpgradeResult{InstalledPath: path}
+	info, err := res.NewBuildInfo()
+	if err != nil {
+		t.Fatalf("reading build info of %s: %v", path, err)
+	}
+	if info.Main.Path != modulePath || info.Main.Version != version {
+		t.Fatalf("%s reports %s@%s, want %s@%s", path, info.Main.Path, info.Main.Version, modulePath, version)
+	}
+	return path
+}
+
+func writeFile(t testing.TB, name string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(name, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeModuleZip(t testing.TB, name, prefix string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for file, content := range files {
+		w, err := zw.Create(prefix + "/" + file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,58 @@
+package autoupgradetest
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/melt-inc/autoupgrade"
+)
+
+func TestTestInstall(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping go install test in short mode")
+	}
+	gobin := t.TempDir()
+	path := TestInstall(t, "example.com/fake", "v1.2.0", gobin)
+	want := filepath.Join(gobin, "fake")
+	if runtime.GOOS == "windows" {
+		want += ".exe"
+	}
+	if path != want {
+		t.Errorf("TestInstall() = %q, want %q", path, want)
+	}
+}
+
+func TestProxy_Publish(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping go install test in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not available")
+	}
+	p := NewProxy(t)
+	p.Publish(t, "example.com/Fake", "v1.0.0")
+	p.Publish(t, "example.com/Fake", "v1.1.0")
+	list, err := os.ReadFile(filepath.Join(p.Dir, "example.com", "!fake", "@v", "list"))
+	if err != nil || string(list) != "v1.0.0\nv1.1.0\n" {
+		t.Fatalf("list = %q, %v, want both versions", list, err)
+	}
+
+	gobin := t.TempDir()
+	cmd := exec.Command("go", "install", "example.com/Fake@latest")
+	cmd.Dir = t.TempDir()
+	cmd.Env = append(os.Environ(), p.Env(gobin)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go install: %v\n%s", err, out)
+	}
+	path, err := autoupgrade.ResolveInstallPath("example.com/Fake", "", p.Options(gobin)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := &autoupgrade.UpgradeResult{InstalledPath: path}
+	if info, err := res.NewBuildInfo(); err != nil || info.Main.Version != "v1.1.0" {
+		t.Errorf("installed @latest = %v, %v, want v1.1.0", info, err)
+	}
+}
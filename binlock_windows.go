@@ -0,0 +1,29 @@
+package autoupgrade
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+const (
+	errorAccessDenied     syscall.Errno = 5
+	errorSharingViolation syscall.Errno = 32
+)
+
+// binaryLocked reports whether the file at path cannot be opened for writing
+// because a process, typically the running binary itself, holds it open.
+func binaryLocked(path string) bool {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err == nil {
+		f.Close()
+		return false
+	}
+	return isLockError(err)
+}
+
+// isLockError reports whether err is the error Windows returns for writing,
+// renaming over or deleting a file that is in use.
+func isLockError(err error) bool {
+	return errors.Is(err, errorSharingViolation) || errors.Is(err, errorAccessDenied)
+}
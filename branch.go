@@ -0,0 +1,67 @@
+package autoupgrade
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LatestCommitVersion returns the version go install would select for the
+// running binary's module at branch, such as "main": normally the
+// pseudo-version of the branch tip, or a tag if the tip is tagged. It runs
+// 'go list -m' so that GOPROXY, GOPRIVATE, GOVCS and the other go
+// environment variables apply as they would to go install, set with WithEnv
+// or its relatives. Comparing the result with the running version tells a
+// dev channel that a new commit is available without installing it. When
+// the lookup needs a version control tool that GOVCS disallows, the error
+// wraps ErrVCSDisallowed. As with CheckLatest, packagePath only mirrors the
+// Upgrade signature.
+func LatestCommitVersion(ctx context.Context, packagePath, branch string, opts ...Option) (pseudoVersion string, err error) {
+	cfg := newConfig(opts)
+	if branch == "" || strings.HasPrefix(branch, "-") || strings.ContainsAny(branch, "@ \t\n") {
+		return "", fmt.Errorf("%w: invalid branch %q", ErrInvalidOption, branch)
+	}
+	modulePath, err := currentModule()
+	if err != nil {
+		return "", err
+	}
+	goCmd, err := cfg.goCommand()
+	if err != nil {
+		return "", err
+	}
+	// Run outside any module, where a query resolves exactly as it does
+	// for go install pkg@version.
+	dir, err := os.MkdirTemp("", "autoupgrade-list-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	cmd, err := cfg.command(ctx, goCmd, "list", "-m", "-json", modulePath+"@"+branch)
+	if err != nil {
+		return "", err
+	}
+	cmd.Dir = dir
+	cmd.Env = append(cfg.environ(), "GOWORK=off")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	cfg.logf("running %s %s", goCmd, strings.Join(cmd.Args[1:], " "))
+	out, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("autoupgrade: go list stopped: %w", ctx.Err())
+		}
+		err = classifyInstallError(err, stderr.Bytes())
+		return "", fmt.Errorf("autoupgrade: resolving %s@%s: %w: %s", modulePath, branch, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	var m struct{ Version string }
+	if err := json.Unmarshal(out, &m); err != nil {
+		return "", fmt.Errorf("autoupgrade: decoding go list output: %w", err)
+	}
+	if m.Version == "" {
+		return "", fmt.Errorf("autoupgrade: go list reported no version for %s@%s", modulePath, branch)
+	}
+	return m.Version, nil
+}
@@ -0,0 +1,32 @@
+package autoupgrade
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLatestCommitVersion(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+	const tip = "v1.0.1-0.20240301120000-abcdefabcdef"
+	dir := filepath.Join(m.proxyDir, "example.com", "fake", "@v")
+	info, _ := json.Marshal(VersionInfo{Version: tip, Time: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)})
+	writeFile(t, filepath.Join(dir, "main.info"), info)
+	writeFile(t, filepath.Join(dir, tip+".info"), info)
+	writeFile(t, filepath.Join(dir, tip+".mod"), []byte("module example.com/fake\n\ngo 1.21\n"))
+
+	got, err := LatestCommitVersion(context.Background(), "", "main", m.options()...)
+	if err != nil || got != tip {
+		t.Errorf("LatestCommitVersion() = %q, %v, want %q", got, err, tip)
+	}
+	if _, err := LatestCommitVersion(context.Background(), "", "nope", m.options()...); err == nil {
+		t.Error("LatestCommitVersion() for a missing branch error = nil")
+	}
+	if _, err := LatestCommitVersion(context.Background(), "", "-x", m.options()...); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("LatestCommitVersion() with a flag as branch error = %v, want %v", err, ErrInvalidOption)
+	}
+}
@@ -0,0 +1,76 @@
+package autoupgrade
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// buildCacheDir returns the build cache directory go install writes to:
+// GOCACHE, defaulting to go-build under the user cache directory, as the go
+// command does. It is empty if GOCACHE is "off" or there is no default.
+func buildCacheDir(cfg *config) string {
+	switch dir := cfg.getenv("GOCACHE"); dir {
+	case "off":
+		return ""
+	case "":
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			return ""
+		}
+		return filepath.Join(cache, "go-build")
+	default:
+		return dir
+	}
+}
+
+// limitBuildCache runs 'go clean -cache' when the build cache has grown past
+// the size set with WithCacheSizeLimit.
+func limitBuildCache(ctx context.Context, cfg *config, goCmd string) error {
+	dir := buildCacheDir(cfg)
+	if dir == "" {
+		return nil
+	}
+	size, err := dirSize(dir)
+	if err != nil {
+		return fmt.Errorf("autoupgrade: measuring build cache: %w", err)
+	}
+	if size <= cfg.cacheSizeLimit {
+		return nil
+	}
+	cfg.logf("build cache %s holds %d bytes, over the limit of %d; cleaning", dir, size, cfg.cacheSizeLimit)
+	cmd, err := cfg.command(ctx, goCmd, "clean", "-cache")
+	if err != nil {
+		return err
+	}
+	cmd.Env = cfg.environ()
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("autoupgrade: go clean -cache: %w: %s", err, out)
+	}
+	return nil
+}
+
+// dirSize returns the total size of the regular files under dir, or 0 if dir
+// does not exist.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,85 @@
+package autoupgrade
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_dirSize(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a"), make([]byte, 10))
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "sub", "b"), make([]byte, 5))
+	if size, err := dirSize(dir); err != nil || size != 15 {
+		t.Errorf("dirSize() = %d, %v, want 15", size, err)
+	}
+	if size, err := dirSize(filepath.Join(dir, "missing")); err != nil || size != 0 {
+		t.Errorf("dirSize(missing) = %d, %v, want 0", size, err)
+	}
+}
+
+func TestUpgrade_cacheSizeLimit(t *testing.T) {
+	fakeBuildInfo(t, "example.com/fake", "v1.0.0")
+	shim, log := writeGoShim(t, "go1.21.5")
+	cache := t.TempDir()
+	writeFile(t, filepath.Join(cache, "obj"), make([]byte, 100))
+	opts := func(limit int64) []Option {
+		return []Option{
+			WithGoBinary(shim),
+			WithEnv("GOBIN=" + t.TempDir()),
+			WithBuildCache(cache),
+			WithSkipPreCheck(true),
+			WithVerifyModulePath(false),
+			WithCacheSizeLimit(limit),
+		}
+	}
+
+	res := Upgrade(context.Background(), "", opts(1000)...)
+	if res.ExitError != nil || res.CacheCleanError != nil {
+		t.Fatalf("Upgrade() error = %v, %v", res.ExitError, res.CacheCleanError)
+	}
+	if data, _ := os.ReadFile(log); strings.Contains(string(data), "clean") {
+		t.Errorf("go clean ran under the limit:\n%s", data)
+	}
+
+	res = Upgrade(context.Background(), "", opts(50)...)
+	if res.ExitError != nil || res.CacheCleanError != nil {
+		t.Fatalf("Upgrade() error = %v, %v", res.ExitError, res.CacheCleanError)
+	}
+	if data, _ := os.ReadFile(log); !strings.HasSuffix(string(data), "install example.com/fake@latest\nclean -cache\n") {
+		t.Errorf("go shim ran:\n%s\nwant go clean -cache after the install", data)
+	}
+}
+
+func TestUpgrade_cacheCleanFails(t *testing.T) {
+	fakeBuildInfo(t, "example.com/fake", "v1.0.0")
+	shim, _ := writeGoShim(t, "go1.21.5")
+	script, err := os.ReadFile(shim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script = []byte(strings.Replace(string(script), "esac", "clean) exit 1 ;;\nesac", 1))
+	writeFile(t, shim, script)
+	cache := t.TempDir()
+	writeFile(t, filepath.Join(cache, "obj"), make([]byte, 100))
+
+	res := Upgrade(context.Background(), "",
+		WithGoBinary(shim),
+		WithEnv("GOBIN="+t.TempDir()),
+		WithBuildCache(cache),
+		WithSkipPreCheck(true),
+		WithVerifyModulePath(false),
+		WithCacheSizeLimit(50),
+	)
+	if res.ExitError != nil || res.InstalledPath == "" {
+		t.Fatalf("Upgrade() = %q, %v, want an install despite the failed cleanup", res.InstalledPath, res.ExitError)
+	}
+	if res.CacheCleanError == nil {
+		t.Error("CacheCleanError = nil, want the go clean failure")
+	}
+}
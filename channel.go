@@ -0,0 +1,187 @@
+package autoupgrade
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// channelTarget reads the channel file at path and returns the entry for
+// channel. The file is a JSON object mapping channel names to either
+// "latest", an explicit version, or a version constraint:
+//
+//	{
+//		"stable":  "latest",
+//		"beta":    ">=1.5.0-0, <2.0.0",
+//		"pinned":  "v1.4.2"
+//	}
+//
+// When channel is empty the "default" entry is used if present, and
+// "latest" otherwise.
+func channelTarget(path, channel string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("autoupgrade: reading channel config: %w", err)
+	}
+	var channels map[string]string
+	if err := json.Unmarshal(data, &channels); err != nil {
+		return "", fmt.Errorf("autoupgrade: parsing channel config %s: %w", path, err)
+	}
+	if channel == "" {
+		if spec, ok := channels["default"]; ok {
+			return spec, nil
+		}
+		return "latest", nil
+	}
+	spec, ok := channels[channel]
+	if !ok {
+		return "", fmt.Errorf("%w: %q in %s", ErrUnknownChannel, channel, path)
+	}
+	return spec, nil
+}
+
+// policyBlock is returned by resolveTarget when the version the channel
+// selects is refused by a policy, and nothing else is acceptable.
+type policyBlock struct {
+	version string
+	policy  Policy
+}
+
+func (e *policyBlock) Error() string {
+	return fmt.Sprintf("autoupgrade: %s blocked by %s policy", e.version, e.policy)
+}
+
+// errNoAcceptableVersion is returned by resolveTarget when WithVersionFilter
+// rejects every candidate newer than the current version.
+var errNoAcceptableVersion = errors.New("autoupgrade: no acceptable version")
+
+// errNoVersionSatisfiesConstraint is returned by resolveTarget when no
+// version the proxy lists satisfies the WithConstraint expression.
+var errNoVersionSatisfiesConstraint = errors.New("autoupgrade: no version satisfies constraint")
+
+// resolveTarget returns the version query to install for modulePath: "latest"
+// unless a channel, WithVersionResolver, WithVersionFile or WithConstraint
+// selects an explicit version or constraint, in which case the constraint is
+// resolved against the versions known to the proxy. A prerelease current
+// version without a channel config stays on its prerelease channel: the
+// greatest version with the same prerelease identifier is chosen, unless
+// WithCrossChannel is set.
+//
+// With WithVersionFilter, the selected version is resolved and checked
+// against the filter. If rejected, the greatest version newer than current
+// that the channel would otherwise allow and the filter accepts is chosen
+// instead, or errNoAcceptableVersion returned if there is none. A constraint
+// or prerelease channel whose greatest version is older than current returns
+// a *policyBlock rather than a downgrade.
+//
+// proxy is the URL of the GOPROXY entry that answered, or "" if the proxy was
+// not asked. allow reports which versions the channel or constraint admits,
+// for later steps that fall back to an older version; it is nil when any
+// release would do.
+func resolveTarget(ctx context.Context, cfg *config, modulePath, current string) (
+	target, proxy string, allow func(string) bool, err error) {
+	spec := "latest"
+	if cfg.versionResolver != nil {
+		if spec, err = cfg.versionResolver(ctx, modulePath); err != nil {
+			return "", "", nil, err
+		}
+		spec = strings.TrimSpace(spec)
+		cfg.logf("version resolver selected %s", spec)
+	} else if cfg.versionFile != "" {
+		if spec, err = readVersionFile(cfg); err != nil {
+			return "", "", nil, err
+		}
+	} else if cfg.constraint != "" {
+		spec = cfg.constraint
+	} else if cfg.resolvedVersion != "" {
+		spec = cfg.resolvedVersion
+	} else if cfg.channelConfig == "" {
+		if cfg.channel != "" {
+			return "", "", nil, fmt.Errorf("%w: %q (no channel config)", ErrUnknownChannel, cfg.channel)
+		}
+	} else {
+		if spec, err = channelTarget(cfg.channelConfig, cfg.channel); err != nil {
+			return "", "", nil, err
+		}
+		spec = strings.TrimSpace(spec)
+	}
+
+	var best string
+	ch := cfg.inferredChannel(current)
+	switch v := normalizeVersion(spec); {
+	case ch != "":
+		spec = "-" + ch + ".*"
+		allow = func(v string) bool { return prereleaseChannel(v) == ch }
+	case cfg.constraint != "":
+		// Even a bare version is a constraint here, so it is not installed
+		// unless the proxy lists it.
+		c, err := parseConstraint(spec)
+		if err != nil {
+			return "", "", nil, err
+		}
+		allow = c.allows
+	case spec == "latest":
+		if cfg.versionFilter == nil {
+			return "latest", "", nil, nil
+		}
+		info, err := latestInfo(ctx, cfg, modulePath)
+		if err != nil {
+			return "", "", nil, err
+		}
+		latest := info.Version
+		if cfg.versionFilter(latest) {
+			return latest, info.Proxy, nil, nil
+		}
+		// Fall back among the releases @latest chooses from: prereleases
+		// only count when @latest itself is one.
+		best = latest
+		prerelease := isPrerelease(latest)
+		allow = func(v string) bool {
+			return !isPseudoVersion(v) && (prerelease || !isPrerelease(v)) && semverCompare(v, latest) < 0
+		}
+	case semverValid(v):
+		if cfg.versionFilter != nil && !cfg.versionFilter(v) {
+			return "", "", nil, errNoAcceptableVersion
+		}
+		return v, "", nil, nil
+	default:
+		c, err := parseConstraint(spec)
+		if err != nil {
+			return "", "", nil, err
+		}
+		allow = c.allows
+	}
+
+	versions, proxy, err := listVersions(ctx, cfg, modulePath)
+	if err != nil {
+		return "", "", nil, err
+	}
+	if best == "" {
+		if best = greatestAllowed(versions, allow); best == "" {
+			if cfg.constraint != "" {
+				return "", "", nil, errNoVersionSatisfiesConstraint
+			}
+			return "", "", nil, fmt.Errorf("%w: %q", ErrNoMatchingVersion, spec)
+		}
+		// Only an explicitly pinned version may move backwards, as with
+		// ShouldUpgrade. A pseudo-version is left to
+		// WithPseudoVersionPolicy when set.
+		pseudo := cfg.pseudoPolicy != "" && isPseudoVersion(current)
+		if semverValid(current) && semverCompare(best, current) < 0 && !pseudo {
+			return "", "", nil, &policyBlock{best, PolicyDowngrade}
+		}
+		if cfg.versionFilter == nil || cfg.versionFilter(best) {
+			return best, proxy, allow, nil
+		}
+	}
+	target = greatestAllowed(versions, func(v string) bool {
+		return allow(v) && cfg.versionFilter(v) && (!semverValid(current) || semverCompare(v, current) > 0)
+	})
+	if target == "" {
+		return "", "", nil, errNoAcceptableVersion
+	}
+	return target, proxy, allow, nil
+}
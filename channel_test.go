@@ -0,0 +1,176 @@
+package autoupgrade
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func Test_resolveTarget(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("v1.4.0\nv1.5.0-beta.1\nv1.5.0-beta.2\nv1.4.1\nv2.0.0\n"))
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "channels.json")
+	writeFile(t, path, []byte(`{
+		"default": "<2.0.0",
+		"stable": "latest",
+		"beta": ">=1.5.0-0, <2.0.0",
+		"pinned": "1.4.0",
+		"future": ">=3.0.0"
+	}`))
+
+	tests := []struct {
+		channel string
+		want    string
+		wantErr error
+	}{
+		{"", "v1.4.1", nil},
+		{"stable", "latest", nil},
+		{"beta", "v1.5.0-beta.2", nil},
+		{"pinned", "v1.4.0", nil},
+		{"future", "", ErrNoMatchingVersion},
+		{"nightly", "", ErrUnknownChannel},
+	}
+	for _, tt := range tests {
+		t.Run(tt.channel, func(t *testing.T) {
+			cfg := newConfig([]Option{
+				WithEnv("GOPROXY=" + srv.URL),
+				WithChannelConfig(path),
+				WithChannel(tt.channel),
+			})
+			got, _, _, err := resolveTarget(context.Background(), cfg, "example.com/fake", "v1.0.0")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("resolveTarget() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolveTarget() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpgrade_channel(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0", "v1.2.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+	path := filepath.Join(t.TempDir(), "channels.json")
+	writeFile(t, path, []byte(`{"pinned": "v1.1.0"}`))
+
+	opts := append(m.options(), WithChannelConfig(path), WithChannel("pinned"))
+	res := Upgrade(context.Background(), "", opts...)
+	if res.ExitError != nil {
+		t.Fatalf("Upgrade() error = %v", res.ExitError)
+	}
+	info, err := res.NewBuildInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Main.Version != "v1.1.0" {
+		t.Errorf("installed %s, want v1.1.0", info.Main.Version)
+	}
+}
+
+func Test_resolveTarget_versionFilter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/@latest") {
+			w.Write([]byte(`{"Version":"v1.4.1"}`))
+			return
+		}
+		w.Write([]byte("v1.3.0\nv1.4.0\nv1.5.0-beta.1\nv1.4.1\n"))
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "channels.json")
+	writeFile(t, path, []byte(`{"pinned": "v1.4.1", "beta": ">=1.4.0-0"}`))
+
+	embargo := func(vs ...string) func(string) bool {
+		return func(v string) bool { return !slices.Contains(vs, v) }
+	}
+	tests := []struct {
+		name    string
+		channel string
+		current string
+		filter  func(string) bool
+		want    string
+		wantErr error
+	}{
+		{"latest accepted", "", "v1.3.0", embargo(), "v1.4.1", nil},
+		{"latest embargoed", "", "v1.3.0", embargo("v1.4.1"), "v1.4.0", nil},
+		{"nothing newer", "", "v1.4.0", embargo("v1.4.1"), "", errNoAcceptableVersion},
+		{"pinned embargoed", "pinned", "v1.3.0", embargo("v1.4.1"), "", errNoAcceptableVersion},
+		{"constraint", "beta", "v1.3.0", embargo("v1.5.0-beta.1"), "v1.4.1", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []Option{WithEnv("GOPROXY=" + srv.URL), WithVersionFilter(tt.filter)}
+			if tt.channel != "" {
+				opts = append(opts, WithChannelConfig(path), WithChannel(tt.channel))
+			}
+			got, _, _, err := resolveTarget(context.Background(), newConfig(opts), "example.com/fake", tt.current)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("resolveTarget() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolveTarget() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_resolveTarget_prereleaseChannel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("v1.2.0\nv1.3.0-beta.1\nv1.3.0-beta.2\nv1.3.0-rc.1\nv1.3.0\nv1.4.0-beta.1\n"))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		current string
+		opts    []Option
+		want    string
+	}{
+		{"stable", "v1.2.0", nil, "latest"},
+		{"beta", "v1.3.0-beta.1", nil, "v1.4.0-beta.1"},
+		{"rc", "v1.3.0-rc.1", nil, "v1.3.0-rc.1"},
+		{"pseudo", "v1.3.1-0.20240101000000-abcdef123456", nil, "latest"},
+		{"cross", "v1.3.0-beta.1", []Option{WithCrossChannel(true)}, "latest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newConfig(append([]Option{WithEnv("GOPROXY=" + srv.URL)}, tt.opts...))
+			got, _, _, err := resolveTarget(context.Background(), cfg, "example.com/fake", tt.current)
+			if err != nil {
+				t.Fatalf("resolveTarget() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveTarget() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpgrade_downgradeBlocked(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0", "v2.0.0")
+	fakeBuildInfo(t, m.path, "v2.0.0")
+	path := filepath.Join(t.TempDir(), "channels.json")
+	writeFile(t, path, []byte(`{"v1": "<2.0.0", "pinned": "v1.1.0"}`))
+
+	res := Upgrade(context.Background(), "", append(m.options(), WithChannelConfig(path), WithChannel("v1"))...)
+	if res.ExitError != nil || res.SkipReason != SkipBlockedByPolicy {
+		t.Fatalf("Upgrade() = %q, %v, want %q", res.SkipReason, res.ExitError, SkipBlockedByPolicy)
+	}
+	if res.Decision.Blocked != "v1.1.0" || res.Decision.BlockedBy != PolicyDowngrade {
+		t.Errorf("Blocked = %q by %q, want v1.1.0 by %q", res.Decision.Blocked, res.Decision.BlockedBy, PolicyDowngrade)
+	}
+
+	res = Upgrade(context.Background(), "", append(m.options(), WithChannelConfig(path), WithChannel("pinned"))...)
+	if res.ExitError != nil || res.Decision.Target != "v1.1.0" {
+		t.Errorf("Upgrade() pinned = %q, %v, want target v1.1.0", res.Decision.Target, res.ExitError)
+	}
+}
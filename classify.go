@@ -0,0 +1,102 @@
+package autoupgrade
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// FailureClass groups upgrade failures by how a caller would typically react
+// to them.
+type FailureClass int
+
+const (
+	// FailureUnknown is an unrecognised failure.
+	FailureUnknown FailureClass = iota
+	// FailureTransient may succeed if retried later, such as a cancelled
+	// context or a proxy returning 5xx.
+	FailureTransient
+	// FailurePermanent will not succeed without a change in configuration,
+	// such as a missing module or an invalid option.
+	FailurePermanent
+	// FailureAuth failed because credentials are missing or rejected.
+	FailureAuth
+	// FailureNetwork failed to reach the proxy or VCS host.
+	FailureNetwork
+	// FailureToolchain failed to obtain the required Go toolchain.
+	FailureToolchain
+)
+
+func (c FailureClass) String() string {
+	switch c {
+	case FailureTransient:
+		return "transient"
+	case FailurePermanent:
+		return "permanent"
+	case FailureAuth:
+		return "auth"
+	case FailureNetwork:
+		return "network"
+	case FailureToolchain:
+		return "toolchain"
+	default:
+		return "unknown"
+	}
+}
+
+// Classify reports the class of an error returned by this package, either
+// directly or through UpgradeResult.ExitError, so that callers can decide
+// whether to retry, skip or give up. A nil error is FailureUnknown.
+func Classify(err error) FailureClass {
+	if err == nil {
+		return FailureUnknown
+	}
+	var perr *ProxyError
+	if errors.As(err, &perr) {
+		switch code := perr.StatusCode; {
+		case code == http.StatusUnauthorized || code == http.StatusForbidden:
+			return FailureAuth
+		case code == http.StatusTooManyRequests || code >= 500:
+			return FailureTransient
+		default:
+			return FailurePermanent
+		}
+	}
+	switch {
+	case errors.Is(err, ErrToolchainDownloadBlocked),
+		errors.Is(err, ErrGoNotFound):
+		return FailureToolchain
+	case errors.Is(err, ErrAuthFailed):
+		return FailureAuth
+	case errors.Is(err, ErrNetwork),
+		errors.Is(err, ErrResolverUnreachable):
+		return FailureNetwork
+	case errors.Is(err, ErrProxyUnavailable),
+		errors.Is(err, ErrRateLimited),
+		errors.Is(err, ErrInsufficientDiskSpace),
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded):
+		return FailureTransient
+	case errors.Is(err, ErrNotFound),
+		errors.Is(err, ErrNotMainPackage),
+		errors.Is(err, ErrVCSDisallowed),
+		errors.Is(err, ErrProxyDisabled),
+		errors.Is(err, ErrNoProxy),
+		errors.Is(err, ErrUnsupportedPlatform),
+		errors.Is(err, ErrInvalidVersion),
+		errors.Is(err, ErrBinaryLocked),
+		errors.Is(err, ErrInvalidPackagePath),
+		errors.Is(err, ErrInvalidModulePath),
+		errors.Is(err, ErrModuleMoved),
+		errors.Is(err, ErrResolverMalformed),
+		errors.Is(err, ErrInvalidVersionFile),
+		errors.Is(err, ErrNoBuildInfo):
+		return FailurePermanent
+	}
+	var nerr net.Error
+	if errors.As(err, &nerr) {
+		return FailureNetwork
+	}
+	return FailureUnknown
+}
@@ -0,0 +1,45 @@
+package autoupgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	exitErr := &exec.ExitError{}
+	tests := []struct {
+		name string
+		err  error
+		want FailureClass
+	}{
+		{"nil", nil, FailureUnknown},
+		{"other", errors.New("boom"), FailureUnknown},
+		{"canceled", context.Canceled, FailureTransient},
+		{"deadline", fmt.Errorf("wrapped: %w", context.DeadlineExceeded), FailureTransient},
+		{"proxy 401", &ProxyError{StatusCode: 401}, FailureAuth},
+		{"proxy 404", &ProxyError{StatusCode: 404}, FailurePermanent},
+		{"proxy 429", &ProxyError{StatusCode: 429}, FailureTransient},
+		{"proxy 503", &ProxyError{StatusCode: 503}, FailureTransient},
+		{"proxy off", ErrProxyDisabled, FailurePermanent},
+		{"resolver down", fmt.Errorf("%w: 503 Service Unavailable", ErrResolverUnreachable), FailureNetwork},
+		{"binary locked", fmt.Errorf("%w: %w", ErrBinaryLocked, exitErr), FailurePermanent},
+		{"dial", &net.OpError{Op: "dial", Err: errors.New("refused")}, FailureNetwork},
+		{"toolchain", classifyInstallError(exitErr, []byte("go: download go1.99.0 for linux/amd64: toolchain not available")), FailureToolchain},
+		{"install auth", classifyInstallError(exitErr, []byte("fatal: could not read Username for 'https://github.com': terminal prompts disabled")), FailureAuth},
+		{"install not found", classifyInstallError(exitErr, []byte("go: example.com/tool@latest: no matching versions for query \"latest\"")), FailurePermanent},
+		{"install 502", classifyInstallError(exitErr, []byte("reading https://proxy.example/x/@v/list: 502 Bad Gateway")), FailureTransient},
+		{"install network", classifyInstallError(exitErr, []byte("dial tcp: lookup proxy.golang.org: no such host")), FailureNetwork},
+		{"install unknown", classifyInstallError(exitErr, []byte("compile error")), FailureUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.err); got != tt.want {
+				t.Errorf("Classify(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package autoupgrade
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// constraint is a set of version comparisons that must all hold, parsed from
+// a comma-separated expression such as ">=1.2.0, <2.0.0".
+//
+// Supported operators are =, !=, >, >=, <, <=, ~ (patch-level changes, so
+// "~1.2.3" is ">=1.2.3, <1.3.0") and ^ (changes that do not modify the left-most
+// non-zero component, so "^1.2.3" is ">=1.2.3, <2.0.0"). A bare version means
+// "=". The "v" prefix is optional.
+//
+// Prerelease versions only satisfy a constraint that itself mentions a
+// prerelease, so ">=1.2.0" does not select "v1.3.0-rc.1" but ">=1.3.0-0" does.
+type constraint struct {
+	terms      []constraintTerm
+	prerelease bool
+}
+
+type constraintTerm struct {
+	op      string
+	version string
+}
+
+func parseConstraint(expr string) (*constraint, error) {
+	c := &constraint{}
+	for _, field := range strings.Split(expr, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			return nil, fmt.Errorf("autoupgrade: empty term in constraint %q", expr)
+		}
+		op := ""
+		for _, o := range []string{">=", "<=", "!=", ">", "<", "=", "~", "^"} {
+			if strings.HasPrefix(field, o) {
+				op = o
+				break
+			}
+		}
+		v := normalizeVersion(strings.TrimSpace(field[len(op):]))
+		if !semver.IsValid(v) {
+			return nil, fmt.Errorf("%w: %q in constraint %q", ErrInvalidVersion, field, expr)
+		}
+		if semver.Prerelease(v) != "" {
+			c.prerelease = true
+		}
+		major, minor, patch := versionNumbers(v)
+		switch op {
+		case "~":
+			c.terms = append(c.terms,
+				constraintTerm{">=", v},
+				constraintTerm{"<", "v" + major + "." + incr(minor) + ".0-0"})
+		case "^":
+			upper := "v" + incr(major) + ".0.0-0"
+			if major == "0" {
+				upper = "v0." + incr(minor) + ".0-0"
+				if minor == "0" {
+					upper = "v0.0." + incr(patch) + "-0"
+				}
+			}
+			c.terms = append(c.terms, constraintTerm{">=", v}, constraintTerm{"<", upper})
+		case "":
+			c.terms = append(c.terms, constraintTerm{"=", v})
+		default:
+			c.terms = append(c.terms, constraintTerm{op, v})
+		}
+	}
+	return c, nil
+}
+
+// allows reports whether version v satisfies every term of the constraint.
+func (c *constraint) allows(v string) bool {
+	ver, err := ParseVersion(v)
+	if err != nil || ver.IsPseudo() {
+		return false
+	}
+	if ver.IsPrerelease() && !c.prerelease {
+		return false
+	}
+	for _, t := range c.terms {
+		cmp := semverCompare(v, t.version)
+		var ok bool
+		switch t.op {
+		case "=":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeVersion adds the "v" prefix the module system requires when it
+// is missing.
+func normalizeVersion(v string) string {
+	if v != "" && v[0] >= '0' && v[0] <= '9' {
+		return "v" + v
+	}
+	return v
+}
+
+// incr returns the decimal string n plus one.
+func incr(n string) string {
+	b := []byte(n)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < '9' {
+			b[i]++
+			return string(b)
+		}
+		b[i] = '0'
+	}
+	return "1" + string(b)
+}
+
+// greatestAllowed returns the greatest of versions satisfying allow, or ""
+// if there is none.
+func greatestAllowed(versions []string, allow func(string) bool) string {
+	best := ""
+	for _, v := range versions {
+		if allow(v) && (best == "" || semverCompare(v, best) > 0) {
+			best = v
+		}
+	}
+	return best
+}
@@ -0,0 +1,110 @@
+package autoupgrade
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_constraint_allows(t *testing.T) {
+	tests := []struct {
+		expr    string
+		version string
+		want    bool
+	}{
+		{">=1.2.0, <2.0.0", "v1.2.0", true},
+		{">=1.2.0, <2.0.0", "v1.9.9", true},
+		{">=1.2.0, <2.0.0", "v2.0.0", false},
+		{">1.2.0", "v1.2.0", false},
+		{"<=v1.4.0", "v1.4.0", true},
+		{"!=1.3.0", "v1.3.0", false},
+		{"1.3.0", "v1.3.0", true},
+		{"~1.2.3", "v1.2.9", true},
+		{"~1.2.3", "v1.3.0", false},
+		{"^1.2.3", "v1.9.0", true},
+		{"^1.2.3", "v2.0.0", false},
+		{"^0.2.3", "v0.3.0", false},
+		{">=1.2.0", "v1.3.0-rc.1", false},
+		{">=1.3.0-0", "v1.3.0-rc.1", true},
+		{">=1.0.0", "v1.1.0-0.20240101000000-abcdefabcdef", false},
+	}
+	for _, tt := range tests {
+		c, err := parseConstraint(tt.expr)
+		if err != nil {
+			t.Fatalf("parseConstraint(%q) error = %v", tt.expr, err)
+		}
+		if got := c.allows(tt.version); got != tt.want {
+			t.Errorf("%q allows %q = %v, want %v", tt.expr, tt.version, got, tt.want)
+		}
+	}
+}
+
+func Test_parseConstraint_invalid(t *testing.T) {
+	for _, expr := range []string{"", ">=", ">=1.0.0,", "latest", ">=1.x"} {
+		if _, err := parseConstraint(expr); err == nil {
+			t.Errorf("parseConstraint(%q) succeeded", expr)
+		}
+	}
+}
+
+func Test_resolveTarget_constraint(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("v1.1.0\nv1.2.0\nv1.3.0\nv1.4.0-rc.1\nv2.0.0-beta.1\nv2.0.0\n"))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		expr    string
+		want    string
+		wantErr error
+	}{
+		{">=1.2.0, <2.0.0", "v1.3.0", nil},
+		{">=1.2.0, <=2.0.0", "v2.0.0", nil},
+		{">1.1.0, <1.3.0", "v1.2.0", nil},
+		{"<=1.2.0", "v1.2.0", nil},
+		{"1.2.0", "v1.2.0", nil},
+		{">=1.2.0, <1.4.0", "v1.3.0", nil},
+		{">=1.2.0-0, <1.5.0", "v1.4.0-rc.1", nil},
+		{">=1.2.0, <2.0.0-0", "v1.4.0-rc.1", nil},
+		{">=2.0.0-0, <2.0.0", "v2.0.0-beta.1", nil},
+		{">1.3.0, <2.0.0", "", errNoVersionSatisfiesConstraint},
+		{">=3.0.0", "", errNoVersionSatisfiesConstraint},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			cfg := newConfig([]Option{WithEnv("GOPROXY=" + srv.URL), WithConstraint(tt.expr)})
+			got, _, _, err := resolveTarget(context.Background(), cfg, "example.com/fake", "v1.0.0")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("resolveTarget() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolveTarget() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpgrade_constraint(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.2.0", "v1.3.0", "v2.0.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+
+	res := Upgrade(context.Background(), "", append(m.options(), WithConstraint(">=1.2.0, <2.0.0"))...)
+	if res.ExitError != nil {
+		t.Fatalf("Upgrade() error = %v", res.ExitError)
+	}
+	if res.Decision.Target != "v1.3.0" || res.InstalledPath == "" {
+		t.Errorf("Upgrade() installed %q at %q, want v1.3.0", res.Decision.Target, res.InstalledPath)
+	}
+
+	res = Upgrade(context.Background(), "", append(m.options(), WithConstraint(">=3.0.0"))...)
+	if res.ExitError != nil || res.SkipReason != SkipNoVersionSatisfiesConstraint {
+		t.Errorf("Upgrade() = %q, %v, want %q", res.SkipReason, res.ExitError, SkipNoVersionSatisfiesConstraint)
+	}
+
+	res = Upgrade(context.Background(), "", append(m.options(), WithConstraint(">=1.2.0, <<2"))...)
+	if !errors.Is(res.ExitError, ErrInvalidOption) {
+		t.Errorf("Upgrade() with an invalid constraint error = %v, want ErrInvalidOption", res.ExitError)
+	}
+}
@@ -0,0 +1,25 @@
+package autoupgrade
+
+import "context"
+
+// correlationHeader carries the correlation ID on HTTP requests.
+const correlationHeader = "X-Correlation-ID"
+
+type correlationKey struct{}
+
+// ContextWithCorrelationID returns a copy of ctx carrying id, which Upgrade
+// and the proxy helpers use as the correlation ID unless WithCorrelationID
+// sets one.
+func ContextWithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// correlationID returns the ID set with WithCorrelationID, or else the one
+// carried by ctx.
+func (c *config) correlationID(ctx context.Context) string {
+	if c.correlation != "" {
+		return c.correlation
+	}
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
@@ -0,0 +1,50 @@
+package autoupgrade
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestUpgrade_correlationID(t *testing.T) {
+	fakeBuildInfo(t, "example.com/fake", "v1.0.0")
+	var mu sync.Mutex
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		got = append(got, r.Header.Get("X-Correlation-ID"))
+		mu.Unlock()
+		w.Write([]byte(`{"Version":"v1.0.0"}`))
+	}))
+	defer srv.Close()
+
+	var logs bytes.Buffer
+	opts := []Option{WithEnv("GOPROXY=" + srv.URL), WithLogger(log.New(&logs, "", 0))}
+	res := Upgrade(context.Background(), "", append(opts, WithCorrelationID("trace-1"))...)
+	if res.SkipReason != SkipAlreadyLatest || res.CorrelationID != "trace-1" {
+		t.Fatalf("Upgrade() = %q, CorrelationID %q, want %q and trace-1", res.SkipReason, res.CorrelationID, SkipAlreadyLatest)
+	}
+	if !strings.Contains(logs.String(), "autoupgrade: [trace-1] ") {
+		t.Errorf("log output %q lacks the correlation ID", logs.String())
+	}
+
+	ctx := ContextWithCorrelationID(context.Background(), "trace-2")
+	if res := Upgrade(ctx, "", opts...); res.CorrelationID != "trace-2" {
+		t.Errorf("CorrelationID from context = %q, want trace-2", res.CorrelationID)
+	}
+	if _, err := CheckLatest(ctx, "", opts...); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"trace-1", "trace-2", "trace-2"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("X-Correlation-ID headers = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,89 @@
+package autoupgrade
+
+// Backend names the mechanism that installed, or tried to install, the new
+// binary. The zero value means no install was attempted.
+type Backend string
+
+const (
+	// BackendGoInstall installs with 'go install', from the module proxy or,
+	// with WithLocalModule, from a local checkout.
+	BackendGoInstall Backend = "goinstall"
+	// BackendGitHub downloads a GitHub release asset, as set with
+	// WithGitHubRelease.
+	BackendGitHub Backend = "github"
+	// BackendGoGetTool updates a Go 1.24 tool dependency with
+	// 'go get -tool', as set with WithGoGetTool.
+	BackendGoGetTool Backend = "gogettool"
+)
+
+// Decision records the inputs Upgrade based its choice to skip or install on,
+// for logging a full explanation of an outcome and for testing policy. Fields
+// are filled in as Upgrade gets to them, so those for a later step are zero
+// when an earlier one ended the upgrade.
+type Decision struct {
+	CurrentVersion string // version of the running binary
+	Channel        string // channel selected with WithChannel or inferred from a prerelease, empty for the default
+	Devel          bool   // the running binary is a development build, see WithDevelDetector
+	Rolling        bool   // any build is upgradeable, as with WithRollingChannel
+	TestBinary     bool   // the running binary was built by 'go test'
+	// ToolGoMod is the go.mod file declaring the running binary with a
+	// tool directive when it was started with 'go tool', empty otherwise.
+	ToolGoMod string
+	// Target is the version query resolved for the channel: "latest", or
+	// an explicit version.
+	Target string
+	// Proxy is the URL of the GOPROXY entry that answered the query for
+	// the target, such as "https://proxy.golang.org". It is empty when the
+	// proxy was not asked, as with WithSkipPreCheck or an explicit version.
+	Proxy         string
+	AlreadyLatest bool     // the running binary is already at Target
+	Rejected      []string // versions refused by WithVersionFilter, in the order checked
+	InstallPath   string   // file go install writes
+	Writable      bool     // whether the directory of InstallPath is writable
+	Elevated      bool     // go install ran under WithPrivilegeElevation
+	// With WithToolchainCompatibleOnly, PreferredTarget is the version
+	// passed over because its go.mod requires Go PreferredGoVersion, newer
+	// than the local toolchain at LocalGoVersion. All three are empty when
+	// the preferred version was installable.
+	PreferredTarget    string
+	PreferredGoVersion string
+	LocalGoVersion     string
+	// Blocked is the newest available version a policy kept Upgrade from
+	// selecting, and BlockedBy the policy, whether or not an older version
+	// was installed instead. Both are empty when nothing was blocked.
+	Blocked   string
+	BlockedBy Policy
+}
+
+// Policy names a rule that can keep Upgrade from selecting a version.
+type Policy string
+
+const (
+	PolicyDowngrade     Policy = "downgrade"       // the version is older than the current one
+	PolicyVersionFilter Policy = "version-filter"  // rejected by WithVersionFilter
+	PolicyMaxVersion    Policy = "max-version"     // above the WithMaxVersion ceiling
+	PolicyToolchain     Policy = "toolchain"       // needs a newer go, with WithToolchainCompatibleOnly
+	PolicyPseudoVersion Policy = "pseudo-version"  // refused by WithPseudoVersionPolicy
+	PolicyMinReleaseAge Policy = "min-release-age" // published too recently for WithMinReleaseAge
+)
+
+// block records on d that a policy refused version, keeping only the newest
+// such version.
+func (d *Decision) block(version string, policy Policy) {
+	if d.Blocked == "" || semverCompare(version, d.Blocked) > 0 {
+		d.Blocked, d.BlockedBy = version, policy
+	}
+}
+
+// logOutcome logs how Upgrade ended, for WithLogger and WithVerbosity.
+func (c *config) logOutcome(res *UpgradeResult) {
+	switch {
+	case c.logger == nil:
+	case res.ExitError != nil:
+		c.logf("upgrade failed: %v", res.ExitError)
+	case res.SkipReason != "":
+		c.logf("upgrade skipped: %s", res.SkipReason)
+	case res.InstalledPath != "":
+		c.logf("installed %s", res.InstalledPath)
+	}
+}
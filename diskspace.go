@@ -0,0 +1,53 @@
+package autoupgrade
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// checkDiskSpace verifies that the filesystems go install writes to, holding
+// the module cache, the build cache and the install directory dst, each have
+// at least minBytes available. Directories that do not exist yet are checked
+// at their nearest existing parent. Platforms that cannot report free space
+// are not checked.
+func checkDiskSpace(cfg *config, dst string, minBytes int64) error {
+	modCache, err := modCacheDir(cfg)
+	if err != nil {
+		return err
+	}
+	dirs := []string{dst, modCache}
+	if dir := buildCacheDir(cfg); dir != "" {
+		dirs = append(dirs, dir)
+	}
+
+	for _, dir := range dirs {
+		dir = existingParent(dir)
+		free, err := freeSpace(dir)
+		if errors.Is(err, errors.ErrUnsupported) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("autoupgrade: checking free space in %s: %w", dir, err)
+		}
+		if free < minBytes {
+			return fmt.Errorf("%w: %s has %d bytes available, need %d", ErrInsufficientDiskSpace, dir, free, minBytes)
+		}
+	}
+	return nil
+}
+
+// existingParent returns path, or its nearest ancestor that exists.
+func existingParent(path string) string {
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
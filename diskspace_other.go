@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd || dragonfly || windows)
+
+package autoupgrade
+
+import "errors"
+
+// freeSpace is not implemented on this platform.
+func freeSpace(dir string) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,31 @@
+package autoupgrade
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func Test_checkDiskSpace(t *testing.T) {
+	dir := t.TempDir()
+	cfg := newConfig([]Option{WithEnv("GOPATH="+dir, "GOMODCACHE=", "GOCACHE=off")})
+	dst := filepath.Join(dir, "bin", "tool")
+	if _, err := freeSpace(dir); errors.Is(err, errors.ErrUnsupported) {
+		t.Skip("free space not available on this platform")
+	}
+
+	if err := checkDiskSpace(cfg, dst, 1); err != nil {
+		t.Errorf("checkDiskSpace(1) error = %v", err)
+	}
+	if err := checkDiskSpace(cfg, dst, math.MaxInt64); !errors.Is(err, ErrInsufficientDiskSpace) {
+		t.Errorf("checkDiskSpace(MaxInt64) error = %v, want %v", err, ErrInsufficientDiskSpace)
+	}
+}
+
+func Test_existingParent(t *testing.T) {
+	dir := t.TempDir()
+	if got := existingParent(filepath.Join(dir, "a", "b")); got != dir {
+		t.Errorf("existingParent() = %q, want %q", got, dir)
+	}
+}
@@ -0,0 +1,49 @@
+package autoupgrade
+
+import (
+	"bytes"
+	"strings"
+)
+
+// parseDownloads returns the modules the go command reported fetching in
+// stderr, as "path@version", in the order reported. It looks only for lines
+// of the form "go: downloading <path> <version>" and ignores everything else,
+// so a change in the go command's output loses the list rather than failing
+// the upgrade.
+func parseDownloads(stderr []byte) []string {
+	var mods []string
+	for _, line := range bytes.Split(stderr, []byte("\n")) {
+		rest, ok := strings.CutPrefix(strings.TrimSpace(string(line)), "go: downloading ")
+		if !ok {
+			continue
+		}
+		f := strings.Fields(rest)
+		if len(f) != 2 || !semverValid(f[1]) {
+			continue
+		}
+		mods = append(mods, f[0]+"@"+f[1])
+	}
+	return mods
+}
+
+// parseToolchainDownload returns the Go toolchain, such as "go1.22.1", the go
+// command reported fetching in stderr with a "go: downloading go1.22.1
+// (linux/amd64)" line when GOTOOLCHAIN selected a release that was not yet
+// in the module cache, or "" if it did not download one.
+func parseToolchainDownload(stderr []byte) string {
+	for _, line := range bytes.Split(stderr, []byte("\n")) {
+		rest, ok := strings.CutPrefix(strings.TrimSpace(string(line)), "go: downloading ")
+		if !ok {
+			continue
+		}
+		f := strings.Fields(rest)
+		if len(f) == 0 || len(f) > 2 || !strings.HasPrefix(f[0], "go1") {
+			continue
+		}
+		if len(f) == 2 && !(strings.HasPrefix(f[1], "(") && strings.HasSuffix(f[1], ")")) {
+			continue
+		}
+		return f[0]
+	}
+	return ""
+}
@@ -0,0 +1,87 @@
+package autoupgrade
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+func Test_parseDownloads(t *testing.T) {
+	stderr := []byte(`go: downloading example.com/tool v1.2.0
+go: downloading golang.org/x/sys v0.20.0
+  go: downloading example.com/indented v1.0.0
+go: finding module for package example.com/x
+go: downloading example.com/odd
+go: downloading example.com/bad not-a-version
+go: example.com/tool@v1.2.0: missing go.sum entry
+`)
+	want := []string{"example.com/tool@v1.2.0", "golang.org/x/sys@v0.20.0", "example.com/indented@v1.0.0"}
+	if got := parseDownloads(stderr); !slices.Equal(got, want) {
+		t.Errorf("parseDownloads() = %q, want %q", got, want)
+	}
+	if got := parseDownloads(nil); got != nil {
+		t.Errorf("parseDownloads(nil) = %q, want nil", got)
+	}
+}
+
+func TestUpgrade_trackDownloads(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+
+	res := Upgrade(context.Background(), "", append(m.options(), WithTrackDownloads(true))...)
+	if res.ExitError != nil {
+		t.Fatalf("Upgrade() error = %v", res.ExitError)
+	}
+	if want := []string{"example.com/fake@v1.1.0"}; !slices.Equal(res.Downloaded, want) {
+		t.Errorf("Downloaded = %q, want %q", res.Downloaded, want)
+	}
+}
+
+func Test_parseToolchainDownload(t *testing.T) {
+	tests := []struct {
+		stderr string
+		want   string
+	}{
+		{"go: downloading go1.22.1 (linux/amd64)\ngo: downloading example.com/tool v1.2.0\n", "go1.22.1"},
+		{"go: downloading example.com/tool v1.2.0\ngo: downloading go1.23rc1 (darwin/arm64)\n", "go1.23rc1"},
+		{"go: downloading go1.22.1\n", "go1.22.1"},
+		{"go: downloading golang.org/toolchain v0.0.1-go1.22.1.linux-amd64\n", ""},
+		{"go: downloading go1.22.1 extra (linux/amd64)\n", ""},
+		{"go: example.com/tool@v1.2.0 requires go >= 1.22.1; switching to go1.22.1\n", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := parseToolchainDownload([]byte(tt.stderr)); got != tt.want {
+			t.Errorf("parseToolchainDownload(%q) = %q, want %q", tt.stderr, got, tt.want)
+		}
+	}
+}
+
+func TestUpgrade_toolchainDownloaded(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script shim not supported on windows")
+	}
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+	shim := filepath.Join(t.TempDir(), "go")
+	script := "#!/bin/sh\necho 'go: downloading go1.99.0 (linux/amd64)' >&2\necho shim > \"$GOBIN/fake\"\n"
+	if err := os.WriteFile(shim, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	res := Upgrade(context.Background(), "", append(m.options(), WithGoBinary(shim), WithVerifyModulePath(false))...)
+	if res.ExitError != nil {
+		t.Fatalf("Upgrade() error = %v", res.ExitError)
+	}
+	if !res.ToolchainDownloaded || res.DownloadedToolchain != "go1.99.0" {
+		t.Errorf("ToolchainDownloaded, DownloadedToolchain = %v, %q, want true, go1.99.0", res.ToolchainDownloaded, res.DownloadedToolchain)
+	}
+
+	res = Upgrade(context.Background(), "", m.options()...)
+	if res.ToolchainDownloaded || res.DownloadedToolchain != "" {
+		t.Errorf("ToolchainDownloaded, DownloadedToolchain = %v, %q without a download", res.ToolchainDownloaded, res.DownloadedToolchain)
+	}
+}
@@ -0,0 +1,175 @@
+package autoupgrade
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNoBuildInfo is returned when build information is not available for
+	// the running process or the newly installed binary.
+	ErrNoBuildInfo = errors.New("autoupgrade: build info not available")
+
+	// ErrNoProxy is returned by the proxy helpers when GOPROXY lists no
+	// module proxy they can query, such as when it is set to "direct".
+	ErrNoProxy = errors.New("autoupgrade: no module proxy configured")
+
+	// ErrProxyDisabled is returned by the proxy helpers when module lookups
+	// are disabled with GOPROXY=off.
+	ErrProxyDisabled = errors.New("autoupgrade: module lookup disabled by GOPROXY=off")
+
+	// ErrToolchainDownloadBlocked is returned when go install fails because
+	// the Go toolchain required by the new version could not be downloaded,
+	// typically because GOTOOLCHAIN auto-download is blocked by a firewall
+	// or proxy. Installing the required Go version locally, or allowing
+	// access to golang.org/toolchain through GOPROXY, resolves it.
+	ErrToolchainDownloadBlocked = errors.New("autoupgrade: go toolchain download blocked")
+
+	// ErrNotMainPackage is returned when go install fails because the package
+	// is not a main package, usually because packagePath points at the
+	// library root rather than a command such as "cmd/tool".
+	ErrNotMainPackage = errors.New("autoupgrade: not a main package; packagePath must name a command")
+
+	// ErrAuthFailed is returned when go install fails because credentials for
+	// the proxy or VCS host are missing or rejected.
+	ErrAuthFailed = errors.New("autoupgrade: authentication failed")
+
+	// ErrNotFound is returned when go install fails because the module or
+	// version does not exist.
+	ErrNotFound = errors.New("autoupgrade: module or version not found")
+
+	// ErrNoReleases is returned when go install fails because the module
+	// path has no version matching the query, such as a module with no
+	// releases left at that path. It wraps ErrNotFound.
+	ErrNoReleases = fmt.Errorf("%w: no matching versions", ErrNotFound)
+
+	// ErrModuleMoved is matched by a *ModuleMovedError, returned when the
+	// module has moved to a new path that could be discovered.
+	ErrModuleMoved = errors.New("autoupgrade: module moved")
+
+	// ErrProxyUnavailable is returned when go install fails because the
+	// module proxy returned a server error.
+	ErrProxyUnavailable = errors.New("autoupgrade: module proxy unavailable")
+
+	// ErrNetwork is returned when go install fails because the proxy or VCS
+	// host could not be reached.
+	ErrNetwork = errors.New("autoupgrade: network error")
+
+	// ErrUnsupportedPlatform is returned when the platform given to
+	// WithTargetPlatform is not supported by the go toolchain.
+	ErrUnsupportedPlatform = errors.New("autoupgrade: unsupported target platform")
+
+	// ErrUnknownChannel is returned when the channel selected with
+	// WithChannel is not defined in the channel config.
+	ErrUnknownChannel = errors.New("autoupgrade: unknown channel")
+
+	// ErrNoMatchingVersion is returned when no available version satisfies
+	// the selected channel's constraint.
+	ErrNoMatchingVersion = errors.New("autoupgrade: no version matches constraint")
+
+	// ErrModulePathMismatch is returned when the installed binary was built
+	// from a different module than the one being upgraded. The previous
+	// binary is restored.
+	ErrModulePathMismatch = errors.New("autoupgrade: installed binary has unexpected module path")
+
+	// ErrNoMatchingAsset is returned when the GitHub release has no asset for
+	// the target platform.
+	ErrNoMatchingAsset = errors.New("autoupgrade: no release asset")
+
+	// ErrNoBinaryInArchive is returned when a release asset is an archive
+	// that contains neither the binary by name nor a single executable.
+	ErrNoBinaryInArchive = errors.New("autoupgrade: archive does not contain binary")
+
+	// ErrVerifyFailed is returned when the new binary fails the command set
+	// with WithVerifyCommand. The previous binary is restored.
+	ErrVerifyFailed = errors.New("autoupgrade: new binary failed verification")
+
+	// ErrHashMismatch is returned when the module hash of the installed
+	// version does not match the one given with WithExpectedHash, or none
+	// was given for it. The previous binary is restored.
+	ErrHashMismatch = errors.New("autoupgrade: module hash mismatch")
+
+	// ErrDirNotWritable is returned when a directory the install needs to
+	// write to, such as a cache set with WithModCache, is not writable.
+	ErrDirNotWritable = errors.New("autoupgrade: directory not writable")
+
+	// ErrBinaryLocked is returned on Windows when the binary being replaced
+	// is running or held open by another process, as Windows does not allow
+	// it to be overwritten in place. WithVersionedName installs the new
+	// version next to it instead, to be picked up on the next launch.
+	ErrBinaryLocked = errors.New("autoupgrade: binary is running or locked; use WithVersionedName to install beside it")
+
+	// ErrResolverUnreachable is returned by HTTPVersionResolver when its URL
+	// cannot be fetched or answers with a status other than 200.
+	ErrResolverUnreachable = errors.New("autoupgrade: version resolver unreachable")
+
+	// ErrResolverMalformed is returned by HTTPVersionResolver when the
+	// response is not a version string or {"version": "..."} object.
+	ErrResolverMalformed = errors.New("autoupgrade: malformed version resolver response")
+
+	// ErrInvalidVersionFile is returned when the file set with
+	// WithVersionFile cannot be read or does not hold a single version.
+	ErrInvalidVersionFile = errors.New("autoupgrade: invalid version file")
+
+	// ErrNothingToRestart is returned by Restart when the result did not
+	// install a binary.
+	ErrNothingToRestart = errors.New("autoupgrade: nothing installed to restart")
+
+	// ErrRestartStaged is returned by Restart when the result staged the
+	// binary with WithReplaceRunning(false) and Activate has not moved it
+	// into place.
+	ErrRestartStaged = errors.New("autoupgrade: binary is staged, not activated")
+
+	// ErrNotStatic is returned when WithRequireStatic is set and the new
+	// binary links shared libraries; the previous binary is restored.
+	ErrNotStatic = errors.New("autoupgrade: binary is not statically linked")
+
+	// ErrNotStaged is returned by UpgradeResult.Activate when the upgrade did
+	// not stage a binary with WithReplaceRunning(false).
+	ErrNotStaged = errors.New("autoupgrade: no staged binary to activate")
+
+	// ErrVCSDisallowed is returned when go install needed a version control
+	// tool that GOVCS does not allow for the module; see WithVCSAllow.
+	ErrVCSDisallowed = errors.New("autoupgrade: version control tool disallowed by GOVCS")
+
+	// ErrInsufficientDiskSpace is returned by WithDiskSpaceCheck when a
+	// filesystem go install writes to is short of space.
+	ErrInsufficientDiskSpace = errors.New("autoupgrade: insufficient disk space")
+
+	// ErrGoNotFound is returned when the go command selected with
+	// WithGoVersion is not installed, or WithGoLocator finds none.
+	ErrGoNotFound = errors.New("autoupgrade: go command not found")
+
+	// ErrInvalidModulePath is returned when a module path given to an
+	// option, such as WithFallbackModulePaths, is empty or carries a version
+	// query like "@v1", or when a module path cannot be escaped for a module
+	// proxy request.
+	ErrInvalidModulePath = errors.New("autoupgrade: invalid module path")
+
+	// ErrInvalidPackagePath is returned when the packagePath given to
+	// Upgrade or ResolveInstallPath is not a path relative to the module
+	// root, such as an absolute path, one with ".." or one with an
+	// "@version" suffix. The wrapping error says what was wrong.
+	ErrInvalidPackagePath = errors.New("autoupgrade: invalid package path")
+
+	// ErrInvalidOption is returned when an option is given an invalid value.
+	ErrInvalidOption = errors.New("autoupgrade: invalid option")
+
+	// ErrVersionNotListed is returned by VersionsBehind when the current
+	// version is not a stable release known to the module proxy, such as a
+	// pseudo-version.
+	ErrVersionNotListed = errors.New("autoupgrade: current version not listed by proxy")
+
+	// ErrRateLimited is returned when a module proxy still responds with 429
+	// Too Many Requests after the retries its Retry-After header asked for.
+	ErrRateLimited = errors.New("autoupgrade: rate limited by module proxy")
+
+	// ErrInvalidVersion is returned when a version string is not a valid
+	// semantic version.
+	ErrInvalidVersion = errors.New("autoupgrade: invalid version")
+
+	// ErrExecutablePathUnresolvable is returned when the path of the running
+	// binary cannot be determined reliably, such as when os.Executable fails
+	// or names a file that no longer exists.
+	ErrExecutablePathUnresolvable = errors.New("autoupgrade: cannot determine path of running executable")
+)
@@ -0,0 +1,66 @@
+package autoupgrade
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// upgradeVars are the counters published for a WithExpvar prefix.
+type upgradeVars struct {
+	attempts  expvar.Int
+	successes expvar.Int
+	failures  expvar.Int
+	skips     expvar.Map // by SkipReason
+	lastCheck expvar.String
+}
+
+var (
+	expvarMu   sync.Mutex
+	expvarSets = make(map[string]*upgradeVars)
+)
+
+// publishedVars returns the counters published under name, publishing them on
+// first use. expvar panics on duplicate names, so each name is published
+// once per process however many upgrades use it.
+func publishedVars(name string) (*upgradeVars, error) {
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+	if v, ok := expvarSets[name]; ok {
+		return v, nil
+	}
+	if expvar.Get(name) != nil {
+		return nil, fmt.Errorf("autoupgrade: expvar %q is already published by another package", name)
+	}
+	v := &upgradeVars{}
+	m := new(expvar.Map)
+	m.Set("attempts", &v.attempts)
+	m.Set("successes", &v.successes)
+	m.Set("failures", &v.failures)
+	m.Set("skips", &v.skips)
+	m.Set("last_check", &v.lastCheck)
+	expvar.Publish(name, m)
+	expvarSets[name] = v
+	return v, nil
+}
+
+// recordExpvar counts the outcome of res in the counters set with
+// WithExpvar.
+func (c *config) recordExpvar(res *UpgradeResult) {
+	v, err := publishedVars(c.expvarName)
+	if err != nil {
+		c.logf("%v", err)
+		return
+	}
+	v.attempts.Add(1)
+	switch {
+	case res.ExitError != nil:
+		v.failures.Add(1)
+	case res.SkipReason != "":
+		v.skips.Add(string(res.SkipReason), 1)
+	case res.InstalledPath != "":
+		v.successes.Add(1)
+	}
+	v.lastCheck.Set(time.Now().UTC().Format(time.RFC3339))
+}
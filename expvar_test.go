@@ -0,0 +1,50 @@
+package autoupgrade
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"testing"
+)
+
+func TestWithExpvar(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+	opts := append(m.options(), WithExpvar("autoupgrade_test"))
+	type counters struct {
+		Attempts, Successes, Failures int
+		Skips                         map[string]int
+		LastCheck                     string `json:"last_check"`
+	}
+	read := func() (c counters) {
+		if v := expvar.Get("autoupgrade_test"); v != nil {
+			if err := json.Unmarshal([]byte(v.String()), &c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return c
+	}
+	// The counters are process-wide, so compare with what earlier runs left.
+	before := read()
+
+	if res := Upgrade(context.Background(), "", opts...); res.InstalledPath == "" {
+		t.Fatalf("Upgrade() = %v, %q, want installed", res.ExitError, res.SkipReason)
+	}
+	fakeBuildInfo(t, m.path, "v1.1.0")
+	Upgrade(context.Background(), "", opts...)
+	Upgrade(context.Background(), "", append(opts, WithParallelism(-1))...)
+
+	got := read()
+	if got.Attempts-before.Attempts != 3 || got.Successes-before.Successes != 1 || got.Failures-before.Failures != 1 ||
+		got.Skips[string(SkipAlreadyLatest)]-before.Skips[string(SkipAlreadyLatest)] != 1 || got.LastCheck == "" {
+		t.Errorf("expvar = %+v after %+v, want 3 more attempts, 1 success, 1 failure, 1 %s skip", got, before, SkipAlreadyLatest)
+	}
+
+	if expvar.Get("autoupgrade_taken") == nil {
+		expvar.NewInt("autoupgrade_taken")
+	}
+	res := Upgrade(context.Background(), "", append(m.options(), WithExpvar("autoupgrade_taken"))...)
+	if res.ExitError != nil {
+		t.Errorf("Upgrade() with a taken expvar name error = %v", res.ExitError)
+	}
+}
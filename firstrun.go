@@ -0,0 +1,38 @@
+package autoupgrade
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// JustUpgraded reports whether this is the first run of the binary since it
+// was upgraded, for showing release notes once. It compares the running
+// version with the one stored in the file at path by the previous call,
+// returning that version as from, and then stores the running version. The
+// first run ever, with no stored version, is not reported as an upgrade, and
+// neither is a return to an older version.
+func JustUpgraded(path string) (upgraded bool, from string, err error) {
+	info, ok := CurrentBuildInfo()
+	if !ok {
+		return false, "", ErrNoBuildInfo
+	}
+	current := info.Main.Version
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, "", fmt.Errorf("autoupgrade: reading last seen version: %w", err)
+	}
+	from = string(bytes.TrimSpace(data))
+	if from == current {
+		return false, from, nil
+	}
+	if err := writeFileAtomic(path, []byte(current+"\n")); err != nil {
+		return false, from, fmt.Errorf("autoupgrade: saving last seen version: %w", err)
+	}
+	if from == "" || semverValid(from) && semverValid(current) && semverCompare(current, from) < 0 {
+		return false, from, nil
+	}
+	return true, from, nil
+}
@@ -0,0 +1,32 @@
+package autoupgrade
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestJustUpgraded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "last-version")
+	steps := []struct {
+		version  string
+		upgraded bool
+		from     string
+	}{
+		{"v1.0.0", false, ""},
+		{"v1.0.0", false, "v1.0.0"},
+		{"v1.1.0", true, "v1.0.0"},
+		{"v1.1.0", false, "v1.1.0"},
+		{"v1.0.5", false, "v1.1.0"},
+		{"v1.1.0", true, "v1.0.5"},
+	}
+	for _, s := range steps {
+		fakeBuildInfo(t, "example.com/fake", s.version)
+		upgraded, from, err := JustUpgraded(path)
+		if err != nil {
+			t.Fatalf("JustUpgraded() at %s error = %v", s.version, err)
+		}
+		if upgraded != s.upgraded || from != s.from {
+			t.Errorf("JustUpgraded() at %s = %v, %q, want %v, %q", s.version, upgraded, from, s.upgraded, s.from)
+		}
+	}
+}
@@ -0,0 +1,389 @@
+package autoupgrade
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// defaultGitHubAPI is the GitHub REST API root.
+const defaultGitHubAPI = "https://api.github.com"
+
+// githubRepo identifies the repository whose releases are installed.
+type githubRepo struct {
+	owner, repo string
+}
+
+// ReleaseAsset is a file attached to a GitHub release.
+type ReleaseAsset struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	URL         string `json:"browser_download_url"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+}
+
+type githubRelease struct {
+	TagName string         `json:"tag_name"`
+	Assets  []ReleaseAsset `json:"assets"`
+}
+
+// latestRelease fetches the latest published release of the configured
+// repository.
+func latestRelease(ctx context.Context, cfg *config) (*githubRelease, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/releases/latest", cfg.githubAPI, cfg.github.owner, cfg.github.repo)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if cfg.userAgent != "" {
+		req.Header.Set("User-Agent", cfg.userAgent)
+	}
+	setGitHubAuth(cfg, req)
+	resp, err := send(cfg, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &ProxyError{URL: url, StatusCode: resp.StatusCode}
+	}
+	var rel githubRelease
+	if err := json.NewDecoder(resp.Body).Decode(&rel); err != nil {
+		return nil, fmt.Errorf("autoupgrade: decoding release: %w", err)
+	}
+	return &rel, nil
+}
+
+// setGitHubAuth adds the WithGitHubToken token to req if it is addressed to
+// the GitHub API host or, for asset downloads, the site it serves: github.com
+// for api.github.com, or the same host for GitHub Enterprise. The token is
+// not sent to other hosts an asset URL may point at.
+func setGitHubAuth(cfg *config, req *http.Request) {
+	if cfg.githubToken == "" {
+		return
+	}
+	api, err := url.Parse(cfg.githubAPI)
+	if err != nil {
+		return
+	}
+	if host := req.URL.Host; host == api.Host || "api."+host == api.Host {
+		req.Header.Set("Authorization", "Bearer "+cfg.githubToken)
+	}
+}
+
+// GitHubLatestRelease reports the tag of the latest published release of
+// owner/repo and the asset WithGitHubRelease would install from it for the
+// target platform, without downloading anything, for notify-only flows; it
+// is the GitHub counterpart of CheckLatest. opts configure the request, such
+// as WithGitHubAPI, WithGitHubToken, WithAssetSelector, WithTargetPlatform
+// and WithHTTPClient.
+func GitHubLatestRelease(ctx context.Context, owner, repo string, opts ...Option) (tag string, asset ReleaseAsset, err error) {
+	cfg := newConfig(append(opts, WithGitHubRelease(owner, repo)))
+	rel, err := latestRelease(ctx, cfg)
+	if err != nil {
+		return "", ReleaseAsset{}, err
+	}
+	asset, err = cfg.selectAsset(rel.Assets)
+	if err != nil {
+		return rel.TagName, ReleaseAsset{}, err
+	}
+	return rel.TagName, asset, nil
+}
+
+// selectAsset picks the asset to install from assets with the WithAssetSelector
+// function, defaulting to DefaultAssetSelector.
+func (c *config) selectAsset(assets []ReleaseAsset) (ReleaseAsset, error) {
+	sel := c.assetSelector
+	if sel == nil {
+		sel = DefaultAssetSelector
+	}
+	return sel(assets, c.targetOS(), c.targetArch())
+}
+
+// DefaultAssetSelector picks the release asset built for goos and goarch,
+// matching the platform names and their common aliases, such as "x86_64" and
+// "macos", against whole words of the asset name as separated by "-", "_"
+// and ".", so that "arm" does not match "arm64". Checksum, signature and
+// certificate files, such as "checksums.txt" or "tool_linux_amd64.sha256",
+// are never picked. It is used unless WithAssetSelector is set, and can be
+// called from a custom selector as a fallback.
+func DefaultAssetSelector(assets []ReleaseAsset, goos, goarch string) (ReleaseAsset, error) {
+	aliases := map[string][]string{
+		"darwin": {"darwin", "macos"},
+		"amd64":  {"amd64", "x86_64"},
+		"arm64":  {"arm64", "aarch64"},
+		"386":    {"386", "i386"},
+	}
+	matches := func(words []string, v string) bool {
+		names, ok := aliases[v]
+		if !ok {
+			names = []string{v}
+		}
+		for _, n := range names {
+			if containsWords(words, assetWords(n)) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, a := range assets {
+		name := strings.ToLower(a.Name)
+		if isChecksumAsset(name) {
+			continue
+		}
+		words := assetWords(name)
+		if matches(words, goos) && matches(words, goarch) {
+			return a, nil
+		}
+	}
+	return ReleaseAsset{}, fmt.Errorf("%w for %s/%s", ErrNoMatchingAsset, goos, goarch)
+}
+
+// assetWords splits an asset name into the words separated by "-", "_" and
+// ".".
+func assetWords(name string) []string {
+	return strings.FieldsFunc(name, func(r rune) bool {
+		return r == '-' || r == '_' || r == '.'
+	})
+}
+
+// containsWords reports whether sub appears as consecutive words in words,
+// so that an alias such as "x86_64" matches as a whole.
+func containsWords(words, sub []string) bool {
+	for i := 0; i+len(sub) <= len(words); i++ {
+		if slices.Equal(words[i:i+len(sub)], sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// isChecksumAsset reports whether the lower-cased asset name is a checksum,
+// signature or certificate file published next to the binaries.
+func isChecksumAsset(name string) bool {
+	if strings.HasPrefix(name, "checksums") {
+		return true
+	}
+	for _, ext := range []string{".sha256", ".sha512", ".sig", ".asc", ".pem"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// installRelease replaces the binary at the executable path with the asset of
+// the latest GitHub release for the target platform.
+func installRelease(ctx context.Context, cfg *config, res *UpgradeResult, modulePath string) {
+	rel, err := latestRelease(ctx, cfg)
+	if err != nil {
+		res.ExitError = err
+		return
+	}
+	res.Decision.Target = rel.TagName
+	if normalizeVersion(rel.TagName) == res.CurrentInfo.Main.Version {
+		skipAlreadyLatest(cfg, res)
+		return
+	}
+	if res.SkipReason, err = checkRelease(cfg, res, rel.TagName); res.SkipReason != "" || err != nil {
+		res.ExitError = err
+		return
+	}
+	asset, err := cfg.selectAsset(rel.Assets)
+	if err != nil {
+		res.ExitError = err
+		return
+	}
+	dst := cfg.execPath
+	if dst == "" {
+		if dst, err = executablePath(); err != nil {
+			res.ExitError = err
+			return
+		}
+	}
+
+	if err := cfg.runPreUpgrade(res, rel.TagName); err != nil {
+		res.ExitError = err
+		return
+	}
+
+	cfg.mutex.Lock()
+	defer cfg.mutex.Unlock()
+
+	res.Backend = BackendGitHub
+	res.ReleaseTag, res.ReleaseAsset = rel.TagName, asset.Name
+	endInstall := res.phase("install")
+	tmp, err := download(ctx, cfg, asset, filepath.Dir(dst))
+	endInstall()
+	if err != nil {
+		res.ExitError = err
+		return
+	}
+	defer os.Remove(tmp)
+	kind, err := detectArchive(tmp, asset.Name)
+	if err != nil {
+		res.ExitError = err
+		return
+	}
+	if kind != notArchive {
+		bin, err := extractBinary(tmp, kind, filepath.Base(dst), filepath.Dir(dst))
+		if err != nil {
+			res.ExitError = err
+			return
+		}
+		defer os.Remove(bin)
+		tmp = bin
+	}
+	if err := verifyInstalled(ctx, cfg, res, tmp, modulePath); err != nil {
+		res.ExitError = err
+		return
+	}
+	target := dst
+	if cfg.keepRunning {
+		target = stagedPath(dst)
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		if binaryLocked(target) {
+			err = fmt.Errorf("%w: %w", ErrBinaryLocked, err)
+		}
+		res.ExitError = err
+		return
+	}
+	if cfg.keepRunning {
+		res.StagedFor, dst = dst, target
+	}
+	res.installedVersion = rel.TagName
+	res.setInstalled(dst)
+}
+
+// checkRelease applies to the latest release tag the policies resolveTarget
+// applies to proxy versions: the downgrade guard, unless WithAllowDowngrade
+// is set, WithConstraint, WithMaxVersion and WithVersionFilter. It returns
+// why the release is not installed, or "" if it may be. Only the latest
+// release is considered, so a rejected one is skipped rather than replaced
+// by an older release.
+func checkRelease(cfg *config, res *UpgradeResult, tag string) (SkipReason, error) {
+	v, current := normalizeVersion(tag), res.CurrentInfo.Main.Version
+	d := &res.Decision
+	if !semverValid(v) {
+		if cfg.constraint != "" || cfg.maxVersion != "" {
+			return "", fmt.Errorf("%w: release tag %q cannot be checked against the version policy", ErrInvalidVersion, tag)
+		}
+		if cfg.versionFilter != nil && !cfg.versionFilter(tag) {
+			d.Rejected = append(d.Rejected, tag)
+			return SkipNoAcceptableVersion, nil
+		}
+		return "", nil
+	}
+	if semverValid(current) && semverCompare(v, current) < 0 && !cfg.allowDowngrade {
+		d.block(v, PolicyDowngrade)
+		return SkipBlockedByPolicy, nil
+	}
+	if cfg.constraint != "" {
+		c, err := parseConstraint(cfg.constraint)
+		if err != nil {
+			return "", err
+		}
+		if !c.allows(v) {
+			return SkipNoVersionSatisfiesConstraint, nil
+		}
+	}
+	if cfg.maxVersion != "" && semverCompare(v, cfg.maxVersion) > 0 {
+		d.block(v, PolicyMaxVersion)
+		return SkipCeilingReached, nil
+	}
+	if cfg.versionFilter != nil && !cfg.versionFilter(v) {
+		d.Rejected = append(d.Rejected, v)
+		d.block(v, PolicyVersionFilter)
+		return SkipNoAcceptableVersion, nil
+	}
+	return "", nil
+}
+
+// download fetches asset into a temporary executable file in dir and returns
+// its path. With WithGitHubToken it is fetched through the API's asset
+// endpoint, as browser_download_url does not accept the token for private
+// repositories.
+func download(ctx context.Context, cfg *config, asset ReleaseAsset, dir string) (string, error) {
+	src := asset.URL
+	if cfg.githubToken != "" && asset.ID != 0 {
+		src = fmt.Sprintf("%s/repos/%s/%s/releases/assets/%d", cfg.githubAPI, cfg.github.owner, cfg.github.repo, asset.ID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/octet-stream")
+	if cfg.userAgent != "" {
+		req.Header.Set("User-Agent", cfg.userAgent)
+	}
+	setGitHubAuth(cfg, req)
+	resp, err := send(cfg, req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", &ProxyError{URL: src, StatusCode: resp.StatusCode}
+	}
+
+	f, err := os.CreateTemp(dir, ".autoupgrade-download-*")
+	if err != nil {
+		return "", err
+	}
+	var body io.Reader = resp.Body
+	if cfg.downloadProgress != nil {
+		body = &progressReader{r: resp.Body, total: resp.ContentLength, fn: cfg.downloadProgress}
+	}
+	_, err = io.Copy(f, body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0o755)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("autoupgrade: downloading %s: %w", asset.Name, err)
+	}
+	return f.Name(), nil
+}
+
+// progressInterval is the minimum time between progress reports.
+const progressInterval = 100 * time.Millisecond
+
+// progressReader reports the bytes read through it at most every
+// progressInterval, and once more when the body is exhausted.
+type progressReader struct {
+	r     io.Reader
+	n     int64
+	total int64
+	last  time.Time
+	done  bool
+	fn    func(downloaded, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.n += int64(n)
+	if err == io.EOF {
+		if !p.done {
+			p.done = true
+			p.fn(p.n, p.total)
+		}
+	} else if now := time.Now(); now.Sub(p.last) >= progressInterval {
+		p.last = now
+		p.fn(p.n, p.total)
+	}
+	return n, err
+}
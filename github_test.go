@@ -0,0 +1,356 @@
+package autoupgrade
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+// newFakeGitHub serves a latest release of owner/repo tagged tag, with an
+// asset for the host platform containing the given binary.
+func newFakeGitHub(t *testing.T, tag string, binary []byte) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/owner/repo/releases/latest":
+			json.NewEncoder(w).Encode(githubRelease{
+				TagName: tag,
+				Assets: []ReleaseAsset{
+					{Name: "tool_plan9_mips", URL: srv.URL + "/download/other"},
+					{Name: "tool_" + runtime.GOOS + "_" + runtime.GOARCH, URL: srv.URL + "/download/tool", Size: int64(len(binary))},
+				},
+			})
+		case "/download/tool":
+			w.Header().Set("Content-Length", strconv.Itoa(len(binary)))
+			w.Write(binary)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestUpgrade_gitHubRelease(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	binary, err := os.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newFakeGitHub(t, "v1.1.0", binary)
+	fakeBuildInfo(t, "github.com/melt-inc/autoupgrade", "v1.0.0")
+	dst := filepath.Join(t.TempDir(), "tool")
+	writeFile(t, dst, []byte("old"))
+
+	var calls int
+	var last [2]int64
+	res := Upgrade(context.Background(), "",
+		WithGitHubRelease("owner", "repo"),
+		WithGitHubAPI(srv.URL),
+		WithExecutablePath(dst),
+		WithDownloadProgress(func(downloaded, total int64) {
+			calls++
+			last = [2]int64{downloaded, total}
+		}),
+	)
+	if res.ExitError != nil {
+		t.Fatalf("Upgrade() error = %v", res.ExitError)
+	}
+	if res.InstalledPath != dst {
+		t.Errorf("InstalledPath = %q, want %q", res.InstalledPath, dst)
+	}
+	wantAsset := "tool_" + runtime.GOOS + "_" + runtime.GOARCH
+	if res.Backend != BackendGitHub || res.ReleaseTag != "v1.1.0" || res.ReleaseAsset != wantAsset {
+		t.Errorf("Backend, ReleaseTag, ReleaseAsset = %q, %q, %q, want %q, v1.1.0, %q", res.Backend, res.ReleaseTag, res.ReleaseAsset, BackendGitHub, wantAsset)
+	}
+	if got, _ := os.ReadFile(dst); len(got) != len(binary) {
+		t.Errorf("installed %d bytes, want %d", len(got), len(binary))
+	}
+	if calls == 0 || last != [2]int64{int64(len(binary)), int64(len(binary))} {
+		t.Errorf("progress: %d calls, last %v, want final %d/%d", calls, last, len(binary), len(binary))
+	}
+	if calls > len(binary)/1024 {
+		t.Errorf("progress called %d times for %d bytes", calls, len(binary))
+	}
+}
+
+func TestUpgrade_gitHubReleaseAlreadyLatest(t *testing.T) {
+	srv := newFakeGitHub(t, "v1.0.0", nil)
+	fakeBuildInfo(t, "github.com/melt-inc/autoupgrade", "v1.0.0")
+
+	res := Upgrade(context.Background(), "", WithGitHubRelease("owner", "repo"), WithGitHubAPI(srv.URL))
+	if res.SkipReason != SkipAlreadyLatest {
+		t.Errorf("SkipReason = %q, want %q", res.SkipReason, SkipAlreadyLatest)
+	}
+}
+
+func TestUpgrade_gitHubReleasePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		opts    []Option
+		want    SkipReason
+	}{
+		{"downgrade", "v1.2.0", nil, SkipBlockedByPolicy},
+		{"constraint", "v1.0.0", []Option{WithConstraint("<1.1.0")}, SkipNoVersionSatisfiesConstraint},
+		{"ceiling", "v1.0.0", []Option{WithMaxVersion("v1.0.5")}, SkipCeilingReached},
+		{"filter", "v1.0.0", []Option{WithVersionFilter(func(v string) bool { return v != "v1.1.0" })}, SkipNoAcceptableVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFakeGitHub(t, "v1.1.0", []byte("new"))
+			fakeBuildInfo(t, "github.com/melt-inc/autoupgrade", tt.current)
+			dst := filepath.Join(t.TempDir(), "tool")
+			writeFile(t, dst, []byte("old"))
+
+			opts := append([]Option{WithGitHubRelease("owner", "repo"), WithGitHubAPI(srv.URL), WithExecutablePath(dst)}, tt.opts...)
+			res := Upgrade(context.Background(), "", opts...)
+			if res.ExitError != nil || res.SkipReason != tt.want {
+				t.Errorf("Upgrade() = %q, %v, want %q", res.SkipReason, res.ExitError, tt.want)
+			}
+			if got, _ := os.ReadFile(dst); string(got) != "old" {
+				t.Errorf("binary replaced with %q", got)
+			}
+		})
+	}
+}
+
+func TestUpgrade_gitHubReleaseAssetSelector(t *testing.T) {
+	srv := newFakeGitHub(t, "v1.1.0", []byte("new"))
+	fakeBuildInfo(t, "github.com/melt-inc/autoupgrade", "v1.0.0")
+	dst := filepath.Join(t.TempDir(), "tool")
+	writeFile(t, dst, []byte("old"))
+
+	var got []string
+	errPicky := errors.New("no asset good enough")
+	res := Upgrade(context.Background(), "",
+		WithGitHubRelease("owner", "repo"),
+		WithGitHubAPI(srv.URL),
+		WithExecutablePath(dst),
+		WithAssetSelector(func(assets []ReleaseAsset, goos, goarch string) (ReleaseAsset, error) {
+			for _, a := range assets {
+				got = append(got, a.Name)
+			}
+			if goos != runtime.GOOS || goarch != runtime.GOARCH {
+				t.Errorf("selector called for %s/%s, want host platform", goos, goarch)
+			}
+			return ReleaseAsset{}, errPicky
+		}),
+	)
+	if !errors.Is(res.ExitError, errPicky) {
+		t.Errorf("ExitError = %v, want %v", res.ExitError, errPicky)
+	}
+	if len(got) != 2 {
+		t.Errorf("selector saw assets %q, want both", got)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "old" {
+		t.Errorf("binary replaced despite selector error")
+	}
+}
+
+func TestUpgrade_gitHubReleaseArchive(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "tool.tar.gz")
+	writeTarGz(t, archive, testEntry{"tool_1.1.0/README.md", 0o644, "docs"}, testEntry{"tool_1.1.0/tool", 0o755, "new"})
+	data, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newFakeGitHub(t, "v1.1.0", data)
+	fakeBuildInfo(t, "github.com/melt-inc/autoupgrade", "v1.0.0")
+	dst := filepath.Join(t.TempDir(), "tool")
+	writeFile(t, dst, []byte("old"))
+
+	res := Upgrade(context.Background(), "",
+		WithGitHubRelease("owner", "repo"),
+		WithGitHubAPI(srv.URL),
+		WithExecutablePath(dst),
+		WithVerifyModulePath(false),
+	)
+	if res.ExitError != nil {
+		t.Fatalf("Upgrade() error = %v", res.ExitError)
+	}
+	if got, _ := os.ReadFile(dst); string(got) != "new" {
+		t.Errorf("installed %q, want the binary from the archive", got)
+	}
+}
+
+func TestDefaultAssetSelector(t *testing.T) {
+	assets := []ReleaseAsset{
+		{Name: "tool_Linux_x86_64"},
+		{Name: "tool_macOS_arm64"},
+		{Name: "tool_windows_amd64.exe"},
+	}
+	tests := []struct {
+		goos, goarch, want string
+	}{
+		{"linux", "amd64", "tool_Linux_x86_64"},
+		{"darwin", "arm64", "tool_macOS_arm64"},
+		{"windows", "amd64", "tool_windows_amd64.exe"},
+	}
+	for _, tt := range tests {
+		a, err := DefaultAssetSelector(assets, tt.goos, tt.goarch)
+		if err != nil || a.Name != tt.want {
+			t.Errorf("DefaultAssetSelector(%s/%s) = %q, %v, want %q", tt.goos, tt.goarch, a.Name, err, tt.want)
+		}
+	}
+	if _, err := DefaultAssetSelector(assets, "linux", "arm64"); !errors.Is(err, ErrNoMatchingAsset) {
+		t.Errorf("DefaultAssetSelector(linux/arm64) error = %v, want %v", err, ErrNoMatchingAsset)
+	}
+}
+
+func TestDefaultAssetSelector_words(t *testing.T) {
+	tests := []struct {
+		name         string
+		assets       []string
+		goos, goarch string
+		want         string
+	}{
+		{"arm is not arm64", []string{"tool_linux_arm64.tar.gz", "tool_linux_arm.tar.gz"}, "linux", "arm", "tool_linux_arm.tar.gz"},
+		{"arm64 is not arm", []string{"tool_linux_arm.tar.gz", "tool_linux_arm64.tar.gz"}, "linux", "arm64", "tool_linux_arm64.tar.gz"},
+		{"x86_64 alias", []string{"tool-1.2.0-linux-x86_64.tar.gz"}, "linux", "amd64", "tool-1.2.0-linux-x86_64.tar.gz"},
+		{"checksum file", []string{"tool_linux_amd64.tar.gz.sha256", "tool_linux_amd64.tar.gz"}, "linux", "amd64", "tool_linux_amd64.tar.gz"},
+		{"signature file", []string{"tool_linux_amd64.sig", "tool_linux_amd64.asc", "tool_linux_amd64.pem", "tool_linux_amd64"}, "linux", "amd64", "tool_linux_amd64"},
+		{"checksums list", []string{"checksums_linux_amd64.txt", "tool_linux_amd64.zip"}, "linux", "amd64", "tool_linux_amd64.zip"},
+		{"only a checksum", []string{"tool_linux_amd64.sha256"}, "linux", "amd64", ""},
+		{"os inside a word", []string{"tool_darwinish_amd64"}, "darwin", "amd64", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var assets []ReleaseAsset
+			for _, name := range tt.assets {
+				assets = append(assets, ReleaseAsset{Name: name})
+			}
+			a, err := DefaultAssetSelector(assets, tt.goos, tt.goarch)
+			if tt.want == "" {
+				if !errors.Is(err, ErrNoMatchingAsset) {
+					t.Errorf("DefaultAssetSelector() = %q, %v, want %v", a.Name, err, ErrNoMatchingAsset)
+				}
+				return
+			}
+			if err != nil || a.Name != tt.want {
+				t.Errorf("DefaultAssetSelector() = %q, %v, want %q", a.Name, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGitHubLatestRelease(t *testing.T) {
+	var auth []string
+	var downloads int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = append(auth, r.Header.Get("Authorization"))
+		if r.URL.Path != "/api/v3/repos/owner/repo/releases/latest" {
+			downloads++
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(githubRelease{
+			TagName: "v1.1.0",
+			Assets:  []ReleaseAsset{{Name: "tool_linux_arm64", URL: "https://example.com/tool"}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	tag, asset, err := GitHubLatestRelease(context.Background(), "owner", "repo",
+		WithGitHubAPI(srv.URL+"/api/v3/"),
+		WithGitHubToken("secret"),
+		WithTargetPlatform("linux", "arm64"),
+	)
+	if err != nil {
+		t.Fatalf("GitHubLatestRelease() error = %v", err)
+	}
+	if tag != "v1.1.0" || asset.Name != "tool_linux_arm64" {
+		t.Errorf("GitHubLatestRelease() = %q, %q, want v1.1.0, tool_linux_arm64", tag, asset.Name)
+	}
+	if downloads != 0 || len(auth) != 1 || auth[0] != "Bearer secret" {
+		t.Errorf("server saw %d downloads and Authorization %q, want only the API request with the token", downloads, auth)
+	}
+
+	if _, _, err := GitHubLatestRelease(context.Background(), "owner", "repo", WithGitHubAPI(srv.URL+"/api/v3"), WithTargetPlatform("windows", "amd64")); !errors.Is(err, ErrNoMatchingAsset) {
+		t.Errorf("GitHubLatestRelease() without a matching asset error = %v, want %v", err, ErrNoMatchingAsset)
+	}
+}
+
+func TestUpgrade_gitHubReleaseToken(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	binary, err := os.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "private repository", http.StatusNotFound)
+			return
+		}
+		switch r.URL.Path {
+		case "/repos/owner/repo/releases/latest":
+			json.NewEncoder(w).Encode(githubRelease{
+				TagName: "v1.1.0",
+				Assets: []ReleaseAsset{
+					{ID: 42, Name: "tool_" + runtime.GOOS + "_" + runtime.GOARCH, URL: srv.URL + "/download/tool"},
+				},
+			})
+		case "/repos/owner/repo/releases/assets/42":
+			if r.Header.Get("Accept") != "application/octet-stream" {
+				t.Errorf("asset request Accept = %q", r.Header.Get("Accept"))
+			}
+			w.Write(binary)
+		default:
+			t.Errorf("unexpected request for %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	fakeBuildInfo(t, "github.com/melt-inc/autoupgrade", "v1.0.0")
+	dst := filepath.Join(t.TempDir(), "tool")
+	writeFile(t, dst, []byte("old"))
+
+	res := Upgrade(context.Background(), "",
+		WithGitHubRelease("owner", "repo"),
+		WithGitHubAPI(srv.URL),
+		WithGitHubToken("secret"),
+		WithExecutablePath(dst),
+	)
+	if res.ExitError != nil {
+		t.Fatalf("Upgrade() error = %v", res.ExitError)
+	}
+	if got, _ := os.ReadFile(dst); len(got) != len(binary) {
+		t.Errorf("installed %d bytes, want %d from the API", len(got), len(binary))
+	}
+}
+
+func Test_setGitHubAuth(t *testing.T) {
+	tests := []struct {
+		api, url string
+		want     bool
+	}{
+		{defaultGitHubAPI, "https://api.github.com/repos/o/r/releases/latest", true},
+		{defaultGitHubAPI, "https://github.com/o/r/releases/download/v1/tool", true},
+		{defaultGitHubAPI, "https://objects.githubusercontent.com/tool", false},
+		{"https://ghe.example.com/api/v3", "https://ghe.example.com/o/r/releases/download/v1/tool", true},
+		{"https://ghe.example.com/api/v3", "https://cdn.example.com/tool", false},
+	}
+	for _, tt := range tests {
+		cfg := newConfig([]Option{WithGitHubAPI(tt.api), WithGitHubToken("secret")})
+		req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		setGitHubAuth(cfg, req)
+		if got := req.Header.Get("Authorization") != ""; got != tt.want {
+			t.Errorf("setGitHubAuth(%s) for API %s sent token %v, want %v", tt.url, tt.api, got, tt.want)
+		}
+	}
+}
@@ -1,3 +1,5 @@
 module github.com/melt-inc/autoupgrade
 
 go 1.21.3
+
+require golang.org/x/mod v0.20.0
@@ -0,0 +1,209 @@
+package autoupgrade
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// credentialSet is a group of HTTP headers sent with requests whose URL
+// starts with one of prefixes, as found in the output of a GOAUTH command or
+// built from a netrc entry.
+type credentialSet struct {
+	prefixes []string
+	header   http.Header
+}
+
+// addProxyAuth adds the credentials the go command would send with req, as
+// configured by GOAUTH, to proxy requests made over HTTPS. Of the credential
+// sets whose prefix matches the URL, the longest prefix wins, and the earlier
+// GOAUTH entry if two are as long.
+func addProxyAuth(cfg *config, req *http.Request) {
+	if req.URL.Scheme != "https" || req.Header.Get("Authorization") != "" {
+		return
+	}
+	cfg.authOnce.Do(func() { cfg.auth = loadGOAUTH(req.Context(), cfg) })
+	u := req.URL.String()
+	var best *credentialSet
+	bestLen := 0
+	for i := range cfg.auth {
+		for _, p := range cfg.auth[i].prefixes {
+			if len(p) > bestLen && urlHasPrefix(u, p) {
+				best, bestLen = &cfg.auth[i], len(p)
+			}
+		}
+	}
+	if best == nil {
+		return
+	}
+	for k, v := range best.header {
+		req.Header[k] = v
+	}
+}
+
+// urlHasPrefix reports whether u starts with prefix at a path element
+// boundary, so "https://host/a" matches "https://host/a/b" but not
+// "https://host/ab".
+func urlHasPrefix(u, prefix string) bool {
+	if !strings.HasPrefix(u, prefix) {
+		return false
+	}
+	return len(u) == len(prefix) || strings.HasSuffix(prefix, "/") || u[len(prefix)] == '/'
+}
+
+// loadGOAUTH returns the credential sets configured by GOAUTH, a
+// semicolon-separated list defaulting to "netrc". An entry is "off", which
+// disables authentication, "netrc", or a command whose output lists
+// credential sets. "git dir" entries are not supported and are skipped.
+func loadGOAUTH(ctx context.Context, cfg *config) []credentialSet {
+	goauth := cfg.getenv("GOAUTH")
+	if goauth == "" {
+		goauth = "netrc"
+	}
+	var sets []credentialSet
+	for _, entry := range strings.Split(goauth, ";") {
+		f := strings.Fields(entry)
+		switch {
+		case len(f) == 0:
+		case f[0] == "off":
+			return nil
+		case f[0] == "netrc" && len(f) == 1:
+			sets = append(sets, netrcCredentials(cfg)...)
+		case f[0] == "git":
+			cfg.logf("GOAUTH %q is not supported for proxy requests; skipping it", entry)
+		default:
+			cmd, err := cfg.command(ctx, f[0], f[1:]...)
+			if err != nil {
+				cfg.logf("GOAUTH command %q not run: %v", entry, err)
+				continue
+			}
+			cmd.Env = cfg.environ()
+			out, err := cmd.Output()
+			if err != nil {
+				cfg.logf("GOAUTH command %q failed: %v", entry, err)
+				continue
+			}
+			sets = append(sets, parseCredentialSets(out)...)
+		}
+	}
+	return sets
+}
+
+// parseCredentialSets parses the output of a GOAUTH command: one or more
+// URL lines, a blank line, header lines, and another blank line, repeated.
+// Malformed sets are dropped.
+func parseCredentialSets(out []byte) []credentialSet {
+	var sets []credentialSet
+	var cur credentialSet
+	inHeaders := false
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		switch {
+		case line == "" && !inHeaders:
+			inHeaders = len(cur.prefixes) > 0
+		case line == "":
+			if len(cur.header) > 0 {
+				sets = append(sets, cur)
+			}
+			cur, inHeaders = credentialSet{}, false
+		case !inHeaders:
+			if strings.HasPrefix(line, "https://") {
+				cur.prefixes = append(cur.prefixes, line)
+			}
+		default:
+			k, v, ok := strings.Cut(line, ":")
+			if !ok || strings.TrimSpace(k) == "" {
+				continue
+			}
+			if cur.header == nil {
+				cur.header = make(http.Header)
+			}
+			cur.header.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+		}
+	}
+	if inHeaders && len(cur.header) > 0 {
+		sets = append(sets, cur)
+	}
+	return sets
+}
+
+// netrcCredentials returns a basic authentication credential set for each
+// machine in the netrc file: NETRC, defaulting to .netrc in the home
+// directory, or _netrc on Windows.
+func netrcCredentials(cfg *config) []credentialSet {
+	name := cfg.getenv("NETRC")
+	if name == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		base := ".netrc"
+		if runtime.GOOS == "windows" {
+			base = "_netrc"
+		}
+		name = filepath.Join(home, base)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil
+	}
+	var sets []credentialSet
+	for _, l := range parseNetrc(string(data)) {
+		h := make(http.Header)
+		h.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(l.login+":"+l.password)))
+		sets = append(sets, credentialSet{prefixes: []string{"https://" + l.machine}, header: h})
+	}
+	return sets
+}
+
+type netrcLine struct {
+	machine, login, password string
+}
+
+// parseNetrc parses the machine entries of a netrc file, as the go command
+// does: a "default" entry and everything after it are ignored, as are macro
+// definitions.
+func parseNetrc(data string) []netrcLine {
+	var lines []netrcLine
+	var l netrcLine
+	inMacro := false
+	for _, line := range strings.Split(data, "\n") {
+		if inMacro {
+			if line == "" {
+				inMacro = false
+			}
+			continue
+		}
+		f := strings.Fields(line)
+		i := 0
+		for ; i < len(f)-1; i += 2 {
+			switch f[i] {
+			case "machine":
+				l = netrcLine{machine: f[i+1]}
+			case "default":
+				return lines
+			case "login":
+				l.login = f[i+1]
+			case "password":
+				l.password = f[i+1]
+			case "macdef":
+				inMacro = true
+			}
+			if l.machine != "" && l.login != "" && l.password != "" {
+				lines = append(lines, l)
+				l = netrcLine{}
+			}
+		}
+		if i < len(f) && f[i] == "default" {
+			return lines
+		}
+	}
+	return lines
+}
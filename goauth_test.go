@@ -0,0 +1,114 @@
+package autoupgrade
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func Test_parseNetrc(t *testing.T) {
+	data := `machine proxy.example.com login alice password s3cret
+machine other.example.com
+	login bob
+	password hunter2
+
+macdef init
+machine ignored.example.com login x password y
+
+machine last.example.com login carol password pw
+default login anon password anon
+machine after.example.com login d password e
+`
+	want := []netrcLine{
+		{"proxy.example.com", "alice", "s3cret"},
+		{"other.example.com", "bob", "hunter2"},
+		{"last.example.com", "carol", "pw"},
+	}
+	if got := parseNetrc(data); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseNetrc() = %v, want %v", got, want)
+	}
+}
+
+func Test_parseCredentialSets(t *testing.T) {
+	out := "https://a.example.com\nhttps://b.example.com/mod\n\nAuthorization: Bearer one\n\nhttps://c.example.com\n\nAuthorization: Basic two\nX-Extra: 3\n\n"
+	sets := parseCredentialSets([]byte(out))
+	if len(sets) != 2 {
+		t.Fatalf("parseCredentialSets() = %d sets, want 2", len(sets))
+	}
+	if got := sets[0].prefixes; !reflect.DeepEqual(got, []string{"https://a.example.com", "https://b.example.com/mod"}) {
+		t.Errorf("first set prefixes = %q", got)
+	}
+	if got := sets[1].header.Get("X-Extra"); got != "3" {
+		t.Errorf("second set X-Extra = %q, want 3", got)
+	}
+}
+
+func Test_urlHasPrefix(t *testing.T) {
+	for _, tt := range []struct {
+		u, prefix string
+		want      bool
+	}{
+		{"https://host/a/b", "https://host", true},
+		{"https://host/a/b", "https://host/a", true},
+		{"https://host/ab", "https://host/a", false},
+		{"https://host.evil/x", "https://host", false},
+		{"https://host/a/", "https://host/a/", true},
+	} {
+		if got := urlHasPrefix(tt.u, tt.prefix); got != tt.want {
+			t.Errorf("urlHasPrefix(%q, %q) = %v, want %v", tt.u, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+// newAuthProxy serves @latest for example.com/fake over HTTPS to requests
+// carrying the Authorization header want, and 401 to others.
+func newAuthProxy(t *testing.T, want string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != want {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"Version":"v1.2.0"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCheckLatest_netrc(t *testing.T) {
+	fakeBuildInfo(t, "example.com/fake", "v1.0.0")
+	srv := newAuthProxy(t, "Basic YWxpY2U6czNjcmV0") // alice:s3cret
+	netrc := filepath.Join(t.TempDir(), "netrc")
+	writeFile(t, netrc, []byte("machine "+strings.TrimPrefix(srv.URL, "https://")+" login alice password s3cret\n"))
+	opts := []Option{WithHTTPClient(srv.Client()), WithEnv("GOPROXY="+srv.URL, "NETRC="+netrc, "GOAUTH=")}
+
+	if v, err := CheckLatest(context.Background(), "", opts...); err != nil || v != "v1.2.0" {
+		t.Errorf("CheckLatest() = %q, %v, want v1.2.0", v, err)
+	}
+	if _, err := CheckLatest(context.Background(), "", append(opts, WithEnv("GOAUTH=off"))...); err == nil {
+		t.Error("CheckLatest() with GOAUTH=off succeeded, want 401")
+	}
+}
+
+func TestCheckLatest_goauthCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script command not supported on windows")
+	}
+	fakeBuildInfo(t, "example.com/fake", "v1.0.0")
+	srv := newAuthProxy(t, "Bearer token")
+	script := filepath.Join(t.TempDir(), "auth")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nprintf '"+srv.URL+"\\n\\nAuthorization: Bearer token\\n\\n'\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := CheckLatest(context.Background(), "", WithHTTPClient(srv.Client()), WithEnv("GOPROXY="+srv.URL, "GOAUTH="+script))
+	if err != nil || v != "v1.2.0" {
+		t.Errorf("CheckLatest() = %q, %v, want v1.2.0", v, err)
+	}
+}
@@ -0,0 +1,113 @@
+package autoupgrade
+
+import (
+	"context"
+	"time"
+)
+
+// Hooks are called around an Upgrade, for example to record it as a tracing
+// span. Any hook may be nil.
+type Hooks struct {
+	// OnStart is called once the running module and version are known. The
+	// context it returns, if not nil, is used for the rest of the upgrade and
+	// passed to OnSuccess or OnError, so it can carry a span.
+	OnStart func(ctx context.Context, ev *UpgradeEvent) context.Context
+	// OnSuccess is called when the upgrade ends without error, including
+	// when it was skipped.
+	OnSuccess func(ctx context.Context, ev *UpgradeEvent)
+	// OnError is called when the upgrade ends with an error.
+	OnError func(ctx context.Context, ev *UpgradeEvent)
+}
+
+// Outcome summarises how an upgrade ended.
+type Outcome string
+
+const (
+	// OutcomeUpgraded means a new binary was installed.
+	OutcomeUpgraded Outcome = "upgraded"
+	// OutcomeSkipped means the upgrade ended without error or install, as
+	// given by UpgradeResult.SkipReason.
+	OutcomeSkipped Outcome = "skipped"
+	// OutcomeFailed means the upgrade ended with UpgradeResult.ExitError.
+	OutcomeFailed Outcome = "failed"
+)
+
+// UpgradeEvent describes an upgrade to Hooks. Fields describing the end of
+// the upgrade are zero in OnStart.
+type UpgradeEvent struct {
+	Module      string    // module path of the running binary
+	FromVersion string    // version of the running binary
+	ToVersion   string    // version installed, or else the target resolved, if any
+	Outcome     Outcome   // how the upgrade ended
+	Start, End  time.Time // when the upgrade started and ended
+	Phases      []Phase   // the steps that ran, in order
+	Result      *UpgradeResult
+}
+
+// Duration returns how long the upgrade took.
+func (e *UpgradeEvent) Duration() time.Duration {
+	return e.End.Sub(e.Start)
+}
+
+// Phase is a timed step of an upgrade: "resolve" for finding the target
+// version, "install" for go install or the release download, and "verify"
+// for checking the new binary.
+type Phase struct {
+	Name       string
+	Start, End time.Time
+}
+
+// phase starts timing the named step on u and returns the function ending it.
+func (u *UpgradeResult) phase(name string) func() {
+	p := Phase{Name: name, Start: time.Now()}
+	if u.onPhase != nil {
+		u.onPhase(p)
+	}
+	return func() {
+		p.End = time.Now()
+		u.phases = append(u.phases, p)
+		if u.onPhase != nil {
+			u.onPhase(p)
+		}
+	}
+}
+
+// startHooks calls OnStart for res and returns the context the upgrade
+// continues with, and the function to call when it ends.
+func (c *config) startHooks(ctx context.Context, res *UpgradeResult) (context.Context, func()) {
+	h := c.hooks
+	ev := &UpgradeEvent{
+		Module:      res.ModulePath,
+		FromVersion: res.CurrentInfo.Main.Version,
+		Start:       time.Now(),
+		Result:      res,
+	}
+	if h.OnStart != nil {
+		if hctx := h.OnStart(ctx, ev); hctx != nil {
+			ctx = hctx
+		}
+	}
+	return ctx, func() {
+		ev.End = time.Now()
+		ev.Phases = res.phases
+		ev.ToVersion = res.installedVersion
+		if ev.ToVersion == "" {
+			ev.ToVersion = res.Decision.Target
+		}
+		switch {
+		case res.ExitError != nil:
+			ev.Outcome = OutcomeFailed
+			if h.OnError != nil {
+				h.OnError(ctx, ev)
+			}
+			return
+		case res.InstalledPath != "":
+			ev.Outcome = OutcomeUpgraded
+		default:
+			ev.Outcome = OutcomeSkipped
+		}
+		if h.OnSuccess != nil {
+			h.OnSuccess(ctx, ev)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package autoupgrade
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type spanKey struct{}
+
+func TestUpgrade_hooks(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+
+	var started, ended *UpgradeEvent
+	var endCtx context.Context
+	hooks := Hooks{
+		OnStart: func(ctx context.Context, ev *UpgradeEvent) context.Context {
+			started = ev
+			if ev.Module != m.path || ev.FromVersion != "v1.0.0" || ev.Start.IsZero() {
+				t.Errorf("OnStart event = %+v", ev)
+			}
+			return context.WithValue(ctx, spanKey{}, "span")
+		},
+		OnSuccess: func(ctx context.Context, ev *UpgradeEvent) { endCtx, ended = ctx, ev },
+		OnError:   func(ctx context.Context, ev *UpgradeEvent) { t.Errorf("OnError(%v)", ev.Result.ExitError) },
+	}
+	res := Upgrade(context.Background(), "", append(m.options(), WithHooks(hooks))...)
+	if res.ExitError != nil {
+		t.Fatalf("Upgrade() error = %v", res.ExitError)
+	}
+	if started == nil || ended != started {
+		t.Fatalf("OnStart event %p, OnSuccess event %p, want the same", started, ended)
+	}
+	if endCtx.Value(spanKey{}) != "span" {
+		t.Error("OnSuccess did not get the context returned by OnStart")
+	}
+	if ended.Outcome != OutcomeUpgraded || ended.ToVersion != "v1.1.0" || ended.Result != res {
+		t.Errorf("OnSuccess event = %+v", ended)
+	}
+	if ended.Duration() <= 0 {
+		t.Errorf("Duration() = %v, want positive", ended.Duration())
+	}
+	var names []string
+	for _, p := range ended.Phases {
+		if p.Start.Before(ended.Start) || p.End.Before(p.Start) || ended.End.Before(p.End) {
+			t.Errorf("phase %s = %v..%v outside %v..%v", p.Name, p.Start, p.End, ended.Start, ended.End)
+		}
+		names = append(names, p.Name)
+	}
+	if len(names) != 3 || names[0] != "resolve" || names[1] != "install" || names[2] != "verify" {
+		t.Errorf("phases = %q, want resolve, install, verify", names)
+	}
+}
+
+func TestUpgrade_hooksError(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+
+	var ended *UpgradeEvent
+	hooks := Hooks{OnError: func(ctx context.Context, ev *UpgradeEvent) { ended = ev }}
+	opts := append(m.options(), WithHooks(hooks), WithGoBinary(filepath.Join(t.TempDir(), "missing-go")))
+	res := Upgrade(context.Background(), "", opts...)
+	if res.ExitError == nil {
+		t.Fatal("Upgrade() with a missing go binary succeeded")
+	}
+	if ended == nil || ended.Outcome != OutcomeFailed {
+		t.Errorf("OnError event = %+v, want failed outcome", ended)
+	}
+}
+
+func TestUpgrade_preUpgrade(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	var calls [][2]string
+	record := WithPreUpgrade(func(current, target string) error {
+		calls = append(calls, [2]string{current, target})
+		return nil
+	})
+
+	fakeBuildInfo(t, m.path, "v1.1.0")
+	res := Upgrade(context.Background(), "", append(m.options(), record)...)
+	if res.SkipReason != SkipAlreadyLatest || len(calls) != 0 {
+		t.Fatalf("Upgrade() at latest = %q, hook calls %q, want %q and no calls", res.SkipReason, calls, SkipAlreadyLatest)
+	}
+
+	fakeBuildInfo(t, m.path, "v1.0.0")
+	errSnapshot := errors.New("snapshot failed")
+	res = Upgrade(context.Background(), "", append(m.options(), WithPreUpgrade(func(current, target string) error {
+		return errSnapshot
+	}))...)
+	if !errors.Is(res.ExitError, errSnapshot) {
+		t.Fatalf("Upgrade() error = %v, want %v", res.ExitError, errSnapshot)
+	}
+	if _, err := os.Stat(m.binary()); err == nil {
+		t.Error("installed despite the pre-upgrade hook failing")
+	}
+
+	res = Upgrade(context.Background(), "", append(m.options(), record)...)
+	if res.ExitError != nil || res.InstalledPath == "" {
+		t.Fatalf("Upgrade() = %v, installed %q", res.ExitError, res.InstalledPath)
+	}
+	if want := [][2]string{{"v1.0.0", "v1.1.0"}}; len(calls) != 1 || calls[0] != want[0] {
+		t.Errorf("hook calls = %q, want %q", calls, want)
+	}
+}
@@ -0,0 +1,98 @@
+package autoupgrade
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheEntry is a proxy response stored in the WithHTTPCache directory, with
+// the validators for revalidating it and the time it stays fresh until.
+type cacheEntry struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	Expires      time.Time `json:"expires,omitempty"`
+	Body         []byte    `json:"body"`
+}
+
+// cacheFile returns the file in dir holding the response for url.
+func cacheFile(dir, url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// readCacheEntry returns the cached response for url, or nil if there is
+// none or it cannot be read.
+func readCacheEntry(dir, url string) *cacheEntry {
+	data, err := os.ReadFile(cacheFile(dir, url))
+	if err != nil {
+		return nil
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(data, &e); err != nil || e.URL != url {
+		return nil
+	}
+	return &e
+}
+
+// fresh reports whether e may be used at now without asking the proxy.
+func (e *cacheEntry) fresh(now time.Time) bool {
+	return now.Before(e.Expires)
+}
+
+// setValidators adds the conditional request headers for e to req.
+func (e *cacheEntry) setValidators(req *http.Request) {
+	if e.ETag != "" {
+		req.Header.Set("If-None-Match", e.ETag)
+	}
+	if e.LastModified != "" {
+		req.Header.Set("If-Modified-Since", e.LastModified)
+	}
+}
+
+// update refreshes e from the headers of a 200 or 304 response received at
+// now. It reports whether the response may be stored at all.
+func (e *cacheEntry) update(h http.Header, now time.Time) bool {
+	if etag := h.Get("ETag"); etag != "" {
+		e.ETag = etag
+	}
+	if lm := h.Get("Last-Modified"); lm != "" {
+		e.LastModified = lm
+	}
+	e.Expires = time.Time{}
+	noCache := false
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store":
+			return false
+		case "no-cache":
+			noCache = true
+		case "max-age":
+			if secs, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil && secs > 0 {
+				e.Expires = now.Add(time.Duration(secs) * time.Second)
+			}
+		}
+	}
+	if noCache {
+		e.Expires = time.Time{}
+	}
+	return e.ETag != "" || e.LastModified != "" || !e.Expires.IsZero()
+}
+
+// writeCacheEntry stores e in dir. Failures are ignored, since the cache only
+// saves requests.
+func writeCacheEntry(dir string, e *cacheEntry) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	_ = writeFileAtomic(cacheFile(dir, e.URL), data)
+}
@@ -0,0 +1,71 @@
+package autoupgrade
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithHTTPCache(t *testing.T) {
+	tests := []struct {
+		name         string
+		cacheControl string
+		etag         string
+		requests     int // requests the server sees over three lookups
+		notModified  int // of which answered 304
+	}{
+		{"etag", "", `"v1.2.0"`, 3, 2},
+		{"max-age", "max-age=3600", "", 1, 0},
+		{"no-cache", "no-cache, max-age=3600", `"v1.2.0"`, 3, 2},
+		{"no-store", "no-store", `"v1.2.0"`, 3, 0},
+		{"no validators", "", "", 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests, notModified int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if tt.cacheControl != "" {
+					w.Header().Set("Cache-Control", tt.cacheControl)
+				}
+				if tt.etag != "" {
+					w.Header().Set("ETag", tt.etag)
+					if r.Header.Get("If-None-Match") == tt.etag {
+						notModified++
+						w.WriteHeader(http.StatusNotModified)
+						return
+					}
+				}
+				w.Write([]byte(`{"Version":"v1.2.0"}`))
+			}))
+			defer srv.Close()
+
+			opts := []Option{WithEnv("GOPROXY=" + srv.URL), WithHTTPCache(t.TempDir())}
+			for i := 0; i < 3; i++ {
+				v, err := ResolveLatest(context.Background(), "example.com/tool", opts...)
+				if err != nil || v != "v1.2.0" {
+					t.Fatalf("ResolveLatest() = %q, %v, want v1.2.0", v, err)
+				}
+			}
+			if requests != tt.requests || notModified != tt.notModified {
+				t.Errorf("requests, 304s = %d, %d, want %d, %d", requests, notModified, tt.requests, tt.notModified)
+			}
+		})
+	}
+}
+
+func Test_cacheEntry_update(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := http.Header{}
+	h.Set("Last-Modified", "Mon, 01 Jan 2024 00:00:00 GMT")
+	h.Set("Cache-Control", "public, max-age=60")
+	e := &cacheEntry{}
+	if !e.update(h, now) || e.LastModified == "" || !e.Expires.Equal(now.Add(time.Minute)) {
+		t.Errorf("update() = %+v, want Last-Modified kept and fresh for a minute", e)
+	}
+	if !e.fresh(now.Add(59*time.Second)) || e.fresh(now.Add(time.Minute)) {
+		t.Error("fresh() does not follow max-age")
+	}
+}
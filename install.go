@@ -0,0 +1,568 @@
+package autoupgrade
+
+import (
+	"bytes"
+	"context"
+	"debug/buildinfo"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// install runs go install for target and records the outcome on res. The
+// installed binary is checked afterwards and rolled back if rejected.
+func install(ctx context.Context, cfg *config, res *UpgradeResult, modulePath, packagePath, target string) {
+	dst, err := installTarget(cfg, modulePath, packagePath)
+	if err != nil {
+		res.ExitError = err
+		return
+	}
+	res.Decision.InstallPath = dst
+	res.Decision.Writable = dirWritable(filepath.Dir(dst))
+	elevate := !res.Decision.Writable && cfg.elevate != ""
+	if elevate && (cfg.versionedName || cfg.keepRunning) {
+		// Staging builds next to the binary as the running user.
+		res.ExitError = fmt.Errorf("%w: %s (WithPrivilegeElevation cannot stage the binary)", ErrDirNotWritable, filepath.Dir(dst))
+		return
+	}
+
+	// Back off if another install in this process is writing the binary
+	// right now, rather than queue to repeat it.
+	release, ok := claimInstall(dst)
+	if !ok {
+		res.SkipReason = SkipInstallInProgress
+		return
+	}
+	defer release()
+	// Serialize installs, as concurrent go install runs writing the same
+	// binary can clobber each other.
+	cfg.mutex.Lock()
+	defer cfg.mutex.Unlock()
+	if cfg.minDiskSpace > 0 {
+		if err := checkDiskSpace(cfg, dst, cfg.minDiskSpace); err != nil {
+			res.ExitError = err
+			return
+		}
+	}
+
+	env := cfg.environ()
+	built := dst
+	if cfg.versionedName || cfg.keepRunning {
+		// Build into a private directory next to the destination, then
+		// rename to the versioned or staged name once the version is known.
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			res.ExitError = err
+			return
+		}
+		stage, err := os.MkdirTemp(filepath.Dir(dst), ".autoupgrade-")
+		if err != nil {
+			res.ExitError = err
+			return
+		}
+		defer os.RemoveAll(stage)
+		env = append(env, "GOBIN="+stage)
+		built = filepath.Join(stage, filepath.Base(dst))
+	}
+
+	var bak *backup
+	if cfg.verifies() && built == dst && !cfg.goInstallDryRun {
+		if elevate {
+			bak, err = elevatedBackup(cfg, dst)
+		} else {
+			bak, err = backupBinary(dst)
+		}
+		if err != nil {
+			res.ExitError = err
+			return
+		}
+		defer bak.discard()
+	}
+
+	pkg := fullPath(modulePath, packagePath, target)
+	if cfg.localModule != "" {
+		pkg = localPackage(packagePath)
+	} else if cfg.targetRewriter != nil {
+		if pkg, err = rewriteTarget(cfg.targetRewriter, pkg); err != nil {
+			res.ExitError = err
+			return
+		}
+		cfg.logf("install target rewritten to %s", pkg)
+	}
+	res.installArg = pkg
+	if cfg.preserveBuildTags {
+		res.BuildTags = BuildTags(res.CurrentInfo)
+	}
+	args := installArgs(cfg, res.BuildTags, pkg)
+	goCmd, err := cfg.goCommand()
+	if err != nil {
+		res.ExitError = err
+		return
+	}
+	if elevate {
+		cmd, err := elevatedCommand(cfg, goCmd, env, args, dst)
+		if err != nil {
+			res.ExitError = err
+			return
+		}
+		cfg.logf("%s is not writable, installing with %s", filepath.Dir(dst), cfg.elevate)
+		goCmd, args = cmd[0], cmd[1:]
+		res.Decision.Elevated = true
+	}
+	res.Backend = BackendGoInstall
+	endInstall := res.phase("install")
+	var tail *tailWriter
+	if cfg.tailLines > 0 {
+		tail = newTailWriter(cfg.tailLines, cfg.onTailLine)
+	}
+	stderr, err := installWithRetry(ctx, cfg, goCmd, env, args, tail)
+	endInstall()
+	if tail != nil {
+		res.Tail = tail.finish()
+	}
+	if cfg.trackDownloads {
+		res.Downloaded = parseDownloads(stderr)
+	}
+	res.setToolchainDownload(stderr)
+	if err != nil {
+		if built == dst && binaryLocked(dst) {
+			err = fmt.Errorf("%w: %w", ErrBinaryLocked, err)
+		}
+		res.ExitError = err
+		return
+	}
+
+	if cfg.goInstallDryRun {
+		res.DryRunCommands = string(stderr)
+		return
+	}
+
+	if err := verifyInstalled(ctx, cfg, res, built, modulePath); err != nil {
+		if bak != nil {
+			if rerr := bak.restore(); rerr != nil {
+				err = fmt.Errorf("%w (rollback failed: %v)", err, rerr)
+			}
+		}
+		res.ExitError = err
+		return
+	}
+
+	// The toolchain that built the binary differs from the running one when
+	// GOTOOLCHAIN selected another release.
+	info, err := buildinfo.ReadFile(built)
+	if err == nil {
+		res.ToolchainVersion = info.GoVersion
+		res.installedVersion = info.Main.Version
+	}
+	if cfg.versionedName {
+		if err != nil {
+			res.ExitError = fmt.Errorf("autoupgrade: reading installed binary: %w", err)
+			return
+		}
+		dst = versionedPath(dst, info.Main.Version)
+		if err := os.Rename(built, dst); err != nil {
+			res.ExitError = err
+			return
+		}
+	} else if cfg.keepRunning {
+		staged := stagedPath(dst)
+		if err := os.Rename(built, staged); err != nil {
+			res.ExitError = err
+			return
+		}
+		res.StagedFor, dst = dst, staged
+	}
+	res.setInstalled(dst)
+	checkOnPath(cfg, res)
+
+	if cfg.cacheSizeLimit > 0 {
+		if err := limitBuildCache(ctx, cfg, goCmd); err != nil {
+			cfg.logf("%v", err)
+			res.CacheCleanError = err
+		}
+	}
+}
+
+// installing holds the install targets with an install under way in this
+// process, guarded by installingMu.
+var (
+	installingMu sync.Mutex
+	installing   = map[string]bool{}
+)
+
+// claimInstall marks dst as being installed, returning a func to release
+// it. It returns false if an install of dst is already under way.
+func claimInstall(dst string) (release func(), ok bool) {
+	installingMu.Lock()
+	defer installingMu.Unlock()
+	if installing[dst] {
+		return nil, false
+	}
+	installing[dst] = true
+	return func() {
+		installingMu.Lock()
+		delete(installing, dst)
+		installingMu.Unlock()
+	}, true
+}
+
+// installWithRetry runs go install with args, retrying failures as set with
+// WithRetry and WithRetryPredicate, copying the output of every run to out
+// if not nil. It returns the standard error of the last run.
+func installWithRetry(ctx context.Context, cfg *config, goCmd string, env, args []string, tail *tailWriter) ([]byte, error) {
+	retryable := cfg.retryPredicate
+	if retryable == nil {
+		retryable = defaultRetryable
+	}
+	attr, err := cfg.procAttr()
+	if err != nil {
+		return nil, err
+	}
+	wait := cfg.retryBackoff
+	for attempt := 0; ; attempt++ {
+		cfg.logf("running %s %s", goCmd, strings.Join(args, " "))
+		stderr, err := runInstall(ctx, goCmd, cfg.localModule, env, args, attr, cfg.installOutput, tail)
+		if err == nil {
+			return stderr, nil
+		}
+		if ctx.Err() != nil {
+			// The process was killed because the context ended; report
+			// that rather than the resulting "signal: killed".
+			return stderr, fmt.Errorf("autoupgrade: go install stopped: %w", ctx.Err())
+		}
+		err = classifyInstallError(err, stderr)
+		if attempt >= cfg.retries || !retryable(err, stderr) {
+			return stderr, err
+		}
+		cfg.logf("go install failed, retrying in %v: %v", wait, err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return stderr, fmt.Errorf("autoupgrade: go install stopped: %w", ctx.Err())
+		case <-timer.C:
+		}
+		wait *= 2
+	}
+}
+
+// runInstall runs the go command goCmd with args and env in dir, or the
+// current directory if empty, and attr if not nil, returning its standard
+// error for diagnostics. Standard output is discarded unless out or tail is
+// set, in which case both streams are copied to each that is.
+func runInstall(ctx context.Context, goCmd, dir string, env, args []string, attr *syscall.SysProcAttr, out io.Writer, tail *tailWriter) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, goCmd, args...)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.SysProcAttr = attr
+	// A nil Stdin is the null device, never the terminal, so a prompt from
+	// the go command or a VCS tool fails instead of hanging.
+	cmd.Stdin = nil
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	var shared io.Writer
+	if out != nil {
+		// The two streams are copied by separate goroutines.
+		shared = &lockedWriter{w: out}
+	}
+	if shared != nil || tail != nil {
+		cmd.Stdout = streamOutput(shared, tail)
+		cmd.Stderr = io.MultiWriter(&stderr, streamOutput(shared, tail))
+	}
+	err := cmd.Run()
+	return stderr.Bytes(), err
+}
+
+// streamOutput returns the writer for one output stream: shared, if not nil,
+// and a stream of tail of its own, if not nil.
+func streamOutput(shared io.Writer, tail *tailWriter) io.Writer {
+	switch {
+	case tail == nil:
+		return shared
+	case shared == nil:
+		return tail.stream()
+	}
+	return io.MultiWriter(shared, tail.stream())
+}
+
+// lockedWriter serializes writes to w.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// rewriteTarget applies the WithTargetRewriter function to target and checks
+// the result is still a clean "path@version" argument.
+func rewriteTarget(rewrite func(string) (string, error), target string) (string, error) {
+	rewritten, err := rewrite(target)
+	if err != nil {
+		return "", fmt.Errorf("autoupgrade: rewriting install target %s: %w", target, err)
+	}
+	if reason := checkInstallTarget(rewritten); reason != "" {
+		return "", fmt.Errorf("%w: WithTargetRewriter returned %q: %s", ErrInvalidOption, rewritten, reason)
+	}
+	return rewritten, nil
+}
+
+// checkInstallTarget returns why target is not a clean go install argument of
+// the form "path@version", or "" if it is.
+func checkInstallTarget(target string) string {
+	pkg, version, ok := strings.Cut(target, "@")
+	switch {
+	case !ok:
+		return "missing @version"
+	case strings.Contains(version, "@"):
+		return "more than one @"
+	case pkg == "" || version == "":
+		return "empty package path or version"
+	case strings.HasPrefix(pkg, "-") || strings.HasPrefix(version, "-"):
+		return "looks like a flag"
+	case strings.ContainsAny(target, " \t\r\n\\"):
+		return "contains whitespace or a backslash"
+	}
+	for _, elem := range strings.Split(pkg, "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return "package path is not clean"
+		}
+	}
+	return ""
+}
+
+// localPackage returns the go install argument for packagePath within the
+// module directory set with WithLocalModule.
+func localPackage(packagePath string) string {
+	if packagePath == "" {
+		return "."
+	}
+	return "./" + strings.TrimPrefix(path.Clean("/"+packagePath), "/")
+}
+
+// defaultRetryable is the retry predicate used without WithRetryPredicate. It
+// retries failures that Classify considers transient or network related.
+func defaultRetryable(err error, output []byte) bool {
+	switch Classify(err) {
+	case FailureTransient, FailureNetwork:
+		return true
+	}
+	return false
+}
+
+// versionedPath returns the side-by-side name for a binary at version, such as
+// "tool-v1.2.3" or "tool-v1.2.3.exe".
+func versionedPath(dst, version string) string {
+	ext := ""
+	if strings.HasSuffix(dst, ".exe") {
+		dst, ext = strings.TrimSuffix(dst, ".exe"), ".exe"
+	}
+	return dst + "-" + version + ext
+}
+
+// stagedPath returns the name a binary is staged under with
+// WithReplaceRunning(false), such as "tool.new" or "tool.new.exe".
+func stagedPath(dst string) string {
+	ext := ""
+	if strings.HasSuffix(dst, ".exe") {
+		dst, ext = strings.TrimSuffix(dst, ".exe"), ".exe"
+	}
+	return dst + ".new" + ext
+}
+
+// stderrPattern maps a well-known fragment of go command output to the
+// error it indicates.
+type stderrPattern struct {
+	fragment string
+	err      error
+}
+
+// stderrPatterns are checked in order against the stderr of a failed
+// go install. The first match wins.
+var stderrPatterns = []stderrPattern{
+	// cmd/go reports failures fetching a toolchain selected via GOTOOLCHAIN
+	// as "go: download go1.X for GOOS/GOARCH: ..." or with the toolchain
+	// module path when the proxy request itself fails.
+	{"go: download go1", ErrToolchainDownloadBlocked},
+	{"golang.org/toolchain@", ErrToolchainDownloadBlocked},
+	{"is not a main package", ErrNotMainPackage},
+	{"no install location", ErrNotMainPackage},
+	{"disallowed by GOVCS", ErrVCSDisallowed},
+	{"GOVCS disallows", ErrVCSDisallowed},
+	{"401 Unauthorized", ErrAuthFailed},
+	{"403 Forbidden", ErrAuthFailed},
+	{"terminal prompts disabled", ErrAuthFailed},
+	{"could not read Username", ErrAuthFailed},
+	{"404 Not Found", ErrNotFound},
+	{"410 Gone", ErrNotFound},
+	{"no matching versions", ErrNoReleases},
+	{"unknown revision", ErrNotFound},
+	{"429 Too Many Requests", ErrRateLimited},
+	{"502 Bad Gateway", ErrProxyUnavailable},
+	{"503 Service Unavailable", ErrProxyUnavailable},
+	{"504 Gateway Timeout", ErrProxyUnavailable},
+	{"dial tcp", ErrNetwork},
+	{"no such host", ErrNetwork},
+	{"connection refused", ErrNetwork},
+	{"i/o timeout", ErrNetwork},
+	{"TLS handshake timeout", ErrNetwork},
+}
+
+// classifyInstallError inspects the stderr of a failed go install and wraps
+// err with a more specific error when the failure is recognised.
+func classifyInstallError(err error, stderr []byte) error {
+	if err == nil {
+		return nil
+	}
+	if path := declaredPath(stderr); path != "" {
+		return &ModuleMovedError{NewPath: path, Err: err}
+	}
+	for _, p := range stderrPatterns {
+		if bytes.Contains(stderr, []byte(p.fragment)) {
+			return fmt.Errorf("%w: %w", p.err, err)
+		}
+	}
+	return err
+}
+
+// installArgs returns the go command arguments to install target, built with
+// the given build tags.
+func installArgs(cfg *config, tags []string, target string) []string {
+	args := []string{"install"}
+	if cfg.parallelism > 0 {
+		args = append(args, "-p", strconv.Itoa(cfg.parallelism))
+	}
+	if cfg.modMode != "" {
+		args = append(args, "-mod="+cfg.modMode)
+	}
+	if len(tags) > 0 {
+		args = append(args, "-tags="+strings.Join(tags, ","))
+	}
+	if cfg.goInstallDryRun {
+		args = append(args, "-n")
+	}
+	return append(args, target)
+}
+
+// checkCacheDirs ensures the directories set by WithModCache, WithBuildCache
+// and WithGoPath exist and are writable, so that go install does not fail
+// part way through with a permission error.
+func checkCacheDirs(cfg *config) error {
+	for _, dir := range []string{cfg.modCache, cfg.buildCache, cfg.goPath} {
+		if dir == "" {
+			continue
+		}
+		if err := checkWritable(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dirWritable reports whether dir, or the nearest existing directory above it
+// that go install would create it in, is writable. Unlike checkWritable it
+// writes nothing, so it is safe for dry runs and read-only checks.
+func dirWritable(dir string) bool {
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return canWrite(dir)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false
+		}
+		dir = parent
+	}
+}
+
+// checkWritable creates dir if needed and verifies a file can be created in
+// it.
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("%w: %w", ErrDirNotWritable, err)
+	}
+	f, err := os.CreateTemp(dir, ".autoupgrade-check-*")
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDirNotWritable, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// goCommand returns the go command to run: the binary set with WithGoBinary,
+// the versioned launcher for WithGoVersion, such as "go1.22.5", found in
+// PATH, the one found by WithGoLocator, or else "go".
+func (c *config) goCommand() (string, error) {
+	if c.goBinary != "" {
+		return c.goBinary, nil
+	}
+	if c.goVersion == "" && c.goLocator != nil {
+		c.goLocatorOnce.Do(func() {
+			c.goLocated, c.goLocatorErr = c.goLocator()
+			if c.goLocatorErr == nil && c.goLocated == "" {
+				c.goLocatorErr = errors.New("locator returned no path")
+			}
+			if c.goLocatorErr != nil {
+				c.goLocated, c.goLocatorErr = "", fmt.Errorf("%w: %w", ErrGoNotFound, c.goLocatorErr)
+			}
+		})
+		return c.goLocated, c.goLocatorErr
+	}
+	if c.goVersion == "" {
+		return "go", nil
+	}
+	name := "go" + strings.TrimPrefix(c.goVersion, "go")
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s not in PATH; install it with 'go install golang.org/dl/%s@latest && %s download': %w", ErrGoNotFound, name, name, name, err)
+	}
+	return path, nil
+}
+
+// validatePlatform checks the configured target platform against the ports
+// supported by the go toolchain.
+func validatePlatform(ctx context.Context, cfg *config) error {
+	if cfg.goos == "" && cfg.goarch == "" {
+		return nil
+	}
+	goCmd, err := cfg.goCommand()
+	if err != nil {
+		return err
+	}
+	cmd, err := cfg.command(ctx, goCmd, "tool", "dist", "list")
+	if err != nil {
+		return err
+	}
+	cmd.Env = cfg.environ()
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("autoupgrade: listing supported platforms: %w", err)
+	}
+	if !supportsPlatform(out, cfg.goos, cfg.goarch) {
+		return fmt.Errorf("%w: %s/%s", ErrUnsupportedPlatform, cfg.goos, cfg.goarch)
+	}
+	return nil
+}
+
+// supportsPlatform reports whether the output of 'go tool dist list' contains
+// the goos/goarch pair.
+func supportsPlatform(distList []byte, goos, goarch string) bool {
+	want := goos + "/" + goarch
+	for _, line := range strings.Split(string(distList), "\n") {
+		if strings.TrimSpace(line) == want {
+			return true
+		}
+	}
+	return false
+}
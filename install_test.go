@@ -0,0 +1,458 @@
+package autoupgrade
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_classifyInstallError(t *testing.T) {
+	exitErr := &exec.ExitError{}
+	tests := []struct {
+		name   string
+		stderr string
+		want   error
+	}{
+		{
+			name:   "toolchain not available",
+			stderr: "go: downloading go1.99.0 (linux/amd64)\ngo: download go1.99.0 for linux/amd64: toolchain not available\n",
+			want:   ErrToolchainDownloadBlocked,
+		},
+		{
+			name:   "toolchain proxy unreachable",
+			stderr: "go: golang.org/toolchain@v0.0.1-go1.22.0.linux-amd64: Get \"https://proxy.golang.org/golang.org/toolchain/@v/v0.0.1-go1.22.0.linux-amd64.zip\": dial tcp: lookup proxy.golang.org: no such host\n",
+			want:   ErrToolchainDownloadBlocked,
+		},
+		{
+			name:   "not a main package",
+			stderr: "go: package github.com/melt-inc/autoupgrade is not a main package\n",
+			want:   ErrNotMainPackage,
+		},
+		{
+			name:   "no install location",
+			stderr: "go: no install location for directory /src/lib outside GOPATH\n",
+			want:   ErrNotMainPackage,
+		},
+		{
+			name:   "GOVCS",
+			stderr: "go: corp.example.com/tool@latest: GOVCS disallows using git for private corp.example.com/tool; see 'go help vcs'\n",
+			want:   ErrVCSDisallowed,
+		},
+		{
+			name:   "unrecognised",
+			stderr: "# example.com/tool\n./main.go:3:1: syntax error: non-declaration statement outside function body\n",
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classifyInstallError(exitErr, []byte(tt.stderr))
+			if !errors.Is(err, exitErr) {
+				t.Errorf("classifyInstallError() = %v, want wrapping of exit error", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("classifyInstallError() = %v, want %v", err, tt.want)
+			}
+			if tt.want == nil && err != error(exitErr) {
+				t.Errorf("classifyInstallError() = %v, want exit error unchanged", err)
+			}
+		})
+	}
+}
+
+func Test_supportsPlatform(t *testing.T) {
+	list := []byte("darwin/arm64\nlinux/amd64\nwindows/amd64\n")
+	if !supportsPlatform(list, "linux", "amd64") {
+		t.Error("linux/amd64 not supported")
+	}
+	if supportsPlatform(list, "linux", "arm64") {
+		t.Error("linux/arm64 supported")
+	}
+	if supportsPlatform(list, "linux", "") {
+		t.Error("linux/ supported")
+	}
+}
+
+func Test_installArgs(t *testing.T) {
+	got := installArgs(newConfig([]Option{WithParallelism(2)}), nil, "example.com/tool@latest")
+	want := []string{"install", "-p", "2", "example.com/tool@latest"}
+	if !slices.Equal(got, want) {
+		t.Errorf("installArgs() = %q, want %q", got, want)
+	}
+	got = installArgs(newConfig([]Option{WithGoInstallDryRun(true)}), nil, "example.com/tool@latest")
+	want = []string{"install", "-n", "example.com/tool@latest"}
+	if !slices.Equal(got, want) {
+		t.Errorf("installArgs() with dry run = %q, want %q", got, want)
+	}
+	got = installArgs(newConfig([]Option{WithModMode("readonly")}), nil, "example.com/tool@latest")
+	want = []string{"install", "-mod=readonly", "example.com/tool@latest"}
+	if !slices.Equal(got, want) {
+		t.Errorf("installArgs() with mod mode = %q, want %q", got, want)
+	}
+	got = installArgs(newConfig(nil), []string{"netgo", "osusergo"}, "example.com/tool@latest")
+	want = []string{"install", "-tags=netgo,osusergo", "example.com/tool@latest"}
+	if !slices.Equal(got, want) {
+		t.Errorf("installArgs() with tags = %q, want %q", got, want)
+	}
+	for _, opts := range [][]Option{
+		{WithParallelism(0)},
+		{WithModMode("vendor")},
+		{WithModMode("fast")},
+	} {
+		if err := newConfig(opts).validate(); !errors.Is(err, ErrInvalidOption) {
+			t.Errorf("validate() error = %v, want %v", err, ErrInvalidOption)
+		}
+	}
+	if err := newConfig([]Option{WithModMode("vendor"), WithLocalModule(t.TempDir())}).validate(); err != nil {
+		t.Errorf("validate() with local module error = %v", err)
+	}
+}
+
+func TestUpgrade_contextDeadline(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	res := Upgrade(ctx, "", m.options()...)
+	if !errors.Is(res.ExitError, context.DeadlineExceeded) {
+		t.Errorf("ExitError = %v, want %v", res.ExitError, context.DeadlineExceeded)
+	}
+}
+
+func Test_defaultRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{classifyInstallError(errors.New("exit status 1"), []byte("dial tcp: lookup proxy.golang.org: no such host")), true},
+		{classifyInstallError(errors.New("exit status 1"), []byte("reading https://proxy.golang.org/...: 503 Service Unavailable")), true},
+		{classifyInstallError(errors.New("exit status 1"), []byte("reading https://proxy.golang.org/...: 404 Not Found")), false},
+		{errors.New("exit status 1"), false},
+	}
+	for _, tt := range tests {
+		if got := defaultRetryable(tt.err, nil); got != tt.want {
+			t.Errorf("defaultRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestUpgrade_retryPredicate(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+
+	var calls int
+	opts := append(m.options(),
+		WithEnv("GOPROXY=off"),
+		WithRetry(2, time.Millisecond),
+		WithRetryPredicate(func(err error, output []byte) bool {
+			calls++
+			return len(output) > 0
+		}),
+	)
+	res := Upgrade(context.Background(), "", opts...)
+	if res.ExitError == nil {
+		t.Fatal("ExitError = nil, want an error")
+	}
+	// Consulted after the first two attempts only, as the third has no
+	// retries left.
+	if calls != 2 {
+		t.Errorf("predicate called %d times, want 2", calls)
+	}
+
+	if err := newConfig([]Option{WithRetry(-1, 0)}).validate(); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("validate() error = %v, want %v", err, ErrInvalidOption)
+	}
+}
+
+func Test_localPackage(t *testing.T) {
+	for pkg, want := range map[string]string{"": ".", "cmd/tool": "./cmd/tool", "/cmd/tool/": "./cmd/tool"} {
+		if got := localPackage(pkg); got != want {
+			t.Errorf("localPackage(%q) = %q, want %q", pkg, got, want)
+		}
+	}
+}
+
+func TestUpgrade_localModule(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake")
+	fakeBuildInfo(t, m.path, "(devel)")
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "go.mod"), []byte("module "+m.path+"\n\ngo 1.21\n"))
+	writeFile(t, filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {}\n"))
+
+	res := Upgrade(context.Background(), "", append(m.options(), WithLocalModule(dir))...)
+	if res.ExitError != nil {
+		t.Fatal(res.ExitError)
+	}
+	if res.SkipReason != "" {
+		t.Fatalf("SkipReason = %q, want none", res.SkipReason)
+	}
+	if res.InstalledPath != m.binary() {
+		t.Errorf("InstalledPath = %q, want %q", res.InstalledPath, m.binary())
+	}
+}
+
+func Test_dirWritable(t *testing.T) {
+	dir := t.TempDir()
+	if !dirWritable(dir) || !dirWritable(filepath.Join(dir, "missing", "bin")) {
+		t.Error("dirWritable() = false for a writable directory")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("dirWritable() left %d entries behind", len(entries))
+	}
+	if err := os.Chmod(dir, 0o555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(dir, 0o755) })
+	if checkWritable(dir) == nil {
+		t.Skip("read-only directories are writable, as when running as root")
+	}
+	if dirWritable(dir) {
+		t.Error("dirWritable() = true for a read-only directory")
+	}
+}
+
+func Test_config_goCommand(t *testing.T) {
+	if got, _ := newConfig(nil).goCommand(); got != "go" {
+		t.Errorf("goCommand() = %q, want go", got)
+	}
+	if got, _ := newConfig([]Option{WithGoBinary("/opt/go/bin/go"), WithGoVersion("1.22.5")}).goCommand(); got != "/opt/go/bin/go" {
+		t.Errorf("goCommand() with WithGoBinary = %q, want /opt/go/bin/go", got)
+	}
+	calls := 0
+	located := newConfig([]Option{WithGoLocator(func() (string, error) {
+		calls++
+		return "/usr/local/go/bin/go", nil
+	})})
+	for i := 0; i < 2; i++ {
+		if got, err := located.goCommand(); err != nil || got != "/usr/local/go/bin/go" {
+			t.Errorf("goCommand() with WithGoLocator = %q, %v, want /usr/local/go/bin/go", got, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("locator called %d times, want 1", calls)
+	}
+	for _, locate := range []func() (string, error){
+		func() (string, error) { return "", errors.New("not found") },
+		func() (string, error) { return "", nil },
+	} {
+		if got, err := newConfig([]Option{WithGoLocator(locate)}).goCommand(); got != "" || !errors.Is(err, ErrGoNotFound) {
+			t.Errorf("goCommand() with a failing locator = %q, %v, want %v", got, err, ErrGoNotFound)
+		}
+	}
+
+	if runtime.GOOS == "windows" {
+		t.Skip("fake launcher is a shell script")
+	}
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+	cfg := newConfig([]Option{WithGoVersion("1.22.5")})
+	if _, err := cfg.goCommand(); !errors.Is(err, ErrGoNotFound) {
+		t.Errorf("goCommand() error = %v, want %v", err, ErrGoNotFound)
+	}
+	launcher := filepath.Join(dir, "go1.22.5")
+	if err := os.WriteFile(launcher, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := cfg.goCommand(); err != nil || got != launcher {
+		t.Errorf("goCommand() = %q, %v, want %q", got, err, launcher)
+	}
+	if env := cfg.environ(); !slices.Contains(env, "GOTOOLCHAIN=local") {
+		t.Error("environ() with WithGoVersion does not set GOTOOLCHAIN=local")
+	}
+}
+
+func Test_runInstall_output(t *testing.T) {
+	var out bytes.Buffer
+	stderr, err := runInstall(context.Background(), "go", "", os.Environ(), []string{"nosuchcommand"}, nil, &out, nil)
+	if err == nil {
+		t.Fatal("runInstall() with an unknown go command succeeded")
+	}
+	if len(stderr) == 0 || !bytes.Equal(out.Bytes(), stderr) {
+		t.Errorf("output %q, want copy of stderr %q", out.Bytes(), stderr)
+	}
+}
+
+func TestUpgrade_goInstallDryRun(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+
+	res := Upgrade(context.Background(), "", append(m.options(), WithGoInstallDryRun(true))...)
+	if res.ExitError != nil {
+		t.Fatalf("Upgrade() error = %v", res.ExitError)
+	}
+	if !strings.Contains(res.DryRunCommands, "$WORK") {
+		t.Errorf("DryRunCommands = %q, want go install -n output", res.DryRunCommands)
+	}
+	if res.InstalledPath != "" {
+		t.Errorf("InstalledPath = %q after dry run, want empty", res.InstalledPath)
+	}
+	if _, err := os.Stat(m.binary()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("binary installed by dry run: %v", err)
+	}
+}
+
+// TestHelperProcess stands in for the go command or an installed binary in
+// tests that run it, behaving as AUTOUPGRADE_HELPER_PROCESS says: "stdin"
+// reports what it read from standard input on standard error, "fail" exits
+// with status 1 and "hang" never exits.
+func TestHelperProcess(t *testing.T) {
+	switch os.Getenv("AUTOUPGRADE_HELPER_PROCESS") {
+	case "stdin":
+		data, err := io.ReadAll(os.Stdin)
+		fmt.Fprintf(os.Stderr, "stdin %q %v", data, err)
+		os.Exit(0)
+	case "fail":
+		fmt.Fprint(os.Stderr, "broken")
+		os.Exit(1)
+	case "hang":
+		time.Sleep(time.Hour)
+	}
+}
+
+func Test_runInstall_stdin(t *testing.T) {
+	// Even with data waiting on the parent's stdin, the child must see
+	// an empty stream rather than block reading it.
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	w.Write([]byte("y\n"))
+	orig := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = orig }()
+
+	env := append(os.Environ(), "AUTOUPGRADE_HELPER_PROCESS=stdin")
+	stderr, err := runInstall(context.Background(), os.Args[0], "", env, []string{"-test.run=^TestHelperProcess$"}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("runInstall() error = %v: %s", err, stderr)
+	}
+	if got, want := string(stderr), `stdin "" <nil>`; got != want {
+		t.Errorf("child read %s, want %s", got, want)
+	}
+}
+
+// writeGoShim writes a shell script that stands in for the go command: it
+// reports version for 'go env GOVERSION', logs the arguments of each run to
+// the returned file, and for 'go install' writes a placeholder binary to
+// GOBIN.
+func writeGoShim(t *testing.T, version string) (shim, log string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script shim not supported on windows")
+	}
+	dir := t.TempDir()
+	shim, log = filepath.Join(dir, "go"), filepath.Join(dir, "log")
+	script := `#!/bin/sh
+echo "$@" >> "` + log + `"
+case "$1" in
+env) echo ` + version + ` ;;
+install) echo shim > "$GOBIN/fake" ;;
+esac
+`
+	if err := os.WriteFile(shim, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return shim, log
+}
+
+func TestUpgrade_goShim(t *testing.T) {
+	proxy := t.TempDir()
+	dir := filepath.Join(proxy, "example.com", "fake", "@v")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(proxy, "example.com", "fake", "@latest"), []byte(`{"Version":"v1.2.0"}`))
+	writeFile(t, filepath.Join(dir, "list"), []byte("v1.0.0\nv1.1.0\nv1.2.0\n"))
+	writeFile(t, filepath.Join(dir, "v1.1.0.mod"), []byte("module example.com/fake\n\ngo 1.21\n"))
+	writeFile(t, filepath.Join(dir, "v1.2.0.mod"), []byte("module example.com/fake\n\ngo 1.22\n"))
+	fakeBuildInfo(t, "example.com/fake", "v1.0.0")
+	shim, log := writeGoShim(t, "go1.21.5")
+	gobin := t.TempDir()
+
+	res := Upgrade(context.Background(), "",
+		WithGoBinary(shim),
+		WithEnv("GOPROXY=file://"+filepath.ToSlash(proxy), "GOBIN="+gobin),
+		WithToolchainCompatibleOnly(true),
+		WithVerifyModulePath(false),
+	)
+	if res.ExitError != nil {
+		t.Fatalf("Upgrade() error = %v", res.ExitError)
+	}
+	if want := filepath.Join(gobin, "fake"); res.InstalledPath != want {
+		t.Errorf("InstalledPath = %q, want %q", res.InstalledPath, want)
+	}
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "env GOVERSION\ninstall example.com/fake@v1.1.0\n"; got != want {
+		t.Errorf("go shim ran:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func Test_checkInstallTarget(t *testing.T) {
+	for target, ok := range map[string]bool{
+		"mirror.internal/tool/cmd/tool@v1.2.3": true,
+		"mirror.internal/tool@latest":          true,
+		"mirror.internal/tool":                 false,
+		"mirror.internal/tool@v1@v2":           false,
+		"@v1.2.3":                              false,
+		"-toolexec=evil@v1":                    false,
+		"mirror.internal/../tool@v1":           false,
+		"mirror.internal//tool@v1":             false,
+		"/abs/tool@v1":                         false,
+		"mirror.internal/tool@v1 -x":           false,
+	} {
+		if got := checkInstallTarget(target) == ""; got != ok {
+			t.Errorf("checkInstallTarget(%q) = %q, want ok %v", target, checkInstallTarget(target), ok)
+		}
+	}
+}
+
+func TestUpgrade_targetRewriter(t *testing.T) {
+	fakeBuildInfo(t, "example.com/fake", "v1.0.0")
+	shim, log := writeGoShim(t, "go1.21.5")
+	opts := func(rewrite func(string) (string, error)) []Option {
+		return []Option{
+			WithGoBinary(shim),
+			WithEnv("GOBIN=" + t.TempDir()),
+			WithSkipPreCheck(true),
+			WithVerifyModulePath(false),
+			WithTargetRewriter(rewrite),
+		}
+	}
+	rewrite := func(target string) (string, error) {
+		return strings.Replace(target, "example.com/", "mirror.internal/", 1), nil
+	}
+
+	res := Upgrade(context.Background(), "", opts(rewrite)...)
+	if res.ExitError != nil {
+		t.Fatalf("Upgrade() error = %v", res.ExitError)
+	}
+	if want := "mirror.internal/fake@latest"; res.Target() != want {
+		t.Errorf("Target() = %q, want %q", res.Target(), want)
+	}
+	if data, _ := os.ReadFile(log); string(data) != "install mirror.internal/fake@latest\n" {
+		t.Errorf("go shim ran %q", data)
+	}
+
+	bad := func(string) (string, error) { return "-toolexec=evil@v1", nil }
+	res = Upgrade(context.Background(), "", opts(bad)...)
+	if !errors.Is(res.ExitError, ErrInvalidOption) {
+		t.Errorf("Upgrade() with bad rewrite error = %v, want ErrInvalidOption", res.ExitError)
+	}
+}
@@ -0,0 +1,185 @@
+package autoupgrade
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// ResolveInstallPath returns the path go install would write the binary for
+// packagePath of modulePath to, without running anything. It applies the go
+// command's rules: GOBIN if set, otherwise GOPATH/bin, with GOPATH
+// defaulting to $HOME/go. Settings are read from WithEnv, the process
+// environment, and the go env file written by 'go env -w', in that order.
+func ResolveInstallPath(modulePath, packagePath string, opts ...Option) (string, error) {
+	if err := validatePackagePath(packagePath); err != nil {
+		return "", err
+	}
+	return installTarget(newConfig(opts), modulePath, packagePath)
+}
+
+// installDir returns the directory go install writes binaries to: GOBIN if
+// set, otherwise the bin directory of the first GOPATH entry, which defaults
+// to $HOME/go. Cross-compiled binaries go in a GOOS_GOARCH subdirectory.
+func installDir(cfg *config) (string, error) {
+	if dir := cfg.getenv("GOBIN"); dir != "" && !cfg.crossCompiling() {
+		return dir, nil
+	}
+	gopath, err := gopathDir(cfg)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(gopath, "bin")
+	if cfg.crossCompiling() {
+		dir = filepath.Join(dir, cfg.targetOS()+"_"+cfg.targetArch())
+	}
+	return dir, nil
+}
+
+// gopathDir returns the first GOPATH entry, which defaults to $HOME/go.
+func gopathDir(cfg *config) (string, error) {
+	gopath := cfg.getenv("GOPATH")
+	if i := strings.IndexRune(gopath, filepath.ListSeparator); i >= 0 {
+		gopath = gopath[:i]
+	}
+	if gopath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		gopath = filepath.Join(home, "go")
+	}
+	return gopath, nil
+}
+
+// binaryName returns the file name go install gives the binary for a package:
+// the last element of its import path, skipping a trailing major version
+// suffix such as "/v2", or the name set with WithBinaryName, plus ".exe" for
+// Windows targets.
+func binaryName(cfg *config, importPath string) string {
+	if cfg.binaryName != "" {
+		name := cfg.binaryName
+		if cfg.targetOS() == "windows" && !strings.HasSuffix(name, ".exe") {
+			name += ".exe"
+		}
+		return name
+	}
+	name := path.Base(importPath)
+	if dir := path.Dir(importPath); dir != "." && pathMajor(importPath) >= 2 && strings.HasPrefix(name, "v") {
+		name = path.Base(dir)
+	}
+	if cfg.targetOS() == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// installTarget returns the path go install writes packagePath of modulePath
+// to.
+func installTarget(cfg *config, modulePath, packagePath string) (string, error) {
+	dir, err := installDir(cfg)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, binaryName(cfg, importPath(modulePath, packagePath))), nil
+}
+
+// targetOS returns the GOOS the binary is built for.
+func (c *config) targetOS() string {
+	if c.goos != "" {
+		return c.goos
+	}
+	if goos := c.getenv("GOOS"); goos != "" {
+		return goos
+	}
+	return runtime.GOOS
+}
+
+// targetArch returns the GOARCH the binary is built for.
+func (c *config) targetArch() string {
+	if c.goarch != "" {
+		return c.goarch
+	}
+	if goarch := c.getenv("GOARCH"); goarch != "" {
+		return goarch
+	}
+	return runtime.GOARCH
+}
+
+// crossCompiling reports whether the binary is built for a platform other
+// than the host.
+func (c *config) crossCompiling() bool {
+	return c.targetOS() != runtime.GOOS || c.targetArch() != runtime.GOARCH
+}
+
+// executable returns the path of the running binary. It is a variable so
+// tests can stand in for an installed binary.
+var executable = os.Executable
+
+// modCacheDir returns the module cache directory: GOMODCACHE, defaulting to
+// pkg/mod in the first GOPATH entry.
+func modCacheDir(cfg *config) (string, error) {
+	if dir := cfg.getenv("GOMODCACHE"); dir != "" {
+		return dir, nil
+	}
+	gopath, err := gopathDir(cfg)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(gopath, "pkg", "mod"), nil
+}
+
+// executablePath returns the absolute path of the running binary, checking
+// that a file still exists there. Errors wrap ErrExecutablePathUnresolvable.
+func executablePath() (string, error) {
+	exe, err := executable()
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrExecutablePathUnresolvable, err)
+	}
+	if exe, err = filepath.Abs(exe); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrExecutablePathUnresolvable, err)
+	}
+	if _, err := os.Stat(exe); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrExecutablePathUnresolvable, err)
+	}
+	return exe, nil
+}
+
+// runningFromInstallTarget reports whether the running binary is the file go
+// install would replace, resolving symbolic links on both sides.
+func runningFromInstallTarget(cfg *config, modulePath, packagePath string) (bool, error) {
+	dst, err := installTarget(cfg, modulePath, packagePath)
+	if err != nil {
+		return false, err
+	}
+	exe, err := executable()
+	if err != nil {
+		return false, err
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(dst); err == nil {
+		dst = resolved
+	}
+	return filepath.Clean(exe) == filepath.Clean(dst), nil
+}
+
+// InstalledViaGoInstall reports whether the binary described by info looks like
+// it was built by 'go install pkg@version', and so most likely lives in GOBIN
+// where Upgrade can replace it, rather than by 'go build' in a checkout. It is
+// a heuristic: such binaries record a released version and a go.sum hash for
+// the main module, which comes from the module cache, and carry no vcs.*
+// build settings, while a go build in a repository records a "(devel)" or
+// "+dirty" version, no hash, and the VCS revision. It returns false for a nil
+// info.
+func InstalledViaGoInstall(info *debug.BuildInfo) bool {
+	if info == nil || info.Main.Sum == "" || !semverValid(info.Main.Version) {
+		return false
+	}
+	return !hasSetting(info, "vcs") && !hasSetting(info, "vcs.revision")
+}
@@ -0,0 +1,210 @@
+package autoupgrade
+
+import (
+	"context"
+	"debug/buildinfo"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"testing"
+)
+
+func Test_binaryName(t *testing.T) {
+	linux := newConfig([]Option{WithTargetPlatform("linux", "amd64")})
+	windows := newConfig([]Option{WithTargetPlatform("windows", "amd64")})
+	tests := []struct {
+		cfg  *config
+		path string
+		want string
+	}{
+		{linux, "example.com/tool", "tool"},
+		{linux, "example.com/tool/cmd/foo", "foo"},
+		{linux, "example.com/tool/v2", "tool"},
+		{linux, "example.com/tool/v2/cmd/foo", "foo"},
+		{windows, "example.com/tool", "tool.exe"},
+		{newConfig([]Option{WithTargetPlatform("linux", "amd64"), WithBinaryName("foo")}), "example.com/tool/cmd/bar", "foo"},
+		{newConfig([]Option{WithTargetPlatform("windows", "amd64"), WithBinaryName("foo")}), "example.com/tool", "foo.exe"},
+		{newConfig([]Option{WithTargetPlatform("windows", "amd64"), WithBinaryName("foo.exe")}), "example.com/tool", "foo.exe"},
+	}
+	for _, tt := range tests {
+		if got := binaryName(tt.cfg, tt.path); got != tt.want {
+			t.Errorf("binaryName(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+	if err := newConfig([]Option{WithBinaryName("bin/foo")}).validate(); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("validate() error = %v, want %v", err, ErrInvalidOption)
+	}
+}
+
+func TestUpgrade_installInProgress(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+	// Another install in this process is writing the binary.
+	release, _ := claimInstall(m.binary())
+	defer release()
+
+	res := Upgrade(context.Background(), "", m.options()...)
+	if res.SkipReason != SkipInstallInProgress {
+		t.Errorf("SkipReason = %q, want %q", res.SkipReason, SkipInstallInProgress)
+	}
+}
+
+func TestResolveInstallPath(t *testing.T) {
+	gobin := t.TempDir()
+	gopath := t.TempDir()
+	t.Setenv("GOENV", "off")
+	t.Setenv("GOPATH", gopath)
+
+	t.Run("GOBIN set", func(t *testing.T) {
+		t.Setenv("GOBIN", gobin)
+		got, err := ResolveInstallPath("example.com/tool", "cmd/foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := filepath.Join(gobin, binaryName(newConfig(nil), "foo")); got != want {
+			t.Errorf("ResolveInstallPath() = %q, want %q", got, want)
+		}
+	})
+	t.Run("GOBIN unset", func(t *testing.T) {
+		t.Setenv("GOBIN", "")
+		got, err := ResolveInstallPath("example.com/tool", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := filepath.Join(gopath, "bin", binaryName(newConfig(nil), "tool")); got != want {
+			t.Errorf("ResolveInstallPath() = %q, want %q", got, want)
+		}
+	})
+	t.Run("WithGoPath", func(t *testing.T) {
+		t.Setenv("GOBIN", "")
+		sandbox := t.TempDir()
+		got, err := ResolveInstallPath("example.com/tool", "", WithGoPath(sandbox))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := filepath.Join(sandbox, "bin", binaryName(newConfig(nil), "tool")); got != want {
+			t.Errorf("ResolveInstallPath() = %q, want %q", got, want)
+		}
+		got, err = ResolveInstallPath("example.com/tool", "", WithGoPath(sandbox), WithEnv("GOBIN="+gobin))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := filepath.Join(gobin, binaryName(newConfig(nil), "tool")); got != want {
+			t.Errorf("ResolveInstallPath() with GOBIN = %q, want %q", got, want)
+		}
+	})
+	t.Run("go env file", func(t *testing.T) {
+		t.Setenv("GOBIN", "")
+		goenv := filepath.Join(t.TempDir(), "env")
+		writeFile(t, goenv, []byte("GOBIN="+gobin+"\n"))
+		got, err := ResolveInstallPath("example.com/tool", "", WithEnv("GOENV="+goenv))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := filepath.Join(gobin, binaryName(newConfig(nil), "tool")); got != want {
+			t.Errorf("ResolveInstallPath() = %q, want %q", got, want)
+		}
+	})
+}
+
+func Test_runningFromInstallTarget(t *testing.T) {
+	gobin := t.TempDir()
+	cfg := newConfig([]Option{WithEnv("GOBIN=" + gobin)})
+	dst, err := installTarget(cfg, "example.com/tool", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, dst, nil)
+	link := filepath.Join(t.TempDir(), "tool")
+	if err := os.Symlink(dst, link); err != nil {
+		t.Skip(err)
+	}
+
+	orig := executable
+	t.Cleanup(func() { executable = orig })
+	for exe, want := range map[string]bool{dst: true, link: true, filepath.Join(t.TempDir(), "tool"): false} {
+		executable = func() (string, error) { return exe, nil }
+		got, err := runningFromInstallTarget(cfg, "example.com/tool", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("runningFromInstallTarget() with executable %s = %v, want %v", exe, got, want)
+		}
+	}
+}
+
+func TestUpgrade_requireInstalledInGoBin(t *testing.T) {
+	fakeBuildInfo(t, "example.com/fake", "v1.0.0")
+	res := Upgrade(context.Background(), "", WithEnv("GOBIN="+t.TempDir()), WithRequireInstalledInGoBin(true))
+	if res.SkipReason != SkipNotInGoBin {
+		t.Errorf("SkipReason = %q, want %q", res.SkipReason, SkipNotInGoBin)
+	}
+}
+
+func Test_executablePath(t *testing.T) {
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "tool")
+	writeFile(t, exe, nil)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel, err := filepath.Rel(wd, exe)
+	if err != nil {
+		t.Skip(err)
+	}
+
+	orig := executable
+	t.Cleanup(func() { executable = orig })
+	executable = func() (string, error) { return rel, nil }
+	if got, err := executablePath(); err != nil || got != exe {
+		t.Errorf("executablePath() with %q = %q, %v, want %q", rel, got, err, exe)
+	}
+
+	missing := filepath.Join(dir, "missing")
+	executable = func() (string, error) { return missing, nil }
+	if _, err := executablePath(); !errors.Is(err, ErrExecutablePathUnresolvable) {
+		t.Errorf("executablePath() with %q error = %v, want ErrExecutablePathUnresolvable", missing, err)
+	}
+	res := &UpgradeResult{}
+	if _, err := res.NewBuildInfo(); !errors.Is(err, ErrExecutablePathUnresolvable) {
+		t.Errorf("NewBuildInfo() error = %v, want ErrExecutablePathUnresolvable", err)
+	}
+}
+
+func TestInstalledViaGoInstall(t *testing.T) {
+	vcs := []debug.BuildSetting{{Key: "vcs", Value: "git"}, {Key: "vcs.revision", Value: "abc123"}}
+	tests := []struct {
+		name string
+		info *debug.BuildInfo
+		want bool
+	}{
+		{"nil", nil, false},
+		{"go install", &debug.BuildInfo{Main: debug.Module{Path: "example.com/tool", Version: "v1.2.3", Sum: "h1:abc="}}, true},
+		{"go build devel", &debug.BuildInfo{Main: debug.Module{Path: "example.com/tool", Version: "(devel)"}, Settings: vcs}, false},
+		{"go build tagged", &debug.BuildInfo{Main: debug.Module{Path: "example.com/tool", Version: "v1.2.3"}, Settings: vcs}, false},
+		{"go build with sum", &debug.BuildInfo{Main: debug.Module{Path: "example.com/tool", Version: "v1.2.3", Sum: "h1:abc="}, Settings: vcs}, false},
+	}
+	for _, tt := range tests {
+		if got := InstalledViaGoInstall(tt.info); got != tt.want {
+			t.Errorf("%s: InstalledViaGoInstall() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInstalledViaGoInstall_fakeModule(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0")
+	fakeBuildInfo(t, m.path, "v0.9.0")
+	if res := Upgrade(context.Background(), "", m.options()...); res.ExitError != nil {
+		t.Fatalf("Upgrade() error = %v", res.ExitError)
+	}
+	info, err := buildinfo.ReadFile(m.binary())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !InstalledViaGoInstall(info) {
+		t.Errorf("InstalledViaGoInstall() = false for a go install build, Main = %+v", info.Main)
+	}
+}
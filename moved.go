@@ -0,0 +1,122 @@
+package autoupgrade
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ModuleMovedError is returned when the module being upgraded has moved to a
+// new path, as reported by the go command or by a deprecation notice in the
+// module's go.mod. Passing NewPath to WithFallbackModulePaths lets binaries
+// built before the move keep upgrading. It matches ErrModuleMoved with
+// errors.Is.
+type ModuleMovedError struct {
+	OldPath     string // module path of the running binary, if known
+	NewPath     string // module path the module moved to
+	Deprecation string // the go.mod deprecation notice, if that is the source
+	Err         error  // the error that led to the move being detected
+}
+
+func (e *ModuleMovedError) Error() string {
+	msg := "autoupgrade: module moved to " + e.NewPath
+	if e.OldPath != "" {
+		msg = fmt.Sprintf("autoupgrade: module %s moved to %s", e.OldPath, e.NewPath)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *ModuleMovedError) Is(target error) bool { return target == ErrModuleMoved }
+
+func (e *ModuleMovedError) Unwrap() error { return e.Err }
+
+// declaredPathRE matches the go command's report that a module's go.mod
+// names a different path than the one requested.
+var declaredPathRE = regexp.MustCompile(`module declares its path as: (\S+)`)
+
+// declaredPath returns the new module path from go install output reporting
+// a path mismatch, or "".
+func declaredPath(stderr []byte) string {
+	if m := declaredPathRE.FindSubmatch(stderr); m != nil {
+		return string(m[1])
+	}
+	return ""
+}
+
+// modulePathRE matches a module path in free text, such as the replacement
+// named by a deprecation notice.
+var modulePathRE = regexp.MustCompile(`[a-z0-9-]+(\.[a-z0-9-]+)+(/[A-Za-z0-9_.~+-]+)+`)
+
+// deprecation returns the text of the "Deprecated:" comment on the module
+// directive of a go.mod file, or "".
+func deprecation(gomod []byte) string {
+	var comments []string
+	for _, line := range bytes.Split(gomod, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if text, ok := bytes.CutPrefix(line, []byte("//")); ok {
+			comments = append(comments, strings.TrimSpace(string(text)))
+			continue
+		}
+		if f := bytes.Fields(line); len(f) > 0 && string(f[0]) == "module" {
+			if _, text, ok := bytes.Cut(line, []byte("//")); ok {
+				comments = append(comments, strings.TrimSpace(string(text)))
+			}
+			for i, c := range comments {
+				if msg, ok := strings.CutPrefix(c, "Deprecated:"); ok {
+					return strings.TrimSpace(strings.Join(append([]string{msg}, comments[i+1:]...), " "))
+				}
+			}
+			return ""
+		}
+		comments = comments[:0]
+	}
+	return ""
+}
+
+// isNotFound reports whether err means the module or version does not exist.
+func isNotFound(err error) bool {
+	var perr *ProxyError
+	return errors.Is(err, ErrNotFound) || errors.As(err, &perr) && perr.notFound()
+}
+
+// checkModuleMoved looks for a deprecation notice naming a new path in the
+// go.mod of modulePath's newest release, or of current when none is listed,
+// after err reported the module or its versions missing. It returns err
+// wrapped in a *ModuleMovedError if one is found, and err otherwise.
+func checkModuleMoved(ctx context.Context, cfg *config, modulePath, current string, err error) error {
+	var moved *ModuleMovedError
+	if errors.As(err, &moved) {
+		moved.OldPath = modulePath
+		return err
+	}
+	version := current
+	if versions, _, lerr := listVersions(ctx, cfg, modulePath); lerr == nil && len(versions) > 0 {
+		version = versions[len(versions)-1]
+	}
+	if !semverValid(version) {
+		return err
+	}
+	name, gerr := versionFile(modulePath, version, ".mod")
+	if gerr != nil {
+		return err
+	}
+	gomod, _, gerr := proxyGet(ctx, cfg, name)
+	if gerr != nil {
+		return err
+	}
+	msg := deprecation(gomod)
+	for _, p := range modulePathRE.FindAllString(msg, -1) {
+		p = strings.TrimRight(p, ".")
+		if p != modulePath {
+			cfg.logf("%s is deprecated: %s", modulePath, msg)
+			return &ModuleMovedError{OldPath: modulePath, NewPath: p, Deprecation: msg, Err: err}
+		}
+	}
+	return err
+}
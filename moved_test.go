@@ -0,0 +1,62 @@
+package autoupgrade
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func Test_deprecation(t *testing.T) {
+	tests := []struct {
+		gomod string
+		want  string
+	}{
+		{"// Deprecated: use example.com/new instead.\nmodule example.com/old\n", "use example.com/new instead."},
+		{"module example.com/old // Deprecated: moved to example.com/new/v2\n", "moved to example.com/new/v2"},
+		{"// Deprecated: moved to\n// example.com/new.\nmodule example.com/old\n", "moved to example.com/new."},
+		{"// Package old does things.\nmodule example.com/old\n", ""},
+		{"// Deprecated: stale\n\nmodule example.com/old\n", ""},
+	}
+	for _, tt := range tests {
+		if got := deprecation([]byte(tt.gomod)); got != tt.want {
+			t.Errorf("deprecation(%q) = %q, want %q", tt.gomod, got, tt.want)
+		}
+	}
+}
+
+func Test_classifyInstallError_moved(t *testing.T) {
+	stderr := []byte("go: example.com/old@v1.2.0: parsing go.mod:\n\tmodule declares its path as: example.com/new\n\t        but was required as: example.com/old\n")
+	err := classifyInstallError(errors.New("exit status 1"), stderr)
+	var moved *ModuleMovedError
+	if !errors.As(err, &moved) || moved.NewPath != "example.com/new" || !errors.Is(err, ErrModuleMoved) {
+		t.Errorf("classifyInstallError() = %v, want a move to example.com/new", err)
+	}
+	err = classifyInstallError(errors.New("exit status 1"), []byte(`go: example.com/old@latest: no matching versions for query "latest"`))
+	if !errors.Is(err, ErrNoReleases) || !errors.Is(err, ErrNotFound) {
+		t.Errorf("classifyInstallError() = %v, want %v wrapping %v", err, ErrNoReleases, ErrNotFound)
+	}
+}
+
+func TestUpgrade_moduleMoved(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+	dir := filepath.Join(m.proxyDir, "example.com", "fake", "@v")
+	writeFile(t, filepath.Join(dir, "v1.1.0.mod"), []byte("// Deprecated: moved to example.com/fake2.\nmodule example.com/fake\n\ngo 1.21\n"))
+	// Served over HTTP so that go install reports the missing version
+	// with a status code, as with a real proxy.
+	srv := httptest.NewServer(http.FileServer(http.Dir(m.proxyDir)))
+	defer srv.Close()
+	resolve := func(ctx context.Context, modulePath string) (string, error) { return "v1.2.0", nil }
+
+	res := Upgrade(context.Background(), "", append(m.options(), WithEnv("GOPROXY="+srv.URL), WithVersionResolver(resolve))...)
+	var moved *ModuleMovedError
+	if !errors.As(res.ExitError, &moved) {
+		t.Fatalf("Upgrade() error = %v, want a *ModuleMovedError", res.ExitError)
+	}
+	if moved.OldPath != m.path || moved.NewPath != "example.com/fake2" || !isNotFound(moved) {
+		t.Errorf("moved = %+v, want %s to example.com/fake2 after a not-found error", moved, m.path)
+	}
+}
@@ -0,0 +1,1611 @@
+package autoupgrade
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Option configures optional behaviour of the functions in this package.
+type Option func(*config)
+
+type config struct {
+	userAgent         string
+	httpCache         string
+	env               []string
+	envFunc           func(env []string) []string
+	execPath          string
+	goos              string
+	goarch            string
+	jitter            time.Duration
+	adaptiveMin       time.Duration
+	adaptiveMax       time.Duration
+	mutex             sync.Locker
+	authOnce          sync.Once
+	auth              []credentialSet
+	rolling           bool
+	channelConfig     string
+	channel           string
+	parallelism       int
+	parallelismSet    bool
+	modMode           string
+	preserveBuildTags bool
+	verifyModulePath  bool
+	versionedName     bool
+	keepRunning       bool
+	elevate           string
+	dropPrivileges    bool
+	dropUID, dropGID  int
+	goGetTool         bool
+	trackDownloads    bool
+	reportPrereleases bool
+	binaryName        string
+	github            *githubRepo
+	githubAPI         string
+	githubToken       string
+	downloadProgress  func(downloaded, total int64)
+	modCache          string
+	buildCache        string
+	// insecureSkipChecksum permits the child to skip checksum verification.
+	insecureSkipChecksum bool
+	noSumDB              string
+	retries              int
+	retryBackoff         time.Duration
+	retryPredicate       func(err error, output []byte) bool
+	insecureModules      string
+	localModule          string
+	requireVCS           bool
+	develDetector        func(info *debug.BuildInfo) bool
+	versionFilter        func(v string) bool
+	versionResolver      VersionResolver
+	versionFile          string
+	constraint           string
+	resolvedVersion      string
+	allowDowngrade       bool
+	versionFileRequired  bool
+	httpClient           *http.Client
+	connectTimeout       time.Duration
+	readTimeout          time.Duration
+	requireInGoBin       bool
+	allowSystemDir       bool
+	proxy                string
+	vcsAllow             string
+	minDiskSpace         int64
+	cacheSizeLimit       int64
+	skipPreCheck         bool
+	goBinary             string
+	goLocator            func() (string, error)
+	goLocatorOnce        sync.Once
+	goLocated            string
+	goLocatorErr         error
+	goVersion            string
+	stateFile            string
+	failureBackoff       time.Duration
+	restart              bool
+	pseudoPolicy         PseudoVersionPolicy
+	crossChannel         bool
+	assetSelector        func(assets []ReleaseAsset, goos, goarch string) (ReleaseAsset, error)
+	verbosity            int
+	logger               *log.Logger
+	installOutput        io.Writer
+	tailLines            int
+	onTailLine           func(string)
+	fallbackModulePaths  []string
+	goInstallDryRun      bool
+	verifyCommand        []string
+	verifyFunc           func(binaryPath string) error
+	requireStatic        bool
+	verifyTimeout        time.Duration
+	timeout              time.Duration
+	expvarName           string
+	correlation          string
+	keepOnVerifyTimeout  bool
+	hooks                *Hooks
+	onPhase              func(Phase) // set by StartUpgrade
+	preUpgrade           func(current, target string) error
+	goPath               string
+	toolchainCompatible  bool
+	minReleaseAge        time.Duration
+	alreadyLatestOK      bool
+	expectedHashes       map[string]string
+	upgradeLog           string
+	targetRewriter       func(target string) (string, error)
+	concurrentProxies    bool
+	maxVersion           string
+}
+
+// installMu is the default guard serializing go install runs within the
+// process.
+var installMu sync.Mutex
+
+func newConfig(opts []Option) *config {
+	c := &config{
+		userAgent:        defaultUserAgent(),
+		mutex:            &installMu,
+		verifyModulePath: true,
+		githubAPI:        defaultGitHubAPI,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	// WithVerbosity only fills in what was not set explicitly, whatever the
+	// order of the options.
+	if c.verbosity >= 1 && c.logger == nil {
+		c.logger = log.Default()
+	}
+	if c.verbosity >= 2 && c.installOutput == nil {
+		c.installOutput = os.Stderr
+	}
+	return c
+}
+
+// logf logs through the logger set with WithLogger or WithVerbosity, if any.
+func (c *config) logf(format string, args ...any) {
+	if c.logger == nil {
+		return
+	}
+	if c.correlation != "" {
+		format = "[" + c.correlation + "] " + format
+	}
+	c.logger.Printf("autoupgrade: "+format, args...)
+}
+
+// WithCorrelationID sets an ID, such as a trace ID, that ties the upgrade to
+// the operation that started it. It is sent in the X-Correlation-ID header of
+// every HTTP request this package makes, prefixed to log lines, and reported
+// in UpgradeResult.CorrelationID. Requests made by go install itself do not
+// carry it. Without this option the ID is taken from the context, if set
+// with ContextWithCorrelationID.
+func WithCorrelationID(id string) Option {
+	return func(c *config) {
+		c.correlation = id
+	}
+}
+
+// WithHTTPCache keeps module proxy responses in dir, which is created if
+// needed, and honors the proxy's caching headers: a response still fresh
+// under its Cache-Control max-age is reused without a request, and a stale
+// one is revalidated with its ETag or Last-Modified date, a 304 reply reusing
+// the stored body. Responses marked no-store, or with neither validators nor
+// a max-age, are not kept. This saves bandwidth and latency for frequent
+// checks, such as CheckLatest on every start, against a compliant mirror.
+// Responses to authenticated requests are stored too, so dir should be
+// private to the user. Without it every check makes a plain request.
+func WithHTTPCache(dir string) Option {
+	return func(c *config) {
+		c.httpCache = dir
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent on requests to the module
+// proxy. It defaults to "autoupgrade/<version>".
+func WithUserAgent(userAgent string) Option {
+	return func(c *config) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithEnv adds environment variables, in "KEY=value" form, to the process
+// environment seen by this package. They are passed to the go command and
+// take precedence over the process environment when the proxy helpers read
+// settings such as GOPROXY.
+func WithEnv(env ...string) Option {
+	return func(c *config) {
+		c.env = append(c.env, env...)
+	}
+}
+
+// WithEnvFunc lets transform rewrite the environment of every go command
+// Upgrade runs, for cases the other options do not cover. It receives the
+// environment as it would otherwise be, the process environment followed by
+// the variables from WithEnv and the other options, with later entries
+// taking precedence, and returns the final slice. It runs last, after every
+// other option; the only change made afterwards is the temporary GOBIN used
+// to stage WithVersionedName and WithReplaceRunning(false) installs.
+// Settings this package reads itself, such as GOBIN and GOPROXY, are also
+// read from the transformed environment.
+func WithEnvFunc(transform func(env []string) []string) Option {
+	return func(c *config) {
+		c.envFunc = transform
+	}
+}
+
+// WithExecutablePath overrides the path of the binary inspected after an
+// upgrade, which defaults to the installed binary, or os.Executable when
+// nothing was installed. This is useful when a launcher runs the real binary
+// from elsewhere, or to point tests at a fixture.
+//
+// The path is used as given: go install always writes to GOBIN (or
+// GOPATH/bin), so NewBuildInfo only reflects the upgrade when path is the
+// binary in that directory.
+func WithExecutablePath(path string) Option {
+	return func(c *config) {
+		c.execPath = path
+	}
+}
+
+// WithTargetPlatform installs the binary for the given GOOS and GOARCH rather
+// than the host platform. The go command places cross-compiled binaries in an
+// arch-named directory, GOPATH/bin/GOOS_GOARCH, so GOBIN is cleared for the
+// install. The pair is validated against 'go tool dist list' before
+// installing.
+func WithTargetPlatform(goos, goarch string) Option {
+	return func(c *config) {
+		c.goos = goos
+		c.goarch = goarch
+	}
+}
+
+// WithJitter randomizes each Watcher check by up to max, including the first
+// one, so that many instances started together do not hit the proxy at the
+// same moment.
+func WithJitter(max time.Duration) Option {
+	return func(c *config) {
+		c.jitter = max
+	}
+}
+
+// WithAdaptiveInterval lets a Watcher vary its interval between min and max
+// instead of always waiting the interval given to NewWatcher, which is only
+// the starting point. Each check that finds the binary already at the target
+// doubles the interval, up to max, saving proxy requests in steady state. An
+// upgrade, or a failure that Classify reports as transient or a network
+// problem, drops it back to min so the next check comes soon after a release
+// or an outage. min must be positive and max at least min.
+func WithAdaptiveInterval(min, max time.Duration) Option {
+	return func(c *config) {
+		c.adaptiveMin, c.adaptiveMax = min, max
+	}
+}
+
+// WithMutex sets the lock held while go install runs, in place of the
+// package's internal guard. It lets an application coordinate the install with
+// its own critical sections, such as pausing request handling.
+func WithMutex(mu sync.Locker) Option {
+	return func(c *config) {
+		c.mutex = mu
+	}
+}
+
+// WithRollingChannel treats any build whose version is not a tagged release,
+// such as a pseudo-version, an unstamped "(devel)" build or a "+dirty" build,
+// as upgradeable to the resolved target. DidUpgrade then compares VCS
+// revisions and commit times rather than versions, so it reports an upgrade
+// when moving to a newer pseudo-version. This suits nightly-style
+// distribution from a branch.
+func WithRollingChannel(rolling bool) Option {
+	return func(c *config) {
+		c.rolling = rolling
+	}
+}
+
+// WithInsecureSkipChecksum disables checksum database verification of the
+// downloaded module by setting GOSUMDB=off for go install. Without it, a
+// GOSUMDB that is off or names another database, -insecure in GOFLAGS,
+// GONOSUMDB, and GOPRIVATE standing in for GONOSUMDB are dropped from the
+// environment and the go env file, so an attacker-controlled environment
+// cannot weaken verification of the new binary. GOPRIVATE then only sets GONOPROXY. Use
+// WithNoSumDB to exempt private modules.
+func WithInsecureSkipChecksum(skip bool) Option {
+	return func(c *config) {
+		c.insecureSkipChecksum = skip
+	}
+}
+
+// WithNoSumDB sets GONOSUMDB to patterns for go install, a comma-separated
+// list of module path prefix patterns, as for GOPRIVATE, whose modules are
+// not checked against the checksum database. This is meant for private
+// modules the database cannot know. Without this option any GONOSUMDB
+// setting is dropped from the environment, and GOPRIVATE no longer exempts
+// modules from the database.
+func WithNoSumDB(patterns string) Option {
+	return func(c *config) {
+		c.noSumDB = patterns
+	}
+}
+
+// WithProxy sets GOPROXY for go install and the proxy helpers, such as
+// "direct" to fetch modules straight from their VCS when there is no module
+// proxy, for instance for a private fork. Variables given with WithEnv take
+// precedence.
+func WithProxy(goproxy string) Option {
+	return func(c *config) {
+		c.proxy = goproxy
+	}
+}
+
+// WithVCSAllow sets GOVCS for go install, the comma-separated list of
+// pattern:vcslist rules deciding which version control tools may be used to
+// fetch modules in direct mode, such as "corp.example.com:git,*:off". By
+// default the go command only allows git and hg for public modules. The
+// syntax is checked before installing.
+func WithVCSAllow(globs string) Option {
+	return func(c *config) {
+		c.vcsAllow = globs
+	}
+}
+
+// WithInsecureModules sets GOINSECURE to globs for go install, a
+// comma-separated list of module path prefix patterns, as for GOPRIVATE, that
+// may be fetched directly over plain HTTP and without verifying TLS
+// certificates. This is meant for on-premises servers that are not fronted by
+// TLS. The proxy helpers likewise skip certificate verification for proxies
+// whose host and path match globs; plain http:// proxies are accepted as they
+// are by the go command.
+//
+// Anyone able to intercept traffic to matching hosts can then substitute
+// their own code, which the upgrade installs and runs, so globs should be as
+// narrow as possible and the checksum database left enabled where it can be.
+// Without this option any GOINSECURE setting is dropped from the environment.
+func WithInsecureModules(globs string) Option {
+	return func(c *config) {
+		c.insecureModules = globs
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for module proxy and GitHub
+// requests, in place of http.DefaultClient, for example to configure a
+// custom transport, dialer or proxy. WithProxyTimeouts and the certificate
+// handling of WithInsecureModules do not apply to it.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *config) {
+		c.httpClient = client
+	}
+}
+
+// WithConcurrentProxies sends the @latest query to every GOPROXY entry at
+// once, up to the first "direct" or "off", and takes the first successful
+// answer, canceling the other requests. This speeds up CheckLatest and the
+// Upgrade pre-check when an early proxy is slow and a later one fast. It
+// diverges from the go command's strict sequential fallback: a later proxy's
+// answer may be used even where an earlier one would have answered too, or
+// failed with an error that stops the lookup. When every proxy fails, the
+// error is the one the sequential lookup would have returned.
+func WithConcurrentProxies(concurrent bool) Option {
+	return func(c *config) {
+		c.concurrentProxies = concurrent
+	}
+}
+
+// WithProxyTimeouts bounds module proxy and GitHub requests without limiting
+// their total duration. connect limits establishing the connection, including
+// the TLS handshake, so a dead proxy fails fast; read limits how long to wait
+// for the response to start and for each further piece of the body, so a
+// large response from a slow mirror still completes as long as it keeps
+// arriving. A zero value leaves that phase unbounded.
+func WithProxyTimeouts(connect, read time.Duration) Option {
+	return func(c *config) {
+		c.connectTimeout = connect
+		c.readTimeout = read
+	}
+}
+
+// WithChannelConfig sets the path of a JSON file mapping release channel names
+// to the version to install: "latest", an explicit version such as "v1.4.2",
+// or a constraint such as ">=1.5.0-0, <2.0.0" resolved against the versions
+// on the module proxy. The file is read on every Upgrade, so edits take effect
+// without restarting.
+func WithChannelConfig(path string) Option {
+	return func(c *config) {
+		c.channelConfig = path
+	}
+}
+
+// WithChannel selects the release channel from the channel config. Without
+// it, the config's "default" entry is used, or "latest" if there is none.
+func WithChannel(name string) Option {
+	return func(c *config) {
+		c.channel = name
+	}
+}
+
+// WithParallelism limits go install to building n packages in parallel by
+// passing -p n, to avoid starving other workloads on the machine. Unlike
+// setting GOMAXPROCS for the child, which only limits the threads of the go
+// command itself, -p bounds the number of concurrent compiler and linker
+// processes, which is where the build spends its CPU. n must be positive.
+func WithParallelism(n int) Option {
+	return func(c *config) {
+		c.parallelism = n
+		c.parallelismSet = true
+	}
+}
+
+// WithModMode passes -mod=mode to go install. For the usual pkg@version
+// install the go command ignores any go.mod in the working directory and
+// resolves only the target module's own graph, so "readonly" and "mod"
+// behave alike there and "vendor" is rejected. The flag matters with
+// WithLocalModule, where "vendor" builds from a checked-in vendor directory
+// without loading the module graph at all, and "readonly" fails rather than
+// updating go.mod. mode must be "mod", "readonly" or "vendor"; "vendor"
+// requires WithLocalModule.
+func WithModMode(mode string) Option {
+	return func(c *config) {
+		c.modMode = mode
+	}
+}
+
+// WithExpectedHash pins the module hash approved for version, in go.sum form
+// such as "h1:abc...=", on top of the go command's checksum database check.
+// After go install, the hash the module cache recorded for the installed
+// version's zip is compared with it; on a mismatch, or if the installed
+// version has no expected hash, the previous binary is restored and the error
+// wraps ErrHashMismatch. Use it once per approved version. It applies only to
+// the go install backend and cannot be combined with WithTargetRewriter.
+// version is normalized as with NormalizeVersion.
+func WithExpectedHash(version, hash string) Option {
+	return func(c *config) {
+		if c.expectedHashes == nil {
+			c.expectedHashes = make(map[string]string)
+		}
+		c.expectedHashes[normalizeVersion(strings.TrimSpace(version))] = hash
+	}
+}
+
+// WithPreserveBuildTags passes the build tags the running binary was built
+// with, such as netgo or osusergo, to go install, so that an upgrade does not
+// silently change the binary's feature set. The tags are read from the -tags
+// build setting with BuildTags and recorded in UpgradeResult.BuildTags. It
+// has no effect with WithGitHubRelease, whose assets are prebuilt.
+func WithPreserveBuildTags(preserve bool) Option {
+	return func(c *config) {
+		c.preserveBuildTags = preserve
+	}
+}
+
+// WithVerifyModulePath controls whether the installed binary's module path is
+// checked against the module being upgraded. It is enabled by default; on a
+// mismatch the previous binary is restored and ErrModulePathMismatch
+// returned. Disable it only when installing a module whose binary reports a
+// different path on purpose.
+func WithVerifyModulePath(verify bool) Option {
+	return func(c *config) {
+		c.verifyModulePath = verify
+	}
+}
+
+// WithBinaryName sets the file name go install is expected to produce, such
+// as "foo", for when it differs from the last element of the package path
+// that Upgrade infers it from. It is used to find the binary to verify, back
+// up and rename, and by ResolveInstallPath. ".exe" is added for Windows
+// targets if missing. name must be a plain file name.
+func WithBinaryName(name string) Option {
+	return func(c *config) {
+		c.binaryName = name
+	}
+}
+
+// WithVersionedName installs the binary under a versioned file name,
+// "<name>-<version>", in the install directory instead of replacing the
+// existing binary, for workflows that keep every version side by side. The
+// final path is reported in UpgradeResult.InstalledPath. It cannot be combined
+// with WithTargetPlatform, as go install does not allow GOBIN for
+// cross-compiled binaries.
+func WithVersionedName(versioned bool) Option {
+	return func(c *config) {
+		c.versionedName = versioned
+	}
+}
+
+// WithReplaceRunning(false) installs the new binary to a staging path next to
+// the install target, "<name>.new", leaving the binary at the target, and so
+// the running process, untouched. UpgradeResult.InstalledPath is the staged
+// binary and StagedFor the path it is meant to replace, so that a supervisor
+// can swap it in with Activate and restart on its own schedule. The default,
+// true, replaces the target in place. Staging cannot be combined with
+// WithVersionedName, or with WithTargetPlatform for go install.
+func WithReplaceRunning(replace bool) Option {
+	return func(c *config) {
+		c.keepRunning = !replace
+	}
+}
+
+// WithGoGetTool updates the running binary with 'go get -tool' when it was
+// started with 'go tool' from a module that declares it as a Go 1.24 tool
+// dependency. go install would write a binary go tool never runs, so such an
+// upgrade is otherwise skipped with SkipToolDependency. The go.mod and
+// go.sum found from the working directory are changed, and the new version
+// runs the next time go tool starts it; nothing is installed, so
+// InstalledPath stays empty.
+func WithGoGetTool(enabled bool) Option {
+	return func(c *config) {
+		c.goGetTool = enabled
+	}
+}
+
+// WithGitHubRelease installs new versions from the latest GitHub release of
+// owner/repo instead of with go install, which does not require a Go
+// toolchain on the machine. The release asset whose name contains the target
+// GOOS and GOARCH (or common aliases such as "x86_64" and "macos") replaces
+// the running executable, or the path given with WithExecutablePath in place
+// of it. A .tar.gz or .zip asset is unpacked and the binary inside it
+// installed. The release tag is compared against the current version: an
+// older release is blocked with PolicyDowngrade unless WithAllowDowngrade is
+// set, and WithConstraint, WithMaxVersion and WithVersionFilter apply to it.
+// Only the latest release is considered, so one they reject is skipped.
+func WithGitHubRelease(owner, repo string) Option {
+	return func(c *config) {
+		c.github = &githubRepo{owner: owner, repo: repo}
+	}
+}
+
+// WithGitHubAPI sets the GitHub REST API root used by WithGitHubRelease and
+// GitHubLatestRelease, such as "https://github.example.com/api/v3" for GitHub
+// Enterprise. It defaults to https://api.github.com.
+func WithGitHubAPI(baseURL string) Option {
+	return func(c *config) {
+		c.githubAPI = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithGitHubToken authenticates GitHub API requests and asset downloads
+// with token, for private repositories and higher rate limits. Assets are
+// then downloaded through the API's release asset endpoint rather than
+// their browser download URL. The token is only sent to the API host and
+// the GitHub site it belongs to.
+func WithGitHubToken(token string) Option {
+	return func(c *config) {
+		c.githubToken = token
+	}
+}
+
+// WithAssetSelector sets the function choosing which asset of the GitHub
+// release to install for the target goos and goarch, for projects whose
+// asset names DefaultAssetSelector does not recognise. An error from sel
+// ends the upgrade and is reported in ExitError.
+func WithAssetSelector(sel func(assets []ReleaseAsset, goos, goarch string) (ReleaseAsset, error)) Option {
+	return func(c *config) {
+		c.assetSelector = sel
+	}
+}
+
+// WithDownloadProgress sets a function called as a GitHub release asset
+// downloads, with the bytes downloaded so far and the total size from
+// Content-Length, or -1 if unknown. It is called at most every 100ms, and once
+// more when the download completes.
+func WithDownloadProgress(fn func(downloaded, total int64)) Option {
+	return func(c *config) {
+		c.downloadProgress = fn
+	}
+}
+
+// WithModCache sets GOMODCACHE for go install, so the module download cache
+// can live in a shared, writable directory, such as in a container whose home
+// directory is read-only. The directory is created if needed and checked to
+// be writable before installing.
+func WithModCache(dir string) Option {
+	return func(c *config) {
+		c.modCache = dir
+	}
+}
+
+// WithBuildCache sets GOCACHE for go install, with the same checks as
+// WithModCache. A shared build cache also speeds up repeated installs.
+func WithBuildCache(dir string) Option {
+	return func(c *config) {
+		c.buildCache = dir
+	}
+}
+
+// WithGoPath sets GOPATH for go install, so that the install, and the module
+// cache when WithModCache is not set, stay inside dir rather than the user's
+// default GOPATH. The binary is written to GOPATH/bin unless GOBIN is set, as
+// with the go command. dir must be absolute; it is created if needed and
+// checked to be writable before installing.
+func WithGoPath(dir string) Option {
+	return func(c *config) {
+		c.goPath = dir
+	}
+}
+
+// WithMinReleaseAge gives releases a bake time: a version published less than
+// d ago, by the time the module proxy reports for it, is not installed. The
+// newest older version that has aged enough, and that the channel,
+// prerelease channel or WithConstraint allows, is installed instead, or the
+// upgrade is skipped with SkipTooFresh when every newer version is too
+// recent, to be picked up by a later check. Decision.Blocked records the
+// version passed over. It does not apply with WithLocalModule.
+func WithMinReleaseAge(d time.Duration) Option {
+	return func(c *config) {
+		c.minReleaseAge = d
+	}
+}
+
+// WithToolchainCompatibleOnly installs the newest version whose go.mod go
+// directive the local go command satisfies. It suits machines where toolchain
+// downloads are disabled, as with GOTOOLCHAIN=local, and go install would
+// otherwise fail for a release that requires a newer Go. When the selected
+// version requires a newer go, older versions are tried in turn, reading each
+// go.mod from the module proxy; only those the channel, prerelease channel
+// or WithConstraint allows count. Decision records the version passed over
+// and why. If none newer than the current one is compatible, the upgrade is
+// skipped with SkipToolchainTooOld.
+func WithToolchainCompatibleOnly(compatible bool) Option {
+	return func(c *config) {
+		c.toolchainCompatible = compatible
+	}
+}
+
+// WithAlreadyLatestAsSuccess reports an upgrade that finds the running binary
+// already at the target as a clean no-op: SkipReason is left empty rather
+// than set to SkipAlreadyLatest, so callers that treat any skip as "nothing
+// happened, look into it" need not special-case it. Decision.AlreadyLatest
+// still tells the two apart, and DidUpgrade still reports false since no new
+// binary was installed.
+func WithAlreadyLatestAsSuccess(success bool) Option {
+	return func(c *config) {
+		c.alreadyLatestOK = success
+	}
+}
+
+// WithRetry retries a failed go install up to retries more times, waiting
+// backoff before the first retry and doubling the wait before each one after
+// that. Only failures accepted by the retry predicate are retried; see
+// WithRetryPredicate. The wait is cut short, and the upgrade abandoned, when
+// the context ends. retries must not be negative.
+func WithRetry(retries int, backoff time.Duration) Option {
+	return func(c *config) {
+		c.retries = retries
+		c.retryBackoff = backoff
+	}
+}
+
+// WithRetryPredicate sets the function deciding whether a failed go install
+// is retried, in place of the default of retrying failures that Classify
+// reports as FailureTransient or FailureNetwork. It is called with the
+// classified error and the go command's standard error after each failed
+// attempt that has retries left under WithRetry, before the backoff wait; a
+// false result ends the upgrade with that error. It is not called for
+// failures caused by the context ending, which are never retried.
+func WithRetryPredicate(fn func(err error, output []byte) bool) Option {
+	return func(c *config) {
+		c.retryPredicate = fn
+	}
+}
+
+// WithLocalModule is a development aid that installs from the module checked
+// out in dir, running 'go install .' there instead of installing a version
+// from the module proxy, so that the install, verification and restart flow
+// can be tried against an uncommitted local build. The running binary is
+// always considered upgradeable, including development builds, and DidUpgrade
+// compares VCS revisions and commit times as with WithRollingChannel. It is
+// not meant for production use.
+func WithLocalModule(dir string) Option {
+	return func(c *config) {
+		c.localModule = dir
+	}
+}
+
+// WithRequireVCS skips the upgrade with SkipNoVCSInfo when the running
+// binary's build settings lack vcs.revision, as for builds made with
+// -buildvcs=false or outside a repository, whose version cannot be relied on.
+// The development build check comes first, so a "(devel)" build is still
+// reported as SkipDevelBuild unless WithRollingChannel lets it through.
+func WithRequireVCS(require bool) Option {
+	return func(c *config) {
+		c.requireVCS = require
+	}
+}
+
+// WithDevelDetector replaces how a development build, which Upgrade skips
+// with SkipDevelBuild, is recognized, for versioning schemes that mark them
+// differently, such as a "0.0.0-dev" version. By default a build is a
+// development build when its main module version is "(devel)". detect
+// replaces that check rather than adding to it, so it should also return
+// true for "(devel)" builds to keep skipping them. WithRollingChannel still
+// lets a development build through. ShouldUpgrade passes a BuildInfo with
+// only Main.Version set to the current version.
+func WithDevelDetector(detect func(info *debug.BuildInfo) bool) Option {
+	return func(c *config) {
+		c.develDetector = detect
+	}
+}
+
+// isDevel reports whether info is a development build, as decided by
+// WithDevelDetector or the "(devel)" version.
+func (c *config) isDevel(info *debug.BuildInfo) bool {
+	if c.develDetector != nil {
+		return c.develDetector(info)
+	}
+	return info.Main.Version == "(devel)"
+}
+
+// WithVersionFilter excludes versions for which accept returns false, such as
+// a release that has been embargoed but not retracted. The version selected
+// by the channel, or @latest, is resolved and checked; if rejected, the
+// greatest newer version the channel allows and accept approves is installed
+// instead. When every version newer than the current one is rejected, the
+// upgrade is skipped with SkipNoAcceptableVersion.
+func WithVersionFilter(accept func(v string) bool) Option {
+	return func(c *config) {
+		c.versionFilter = accept
+	}
+}
+
+// WithVersionResolver asks resolve what to install instead of reading a
+// channel config, such as a service that publishes the approved version; see
+// HTTPVersionResolver. Its answer is treated like a channel config entry, so
+// an explicit version is installed even if older than the current one, while
+// WithVersionFilter and WithMaxVersion still apply. It cannot be combined
+// with WithChannelConfig.
+func WithVersionResolver(resolve VersionResolver) Option {
+	return func(c *config) {
+		c.versionResolver = resolve
+	}
+}
+
+// WithVersionFile installs the version named in the file at path, read on
+// every call, so that a controller can push the version a deployment should
+// converge to, such as by dropping a VERSION file next to the binary. The
+// file holds a single channel config entry: an explicit version such as
+// "v1.4.2", installed even if older than the current one, "latest", or a
+// version constraint. A missing file selects "latest" unless
+// WithVersionFileRequired is set. It cannot be combined with
+// WithVersionResolver or WithChannelConfig.
+func WithVersionFile(path string) Option {
+	return func(c *config) {
+		c.versionFile = path
+	}
+}
+
+// WithConstraint installs the greatest version the proxy lists that
+// satisfies expr, a comma-separated list of comparisons such as
+// ">=1.2.0, <2.0.0" that must all hold. The operators are =, !=, >, >=, <,
+// <=, ~ and ^, as in a channel config. Prereleases only satisfy an
+// expression that mentions one, such as ">=1.3.0-0". If no version
+// satisfies it the upgrade is skipped with SkipNoVersionSatisfiesConstraint,
+// and if the greatest one is older than the current version it is blocked
+// with PolicyDowngrade. It cannot be combined with WithVersionResolver,
+// WithVersionFile or WithChannelConfig.
+func WithConstraint(expr string) Option {
+	return func(c *config) {
+		c.constraint = expr
+	}
+}
+
+// WithResolvedVersion installs exactly version v, such as one the caller
+// already chose from ResolveLatest or CheckLatest, without asking the proxy
+// again: Upgrade neither re-resolves the target nor applies
+// WithPseudoVersionPolicy, WithMinReleaseAge or
+// WithToolchainCompatibleOnly, which would query it. What the caller checked
+// is therefore what is installed, even if a newer version is published in
+// between. WithVersionFilter and WithMaxVersion still apply, and a version
+// older than the current one is blocked with PolicyDowngrade unless
+// WithAllowDowngrade is set. It cannot be combined with WithVersionResolver,
+// WithVersionFile, WithChannelConfig, WithConstraint, WithGitHubRelease or
+// WithLocalModule.
+func WithResolvedVersion(v string) Option {
+	return func(c *config) {
+		c.resolvedVersion = v
+	}
+}
+
+// WithAllowDowngrade lets Upgrade install a version older than the running
+// one, such as to roll back a bad release, instead of blocking it with
+// PolicyDowngrade: one set with WithResolvedVersion, or an @latest that is
+// older than current because a newer tag was retracted.
+func WithAllowDowngrade(allow bool) Option {
+	return func(c *config) {
+		c.allowDowngrade = allow
+	}
+}
+
+// WithVersionFileRequired skips the upgrade with SkipNoVersionFile when the
+// file set with WithVersionFile is missing, rather than installing the
+// latest version.
+func WithVersionFileRequired(required bool) Option {
+	return func(c *config) {
+		c.versionFileRequired = required
+	}
+}
+
+// WithPrivilegeElevation runs go install under command, such as "sudo -n",
+// when the directory of the install target is not writable, as for a binary
+// in a root-owned directory. command is split on spaces and followed by an
+// env(1) invocation forwarding the GO and CGO_ variables, other than the
+// caches and GOPATH, and setting GOBIN to the install directory, then the
+// absolute path of the go command. Standard input is not connected, so the
+// command must not prompt for a password.
+//
+// The elevated go command downloads and builds the module with the elevated
+// user's privileges, and the forwarded variables appear on its command line.
+// Prefer making the install directory writable by the user that runs the
+// upgrade; see the README for the security considerations. When the new
+// binary is verified, the old one is backed up, restored and removed with
+// cp, mv and rm under command, so those must be allowed too. Elevated
+// installs fail with ErrDirNotWritable with WithVersionedName or
+// WithReplaceRunning(false), which stage the build next to the binary, and
+// when cross-compiling. It cannot be combined with WithDropPrivileges.
+func WithPrivilegeElevation(command string) Option {
+	return func(c *config) {
+		c.elevate = command
+	}
+}
+
+// WithDropPrivileges runs the go command, GOAUTH commands and the
+// WithVerifyCommand run of the new binary as uid and gid, without
+// supplementary groups, when the process runs as root, so that a service
+// started as root does not download, build or run modules as root. The user
+// must be able to write the install directory and the build and module
+// caches, which with the HOME of root are usually not; set them with
+// WithBuildCache, WithModCache and WithGoPath. It is only supported on Unix platforms, and
+// cannot be combined with WithPrivilegeElevation.
+func WithDropPrivileges(uid, gid int) Option {
+	return func(c *config) {
+		c.dropPrivileges = true
+		c.dropUID, c.dropGID = uid, gid
+	}
+}
+
+// WithRequireInstalledInGoBin skips the upgrade with SkipNotInGoBin unless
+// the running executable is the binary go install writes, in GOBIN or
+// GOPATH/bin. A copy of the binary elsewhere would otherwise never be
+// replaced, while a second copy was installed next to the go toolchain's
+// binaries. It does not apply with WithGitHubRelease, which replaces the
+// running executable itself.
+func WithRequireInstalledInGoBin(require bool) Option {
+	return func(c *config) {
+		c.requireInGoBin = require
+	}
+}
+
+// WithAllowSystemDir lets Upgrade replace a binary in a directory managed by
+// the system or a package manager, such as /usr/bin, a Homebrew prefix or
+// Program Files. Without it, the upgrade is skipped with SkipSystemManaged
+// when the install target is in one, so that Upgrade does not fight apt,
+// brew or choco over the binary. With WithGitHubRelease the target is the
+// WithExecutablePath path, or else the running executable. Builds from
+// WithLocalModule are not checked.
+func WithAllowSystemDir(allow bool) Option {
+	return func(c *config) {
+		c.allowSystemDir = allow
+	}
+}
+
+// WithMaxVersion caps the versions Upgrade selects at ceiling, such as
+// "v1.4.99" to hold a fleet on v1.4 during a staged rollout of v1.5.0. The
+// greatest version at or below the ceiling that the channel and
+// WithVersionFilter allow is installed; when every newer version is above
+// it, the upgrade is skipped with SkipCeilingReached. Combined with the
+// downgrade guard, a binary already above the ceiling stays where it is.
+// The ceiling is normalized as with NormalizeVersion, so "1.4.99" works too.
+func WithMaxVersion(ceiling string) Option {
+	return func(c *config) {
+		c.maxVersion = normalizeVersion(strings.TrimSpace(ceiling))
+	}
+}
+
+// WithDiskSpaceCheck checks before installing that the filesystems holding
+// the module cache, the build cache and the install directory each have at
+// least minBytes available, returning ErrInsufficientDiskSpace otherwise
+// rather than letting go install fail part way through. The check is skipped
+// on platforms that cannot report free space.
+func WithDiskSpaceCheck(minBytes int64) Option {
+	return func(c *config) {
+		c.minDiskSpace = minBytes
+	}
+}
+
+// WithCacheSizeLimit runs 'go clean -cache' after a successful go install
+// when the build cache holds more than maxBytes, so that a long-lived process
+// upgrading itself, such as in a container, does not slowly fill its disk.
+// A failed cleanup is logged and recorded in UpgradeResult.CacheCleanError
+// but does not fail the upgrade. Zero, the default, never cleans.
+func WithCacheSizeLimit(maxBytes int64) Option {
+	return func(c *config) {
+		c.cacheSizeLimit = maxBytes
+	}
+}
+
+// WithSkipPreCheck stops Upgrade from asking the module proxy for the @latest
+// version before running go install. The pre-check saves a build when the
+// binary is already current, at the cost of an extra HTTP request on every
+// call; without it, go install always runs, which is quick when the module
+// and build caches are warm. It has no effect when the channel selects an
+// explicit version or constraint, which is compared without installing.
+func WithSkipPreCheck(skip bool) Option {
+	return func(c *config) {
+		c.skipPreCheck = skip
+	}
+}
+
+// WithTrackDownloads records on UpgradeResult.Downloaded the modules go
+// install reported downloading, for finding out why an upgrade was slow. The
+// list is read from the go command's standard error and is best-effort: it
+// is empty when everything came from the module cache, and may be incomplete
+// if the output format changes. The list is kept for a failed install too.
+func WithTrackDownloads(track bool) Option {
+	return func(c *config) {
+		c.trackDownloads = track
+	}
+}
+
+// WithReportPrereleases makes an upgrade that finds the binary already at
+// @latest also look for a newer prerelease, which @latest passes over, and
+// report it in UpgradeResult.NewerPrereleaseAvailable, so that a tool can
+// tell users who opted in about a beta. It costs one more proxy request, for
+// the version list, on each such check. Nothing more is installed.
+func WithReportPrereleases(report bool) Option {
+	return func(c *config) {
+		c.reportPrereleases = report
+	}
+}
+
+// WithGoBinary runs the go command at path, instead of "go" from PATH, for
+// go install and every other go command Upgrade runs, such as 'go env' and
+// 'go tool dist list'. This removes ambiguity on machines with several Go
+// installations, and lets tests drive the exec-based features end to end with
+// a script that emulates the go command.
+func WithGoBinary(path string) Option {
+	return func(c *config) {
+		c.goBinary = path
+	}
+}
+
+// WithGoLocator lets locate find the go command when it is not in PATH, as
+// for a desktop app launched with the minimal PATH of a macOS app bundle. It
+// might check /usr/local/go/bin/go, a version manager's shims or a path from
+// the app's settings. locate is called at most once per upgrade, and only if
+// neither WithGoBinary nor WithGoVersion is set; the default looks up "go" in
+// PATH. An error from locate, or an empty path, fails the upgrade with an
+// error wrapping ErrGoNotFound.
+func WithGoLocator(locate func() (string, error)) Option {
+	return func(c *config) {
+		c.goLocator = locate
+	}
+}
+
+// WithTargetRewriter lets rewrite replace the "module/pkg@version" argument
+// just before go install runs, for mirrors with nonstandard module addressing
+// such as an internal host standing in for github.com. The result must still
+// be a clean "path@version", or the upgrade fails with ErrInvalidOption; an
+// error from rewrite fails it too. Target reports the rewritten argument. If
+// the mirror's module path differs from the original, disable
+// WithVerifyModulePath. It is not used with WithLocalModule and cannot be
+// combined with WithExpectedHash.
+func WithTargetRewriter(rewrite func(target string) (string, error)) Option {
+	return func(c *config) {
+		c.targetRewriter = rewrite
+	}
+}
+
+// WithGoVersion builds with a specific Go release, such as "1.22.5", using the
+// versioned launcher go1.22.5 from golang.org/dl found in PATH. An error
+// wrapping ErrGoNotFound explains how to install it when it is missing.
+// GOTOOLCHAIN is set to "local" so that the pinned toolchain is not switched
+// for one named by the module's go.mod. WithGoBinary takes precedence.
+func WithGoVersion(version string) Option {
+	return func(c *config) {
+		c.goVersion = version
+	}
+}
+
+// WithPseudoVersionPolicy sets how a binary built at a pseudo-version, such as
+// v1.4.1-0.20240301120000-abcdefabcdef, is compared with the tag Upgrade
+// selects. A commit after v1.4.0 sorts above it by semver, so comparing
+// versions alone would never move such a build to v1.4.0:
+//
+//   - PseudoPreferTag always installs the tag over a pseudo-version.
+//   - PseudoPreferNewerByTime installs it only if the tag's commit time is
+//     after the pseudo-version's timestamp.
+//   - PseudoNeverDowngrade installs it only if semver orders it higher.
+//
+// When refused, the upgrade is skipped with SkipBlockedByPolicy and
+// Decision.BlockedBy is PolicyPseudoVersion. The policy also applies to a
+// version pinned by the channel config. Without this option a
+// pseudo-version moves to whatever @latest or the channel selects, as go
+// install does, and ShouldUpgrade compares by semver.
+func WithPseudoVersionPolicy(policy PseudoVersionPolicy) Option {
+	return func(c *config) {
+		c.pseudoPolicy = policy
+	}
+}
+
+// WithCrossChannel lets a prerelease build leave its prerelease channel. By
+// default a binary at a version such as v1.3.0-beta.2 only upgrades to the
+// greatest "-beta" prerelease, rather than to the stable release @latest
+// would select. The channel is not inferred when WithChannelConfig is set.
+func WithCrossChannel(cross bool) Option {
+	return func(c *config) {
+		c.crossChannel = cross
+	}
+}
+
+// inferredChannel returns the prerelease channel of current that target
+// selection is confined to, or "" when there is none.
+func (c *config) inferredChannel(current string) string {
+	if c.crossChannel || c.channelConfig != "" || c.versionResolver != nil || c.versionFile != "" || c.constraint != "" || c.resolvedVersion != "" {
+		return ""
+	}
+	return prereleaseChannel(current)
+}
+
+// WithFallbackModulePaths sets module paths to upgrade from, in order, when
+// resolving or installing the running binary's module path fails, such as
+// the hosting path of a module also published under a vanity path, or the
+// new path of a module that moved. UpgradeResult.ModulePath reports the path
+// used. Fallbacks are not used with WithGitHubRelease or WithLocalModule. A
+// path with a version query, such as "example.com/tool@v1", fails the
+// upgrade with ErrInvalidModulePath.
+func WithFallbackModulePaths(paths ...string) Option {
+	return func(c *config) {
+		c.fallbackModulePaths = paths
+	}
+}
+
+// WithVerifyCommand runs the newly installed binary with args, such as
+// "--version", before accepting it. If the command fails, the previous binary
+// is restored and ExitError wraps ErrVerifyFailed.
+func WithVerifyCommand(args ...string) Option {
+	return func(c *config) {
+		c.verifyCommand = args
+	}
+}
+
+// WithVerifyFunc checks the newly installed binary with verify before
+// accepting it, for tools that need more than WithVerifyCommand, such as
+// starting the binary and probing a health endpoint. binaryPath is the new
+// binary, which may still be at a temporary path next to its destination.
+// If verify returns an error, the previous binary is restored and ExitError
+// wraps ErrVerifyFailed and the error. It runs after WithVerifyCommand when
+// both are set.
+func WithVerifyFunc(verify func(binaryPath string) error) Option {
+	return func(c *config) {
+		c.verifyFunc = verify
+	}
+}
+
+// WithRequireStatic rejects a new binary that links shared libraries, for
+// deployments such as scratch or distroless containers that have no libc.
+// An ELF binary must have no dynamic loader or needed libraries, and a
+// Mach-O binary may link only libSystem, which every macOS binary does.
+// Other formats are judged by their build settings, a cgo build counting as
+// dynamic unless linked with -static. A rejected binary is rolled back and
+// ExitError wraps ErrNotStatic.
+func WithRequireStatic(require bool) Option {
+	return func(c *config) {
+		c.requireStatic = require
+	}
+}
+
+// WithTimeout bounds the whole upgrade to d, on top of any deadline of the
+// context passed in; go install is killed when it expires. UpgradeSimple
+// applies DefaultTimeout unless this is given. A zero d sets no limit.
+func WithTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.timeout = d
+	}
+}
+
+// WithVerifyTimeout limits the WithVerifyCommand run to d, independently of
+// the context, so a new binary that hangs on startup cannot block once a slow
+// install has finished. A run that times out is inconclusive and reported in
+// UpgradeResult.VerifyInconclusive: with keep set the new binary is kept,
+// otherwise it is rolled back as if verification had failed.
+func WithVerifyTimeout(d time.Duration, keep bool) Option {
+	return func(c *config) {
+		c.verifyTimeout = d
+		c.keepOnVerifyTimeout = keep
+	}
+}
+
+// WithHooks sets functions called when Upgrade starts and ends, with the
+// module, versions, outcome and the timing of each phase, so that callers can
+// record the upgrade as a tracing span or metric without this package
+// depending on a telemetry library.
+func WithHooks(h Hooks) Option {
+	return func(c *config) {
+		c.hooks = &h
+	}
+}
+
+// WithPreUpgrade calls fn once Upgrade has decided to install target over
+// the running version current, just before go install or the release
+// download, so that a tool with local state can back it up in case the new
+// version migrates it incompatibly. target is the version being installed,
+// or "latest" when go install resolves it, as with WithSkipPreCheck. An
+// error from fn aborts the upgrade and is returned wrapped in ExitError.
+// fn is not called when the upgrade is skipped, as for SkipAlreadyLatest,
+// with WithGoInstallDryRun, or with WithLocalModule.
+func WithPreUpgrade(fn func(current, target string) error) Option {
+	return func(c *config) {
+		c.preUpgrade = fn
+	}
+}
+
+// WithGoInstallDryRun runs go install with -n, which prints the commands the
+// toolchain would run without running them, and records them in
+// UpgradeResult.DryRunCommands. Nothing is built or installed. It is meant
+// for diagnosing unexpected build behaviour on a particular machine.
+func WithGoInstallDryRun(dryRun bool) Option {
+	return func(c *config) {
+		c.goInstallDryRun = dryRun
+	}
+}
+
+// WithVerbosity sets how much Upgrade reports, for wiring to -v and -vv
+// flags:
+//
+//   - 0, the default, is silent.
+//   - 1 logs each decision, such as the resolved target and why an upgrade
+//     was skipped, as if WithLogger(log.Default()) were set.
+//   - 2 also streams the output of go install to standard error, as if
+//     WithInstallOutput(os.Stderr) were set.
+//
+// WithLogger and WithInstallOutput take precedence over the defaults that
+// WithVerbosity implies.
+func WithVerbosity(level int) Option {
+	return func(c *config) {
+		c.verbosity = level
+	}
+}
+
+// WithLogger logs the decisions Upgrade makes to l.
+func WithLogger(l *log.Logger) Option {
+	return func(c *config) {
+		c.logger = l
+	}
+}
+
+// WithTail passes each line of go install output, standard output and
+// standard error alike, to onLine as it is written, and keeps the last lines
+// lines in UpgradeResult.Tail, for showing recent activity in a TUI without
+// holding the whole output. Lines are reassembled across writes, so onLine
+// always gets complete lines, without the newline; a final line without one
+// is passed when go install exits. onLine may be nil to only keep the tail.
+// It is called from the goroutines copying the output, one call at a time.
+// It can be combined with WithInstallOutput.
+func WithTail(lines int, onLine func(string)) Option {
+	return func(c *config) {
+		c.tailLines, c.onTailLine = lines, onLine
+	}
+}
+
+// WithInstallOutput copies the standard output and standard error of go
+// install to w as it runs. The output is still inspected to classify
+// failures.
+func WithInstallOutput(w io.Writer) Option {
+	return func(c *config) {
+		c.installOutput = w
+	}
+}
+
+// WithExpvar publishes upgrade counters with expvar under name, served on
+// /debug/vars by an HTTP server using http.DefaultServeMux: "attempts",
+// "successes", "failures", "skips" by SkipReason, and "last_check", the
+// RFC 3339 time the last upgrade ended. Upgrades given the same name share
+// the counters, which are published on first use. If name is already taken
+// by another expvar, the counters are not recorded.
+func WithExpvar(name string) Option {
+	return func(c *config) {
+		c.expvarName = name
+	}
+}
+
+// WithStateFile records the time and outcome of each upgrade attempt in the
+// JSON file at path, so that they survive process restarts. It is used by
+// WithFailureBackoff. The file is created if needed, along with its
+// directory, and one that does not parse is treated as empty. Attempts
+// ended by their context being canceled or timing out are not recorded.
+func WithStateFile(path string) Option {
+	return func(c *config) {
+		c.stateFile = path
+	}
+}
+
+// WithFailureBackoff skips the upgrade with SkipBackoff when the last attempt
+// recorded in the WithStateFile file failed less than d ago, so that a
+// frequently started CLI does not retry a failing upgrade on every run. A
+// successful attempt or skip clears the failure.
+func WithFailureBackoff(d time.Duration) Option {
+	return func(c *config) {
+		c.failureBackoff = d
+	}
+}
+
+// WithUpgradeLog appends a line of JSON to the file at path after each
+// successful upgrade, recording the time, module, from and to versions, go
+// install target and installed path, so that "when did this binary last
+// update itself?" can be answered later. The file is bounded in size: when
+// full it is moved to path+".1", replacing the previous one, and a new file
+// started. Failing to write the log does not fail the upgrade. Unlike
+// WithStateFile, it records nothing for skipped or failed attempts.
+func WithUpgradeLog(path string) Option {
+	return func(c *config) {
+		c.upgradeLog = path
+	}
+}
+
+// WithRestart makes RunBackground restart the process into the new binary
+// after a successful upgrade; see Restart for what that implies. Other entry
+// points ignore it.
+func WithRestart(restart bool) Option {
+	return func(c *config) {
+		c.restart = restart
+	}
+}
+
+// validate reports options that were given invalid values.
+func (c *config) validate() error {
+	if c.parallelismSet && c.parallelism <= 0 {
+		return fmt.Errorf("%w: parallelism must be positive, got %d", ErrInvalidOption, c.parallelism)
+	}
+	switch c.modMode {
+	case "", "mod", "readonly":
+	case "vendor":
+		if c.localModule == "" {
+			return fmt.Errorf("%w: WithModMode(\"vendor\") requires WithLocalModule", ErrInvalidOption)
+		}
+	default:
+		return fmt.Errorf("%w: WithModMode needs mod, readonly or vendor, got %q", ErrInvalidOption, c.modMode)
+	}
+	switch c.pseudoPolicy {
+	case "", PseudoPreferTag, PseudoPreferNewerByTime, PseudoNeverDowngrade:
+	default:
+		return fmt.Errorf("%w: unknown pseudo-version policy %q", ErrInvalidOption, c.pseudoPolicy)
+	}
+	if c.versionResolver != nil && c.channelConfig != "" {
+		return fmt.Errorf("%w: WithVersionResolver cannot be combined with WithChannelConfig", ErrInvalidOption)
+	}
+	if c.versionFile != "" && (c.versionResolver != nil || c.channelConfig != "") {
+		return fmt.Errorf("%w: WithVersionFile cannot be combined with WithVersionResolver or WithChannelConfig", ErrInvalidOption)
+	}
+	if c.constraint != "" {
+		if c.versionResolver != nil || c.versionFile != "" || c.channelConfig != "" {
+			return fmt.Errorf("%w: WithConstraint cannot be combined with WithVersionResolver, WithVersionFile or WithChannelConfig", ErrInvalidOption)
+		}
+		if _, err := parseConstraint(c.constraint); err != nil {
+			return fmt.Errorf("%w: WithConstraint: %w", ErrInvalidOption, err)
+		}
+	}
+	if c.resolvedVersion != "" {
+		if c.versionResolver != nil || c.versionFile != "" || c.channelConfig != "" || c.constraint != "" || c.github != nil || c.localModule != "" {
+			return fmt.Errorf("%w: WithResolvedVersion cannot be combined with WithVersionResolver, WithVersionFile, WithChannelConfig, WithConstraint, WithGitHubRelease or WithLocalModule", ErrInvalidOption)
+		}
+		if !semverValid(normalizeVersion(c.resolvedVersion)) {
+			return fmt.Errorf("%w: WithResolvedVersion needs a version, got %q", ErrInvalidOption, c.resolvedVersion)
+		}
+	}
+	if c.elevate != "" && len(strings.Fields(c.elevate)) == 0 {
+		return fmt.Errorf("%w: WithPrivilegeElevation needs a command", ErrInvalidOption)
+	}
+	if c.elevate != "" && c.dropPrivileges {
+		return fmt.Errorf("%w: WithPrivilegeElevation cannot be combined with WithDropPrivileges", ErrInvalidOption)
+	}
+	if c.dropPrivileges && (c.dropUID < 0 || c.dropGID < 0) {
+		return fmt.Errorf("%w: WithDropPrivileges needs a non-negative uid and gid, got %d:%d", ErrInvalidOption, c.dropUID, c.dropGID)
+	}
+	if c.localModule != "" && c.github != nil {
+		return fmt.Errorf("%w: WithLocalModule cannot be combined with WithGitHubRelease", ErrInvalidOption)
+	}
+	if len(c.expectedHashes) > 0 && c.targetRewriter != nil {
+		// The module cache keys the hash by the module actually fetched,
+		// which the rewritten target no longer names reliably.
+		return fmt.Errorf("%w: WithExpectedHash cannot be combined with WithTargetRewriter", ErrInvalidOption)
+	}
+	if c.goPath != "" && !filepath.IsAbs(c.goPath) {
+		return fmt.Errorf("%w: WithGoPath needs an absolute path, got %q", ErrInvalidOption, c.goPath)
+	}
+	if err := checkGOVCS(c.vcsAllow); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidOption, err)
+	}
+	if c.failureBackoff > 0 && c.stateFile == "" {
+		return fmt.Errorf("%w: WithFailureBackoff requires WithStateFile", ErrInvalidOption)
+	}
+	if c.maxVersion != "" {
+		if _, err := NormalizeVersion(c.maxVersion); err != nil {
+			return fmt.Errorf("%w: WithMaxVersion: %w", ErrInvalidOption, err)
+		}
+	}
+	if c.minReleaseAge < 0 {
+		return fmt.Errorf("%w: minimum release age must not be negative, got %v", ErrInvalidOption, c.minReleaseAge)
+	}
+	if c.cacheSizeLimit < 0 {
+		return fmt.Errorf("%w: cache size limit must not be negative, got %d", ErrInvalidOption, c.cacheSizeLimit)
+	}
+	if c.timeout < 0 {
+		return fmt.Errorf("%w: timeout must not be negative, got %v", ErrInvalidOption, c.timeout)
+	}
+	if c.retries < 0 {
+		return fmt.Errorf("%w: retries must not be negative, got %d", ErrInvalidOption, c.retries)
+	}
+	if c.binaryName != "" && (strings.ContainsAny(c.binaryName, `/\`) || c.binaryName == "." || c.binaryName == "..") {
+		return fmt.Errorf("%w: WithBinaryName needs a file name, got %q", ErrInvalidOption, c.binaryName)
+	}
+	if c.versionedName && c.crossCompiling() {
+		return fmt.Errorf("%w: WithVersionedName cannot be used when cross-compiling", ErrInvalidOption)
+	}
+	if (c.adaptiveMin != 0 || c.adaptiveMax != 0) && (c.adaptiveMin <= 0 || c.adaptiveMax < c.adaptiveMin) {
+		return fmt.Errorf("%w: WithAdaptiveInterval bounds %v, %v must be positive and in order", ErrInvalidOption, c.adaptiveMin, c.adaptiveMax)
+	}
+	if c.tailLines < 0 {
+		return fmt.Errorf("%w: WithTail lines must not be negative", ErrInvalidOption)
+	}
+	for _, path := range c.fallbackModulePaths {
+		if err := validateModulePath(path); err != nil {
+			return err
+		}
+	}
+	if c.keepRunning && c.versionedName {
+		return fmt.Errorf("%w: WithReplaceRunning(false) cannot be combined with WithVersionedName", ErrInvalidOption)
+	}
+	if c.keepRunning && c.crossCompiling() && c.github == nil {
+		return fmt.Errorf("%w: WithReplaceRunning(false) cannot be used when cross-compiling", ErrInvalidOption)
+	}
+	return nil
+}
+
+// checkGOVCS reports syntax errors in a GOVCS value with the go command's
+// messages, so that a typo fails before anything is downloaded rather than
+// part way through go install.
+func checkGOVCS(value string) error {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	have := make(map[string]string)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			return fmt.Errorf("empty entry in GOVCS")
+		}
+		pattern, list, ok := strings.Cut(item, ":")
+		if !ok {
+			return fmt.Errorf("malformed entry in GOVCS (missing colon): %q", item)
+		}
+		pattern, list = strings.TrimSpace(pattern), strings.TrimSpace(list)
+		switch {
+		case pattern == "":
+			return fmt.Errorf("empty pattern in GOVCS: %q", item)
+		case list == "":
+			return fmt.Errorf("empty VCS list in GOVCS: %q", item)
+		case have[pattern] != "":
+			return fmt.Errorf("unreachable pattern in GOVCS: %q after %q", item, have[pattern])
+		}
+		have[pattern] = item
+		for _, vcs := range strings.Split(list, "|") {
+			if strings.TrimSpace(vcs) == "" {
+				return fmt.Errorf("empty VCS name in GOVCS: %q", item)
+			}
+		}
+	}
+	return nil
+}
+
+// getenv returns the value of the go environment variable key, looking at the
+// variables set by options such as WithEnv, then the process environment,
+// then the go env file, as the go command does.
+func (c *config) getenv(key string) string {
+	if c.envFunc != nil {
+		// The transformed environment already includes the process one
+		env := c.environ()
+		for i := len(env) - 1; i >= 0; i-- {
+			if k, v, ok := strings.Cut(env[i], "="); ok && k == key {
+				if v != "" {
+					return v
+				}
+				break
+			}
+		}
+		return c.goenvFile()[key]
+	}
+	env := c.overrides()
+	for i := len(env) - 1; i >= 0; i-- {
+		if k, v, ok := strings.Cut(env[i], "="); ok && k == key {
+			return v
+		}
+	}
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return c.goenvFile()[key]
+}
+
+// goenvFile returns the settings in the go env file, which holds values set
+// with 'go env -w'. It is located by GOENV, defaulting to go/env under the
+// user config directory.
+func (c *config) goenvFile() map[string]string {
+	name := ""
+	for i := len(c.env) - 1; i >= 0 && name == ""; i-- {
+		if k, v, ok := strings.Cut(c.env[i], "="); ok && k == "GOENV" {
+			name = v
+		}
+	}
+	if name == "" {
+		name = os.Getenv("GOENV")
+	}
+	if name == "off" {
+		return nil
+	}
+	if name == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return nil
+		}
+		name = filepath.Join(dir, "go", "env")
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil
+	}
+	vars := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(line), "="); ok && k != "" && k[0] != '#' {
+			vars[k] = v
+		}
+	}
+	return vars
+}
+
+// environ returns the environment for child processes. The go env file is
+// read here and turned off for the child with GOENV=off, so that settings
+// written with 'go env -w', or in a file GOENV points to, pass the same
+// checks as the environment's.
+func (c *config) environ() []string {
+	env := withGoenvFile(append(os.Environ(), c.overrides()...), c.goenvFile())
+	env = append(env, "GOENV=off")
+	env = withoutVar(env, "GOINSECURE")
+	if c.insecureModules != "" {
+		env = append(env, "GOINSECURE="+c.insecureModules)
+	}
+	if c.insecureSkipChecksum {
+		env = append(env, "GOSUMDB=off")
+	} else {
+		env = withoutChecksumBypass(env)
+		if c.noSumDB != "" {
+			env = append(env, "GONOSUMDB="+c.noSumDB)
+		}
+	}
+	if c.envFunc != nil {
+		env = c.envFunc(env)
+	}
+	return env
+}
+
+// overrides returns the variables set by options, in "KEY=value" form, with
+// those from WithEnv last so they take precedence.
+func (c *config) overrides() []string {
+	var env []string
+	if c.goos != "" || c.goarch != "" {
+		env = append(env, "GOOS="+c.goos, "GOARCH="+c.goarch, "GOBIN=")
+	}
+	if c.modCache != "" {
+		env = append(env, "GOMODCACHE="+c.modCache)
+	}
+	if c.buildCache != "" {
+		env = append(env, "GOCACHE="+c.buildCache)
+	}
+	if c.goPath != "" {
+		env = append(env, "GOPATH="+c.goPath)
+	}
+	if c.goVersion != "" && c.goBinary == "" {
+		env = append(env, "GOTOOLCHAIN=local")
+	}
+	if c.proxy != "" {
+		env = append(env, "GOPROXY="+c.proxy)
+	}
+	if c.vcsAllow != "" {
+		env = append(env, "GOVCS="+c.vcsAllow)
+	}
+	return append(env, c.env...)
+}
+
+// withGoenvFile returns env with the settings of the go env file vars added
+// for the variables env leaves unset or empty, as the go command applies
+// them.
+func withGoenvFile(env []string, vars map[string]string) []string {
+	set := make(map[string]bool)
+	for _, kv := range env {
+		k, v, _ := strings.Cut(kv, "=")
+		set[k] = v != ""
+	}
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v := vars[k]; !set[k] && v != "" && k != "GOENV" {
+			env = append(withoutVar(env, k), k+"="+v)
+		}
+	}
+	return env
+}
+
+// withoutVar removes every setting of key from env.
+func withoutVar(env []string, key string) []string {
+	ret := env[:0:0]
+	for _, kv := range env {
+		if k, _, _ := strings.Cut(kv, "="); k != key {
+			ret = append(ret, kv)
+		}
+	}
+	return ret
+}
+
+// withoutChecksumBypass removes settings that disable or redirect checksum
+// verification: a GOSUMDB other than the default database, -insecure in
+// GOFLAGS, GONOSUMDB, and GOPRIVATE, which is the default for GONOSUMDB.
+// GOPRIVATE is moved to GONOPROXY, unless that is set, so matching modules
+// are still fetched directly.
+func withoutChecksumBypass(env []string) []string {
+	var private string
+	var noProxy bool
+	for _, kv := range env {
+		k, v, _ := strings.Cut(kv, "=")
+		switch k {
+		case "GOPRIVATE":
+			private = v
+		case "GONOPROXY":
+			noProxy = v != ""
+		}
+	}
+	ret := env[:0:0]
+	for _, kv := range env {
+		k, v, _ := strings.Cut(kv, "=")
+		switch {
+		case k == "GOSUMDB" && !defaultSumDB(v):
+			continue
+		case k == "GOPRIVATE" || k == "GONOSUMDB":
+			continue
+		case k == "GOFLAGS":
+			kv = k + "=" + withoutInsecureFlag(v)
+		}
+		ret = append(ret, kv)
+	}
+	if private != "" && !noProxy {
+		ret = append(ret, "GONOPROXY="+private)
+	}
+	return ret
+}
+
+// defaultSumDB reports whether the GOSUMDB value v names one of the checksum
+// databases the go command knows the key of, or is empty. A value with its
+// own key ("name+key") or any other name is not the default.
+func defaultSumDB(v string) bool {
+	name, _, _ := strings.Cut(strings.TrimSpace(v), " ")
+	switch name {
+	case "", "sum.golang.org", "sum.golang.google.cn":
+		return true
+	}
+	return false
+}
+
+// withoutInsecureFlag removes the -insecure flag from the GOFLAGS value v.
+func withoutInsecureFlag(v string) string {
+	flags := strings.Fields(v)
+	ret := flags[:0]
+	for _, f := range flags {
+		name, val, _ := strings.Cut(strings.TrimLeft(f, "-"), "=")
+		if name == "insecure" && val != "false" {
+			continue
+		}
+		ret = append(ret, f)
+	}
+	return strings.Join(ret, " ")
+}
+
+// defaultUserAgent identifies this package, including its version when it can
+// be determined from the build information of the running binary.
+func defaultUserAgent() string {
+	const self = "github.com/melt-inc/autoupgrade"
+	info, ok := CurrentBuildInfo()
+	if !ok {
+		return "autoupgrade"
+	}
+	mods := append([]*debug.Module{&info.Main}, info.Deps...)
+	for _, m := range mods {
+		if m.Path == self && m.Version != "" && m.Version != "(devel)" {
+			return "autoupgrade/" + m.Version
+		}
+	}
+	return "autoupgrade"
+}
@@ -0,0 +1,234 @@
+package autoupgrade
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func Test_config_environ_checksum(t *testing.T) {
+	t.Setenv("GOSUMDB", "off")
+	t.Setenv("GONOSUMDB", "example.com/*")
+	t.Setenv("GOFLAGS", "-mod=mod -insecure")
+
+	env := newConfig(nil).environ()
+	if slices.Contains(env, "GOSUMDB=off") {
+		t.Error("environ() contains GOSUMDB=off by default")
+	}
+	if slices.Contains(env, "GONOSUMDB=example.com/*") {
+		t.Error("environ() kept GONOSUMDB by default")
+	}
+	if !slices.Contains(env, "GOFLAGS=-mod=mod") {
+		t.Error("environ() kept -insecure in GOFLAGS")
+	}
+
+	env = newConfig([]Option{WithNoSumDB("corp.example/*")}).environ()
+	if slices.Contains(env, "GONOSUMDB=example.com/*") || env[len(env)-1] != "GONOSUMDB=corp.example/*" {
+		t.Errorf("environ() with WithNoSumDB does not end with its GONOSUMDB only: %q", env)
+	}
+
+	env = newConfig([]Option{WithInsecureSkipChecksum(true)}).environ()
+	if !slices.Contains(env, "GONOSUMDB=example.com/*") {
+		t.Error("environ() dropped GONOSUMDB with WithInsecureSkipChecksum")
+	}
+	if env[len(env)-1] != "GOSUMDB=off" {
+		t.Errorf("environ() does not end with GOSUMDB=off: %v", env[len(env)-1])
+	}
+}
+
+func Test_config_environ_goenvFile(t *testing.T) {
+	goenv := filepath.Join(t.TempDir(), "env")
+	writeFile(t, goenv, []byte("GOSUMDB=off\nGOFLAGS=-insecure\nGONOSUMDB=example.com/*\nGOPRIVATE=corp.example/*\nGOTOOLCHAIN=local\nGOPROXY=https://file.example\n"))
+	t.Setenv("GOENV", goenv)
+	t.Setenv("GOPROXY", "https://env.example")
+	for _, k := range []string{"GOSUMDB", "GOFLAGS", "GONOSUMDB", "GOPRIVATE", "GONOPROXY", "GOTOOLCHAIN"} {
+		t.Setenv(k, "")
+	}
+
+	env := newConfig(nil).environ()
+	for _, kv := range []string{"GOSUMDB=off", "GOFLAGS=-insecure", "GONOSUMDB=example.com/*", "GOPRIVATE=corp.example/*", "GOPROXY=https://file.example"} {
+		if slices.Contains(env, kv) {
+			t.Errorf("environ() contains %s from the go env file", kv)
+		}
+	}
+	for _, kv := range []string{"GOENV=off", "GONOPROXY=corp.example/*", "GOTOOLCHAIN=local", "GOPROXY=https://env.example"} {
+		if !slices.Contains(env, kv) {
+			t.Errorf("environ() does not contain %s", kv)
+		}
+	}
+
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not available")
+	}
+	cmd := exec.Command(goCmd, "env", "GOSUMDB", "GONOSUMDB")
+	cmd.Env = env
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Fields(string(out)); len(got) != 1 || got[0] != "sum.golang.org" {
+		t.Errorf("go env GOSUMDB GONOSUMDB = %q, want only sum.golang.org", got)
+	}
+}
+
+func Test_withoutChecksumBypass(t *testing.T) {
+	tests := []struct {
+		env, want []string
+	}{
+		{[]string{"GOSUMDB=sum.golang.org"}, []string{"GOSUMDB=sum.golang.org"}},
+		{[]string{"GOSUMDB=sum.golang.google.cn https://mirror.example"}, []string{"GOSUMDB=sum.golang.google.cn https://mirror.example"}},
+		{[]string{"GOSUMDB=sum.example.com"}, []string{}},
+		{[]string{"GOSUMDB=sum.golang.org+abc123"}, []string{}},
+		{[]string{"GOFLAGS=-insecure=false"}, []string{"GOFLAGS=-insecure=false"}},
+		{[]string{"GOFLAGS=--insecure=true -x"}, []string{"GOFLAGS=-x"}},
+		{[]string{"GOPRIVATE=corp.example/*"}, []string{"GONOPROXY=corp.example/*"}},
+		{[]string{"GOPRIVATE=corp.example/*", "GONOPROXY=none"}, []string{"GONOPROXY=none"}},
+		{[]string{"GOPRIVATE=corp.example/*", "GONOSUMDB=corp.example/x"}, []string{"GONOPROXY=corp.example/*"}},
+		{[]string{"GONOSUMDB=corp.example/x", "GOSUMDB=sum.golang.org"}, []string{"GOSUMDB=sum.golang.org"}},
+	}
+	for _, tt := range tests {
+		if got := withoutChecksumBypass(tt.env); !slices.Equal(got, tt.want) {
+			t.Errorf("withoutChecksumBypass(%q) = %q, want %q", tt.env, got, tt.want)
+		}
+	}
+}
+
+func Test_config_environ_envFunc(t *testing.T) {
+	t.Setenv("GOFLAGS", "-mod=mod")
+	var seen []string
+	cfg := newConfig([]Option{
+		WithEnv("GOBIN=/opt/a", "GOPROXY=https://proxy.example.com"),
+		WithEnvFunc(func(env []string) []string {
+			seen = slices.Clone(env)
+			return append(withoutVar(env, "GOFLAGS"), "GOBIN=/opt/b", "GOPROXY=")
+		}),
+	})
+	env := cfg.environ()
+	if !slices.Contains(seen, "GOBIN=/opt/a") || !slices.Contains(seen, "GOFLAGS=-mod=mod") {
+		t.Errorf("WithEnvFunc saw %q, want the process environment and WithEnv", seen)
+	}
+	if slices.ContainsFunc(env, func(kv string) bool { return strings.HasPrefix(kv, "GOFLAGS=") }) {
+		t.Error("environ() kept GOFLAGS removed by WithEnvFunc")
+	}
+	if got := cfg.getenv("GOBIN"); got != "/opt/b" {
+		t.Errorf("getenv(GOBIN) = %q, want /opt/b", got)
+	}
+	if got := cfg.getenv("GOPROXY"); got == "https://proxy.example.com" {
+		t.Error("getenv(GOPROXY) ignored the value WithEnvFunc cleared")
+	}
+}
+
+func Test_config_environ_caches(t *testing.T) {
+	cfg := newConfig([]Option{WithModCache("/cache/mod"), WithBuildCache("/cache/build")})
+	env := cfg.environ()
+	for _, kv := range []string{"GOMODCACHE=/cache/mod", "GOCACHE=/cache/build"} {
+		if !slices.Contains(env, kv) {
+			t.Errorf("environ() missing %q", kv)
+		}
+	}
+	if got := cfg.getenv("GOMODCACHE"); got != "/cache/mod" {
+		t.Errorf("getenv(GOMODCACHE) = %q", got)
+	}
+}
+
+func Test_checkCacheDirs(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mod")
+	if err := checkCacheDirs(newConfig([]Option{WithModCache(dir)})); err != nil {
+		t.Errorf("checkCacheDirs() error = %v", err)
+	}
+	file := filepath.Join(t.TempDir(), "file")
+	writeFile(t, file, nil)
+	err := checkCacheDirs(newConfig([]Option{WithBuildCache(filepath.Join(file, "sub"))}))
+	if !errors.Is(err, ErrDirNotWritable) {
+		t.Errorf("checkCacheDirs() error = %v, want %v", err, ErrDirNotWritable)
+	}
+	err = checkCacheDirs(newConfig([]Option{WithGoPath(filepath.Join(file, "gopath"))}))
+	if !errors.Is(err, ErrDirNotWritable) {
+		t.Errorf("checkCacheDirs() with GOPATH error = %v, want %v", err, ErrDirNotWritable)
+	}
+	if err := newConfig([]Option{WithGoPath("relative/gopath")}).validate(); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("validate() with relative GOPATH error = %v, want %v", err, ErrInvalidOption)
+	}
+}
+
+func Test_config_environ_insecure(t *testing.T) {
+	t.Setenv("GOINSECURE", "*")
+
+	if env := newConfig(nil).environ(); slices.Contains(env, "GOINSECURE=*") {
+		t.Error("environ() contains GOINSECURE by default")
+	}
+	env := newConfig([]Option{WithInsecureModules("corp.example.com")}).environ()
+	if slices.Contains(env, "GOINSECURE=*") || !slices.Contains(env, "GOINSECURE=corp.example.com") {
+		t.Errorf("environ() with WithInsecureModules = %v", env)
+	}
+}
+
+func Test_config_environ_direct(t *testing.T) {
+	cfg := newConfig([]Option{WithProxy("direct"), WithVCSAllow("corp.example.com:git,*:off")})
+	env := cfg.environ()
+	for _, kv := range []string{"GOPROXY=direct", "GOVCS=corp.example.com:git,*:off"} {
+		if !slices.Contains(env, kv) {
+			t.Errorf("environ() missing %q", kv)
+		}
+	}
+	if got := cfg.getenv("GOPROXY"); got != "direct" {
+		t.Errorf("getenv(GOPROXY) = %q, want direct", got)
+	}
+	if err := cfg.validate(); err != nil {
+		t.Errorf("validate() error = %v", err)
+	}
+}
+
+func Test_checkGOVCS(t *testing.T) {
+	for value, ok := range map[string]bool{
+		"":                          true,
+		"private:git|hg,public:off": true,
+		"corp.example.com:all":      true,
+		"corp.example.com":          false,
+		":git":                      false,
+		"corp.example.com:":         false,
+		"corp.example.com:git|":     false,
+		"a.com:git,,b.com:hg":       false,
+		"a.com:git,a.com:hg":        false,
+	} {
+		err := checkGOVCS(value)
+		if (err == nil) != ok {
+			t.Errorf("checkGOVCS(%q) error = %v, want ok %v", value, err, ok)
+		}
+	}
+	err := newConfig([]Option{WithVCSAllow("corp.example.com")}).validate()
+	if !errors.Is(err, ErrInvalidOption) || !strings.Contains(err.Error(), "missing colon") {
+		t.Errorf("validate() error = %v, want %v mentioning the missing colon", err, ErrInvalidOption)
+	}
+}
+
+func Test_newConfig_verbosity(t *testing.T) {
+	custom := log.New(io.Discard, "", 0)
+	tests := []struct {
+		name       string
+		opts       []Option
+		wantLogger *log.Logger
+		wantOutput io.Writer
+	}{
+		{"silent", nil, nil, nil},
+		{"level 1", []Option{WithVerbosity(1)}, log.Default(), nil},
+		{"level 2", []Option{WithVerbosity(2)}, log.Default(), os.Stderr},
+		{"explicit logger", []Option{WithLogger(custom), WithVerbosity(2)}, custom, os.Stderr},
+		{"explicit output", []Option{WithVerbosity(2), WithInstallOutput(io.Discard)}, log.Default(), io.Discard},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newConfig(tt.opts)
+			if cfg.logger != tt.wantLogger || cfg.installOutput != tt.wantOutput {
+				t.Errorf("logger, output = %p, %v, want %p, %v", cfg.logger, cfg.installOutput, tt.wantLogger, tt.wantOutput)
+			}
+		})
+	}
+}
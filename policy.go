@@ -0,0 +1,190 @@
+package autoupgrade
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// PseudoVersionPolicy decides whether a binary built at a pseudo-version, such
+// as a build of an untagged commit, moves to a tagged release. See
+// WithPseudoVersionPolicy.
+type PseudoVersionPolicy string
+
+const (
+	// PseudoPreferTag always replaces a pseudo-version with the selected
+	// tag, even when semver orders the tag lower, as it does for a commit
+	// after the latest release.
+	PseudoPreferTag PseudoVersionPolicy = "prefer-tag"
+	// PseudoPreferNewerByTime moves to the tag only if its commit time,
+	// as reported by the module proxy, is after the pseudo-version's.
+	PseudoPreferNewerByTime PseudoVersionPolicy = "prefer-newer-by-time"
+	// PseudoNeverDowngrade moves to the tag only if semver orders it above
+	// the pseudo-version.
+	PseudoNeverDowngrade PseudoVersionPolicy = "never-downgrade"
+)
+
+// pseudoUpgrade reports whether a binary at pseudo-version current should
+// move to the tagged version target, committed at targetTime, under policy.
+// PseudoPreferNewerByTime falls back to semver when targetTime is zero.
+func pseudoUpgrade(policy PseudoVersionPolicy, current, target string, targetTime time.Time) bool {
+	switch policy {
+	case PseudoPreferTag:
+		return true
+	case PseudoPreferNewerByTime:
+		if t, ok := pseudoVersionTime(current); ok && !targetTime.IsZero() {
+			return targetTime.After(t)
+		}
+	}
+	return semverCompare(target, current) > 0
+}
+
+// checkPseudoPolicy applies WithPseudoVersionPolicy to an upgrade from
+// pseudo-version current to target, which is "latest" or a version. latest
+// is the proxy's @latest answer if already known. It returns a *policyBlock
+// if the policy refuses the tag.
+func checkPseudoPolicy(ctx context.Context, cfg *config, modulePath, current, target string,
+	latest *VersionInfo) error {
+	info := latest
+	if target != "latest" || info == nil {
+		var err error
+		if target == "latest" {
+			info, err = latestInfo(ctx, cfg, modulePath)
+		} else {
+			info, err = versionInfo(ctx, cfg, modulePath, target)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	v := info.Version
+	if isPseudoVersion(v) || pseudoUpgrade(cfg.pseudoPolicy, current, v, info.Time) {
+		return nil
+	}
+	cfg.logf("%s not installed over %s under the %s pseudo-version policy",
+		v, current, cfg.pseudoPolicy)
+	return &policyBlock{v, PolicyPseudoVersion}
+}
+
+// ShouldUpgrade reports whether a binary at version current should be
+// upgraded to version target, applying the same policy as Upgrade without
+// inspecting the running process, so that it can be used to manage other
+// binaries. When it returns false, the SkipReason says why.
+//
+// A development build is not upgraded unless WithRollingChannel is set.
+// Downgrades are refused, except to a version the channel config pins
+// explicitly. A prerelease target is accepted only when the channel's
+// constraint mentions a prerelease, as with go install's @latest. With
+// WithChannelConfig, target must also be the pinned version or satisfy the
+// channel's constraint, with WithMaxVersion it must not exceed the ceiling,
+// and with WithVersionFilter it must be accepted by the filter. Without a
+// channel config, a prerelease current version such as v1.3.0-beta.2 only
+// moves to other "-beta" prereleases unless WithCrossChannel is set. With
+// WithPseudoVersionPolicy, a pseudo-version current moves to a tagged target
+// as the policy decides; without tag commit times, PseudoPreferNewerByTime
+// compares by semver.
+func ShouldUpgrade(current, target string, opts ...Option) (bool, SkipReason, error) {
+	cfg := newConfig(opts)
+	if cfg.isDevel(&debug.BuildInfo{Main: debug.Module{Version: current}}) && !cfg.rolling {
+		return false, SkipDevelBuild, nil
+	}
+	target = normalizeVersion(target)
+	tv, err := ParseVersion(target)
+	if err != nil {
+		return false, "", err
+	}
+	if current != "(devel)" {
+		current = normalizeVersion(current)
+		if !semverValid(current) {
+			return false, "", fmt.Errorf("%w: %q", ErrInvalidVersion, current)
+		}
+	}
+
+	pinned := false
+	prerelease := false
+	if cfg.channelConfig != "" {
+		spec, err := channelTarget(cfg.channelConfig, cfg.channel)
+		if err != nil {
+			return false, "", err
+		}
+		spec = strings.TrimSpace(spec)
+		switch v := normalizeVersion(spec); {
+		case spec == "latest":
+		case semverValid(v):
+			if semverCompare(target, v) != 0 {
+				return false, SkipNotInChannel, nil
+			}
+			pinned = true
+		default:
+			c, err := parseConstraint(spec)
+			if err != nil {
+				return false, "", err
+			}
+			if !c.allows(target) {
+				return false, SkipNotInChannel, nil
+			}
+			prerelease = c.prerelease
+		}
+	} else if cfg.channel != "" {
+		return false, "", fmt.Errorf("%w: %q (no channel config)", ErrUnknownChannel, cfg.channel)
+	}
+
+	if ch := cfg.inferredChannel(current); ch != "" {
+		if prereleaseChannel(target) != ch {
+			return false, SkipNotInChannel, nil
+		}
+		prerelease = true
+	}
+
+	if cfg.maxVersion != "" && semverCompare(target, cfg.maxVersion) > 0 {
+		return false, SkipCeilingReached, nil
+	}
+	if cfg.versionFilter != nil && !cfg.versionFilter(target) {
+		return false, SkipNoAcceptableVersion, nil
+	}
+	if tv.IsPrerelease() && !pinned && !prerelease {
+		return false, SkipPrerelease, nil
+	}
+	if current == "(devel)" {
+		return true, "", nil
+	}
+	if cfg.pseudoPolicy != "" && isPseudoVersion(current) && !isPseudoVersion(target) {
+		if !pseudoUpgrade(cfg.pseudoPolicy, current, target, time.Time{}) {
+			return false, SkipBlockedByPolicy, nil
+		}
+		return true, "", nil
+	}
+	switch cmp := semverCompare(target, current); {
+	case cmp == 0:
+		return false, SkipAlreadyLatest, nil
+	case cmp < 0 && !pinned:
+		return false, SkipDowngrade, nil
+	}
+	return true, "", nil
+}
+
+// AtLeast reports whether the running binary's version is minVersion or newer,
+// for refusing to run, or forcing an upgrade, below a known-good floor. The
+// "v" prefix of minVersion may be left off. A pseudo-version counts as the
+// commit after the tag it is based on, so v1.4.1-0.20240301120000-abcdef is
+// at least v1.4.0 but not v1.4.1. The error wraps ErrNoBuildInfo when build
+// information is unavailable, and ErrInvalidVersion when minVersion is not a
+// valid version or the running binary has none to compare, as for a
+// "(devel)" build.
+func AtLeast(minVersion string) (bool, error) {
+	floor, err := NormalizeVersion(minVersion)
+	if err != nil {
+		return false, err
+	}
+	info, ok := CurrentBuildInfo()
+	if !ok {
+		return false, fmt.Errorf("%w: the binary was not built with module support", ErrNoBuildInfo)
+	}
+	current := info.Main.Version
+	if !semverValid(current) {
+		return false, fmt.Errorf("%w: running version %q cannot be compared with %s", ErrInvalidVersion, current, floor)
+	}
+	return semverCompare(current, floor) >= 0, nil
+}
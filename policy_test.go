@@ -0,0 +1,142 @@
+package autoupgrade
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime/debug"
+	"testing"
+)
+
+func TestShouldUpgrade(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "channels.json")
+	writeFile(t, path, []byte(`{
+		"stable": "latest",
+		"beta": ">=1.5.0-0, <2.0.0",
+		"pinned": "1.4.0"
+	}`))
+
+	tests := []struct {
+		name            string
+		current, target string
+		opts            []Option
+		want            bool
+		wantReason      SkipReason
+		wantErr         error
+	}{
+		{"newer", "v1.0.0", "v1.1.0", nil, true, "", nil},
+		{"no prefix", "1.0.0", "1.1.0", nil, true, "", nil},
+		{"same", "v1.1.0", "v1.1.0", nil, false, SkipAlreadyLatest, nil},
+		{"downgrade", "v1.1.0", "v1.0.0", nil, false, SkipDowngrade, nil},
+		{"prerelease", "v1.0.0", "v1.1.0-rc.1", nil, false, SkipPrerelease, nil},
+		{"devel", "(devel)", "v1.1.0", nil, false, SkipDevelBuild, nil},
+		{"devel rolling", "(devel)", "v1.1.0", []Option{WithRollingChannel(true)}, true, "", nil},
+		{"devel detector", "v0.0.0-dev", "v1.1.0", []Option{WithDevelDetector(func(info *debug.BuildInfo) bool { return info.Main.Version == "v0.0.0-dev" })}, false, SkipDevelBuild, nil},
+		{"invalid", "v1.0.0", "latest", nil, false, "", ErrInvalidVersion},
+		{"stable", "v1.0.0", "v2.0.0", []Option{WithChannelConfig(path), WithChannel("stable")}, true, "", nil},
+		{"beta prerelease", "v1.4.0", "v1.5.0-beta.1", []Option{WithChannelConfig(path), WithChannel("beta")}, true, "", nil},
+		{"beta major", "v1.4.0", "v2.0.0", []Option{WithChannelConfig(path), WithChannel("beta")}, false, SkipNotInChannel, nil},
+		{"pinned rollback", "v1.5.0", "v1.4.0", []Option{WithChannelConfig(path), WithChannel("pinned")}, true, "", nil},
+		{"pinned other", "v1.0.0", "v1.5.0", []Option{WithChannelConfig(path), WithChannel("pinned")}, false, SkipNotInChannel, nil},
+		{"beta channel", "v1.3.0-beta.2", "v1.3.0-beta.3", nil, true, "", nil},
+		{"under ceiling", "v1.0.0", "v1.4.2", []Option{WithMaxVersion("v1.4.99")}, true, "", nil},
+		{"above ceiling", "v1.0.0", "v1.5.0", []Option{WithMaxVersion("v1.4.99")}, false, SkipCeilingReached, nil},
+		{"unprefixed ceiling", "v1.0.0", "v1.5.0", []Option{WithMaxVersion("1.4.99")}, false, SkipCeilingReached, nil},
+		{"beta to stable", "v1.3.0-beta.2", "v1.3.0", nil, false, SkipNotInChannel, nil},
+		{"beta to rc", "v1.3.0-beta.2", "v1.3.0-rc.1", nil, false, SkipNotInChannel, nil},
+		{"beta cross", "v1.3.0-beta.2", "v1.3.0", []Option{WithCrossChannel(true)}, true, "", nil},
+		{"pseudo after tag", "v1.1.1-0.20240301000000-abcdefabcdef", "v1.1.0", nil, false, SkipDowngrade, nil},
+		{"pseudo prefer tag", "v1.1.1-0.20240301000000-abcdefabcdef", "v1.1.0", []Option{WithPseudoVersionPolicy(PseudoPreferTag)}, true, "", nil},
+		{"pseudo by time", "v1.1.1-0.20240301000000-abcdefabcdef", "v1.1.0", []Option{WithPseudoVersionPolicy(PseudoPreferNewerByTime)}, false, SkipBlockedByPolicy, nil},
+		{"pseudo never downgrade", "v1.1.1-0.20240301000000-abcdefabcdef", "v1.1.0", []Option{WithPseudoVersionPolicy(PseudoNeverDowngrade)}, false, SkipBlockedByPolicy, nil},
+		{"pseudo before tag", "v1.0.1-0.20231201000000-abcdefabcdef", "v1.1.0", []Option{WithPseudoVersionPolicy(PseudoNeverDowngrade)}, true, "", nil},
+		{"unknown channel", "v1.0.0", "v1.5.0", []Option{WithChannelConfig(path), WithChannel("nightly")}, false, "", ErrUnknownChannel},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason, err := ShouldUpgrade(tt.current, tt.target, tt.opts...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ShouldUpgrade() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want || reason != tt.wantReason {
+				t.Errorf("ShouldUpgrade() = %v, %q, want %v, %q", got, reason, tt.want, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestUpgrade_pseudoVersionPolicy(t *testing.T) {
+	// The fake proxy dates v1.1.0 2024-01-02.
+	const (
+		afterTag  = "v1.1.1-0.20240301000000-abcdefabcdef" // newer by semver and time
+		untagged  = "v0.0.0-20240301000000-abcdefabcdef"   // older by semver, newer by time
+		beforeTag = "v1.0.1-0.20231201000000-abcdefabcdef" // older by both
+	)
+	tests := []struct {
+		current string
+		policy  PseudoVersionPolicy
+		install bool
+	}{
+		{afterTag, PseudoNeverDowngrade, false},
+		{afterTag, PseudoPreferNewerByTime, false},
+		{afterTag, PseudoPreferTag, true},
+		{untagged, PseudoNeverDowngrade, true},
+		{untagged, PseudoPreferNewerByTime, false},
+		{beforeTag, PseudoPreferNewerByTime, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.current+"/"+string(tt.policy), func(t *testing.T) {
+			m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+			fakeBuildInfo(t, m.path, tt.current)
+			res := Upgrade(context.Background(), "", append(m.options(), WithPseudoVersionPolicy(tt.policy))...)
+			if res.ExitError != nil {
+				t.Fatalf("Upgrade() error = %v", res.ExitError)
+			}
+			if got := res.InstalledPath != ""; got != tt.install {
+				t.Fatalf("installed = %v (skip %q), want %v", got, res.SkipReason, tt.install)
+			}
+			if !tt.install && (res.SkipReason != SkipBlockedByPolicy || res.Decision.BlockedBy != PolicyPseudoVersion || res.Decision.Blocked != "v1.1.0") {
+				t.Errorf("skip %q, blocked %q by %q, want v1.1.0 blocked by %q", res.SkipReason, res.Decision.Blocked, res.Decision.BlockedBy, PolicyPseudoVersion)
+			}
+		})
+	}
+
+	m := newFakeModule(t, "example.com/fake", "v1.0.0")
+	fakeBuildInfo(t, m.path, afterTag)
+	res := Upgrade(context.Background(), "", append(m.options(), WithPseudoVersionPolicy("sometimes"))...)
+	if !errors.Is(res.ExitError, ErrInvalidOption) {
+		t.Errorf("Upgrade() with unknown policy error = %v, want %v", res.ExitError, ErrInvalidOption)
+	}
+}
+
+func TestAtLeast(t *testing.T) {
+	tests := []struct {
+		current, min string
+		want         bool
+		err          error
+	}{
+		{"v1.4.0", "v1.4.0", true, nil},
+		{"v1.4.2", "1.4.0", true, nil},
+		{"v1.3.9", "v1.4.0", false, nil},
+		{"v1.4.0-rc.1", "v1.4.0", false, nil},
+		{"v1.4.1-0.20240301120000-abcdefabcdef", "v1.4.0", true, nil},
+		{"v1.4.1-0.20240301120000-abcdefabcdef", "v1.4.1", false, nil},
+		{"v2.0.0+incompatible", "v1.9.0", true, nil},
+		{"(devel)", "v1.0.0", false, ErrInvalidVersion},
+		{"v1.4.0", "1.4.x", false, ErrInvalidVersion},
+	}
+	for _, tt := range tests {
+		fakeBuildInfo(t, "example.com/fake", tt.current)
+		got, err := AtLeast(tt.min)
+		if got != tt.want || !errors.Is(err, tt.err) || (tt.err == nil) != (err == nil) {
+			t.Errorf("AtLeast(%q) at %s = %v, %v, want %v, %v", tt.min, tt.current, got, err, tt.want, tt.err)
+		}
+	}
+
+	orig := readBuildInfo
+	readBuildInfo = func() (*debug.BuildInfo, bool) { return nil, false }
+	t.Cleanup(func() { readBuildInfo = orig })
+	if _, err := AtLeast("v1.0.0"); !errors.Is(err, ErrNoBuildInfo) {
+		t.Errorf("AtLeast() without build info error = %v, want %v", err, ErrNoBuildInfo)
+	}
+}
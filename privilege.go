@@ -0,0 +1,108 @@
+package autoupgrade
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// geteuid returns the effective user ID of the process; a variable so tests
+// can pretend to run as root.
+var geteuid = os.Geteuid
+
+// elevatedCommand returns the command line that runs goCmd with args under
+// the WithPrivilegeElevation command, to install into dst's directory, which
+// the process cannot write. The elevation command usually resets the
+// environment, so the go command runs under env(1) with the GO and CGO_
+// variables it needs from env. The build and module caches are left to the
+// elevated user, so its files do not end up in the caller's caches, and GOBIN
+// names dst's directory since the elevated user has its own GOPATH.
+func elevatedCommand(cfg *config, goCmd string, env, args []string, dst string) ([]string, error) {
+	if cfg.crossCompiling() {
+		return nil, fmt.Errorf("%w: %s (WithPrivilegeElevation does not apply to cross-compiled installs)", ErrDirNotWritable, filepath.Dir(dst))
+	}
+	// The elevated PATH, such as sudo's secure_path, may find another go.
+	goPath, err := exec.LookPath(goCmd)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrGoNotFound, err)
+	}
+	if goPath, err = filepath.Abs(goPath); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrGoNotFound, err)
+	}
+	cmd := append(strings.Fields(cfg.elevate), "env")
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		switch name {
+		case "GOCACHE", "GOMODCACHE", "GOPATH", "GOBIN":
+			continue
+		}
+		if strings.HasPrefix(name, "GO") || strings.HasPrefix(name, "CGO_") {
+			cmd = append(cmd, kv)
+		}
+	}
+	cmd = append(cmd, "GOBIN="+filepath.Dir(dst), goPath)
+	return append(cmd, args...), nil
+}
+
+// command returns the command running name with args under ctx as
+// WithDropPrivileges requires, with standard input on the null device. Every
+// command Upgrade runs is made with it, so that none runs as root when
+// privileges are dropped, least of all the new binary being verified.
+func (c *config) command(ctx context.Context, name string, args ...string) (*exec.Cmd, error) {
+	attr, err := c.procAttr()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = nil
+	cmd.SysProcAttr = attr
+	return cmd, nil
+}
+
+// elevatedBackup copies the binary at target to a hidden file alongside it
+// with 'cp -p' under the WithPrivilegeElevation command, for an install into
+// a directory the process cannot write. The backup is restored and removed
+// the same way.
+func elevatedBackup(cfg *config, target string) (*backup, error) {
+	b := &backup{target: target, elevate: strings.Fields(cfg.elevate)}
+	if _, err := os.Stat(target); errors.Is(err, fs.ErrNotExist) {
+		return b, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("autoupgrade: backing up binary: %w", err)
+	}
+	path := filepath.Join(filepath.Dir(target), "."+filepath.Base(target)+".autoupgrade-"+strconv.Itoa(os.Getpid()))
+	if err := b.run("cp", "-p", target, path); err != nil {
+		return nil, fmt.Errorf("autoupgrade: backing up binary: %w", err)
+	}
+	b.path = path
+	return b, nil
+}
+
+// run runs the command args under the elevation command of b.
+func (b *backup) run(args ...string) error {
+	argv := append(append([]string(nil), b.elevate...), args...)
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdin = nil
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w: %s", strings.Join(argv, " "), err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// procAttr returns the process attributes go commands run with: those
+// running as the WithDropPrivileges user when the process runs as root, or
+// nil.
+func (c *config) procAttr() (*syscall.SysProcAttr, error) {
+	if !c.dropPrivileges || geteuid() != 0 {
+		return nil, nil
+	}
+	return dropCredential(c.dropUID, c.dropGID)
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package autoupgrade
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+)
+
+// dropCredential reports that dropping privileges is not supported on this
+// platform.
+func dropCredential(uid, gid int) (*syscall.SysProcAttr, error) {
+	return nil, fmt.Errorf("%w: WithDropPrivileges on %s", ErrUnsupportedPlatform, runtime.GOOS)
+}
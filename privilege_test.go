@@ -0,0 +1,168 @@
+package autoupgrade
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func Test_elevatedCommand(t *testing.T) {
+	exe, err := filepath.Abs(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := newConfig([]Option{
+		WithPrivilegeElevation("sudo -n"),
+		WithEnv("GOPROXY=https://proxy.example", "CGO_ENABLED=0", "GOCACHE=/home/u/.cache/go-build", "GOPATH=/home/u/go", "HOME=/home/u"),
+	})
+	dst := filepath.Join(t.TempDir(), "bin", "fake")
+	got, err := elevatedCommand(cfg, exe, cfg.environ(), []string{"install", "example.com/fake@v1.1.0"}, dst)
+	if err != nil {
+		t.Fatalf("elevatedCommand() error = %v", err)
+	}
+	if !slices.Equal(got[:3], []string{"sudo", "-n", "env"}) {
+		t.Errorf("elevatedCommand() = %q, want it to start with sudo -n env", got)
+	}
+	if want := []string{"GOBIN=" + filepath.Dir(dst), exe, "install", "example.com/fake@v1.1.0"}; !slices.Equal(got[len(got)-4:], want) {
+		t.Errorf("elevatedCommand() = %q, want it to end with %q", got, want)
+	}
+	for _, kv := range []string{"GOPROXY=https://proxy.example", "CGO_ENABLED=0"} {
+		if !slices.Contains(got, kv) {
+			t.Errorf("elevatedCommand() = %q, want %s forwarded", got, kv)
+		}
+	}
+	for _, arg := range got {
+		for _, name := range []string{"GOCACHE=", "GOPATH=", "HOME="} {
+			if strings.HasPrefix(arg, name) {
+				t.Errorf("elevatedCommand() forwarded %s", arg)
+			}
+		}
+	}
+
+	goos := "linux"
+	if runtime.GOOS == goos {
+		goos = "darwin"
+	}
+	cfg = newConfig([]Option{WithPrivilegeElevation("sudo"), WithTargetPlatform(goos, "arm64")})
+	if _, err := elevatedCommand(cfg, exe, nil, []string{"install"}, dst); !errors.Is(err, ErrDirNotWritable) {
+		t.Errorf("elevatedCommand() cross-compiling error = %v, want %v", err, ErrDirNotWritable)
+	}
+}
+
+func TestUpgrade_privilegeElevation(t *testing.T) {
+	shim, _ := writeGoShim(t, "go1.21.5")
+	proxy := t.TempDir()
+	dir := filepath.Join(proxy, "example.com", "fake", "@v")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(proxy, "example.com", "fake", "@latest"), []byte(`{"Version":"v1.1.0"}`))
+	fakeBuildInfo(t, "example.com/fake", "v1.0.0")
+	gobin := t.TempDir()
+	if err := os.Chmod(gobin, 0o555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(gobin, 0o755) })
+	if checkWritable(gobin) == nil {
+		t.Skip("read-only directories are writable, as when running as root")
+	}
+	// The elevation command stands in for sudo by making GOBIN writable.
+	log := filepath.Join(t.TempDir(), "elevate.log")
+	elevate := filepath.Join(t.TempDir(), "elevate")
+	writeFile(t, elevate, []byte("#!/bin/sh\necho \"$@\" > "+log+"\nchmod 755 "+gobin+"\nexec \"$@\"\n"))
+	if err := os.Chmod(elevate, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	opts := []Option{
+		WithGoBinary(shim),
+		WithEnv("GOPROXY=file://"+filepath.ToSlash(proxy), "GOBIN="+gobin),
+		WithVerifyModulePath(false),
+	}
+
+	res := Upgrade(context.Background(), "", opts...)
+	if res.ExitError == nil || res.Decision.Elevated {
+		t.Fatalf("Upgrade() without elevation = %v, elevated %v, want a failed install", res.ExitError, res.Decision.Elevated)
+	}
+
+	res = Upgrade(context.Background(), "", append(opts, WithPrivilegeElevation(elevate))...)
+	if res.ExitError != nil {
+		t.Fatalf("Upgrade() error = %v", res.ExitError)
+	}
+	if !res.Decision.Elevated || res.Decision.Writable {
+		t.Errorf("Decision.Elevated, Writable = %v, %v, want true, false", res.Decision.Elevated, res.Decision.Writable)
+	}
+	if data, err := os.ReadFile(filepath.Join(gobin, "fake")); err != nil || string(data) != "shim\n" {
+		t.Errorf("installed binary = %q, %v", data, err)
+	}
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); !strings.HasPrefix(got, "env ") || !strings.Contains(got, " "+shim+" install example.com/fake@") {
+		t.Errorf("elevation command ran with %q", got)
+	}
+}
+
+func TestWithDropPrivileges_validate(t *testing.T) {
+	for _, opts := range [][]Option{
+		{WithDropPrivileges(-1, 0)},
+		{WithDropPrivileges(1000, 1000), WithPrivilegeElevation("sudo")},
+		{WithPrivilegeElevation(" ")},
+	} {
+		if err := newConfig(opts).validate(); !errors.Is(err, ErrInvalidOption) {
+			t.Errorf("validate() error = %v, want %v", err, ErrInvalidOption)
+		}
+	}
+}
+
+func Test_elevatedBackup(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script elevation command not supported on windows")
+	}
+	dir := t.TempDir()
+	elevate := filepath.Join(dir, "elevate")
+	writeFile(t, elevate, []byte("#!/bin/sh\nexec \"$@\"\n"))
+	if err := os.Chmod(elevate, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := newConfig([]Option{WithPrivilegeElevation(elevate)})
+	target := filepath.Join(dir, "bin", "fake")
+	if err := os.Mkdir(filepath.Dir(target), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, target, []byte("old"))
+
+	bak, err := elevatedBackup(cfg, target)
+	if err != nil {
+		t.Fatalf("elevatedBackup() error = %v", err)
+	}
+	writeFile(t, target, []byte("new"))
+	if err := bak.restore(); err != nil {
+		t.Fatalf("restore() error = %v", err)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "old" {
+		t.Errorf("after restore, binary = %q, want old", data)
+	}
+	bak.discard()
+	if entries, _ := os.ReadDir(filepath.Dir(target)); len(entries) != 1 {
+		t.Errorf("restore left %d files, want only the binary", len(entries))
+	}
+
+	// With no binary before, restoring removes the new one.
+	os.Remove(target)
+	if bak, err = elevatedBackup(cfg, target); err != nil {
+		t.Fatalf("elevatedBackup() without a binary error = %v", err)
+	}
+	writeFile(t, target, []byte("new"))
+	if err := bak.restore(); err != nil {
+		t.Fatalf("restore() error = %v", err)
+	}
+	if _, err := os.Stat(target); err == nil {
+		t.Error("restore() left the new binary in place")
+	}
+}
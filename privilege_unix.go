@@ -0,0 +1,13 @@
+//go:build unix
+
+package autoupgrade
+
+import "syscall"
+
+// dropCredential returns process attributes that run a command as uid and
+// gid, without the supplementary groups of the running process.
+func dropCredential(uid, gid int) (*syscall.SysProcAttr, error) {
+	return &syscall.SysProcAttr{
+		Credential: &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid), Groups: []uint32{}},
+	}, nil
+}
@@ -0,0 +1,37 @@
+//go:build unix
+
+package autoupgrade
+
+import (
+	"context"
+	"testing"
+)
+
+func Test_procAttr(t *testing.T) {
+	orig := geteuid
+	t.Cleanup(func() { geteuid = orig })
+	cfg := newConfig([]Option{WithDropPrivileges(1000, 1001)})
+
+	geteuid = func() int { return 1000 }
+	if attr, err := cfg.procAttr(); attr != nil || err != nil {
+		t.Errorf("procAttr() not running as root = %+v, %v, want nil", attr, err)
+	}
+
+	geteuid = func() int { return 0 }
+	attr, err := cfg.procAttr()
+	if err != nil {
+		t.Fatalf("procAttr() error = %v", err)
+	}
+	if c := attr.Credential; c == nil || c.Uid != 1000 || c.Gid != 1001 || len(c.Groups) != 0 {
+		t.Errorf("procAttr().Credential = %+v, want 1000:1001 with no groups", c)
+	}
+
+	// The verify command and the other go commands are made the same way.
+	cmd, err := cfg.command(context.Background(), "true")
+	if err != nil {
+		t.Fatalf("command() error = %v", err)
+	}
+	if cmd.SysProcAttr == nil || cmd.SysProcAttr.Credential == nil || cmd.SysProcAttr.Credential.Uid != 1000 {
+		t.Errorf("command().SysProcAttr = %+v, want the dropped credential", cmd.SysProcAttr)
+	}
+}
@@ -0,0 +1,585 @@
+package autoupgrade
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/module"
+)
+
+// defaultGOPROXY is the value the go command uses when GOPROXY is unset.
+const defaultGOPROXY = "https://proxy.golang.org,direct"
+
+const (
+	// rateLimitRetries is how many times fetch retries a request that the
+	// proxy answered with 429 Too Many Requests.
+	rateLimitRetries = 3
+	// defaultRetryAfter is the delay before the first retry when a 429
+	// response has no usable Retry-After header. It doubles for each retry.
+	defaultRetryAfter = time.Second
+	// maxRetryAfter caps the delay asked for by Retry-After, so that a
+	// misbehaving proxy cannot stall a check without a context deadline.
+	maxRetryAfter = time.Minute
+)
+
+// ProxyError is returned when a module proxy responds with an unsuccessful
+// HTTP status.
+type ProxyError struct {
+	URL        string // URL of the failed request
+	StatusCode int    // HTTP status code returned by the proxy
+}
+
+func (e *ProxyError) Error() string {
+	return fmt.Sprintf("autoupgrade: proxy request %s: %d %s", e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// notFound reports whether the go command would fall through to the next
+// proxy in a comma-separated list.
+func (e *ProxyError) notFound() bool {
+	return e.StatusCode == http.StatusNotFound || e.StatusCode == http.StatusGone
+}
+
+// proxyEntry is a single element of the GOPROXY list.
+type proxyEntry struct {
+	url string
+	// fallBackOnError is set when the entry is followed by a pipe, meaning
+	// any error falls back to the next entry rather than only 404 and 410.
+	fallBackOnError bool
+}
+
+// proxyList parses GOPROXY following the rules of the go command.
+func proxyList(cfg *config) []proxyEntry {
+	value := cfg.getenv("GOPROXY")
+	if value == "" {
+		value = defaultGOPROXY
+	}
+	var list []proxyEntry
+	for value != "" {
+		var url string
+		fallBackOnError := false
+		if i := strings.IndexAny(value, ",|"); i >= 0 {
+			url = value[:i]
+			fallBackOnError = value[i] == '|'
+			value = value[i+1:]
+		} else {
+			url, value = value, ""
+		}
+		url = strings.TrimSpace(url)
+		if url == "" {
+			continue
+		}
+		list = append(list, proxyEntry{url: strings.TrimSuffix(url, "/"), fallBackOnError: fallBackOnError})
+	}
+	return list
+}
+
+// proxyGet fetches the given path relative to the module proxy root, trying
+// each configured proxy in turn. It returns the URL of the GOPROXY entry that
+// answered.
+func proxyGet(ctx context.Context, cfg *config, path string) ([]byte, string, error) {
+	var lastErr error
+	for _, p := range proxyList(cfg) {
+		if p.url == "off" {
+			return nil, "", ErrProxyDisabled
+		}
+		if p.url == "direct" {
+			break
+		}
+		body, err := fetch(ctx, cfg, p.url+"/"+path)
+		if err == nil {
+			return body, p.url, nil
+		}
+		lastErr = err
+		var perr *ProxyError
+		if p.fallBackOnError || errors.As(err, &perr) && perr.notFound() {
+			cfg.logf("proxy %s failed, trying the next one: %v", p.url, err)
+			continue
+		}
+		return nil, "", err
+	}
+	if lastErr == nil {
+		lastErr = ErrNoProxy
+	}
+	return nil, "", lastErr
+}
+
+// proxyGetConcurrent is like proxyGet but queries every proxy up to the first
+// "direct" or "off" at once, returning the first success and canceling the
+// other requests. When all fail, the error is the one the sequential lookup
+// would have returned.
+func proxyGetConcurrent(ctx context.Context, cfg *config, path string) ([]byte, string, error) {
+	var list []proxyEntry
+	off := false
+	for _, p := range proxyList(cfg) {
+		if p.url == "off" || p.url == "direct" {
+			off = p.url == "off"
+			break
+		}
+		list = append(list, p)
+	}
+	if len(list) < 2 {
+		return proxyGet(ctx, cfg, path)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		i    int
+		body []byte
+		err  error
+	}
+	results := make(chan result, len(list))
+	for i, p := range list {
+		go func(i int, url string) {
+			body, err := fetch(ctx, cfg, url+"/"+path)
+			results <- result{i, body, err}
+		}(i, p.url)
+	}
+	errs := make([]error, len(list))
+	for range list {
+		r := <-results
+		if r.err == nil {
+			return r.body, list[r.i].url, nil
+		}
+		errs[r.i] = r.err
+	}
+	for i, p := range list {
+		var perr *ProxyError
+		if !p.fallBackOnError && !(errors.As(errs[i], &perr) && perr.notFound()) {
+			return nil, "", errs[i]
+		}
+	}
+	if off {
+		return nil, "", ErrProxyDisabled
+	}
+	return nil, "", errs[len(errs)-1]
+}
+
+// matchPrefixPatterns reports whether any of the comma-separated glob
+// patterns matches a prefix of target, following the rules the go command
+// applies to GOPRIVATE and GOINSECURE: a pattern with n slashes is matched
+// against the first n+1 path elements of target.
+func matchPrefixPatterns(globs, target string) bool {
+	target = strings.Trim(target, "/")
+	for _, glob := range strings.Split(globs, ",") {
+		glob = strings.Trim(strings.TrimSpace(glob), "/")
+		if glob == "" {
+			continue
+		}
+		prefix := target
+		n := strings.Count(glob, "/")
+		for i := 0; i < len(target); i++ {
+			if target[i] == '/' {
+				if n == 0 {
+					prefix = target[:i]
+					break
+				}
+				n--
+			}
+		}
+		if n > 0 {
+			continue
+		}
+		if ok, _ := path.Match(glob, prefix); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func fetch(ctx context.Context, cfg *config, url string) ([]byte, error) {
+	if strings.HasPrefix(url, "file://") {
+		return fetchFile(url)
+	}
+	var cached *cacheEntry
+	if cfg.httpCache != "" {
+		if cached = readCacheEntry(cfg.httpCache, url); cached != nil && cached.fresh(time.Now()) {
+			return cached.Body, nil
+		}
+	}
+	wait := defaultRetryAfter
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.userAgent != "" {
+			req.Header.Set("User-Agent", cfg.userAgent)
+		}
+		if cached != nil {
+			cached.setValidators(req)
+		}
+		addProxyAuth(cfg, req)
+		resp, err := send(cfg, req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusNotModified && cached != nil {
+			resp.Body.Close()
+			if cached.update(resp.Header, time.Now()) {
+				writeCacheEntry(cfg.httpCache, cached)
+			}
+			return cached.Body, nil
+		}
+		if resp.StatusCode == http.StatusOK {
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err == nil && cfg.httpCache != "" {
+				e := &cacheEntry{URL: url, Body: body}
+				if e.update(resp.Header, time.Now()) {
+					writeCacheEntry(cfg.httpCache, e)
+				}
+			}
+			return body, err
+		}
+		resp.Body.Close()
+		perr := &ProxyError{URL: url, StatusCode: resp.StatusCode}
+		if resp.StatusCode != http.StatusTooManyRequests {
+			return nil, perr
+		}
+		if attempt >= rateLimitRetries {
+			return nil, fmt.Errorf("%w: %w", ErrRateLimited, perr)
+		}
+		delay, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if !ok {
+			delay, wait = wait, wait*2
+		}
+		timer := time.NewTimer(min(delay, maxRetryAfter))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("%w: %w (%w)", ErrRateLimited, perr, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// retryAfter parses a Retry-After header, given either as a number of
+// seconds or as an HTTP date, into the delay from now.
+func retryAfter(header string, now time.Time) (time.Duration, bool) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		return time.Duration(max(secs, 0)) * time.Second, true
+	}
+	t, err := http.ParseTime(header)
+	if err != nil {
+		return 0, false
+	}
+	return max(t.Sub(now), 0), true
+}
+
+// fetchFile reads a file:// proxy URL, which the go command accepts for a
+// proxy laid out on disk. A missing file is reported as a 404 so that the
+// caller falls through to the next proxy, as for an HTTP proxy.
+func fetchFile(rawURL string) ([]byte, error) {
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.FromSlash(u.Path)
+	if filepath.Separator == '\\' {
+		// file:///C:/dir has the path /C:/dir
+		name = strings.TrimPrefix(name, `\`)
+	}
+	data, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, &ProxyError{URL: rawURL, StatusCode: http.StatusNotFound}
+	}
+	return data, err
+}
+
+// currentModule returns the module path of the running binary.
+func currentModule() (string, error) {
+	info, ok := CurrentBuildInfo()
+	if !ok || info.Main.Path == "" {
+		return "", ErrNoBuildInfo
+	}
+	return info.Main.Path, nil
+}
+
+// CheckLatest queries the module proxy for the version that 'go install'
+// would select for packagePath@latest. The module is taken from the build
+// information of the running binary, so packagePath only mirrors the Upgrade
+// signature. No installation is performed.
+func CheckLatest(ctx context.Context, packagePath string, opts ...Option) (string, error) {
+	cfg := newConfig(opts)
+	modulePath, err := currentModule()
+	if err != nil {
+		return "", err
+	}
+	return latestVersion(ctx, cfg, modulePath)
+}
+
+// ResolveLatest returns the concrete version the module proxy reports as
+// @latest for modulePath, such as "v1.4.2", for callers building their own
+// flows; it is what Upgrade's already-latest pre-check and CheckLatest use.
+// Unlike CheckLatest, the module is given rather than taken from the running
+// binary. GOPROXY is honored as by go install, falling back to later entries
+// as its separators allow, and opts such as WithEnv, WithHTTPClient and
+// WithConcurrentProxies configure the lookup. A failed request returns a
+// *ProxyError, ErrProxyDisabled or ErrNoProxy, and a response that is not a
+// valid version an error wrapping ErrInvalidVersion.
+func ResolveLatest(ctx context.Context, modulePath string, opts ...Option) (string, error) {
+	return latestVersion(ctx, newConfig(opts), modulePath)
+}
+
+// latestVersion returns the version the proxy reports as @latest for
+// modulePath.
+func latestVersion(ctx context.Context, cfg *config, modulePath string) (string, error) {
+	info, err := latestInfo(ctx, cfg, modulePath)
+	if err != nil {
+		return "", err
+	}
+	if !semverValid(info.Version) {
+		return "", fmt.Errorf("%w: @latest for %s is %q", ErrInvalidVersion, modulePath, info.Version)
+	}
+	return info.Version, nil
+}
+
+// maxMajorProbes bounds the number of major versions LatestMajorAvailable
+// probes beyond the current one.
+const maxMajorProbes = 20
+
+// LatestMajorAvailable looks for a newer major version of the running
+// binary's module, which @latest never selects because each major version of
+// two and above has its own module path. It probes "<module>/v2", "/v3" and
+// so on past the current major on the proxy, stopping at the first that does
+// not exist, and returns the module path and @latest version of the highest
+// one found. When there is no newer major, both are empty and err is nil.
+func LatestMajorAvailable(ctx context.Context, packagePath string, opts ...Option) (modulePath, version string, err error) {
+	cfg := newConfig(opts)
+	info, ok := CurrentBuildInfo()
+	if !ok || info.Main.Path == "" {
+		return "", "", ErrNoBuildInfo
+	}
+	// Strip any "/vN" or ".vN" suffix; v0, v1 and +incompatible versions
+	// all share the unsuffixed path, so probing starts at v2 for them.
+	base, sep, major := info.Main.Path, "/v", 1
+	if n := pathMajor(base); n >= 0 {
+		base = strings.TrimSuffix(base, strconv.Itoa(n))
+		base, sep = base[:len(base)-2], base[len(base)-2:]
+		major = max(n, 1)
+	}
+	for n := major + 1; n <= major+maxMajorProbes; n++ {
+		candidate := base + sep + strconv.Itoa(n)
+		v, err := latestVersion(ctx, cfg, candidate)
+		var perr *ProxyError
+		if errors.As(err, &perr) && perr.notFound() {
+			break
+		}
+		if err != nil {
+			return "", "", err
+		}
+		modulePath, version = candidate, v
+	}
+	return modulePath, version, nil
+}
+
+// VersionInfo is the metadata a module proxy reports for a version. Version
+// and Time are always present; Origin is best-effort and depends on whether
+// the proxy records it.
+type VersionInfo struct {
+	Version string    // canonical version, e.g. "v1.2.3"
+	Time    time.Time // commit time of the version
+	Origin  *Origin   `json:",omitempty"` // VCS origin, if reported by the proxy
+	// Proxy is the URL of the GOPROXY entry that served the metadata. It
+	// is filled in by LatestInfo rather than sent by the proxy.
+	Proxy string `json:"-"`
+}
+
+// Origin describes the VCS source a version was fetched from.
+type Origin struct {
+	VCS    string `json:",omitempty"` // e.g. "git"
+	URL    string `json:",omitempty"` // repository URL
+	Subdir string `json:",omitempty"` // module subdirectory within the repository
+	Hash   string `json:",omitempty"` // commit hash
+	Ref    string `json:",omitempty"` // tag or branch, e.g. "refs/tags/v1.2.3"
+}
+
+// LatestInfoRaw returns the undecoded JSON the module proxy serves for the
+// running binary's module at @latest, for callers that need fields beyond
+// those in VersionInfo.
+func LatestInfoRaw(ctx context.Context, packagePath string, opts ...Option) (json.RawMessage, error) {
+	cfg := newConfig(opts)
+	modulePath, err := currentModule()
+	if err != nil {
+		return nil, err
+	}
+	raw, _, err := latestInfoRaw(ctx, cfg, modulePath)
+	return raw, err
+}
+
+// LatestInfo returns the module proxy's metadata for the running binary's
+// module at @latest.
+func LatestInfo(ctx context.Context, packagePath string, opts ...Option) (*VersionInfo, error) {
+	cfg := newConfig(opts)
+	modulePath, err := currentModule()
+	if err != nil {
+		return nil, err
+	}
+	return latestInfo(ctx, cfg, modulePath)
+}
+
+func latestInfoRaw(ctx context.Context, cfg *config, modulePath string) (json.RawMessage, string, error) {
+	get := proxyGet
+	if cfg.concurrentProxies {
+		get = proxyGetConcurrent
+	}
+	escaped, err := escapeModulePath(modulePath)
+	if err != nil {
+		return nil, "", err
+	}
+	body, source, err := get(ctx, cfg, escaped+"/@latest")
+	if err != nil {
+		return nil, "", err
+	}
+	if !json.Valid(body) {
+		return nil, "", fmt.Errorf("autoupgrade: invalid JSON in @latest response for %s", modulePath)
+	}
+	return body, source, nil
+}
+
+func latestInfo(ctx context.Context, cfg *config, modulePath string) (*VersionInfo, error) {
+	body, source, err := latestInfoRaw(ctx, cfg, modulePath)
+	if err != nil {
+		return nil, err
+	}
+	var info VersionInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("autoupgrade: decoding @latest response: %w", err)
+	}
+	info.Proxy = source
+	return &info, nil
+}
+
+// versionInfo returns the proxy's metadata for modulePath at version.
+func versionInfo(ctx context.Context, cfg *config, modulePath, version string) (*VersionInfo, error) {
+	name, err := versionFile(modulePath, version, ".info")
+	if err != nil {
+		return nil, err
+	}
+	body, source, err := proxyGet(ctx, cfg, name)
+	if err != nil {
+		return nil, err
+	}
+	var info VersionInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("autoupgrade: decoding %s info: %w", version, err)
+	}
+	info.Proxy = source
+	return &info, nil
+}
+
+// AvailableVersions returns the tagged versions of the running binary's
+// module known to the module proxy, sorted in ascending semver order.
+// Pseudo-versions are not included.
+func AvailableVersions(ctx context.Context, packagePath string, opts ...Option) ([]string, error) {
+	cfg := newConfig(opts)
+	modulePath, err := currentModule()
+	if err != nil {
+		return nil, err
+	}
+	versions, _, err := listVersions(ctx, cfg, modulePath)
+	return versions, err
+}
+
+// VersionsBehind returns how many tagged stable releases of the running
+// binary's module are newer than the current version, for messages such as
+// "3 releases behind". Prereleases are not counted. When the current version
+// is not a stable release in the proxy's list, such as a pseudo-version or a
+// retracted tag, it returns -1 and ErrVersionNotListed.
+func VersionsBehind(ctx context.Context, packagePath string, opts ...Option) (int, error) {
+	cfg := newConfig(opts)
+	info, ok := CurrentBuildInfo()
+	if !ok || info.Main.Path == "" {
+		return -1, ErrNoBuildInfo
+	}
+	versions, _, err := listVersions(ctx, cfg, info.Main.Path)
+	if err != nil {
+		return -1, err
+	}
+	current := info.Main.Version
+	behind, found := 0, false
+	for _, v := range versions {
+		if isPrerelease(v) {
+			continue
+		}
+		switch {
+		case v == current:
+			found = true
+		case found:
+			behind++
+		}
+	}
+	if !found {
+		return -1, fmt.Errorf("%w: %s", ErrVersionNotListed, current)
+	}
+	return behind, nil
+}
+
+// listVersions returns the sorted tagged versions of modulePath known to the
+// proxy, and the URL of the GOPROXY entry that listed them.
+func listVersions(ctx context.Context, cfg *config, modulePath string) ([]string, string, error) {
+	escaped, err := escapeModulePath(modulePath)
+	if err != nil {
+		return nil, "", err
+	}
+	body, source, err := proxyGet(ctx, cfg, escaped+"/@v/list")
+	if err != nil {
+		return nil, "", err
+	}
+	var versions []string
+	for _, line := range strings.Split(string(body), "\n") {
+		if v := strings.TrimSpace(line); semverValid(v) {
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return semverCompare(versions[i], versions[j]) < 0
+	})
+	return versions, source, nil
+}
+
+// escapeModulePath returns modulePath in the case-encoded form used in
+// module proxy URLs and the module cache, as computed by module.EscapePath.
+// The error wraps ErrInvalidModulePath if modulePath is not a valid module
+// path, so that no request is made for it.
+func escapeModulePath(modulePath string) (string, error) {
+	escaped, err := module.EscapePath(modulePath)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidModulePath, err)
+	}
+	return escaped, nil
+}
+
+// versionFile returns the path, relative to a module proxy or the module
+// cache's download directory, of the file with the given suffix, such as
+// ".info" or ".mod", for modulePath at version. The error wraps
+// ErrInvalidModulePath or ErrInvalidVersion if either cannot be escaped.
+func versionFile(modulePath, version, suffix string) (string, error) {
+	escaped, err := escapeModulePath(modulePath)
+	if err != nil {
+		return "", err
+	}
+	v, err := module.EscapeVersion(version)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidVersion, err)
+	}
+	return escaped + "/@v/" + v + suffix, nil
+}
@@ -0,0 +1,457 @@
+package autoupgrade
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckLatest_userAgent(t *testing.T) {
+	var gotUA string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUA = r.Header.Get("User-Agent")
+		w.Write([]byte(`{"Version":"v1.2.3"}`))
+	}))
+	defer srv.Close()
+	t.Setenv("GOPROXY", srv.URL)
+
+	v, err := CheckLatest(context.Background(), "", WithUserAgent("mytool-updater/1.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "v1.2.3" {
+		t.Errorf("CheckLatest() = %q, want %q", v, "v1.2.3")
+	}
+	if gotUA != "mytool-updater/1.0" {
+		t.Errorf("User-Agent = %q, want %q", gotUA, "mytool-updater/1.0")
+	}
+}
+
+func TestAvailableVersions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/github.com/melt-inc/autoupgrade/@v/list" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("v1.10.0\nv1.2.0\nv1.9.0-rc.1\nv1.9.0\n"))
+	}))
+	defer srv.Close()
+	t.Setenv("GOPROXY", srv.URL)
+
+	versions, err := AvailableVersions(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"v1.2.0", "v1.9.0-rc.1", "v1.9.0", "v1.10.0"}
+	if len(versions) != len(want) {
+		t.Fatalf("AvailableVersions() = %v, want %v", versions, want)
+	}
+	for i := range want {
+		if versions[i] != want[i] {
+			t.Fatalf("AvailableVersions() = %v, want %v", versions, want)
+		}
+	}
+}
+
+func Test_proxyList(t *testing.T) {
+	t.Setenv("GOPROXY", "https://a.example/, https://b.example|direct")
+	list := proxyList(newConfig(nil))
+	want := []proxyEntry{
+		{url: "https://a.example"},
+		{url: "https://b.example", fallBackOnError: true},
+		{url: "direct"},
+	}
+	if len(list) != len(want) {
+		t.Fatalf("proxyList() = %v, want %v", list, want)
+	}
+	for i := range want {
+		if list[i] != want[i] {
+			t.Errorf("proxyList()[%d] = %v, want %v", i, list[i], want[i])
+		}
+	}
+}
+
+func TestCheckLatest_proxyOff(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request to %s", r.URL)
+	}))
+	defer srv.Close()
+	t.Setenv("GOPROXY", srv.URL)
+
+	_, err := CheckLatest(context.Background(), "", WithEnv("GOPROXY=off"))
+	if !errors.Is(err, ErrProxyDisabled) {
+		t.Errorf("CheckLatest() error = %v, want %v", err, ErrProxyDisabled)
+	}
+	_, err = AvailableVersions(context.Background(), "", WithEnv("GOPROXY=off"))
+	if !errors.Is(err, ErrProxyDisabled) {
+		t.Errorf("AvailableVersions() error = %v, want %v", err, ErrProxyDisabled)
+	}
+}
+
+func TestResolveLatest(t *testing.T) {
+	empty, proxy := t.TempDir(), t.TempDir()
+	dir := filepath.Join(proxy, "example.com", "!fake")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "@latest"), []byte(`{"Version":"v1.4.2"}`))
+	goproxy := "GOPROXY=file://" + filepath.ToSlash(empty) + ",file://" + filepath.ToSlash(proxy)
+
+	v, err := ResolveLatest(context.Background(), "example.com/Fake", WithEnv(goproxy))
+	if err != nil || v != "v1.4.2" {
+		t.Errorf("ResolveLatest() = %q, %v, want v1.4.2 from the second proxy", v, err)
+	}
+
+	_, err = ResolveLatest(context.Background(), "example.com/missing", WithEnv(goproxy))
+	var perr *ProxyError
+	if !errors.As(err, &perr) || perr.StatusCode != http.StatusNotFound {
+		t.Errorf("ResolveLatest(missing) error = %v, want a 404 *ProxyError", err)
+	}
+
+	writeFile(t, filepath.Join(dir, "@latest"), []byte(`{"Version":"master"}`))
+	if _, err := ResolveLatest(context.Background(), "example.com/Fake", WithEnv(goproxy)); !errors.Is(err, ErrInvalidVersion) {
+		t.Errorf("ResolveLatest() with a bad version error = %v, want %v", err, ErrInvalidVersion)
+	}
+}
+
+func Test_escapeModulePath(t *testing.T) {
+	tests := map[string]string{
+		"github.com/BurntSushi/toml": "github.com/!burnt!sushi/toml",
+		"github.com/melt-inc/tool":   "github.com/melt-inc/tool",
+		"example.com/ABC":            "example.com/!a!b!c",
+	}
+	for in, want := range tests {
+		if got, err := escapeModulePath(in); err != nil || got != want {
+			t.Errorf("escapeModulePath(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "example.com/../tool", "example.com/tool?x", "/example.com/tool", "example.com//tool"} {
+		if _, err := escapeModulePath(in); !errors.Is(err, ErrInvalidModulePath) {
+			t.Errorf("escapeModulePath(%q) error = %v, want %v", in, err, ErrInvalidModulePath)
+		}
+	}
+}
+
+func Test_versionFile(t *testing.T) {
+	got, err := versionFile("github.com/BurntSushi/toml", "v1.3.2-RC", ".info")
+	if want := "github.com/!burnt!sushi/toml/@v/v1.3.2-!r!c.info"; err != nil || got != want {
+		t.Errorf("versionFile() = %q, %v, want %q", got, err, want)
+	}
+	if _, err := versionFile("example.com/tool", "v1.0.0/../x", ".mod"); !errors.Is(err, ErrInvalidVersion) {
+		t.Errorf("versionFile() with a bad version error = %v, want %v", err, ErrInvalidVersion)
+	}
+}
+
+func Test_latestInfo_invalidModulePath(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+	cfg := newConfig([]Option{WithEnv("GOPROXY=" + srv.URL)})
+	if _, err := latestInfo(context.Background(), cfg, "example.com/../tool"); !errors.Is(err, ErrInvalidModulePath) {
+		t.Errorf("latestInfo() error = %v, want %v", err, ErrInvalidModulePath)
+	}
+	if requests != 0 {
+		t.Errorf("proxy got %d requests, want 0", requests)
+	}
+}
+
+func Test_latestVersion_uppercase(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/github.com/!burnt!sushi/toml/@latest" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"Version":"v1.3.2"}`))
+	}))
+	defer srv.Close()
+
+	cfg := newConfig([]Option{WithEnv("GOPROXY=" + srv.URL)})
+	v, err := latestVersion(context.Background(), cfg, "github.com/BurntSushi/toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "v1.3.2" {
+		t.Errorf("latestVersion() = %q, want %q", v, "v1.3.2")
+	}
+}
+
+func TestLatestInfo(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Version":"v1.2.3","Time":"2024-01-02T03:04:05Z","Origin":{"VCS":"git","URL":"https://github.com/melt-inc/autoupgrade","Ref":"refs/tags/v1.2.3","Hash":"abc123"}}`))
+	}))
+	defer srv.Close()
+	t.Setenv("GOPROXY", srv.URL)
+
+	info, err := LatestInfo(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != "v1.2.3" || info.Time.Year() != 2024 {
+		t.Errorf("LatestInfo() = %+v", info)
+	}
+	if info.Origin == nil || info.Origin.Ref != "refs/tags/v1.2.3" || info.Origin.Hash != "abc123" {
+		t.Errorf("LatestInfo().Origin = %+v", info.Origin)
+	}
+
+	raw, err := LatestInfoRaw(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw), `"VCS":"git"`) {
+		t.Errorf("LatestInfoRaw() = %s", raw)
+	}
+}
+
+func TestLatestInfo_proxy(t *testing.T) {
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Version":"v1.2.3"}`))
+	}))
+	defer srv.Close()
+	t.Setenv("GOPROXY", missing.URL+","+srv.URL+"/")
+
+	info, err := LatestInfo(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Proxy != srv.URL {
+		t.Errorf("LatestInfo().Proxy = %q, want %q", info.Proxy, srv.URL)
+	}
+}
+
+func TestCheckLatest_concurrentProxies(t *testing.T) {
+	fakeBuildInfo(t, "example.com/fake", "v1.0.0")
+	canceled := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(canceled)
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Version":"v1.2.3"}`))
+	}))
+	defer fast.Close()
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+
+	info, err := LatestInfo(context.Background(), "", WithProxy(slow.URL+","+fast.URL), WithConcurrentProxies(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != "v1.2.3" || info.Proxy != fast.URL {
+		t.Errorf("LatestInfo() = %s from %s, want v1.2.3 from %s", info.Version, info.Proxy, fast.URL)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Error("request to slow proxy not canceled")
+	}
+
+	_, err = CheckLatest(context.Background(), "", WithProxy(missing.URL+","+missing.URL+",off"), WithConcurrentProxies(true))
+	if !errors.Is(err, ErrProxyDisabled) {
+		t.Errorf("CheckLatest() with every proxy missing error = %v, want ErrProxyDisabled", err)
+	}
+}
+
+func Test_matchPrefixPatterns(t *testing.T) {
+	tests := []struct {
+		globs, target string
+		want          bool
+	}{
+		{"corp.example.com", "corp.example.com/go/tool", true},
+		{"*.example.com", "corp.example.com/go", true},
+		{"corp.example.com/go", "corp.example.com/go/tool", true},
+		{"corp.example.com/go", "corp.example.com/other", false},
+		{"corp.example.com/go/tool/v2", "corp.example.com/go", false},
+		{"other.com, corp.example.com", "corp.example.com", true},
+		{"", "corp.example.com", false},
+	}
+	for _, tt := range tests {
+		if got := matchPrefixPatterns(tt.globs, tt.target); got != tt.want {
+			t.Errorf("matchPrefixPatterns(%q, %q) = %v, want %v", tt.globs, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestCheckLatest_insecureModules(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Version":"v1.2.3"}`))
+	}))
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0) // expected handshake failure
+	srv.StartTLS()
+	defer srv.Close()
+	t.Setenv("GOPROXY", srv.URL)
+
+	if _, err := CheckLatest(context.Background(), ""); err == nil {
+		t.Error("CheckLatest() accepted an untrusted certificate by default")
+	}
+	v, err := CheckLatest(context.Background(), "", WithInsecureModules("127.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "v1.2.3" {
+		t.Errorf("CheckLatest() = %q, want %q", v, "v1.2.3")
+	}
+}
+
+func TestVersionsBehind(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("v1.10.0\nv1.2.0\nv1.9.0-rc.1\nv1.9.0\nv1.3.0\n"))
+	}))
+	defer srv.Close()
+	t.Setenv("GOPROXY", srv.URL)
+
+	tests := []struct {
+		current string
+		want    int
+		wantErr error
+	}{
+		{"v1.2.0", 3, nil},
+		{"v1.10.0", 0, nil},
+		{"v1.9.0-rc.1", -1, ErrVersionNotListed},
+		{"v0.0.0-20240101000000-abcdef123456", -1, ErrVersionNotListed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.current, func(t *testing.T) {
+			fakeBuildInfo(t, "example.com/fake", tt.current)
+			got, err := VersionsBehind(context.Background(), "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VersionsBehind() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("VersionsBehind() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLatestMajorAvailable(t *testing.T) {
+	var probes []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes = append(probes, r.URL.Path)
+		switch r.URL.Path {
+		case "/example.com/tool/v2/@latest":
+			w.Write([]byte(`{"Version":"v2.4.0"}`))
+		case "/example.com/tool/v3/@latest":
+			w.Write([]byte(`{"Version":"v3.0.1"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("GOPROXY", srv.URL)
+
+	tests := []struct {
+		path, version      string
+		wantPath, wantVers string
+	}{
+		{"example.com/tool", "v1.2.0", "example.com/tool/v3", "v3.0.1"},
+		{"example.com/tool/v2", "v2.4.0", "example.com/tool/v3", "v3.0.1"},
+		{"example.com/tool/v3", "v3.0.1", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			probes = nil
+			fakeBuildInfo(t, tt.path, tt.version)
+			gotPath, gotVers, err := LatestMajorAvailable(context.Background(), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotPath != tt.wantPath || gotVers != tt.wantVers {
+				t.Errorf("LatestMajorAvailable() = %q, %q, want %q, %q", gotPath, gotVers, tt.wantPath, tt.wantVers)
+			}
+			// Probing stops at the first missing major
+			if last := probes[len(probes)-1]; last != "/example.com/tool/v4/@latest" {
+				t.Errorf("last probe = %q, want v4", last)
+			}
+		})
+	}
+}
+
+func Test_fetch_file(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "list"), []byte("v1.0.0\n"))
+	cfg := newConfig(nil)
+	root := "file://" + filepath.ToSlash(dir)
+	if !strings.HasPrefix(root, "file:///") {
+		root = "file:///" + strings.TrimPrefix(root, "file://")
+	}
+
+	body, err := fetch(context.Background(), cfg, root+"/list")
+	if err != nil || string(body) != "v1.0.0\n" {
+		t.Errorf("fetch() = %q, %v", body, err)
+	}
+	var perr *ProxyError
+	if _, err := fetch(context.Background(), cfg, root+"/missing"); !errors.As(err, &perr) || !perr.notFound() {
+		t.Errorf("fetch() of missing file error = %v, want not found", err)
+	}
+}
+
+func TestAvailableVersions_rateLimited(t *testing.T) {
+	var calls atomic.Int32
+	limit := int32(2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= limit {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("v1.0.0\n"))
+	}))
+	defer srv.Close()
+	fakeBuildInfo(t, "example.com/fake", "v1.0.0")
+	opts := []Option{WithEnv("GOPROXY=" + srv.URL)}
+
+	versions, err := AvailableVersions(context.Background(), "", opts...)
+	if err != nil {
+		t.Fatalf("AvailableVersions() error = %v", err)
+	}
+	if len(versions) != 1 || calls.Load() != 3 {
+		t.Errorf("AvailableVersions() = %v after %d requests, want [v1.0.0] after 3", versions, calls.Load())
+	}
+
+	calls.Store(0)
+	limit = 100
+	_, err = AvailableVersions(context.Background(), "", opts...)
+	if !errors.Is(err, ErrRateLimited) || Classify(err) != FailureTransient {
+		t.Errorf("AvailableVersions() error = %v (%v), want transient ErrRateLimited", err, Classify(err))
+	}
+	if got := calls.Load(); got != rateLimitRetries+1 {
+		t.Errorf("requests = %d, want %d", got, rateLimitRetries+1)
+	}
+}
+
+func Test_retryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"5", 5 * time.Second, true},
+		{"-1", 0, true},
+		{"Mon, 01 Jan 2024 00:00:30 GMT", 30 * time.Second, true},
+		{"Sun, 31 Dec 2023 00:00:00 GMT", 0, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := retryAfter(tt.header, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfter(%q) = %v, %v, want %v, %v", tt.header, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package autoupgrade
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// errTooFresh is returned by releaseOldEnough when every version newer than
+// the current one was published less than WithMinReleaseAge ago.
+var errTooFresh = errors.New("autoupgrade: no release old enough")
+
+// releaseOldEnough returns target, or for WithMinReleaseAge the newest older
+// version published at least the minimum age before now when target is more
+// recent. Versions are considered as in toolchainCompatible, with allow from
+// resolveTarget; a version whose publish time the proxy does not report
+// counts as too recent.
+func releaseOldEnough(ctx context.Context, cfg *config, res *UpgradeResult, modulePath, current, target string, allow func(string) bool, now time.Time) (string, error) {
+	var info *VersionInfo
+	var err error
+	if target == "latest" {
+		info, err = latestInfo(ctx, cfg, modulePath)
+	} else {
+		info, err = versionInfo(ctx, cfg, modulePath, target)
+	}
+	if err != nil {
+		return "", err
+	}
+	oldEnough := func(t time.Time) bool { return !t.IsZero() && now.Sub(t) >= cfg.minReleaseAge }
+	if oldEnough(info.Time) {
+		return target, nil
+	}
+	preferred := info.Version
+	res.Decision.block(preferred, PolicyMinReleaseAge)
+	cfg.logf("%s was published %v ago, less than the minimum age of %v", preferred, now.Sub(info.Time).Round(time.Second), cfg.minReleaseAge)
+
+	versions, _, err := listVersions(ctx, cfg, modulePath)
+	if err != nil {
+		return "", err
+	}
+	for i := len(versions) - 1; i >= 0; i-- {
+		v := versions[i]
+		if semverCompare(v, preferred) >= 0 || !fallbackAllowed(allow, preferred, v) {
+			continue
+		}
+		if semverValid(current) && semverCompare(v, current) <= 0 {
+			break
+		}
+		if cfg.versionFilter != nil && !cfg.versionFilter(v) {
+			continue
+		}
+		vi, err := versionInfo(ctx, cfg, modulePath, v)
+		if err != nil {
+			return "", err
+		}
+		if oldEnough(vi.Time) {
+			cfg.logf("installing %s instead, published %v ago", v, now.Sub(vi.Time).Round(time.Second))
+			return v, nil
+		}
+	}
+	return "", errTooFresh
+}
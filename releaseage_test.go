@@ -0,0 +1,60 @@
+package autoupgrade
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// publishAt sets the publish time the fake proxy reports for version, and
+// for @latest when latest is set.
+func publishAt(t *testing.T, m *fakeModule, version string, when time.Time, latest bool) {
+	t.Helper()
+	info, _ := json.Marshal(VersionInfo{Version: version, Time: when})
+	dir := filepath.Join(m.proxyDir, "example.com", "fake")
+	writeFile(t, filepath.Join(dir, "@v", version+".info"), info)
+	if latest {
+		writeFile(t, filepath.Join(dir, "@latest"), info)
+	}
+}
+
+func TestUpgrade_minReleaseAge(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0", "v1.2.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+	publishAt(t, m, "v1.2.0", time.Now().Add(-time.Hour), true)
+	opts := append(m.options(), WithMinReleaseAge(24*time.Hour))
+
+	res := Upgrade(context.Background(), "", opts...)
+	if res.ExitError != nil || res.Decision.Target != "v1.1.0" {
+		t.Fatalf("Upgrade() = %q, %v, want target v1.1.0", res.Decision.Target, res.ExitError)
+	}
+	if res.Decision.Blocked != "v1.2.0" || res.Decision.BlockedBy != PolicyMinReleaseAge {
+		t.Errorf("Blocked = %q by %q, want v1.2.0 by %q", res.Decision.Blocked, res.Decision.BlockedBy, PolicyMinReleaseAge)
+	}
+
+	publishAt(t, m, "v1.1.0", time.Now().Add(-time.Minute), false)
+	m.gobin = t.TempDir()
+	res = Upgrade(context.Background(), "", append(m.options(), WithMinReleaseAge(24*time.Hour))...)
+	if res.ExitError != nil || res.SkipReason != SkipTooFresh {
+		t.Errorf("Upgrade() with only fresh releases = %q, %v, want %q", res.SkipReason, res.ExitError, SkipTooFresh)
+	}
+
+	res = Upgrade(context.Background(), "", append(m.options(), WithMinReleaseAge(time.Minute/2))...)
+	if res.ExitError != nil || res.Decision.Target != "latest" || res.InstalledPath == "" {
+		t.Errorf("Upgrade() with a short bake time = %q, %v, want latest installed", res.Decision.Target, res.ExitError)
+	}
+}
+
+func TestUpgrade_minReleaseAgeConstraint(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0", "v1.2.0", "v1.3.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+	publishAt(t, m, "v1.3.0", time.Now().Add(-time.Hour), false)
+
+	// The fallback must still satisfy the constraint that excluded v1.2.0.
+	res := Upgrade(context.Background(), "", append(m.options(), WithConstraint(">=1.0.0, !=1.2.0"), WithMinReleaseAge(24*time.Hour))...)
+	if res.ExitError != nil || res.Decision.Target != "v1.1.0" {
+		t.Errorf("Upgrade() = %q, %v, want target v1.1.0", res.Decision.Target, res.ExitError)
+	}
+}
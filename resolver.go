@@ -0,0 +1,98 @@
+package autoupgrade
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// VersionResolver returns what Upgrade should install for modulePath, in the
+// form of a channel config entry: "latest", an explicit version such as
+// "v1.4.2", or a version constraint. See WithVersionResolver.
+type VersionResolver func(ctx context.Context, modulePath string) (string, error)
+
+// maxResolverResponse bounds the body read from an HTTPVersionResolver URL.
+const maxResolverResponse = 64 << 10
+
+// HTTPVersionResolver returns a VersionResolver that GETs url and installs
+// the version it names, for teams that publish the currently approved version
+// from a small service. The response is either a plain version string, such
+// as "v1.4.2", or a JSON object {"version": "v1.4.2"}. The answer is reused
+// for ttl before url is asked again; a zero ttl asks on every call.
+//
+// opts configure the request as they do for the proxy: WithHTTPClient,
+// WithUserAgent and WithProxyTimeouts. Errors wrap ErrResolverUnreachable
+// when the request fails or returns a status other than 200, and
+// ErrResolverMalformed when the body is not a valid version.
+func HTTPVersionResolver(url string, ttl time.Duration, opts ...Option) VersionResolver {
+	cfg := newConfig(opts)
+	var (
+		mu      sync.Mutex
+		cached  string
+		fetched time.Time
+	)
+	return func(ctx context.Context, modulePath string) (string, error) {
+		// Holding the lock while fetching makes concurrent callers share
+		// one request.
+		mu.Lock()
+		defer mu.Unlock()
+		if cached != "" && time.Since(fetched) < ttl {
+			return cached, nil
+		}
+		v, err := fetchResolverVersion(ctx, cfg, url)
+		if err != nil {
+			return "", err
+		}
+		cached, fetched = v, time.Now()
+		return v, nil
+	}
+}
+
+// fetchResolverVersion GETs url and parses the version in the response.
+func fetchResolverVersion(ctx context.Context, cfg *config, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrResolverUnreachable, err)
+	}
+	if cfg.userAgent != "" {
+		req.Header.Set("User-Agent", cfg.userAgent)
+	}
+	resp, err := send(cfg, req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrResolverUnreachable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: %s: %s", ErrResolverUnreachable, url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResolverResponse))
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrResolverUnreachable, err)
+	}
+	return parseResolverVersion(body)
+}
+
+// parseResolverVersion returns the version in an HTTPVersionResolver
+// response: a plain version string or {"version": "..."}.
+func parseResolverVersion(body []byte) (string, error) {
+	body = bytes.TrimSpace(body)
+	v := string(body)
+	if bytes.HasPrefix(body, []byte("{")) {
+		var doc struct {
+			Version string `json:"version"`
+		}
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return "", fmt.Errorf("%w: %w", ErrResolverMalformed, err)
+		}
+		v = doc.Version
+	}
+	if v = normalizeVersion(v); !semverValid(v) {
+		return "", fmt.Errorf("%w: %q is not a version", ErrResolverMalformed, v)
+	}
+	return v, nil
+}
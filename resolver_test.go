@@ -0,0 +1,76 @@
+package autoupgrade
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_parseResolverVersion(t *testing.T) {
+	tests := []struct {
+		body    string
+		want    string
+		wantErr error
+	}{
+		{"v1.4.2\n", "v1.4.2", nil},
+		{"1.4.2", "v1.4.2", nil},
+		{`{"version": "v1.5.0-rc.1"}`, "v1.5.0-rc.1", nil},
+		{`{"version": ""}`, "", ErrResolverMalformed},
+		{`{"version":`, "", ErrResolverMalformed},
+		{"<html>maintenance</html>", "", ErrResolverMalformed},
+	}
+	for _, tt := range tests {
+		got, err := parseResolverVersion([]byte(tt.body))
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("parseResolverVersion(%q) = %q, %v, want %q, %v", tt.body, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestHTTPVersionResolver(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.URL.Path == "/down" {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"version": "v1.1.0"}`))
+	}))
+	defer srv.Close()
+
+	resolve := HTTPVersionResolver(srv.URL+"/approved", time.Hour)
+	for i := 0; i < 2; i++ {
+		if v, err := resolve(context.Background(), "example.com/fake"); v != "v1.1.0" || err != nil {
+			t.Fatalf("resolve() = %q, %v, want v1.1.0", v, err)
+		}
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("%d requests within the TTL, want 1", n)
+	}
+
+	resolve = HTTPVersionResolver(srv.URL+"/down", 0)
+	if _, err := resolve(context.Background(), "example.com/fake"); !errors.Is(err, ErrResolverUnreachable) {
+		t.Errorf("resolve() error = %v, want %v", err, ErrResolverUnreachable)
+	}
+}
+
+func TestUpgrade_versionResolver(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0", "v1.2.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+	resolve := func(ctx context.Context, modulePath string) (string, error) { return "v1.1.0", nil }
+
+	res := Upgrade(context.Background(), "", append(m.options(), WithVersionResolver(resolve))...)
+	if res.ExitError != nil || res.Decision.Target != "v1.1.0" {
+		t.Errorf("Upgrade() = %q, %v, want target v1.1.0", res.Decision.Target, res.ExitError)
+	}
+
+	res = Upgrade(context.Background(), "", append(m.options(), WithVersionResolver(resolve), WithChannelConfig("channels.json"))...)
+	if !errors.Is(res.ExitError, ErrInvalidOption) {
+		t.Errorf("Upgrade() with channel config error = %v, want %v", res.ExitError, ErrInvalidOption)
+	}
+}
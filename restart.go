@@ -0,0 +1,67 @@
+package autoupgrade
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// Restart replaces the running process with the binary res installed, passing
+// it the same arguments and environment. On Unix the process is re-executed
+// in place, keeping its PID, so a supervisor such as systemd sees no exit; on
+// Windows the new binary is started with the same standard streams and the
+// current process exits with status 0. Restart only returns on failure.
+//
+// Deferred functions and exit handlers do not run, and buffered output that
+// has not been flushed is lost, so call it only once the process has nothing
+// left to clean up. Files opened by Go are closed on exec; descriptors
+// inherited without close-on-exec pass to the new binary.
+//
+// A binary staged with WithReplaceRunning(false) is not restarted into,
+// since it would run under its staged name and the next upgrade would stage
+// over it; Restart returns ErrRestartStaged until Activate has moved it into
+// place.
+func Restart(res *UpgradeResult) error {
+	if res == nil || res.InstalledPath == "" {
+		return ErrNothingToRestart
+	}
+	if res.StagedFor != "" {
+		return fmt.Errorf("%w: call Activate to move %s into place at %s", ErrRestartStaged, res.InstalledPath, res.StagedFor)
+	}
+	path := res.InstalledPath
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("autoupgrade: restart: %w", err)
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("autoupgrade: restart: %s is not a regular file", path)
+	}
+	args := append([]string(nil), os.Args...)
+	if len(args) == 0 {
+		args = []string{path}
+	}
+	if err := restartProcess(path, args, os.Environ()); err != nil {
+		return fmt.Errorf("autoupgrade: restart: %w", err)
+	}
+	return nil
+}
+
+// RunBackground is UpgradeBackground for set-and-forget daemons: with
+// WithRestart(true), once the upgrade has installed and verified a new
+// version, the process is restarted into it with Restart. Hooks set with
+// WithHooks report the upgrade as usual before the restart. The channel
+// receives the result only when no restart happened or it failed, in which
+// case RestartError is set; after a successful restart the process is gone.
+func RunBackground(ctx context.Context, packagePath string, opts ...Option) <-chan *UpgradeResult {
+	restart := newConfig(opts).restart
+	ch := make(chan *UpgradeResult, 1)
+	go func() {
+		defer close(ch)
+		res := <-UpgradeBackground(ctx, packagePath, opts...)
+		if restart && ctx.Err() == nil && res.DidUpgrade() {
+			res.RestartError = Restart(res)
+		}
+		ch <- res
+	}()
+	return ch
+}
@@ -0,0 +1,13 @@
+//go:build !unix && !windows
+
+package autoupgrade
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// restartProcess reports that restarting is not supported on this platform.
+func restartProcess(path string, args, env []string) error {
+	return fmt.Errorf("%w: restart on %s", ErrUnsupportedPlatform, runtime.GOOS)
+}
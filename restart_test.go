@@ -0,0 +1,68 @@
+//go:build unix
+
+package autoupgrade
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func stubExecve(t *testing.T, fn func(path string, args, env []string) error) {
+	t.Helper()
+	old := execve
+	execve = fn
+	t.Cleanup(func() { execve = old })
+}
+
+func TestRestart(t *testing.T) {
+	if err := Restart(&UpgradeResult{}); !errors.Is(err, ErrNothingToRestart) {
+		t.Errorf("Restart() with nothing installed error = %v, want %v", err, ErrNothingToRestart)
+	}
+	if err := Restart(&UpgradeResult{InstalledPath: "tool.new", StagedFor: "tool"}); !errors.Is(err, ErrRestartStaged) {
+		t.Errorf("Restart() with a staged binary error = %v, want %v", err, ErrRestartStaged)
+	}
+
+	path := filepath.Join(t.TempDir(), "tool")
+	writeFile(t, path, []byte("#!/bin/sh\n"))
+	var gotPath string
+	var gotArgs []string
+	stubExecve(t, func(path string, args, env []string) error {
+		gotPath, gotArgs = path, args
+		return errors.New("exec format error")
+	})
+	err := Restart(&UpgradeResult{InstalledPath: path})
+	if err == nil {
+		t.Fatal("Restart() error = nil, want the exec error")
+	}
+	if gotPath != path || !slices.Equal(gotArgs, os.Args) {
+		t.Errorf("exec(%q, %q), want (%q, %q)", gotPath, gotArgs, path, os.Args)
+	}
+}
+
+func TestRunBackground_restart(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+	var restarted string
+	stubExecve(t, func(path string, args, env []string) error {
+		restarted = path
+		return errors.New("stubbed")
+	})
+
+	res := <-RunBackground(context.Background(), "", append(m.options(), WithRestart(true))...)
+	if res.ExitError != nil || !res.DidUpgrade() {
+		t.Fatalf("RunBackground() = %v, DidUpgrade %v", res.ExitError, res.DidUpgrade())
+	}
+	if restarted != m.binary() || res.RestartError == nil {
+		t.Errorf("restarted %q with error %v, want %q and the stub error", restarted, res.RestartError, m.binary())
+	}
+
+	restarted = ""
+	res = <-RunBackground(context.Background(), "", m.options()...)
+	if restarted != "" || res.RestartError != nil {
+		t.Errorf("restarted %q without WithRestart", restarted)
+	}
+}
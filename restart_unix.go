@@ -0,0 +1,13 @@
+//go:build unix
+
+package autoupgrade
+
+import "syscall"
+
+// execve replaces the process image; a variable so tests can stub it.
+var execve = syscall.Exec
+
+// restartProcess re-executes path in place of the running process.
+func restartProcess(path string, args, env []string) error {
+	return execve(path, args, env)
+}
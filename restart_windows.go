@@ -0,0 +1,19 @@
+package autoupgrade
+
+import (
+	"os"
+	"os/exec"
+)
+
+// restartProcess starts path with the standard streams of the running
+// process and exits, as Windows cannot replace a running process image.
+func restartProcess(path string, args, env []string) error {
+	cmd := exec.Command(path, args[1:]...)
+	cmd.Env = env
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	os.Exit(0)
+	return nil
+}
@@ -0,0 +1,76 @@
+package autoupgrade
+
+// SkipReason explains why Upgrade did not install anything. The zero value
+// means the upgrade was not skipped.
+type SkipReason string
+
+const (
+	// SkipNoBuildInfo means the running binary has no module build
+	// information, so there is nothing to upgrade from. ExitError wraps
+	// ErrNoBuildInfo with the details.
+	SkipNoBuildInfo SkipReason = "no-build-info"
+	// SkipCanceled means the context was already done when
+	// UpgradeBackground started, so Upgrade was not run.
+	SkipCanceled SkipReason = "canceled"
+	// SkipTestBinary means the running binary was built by 'go test', which
+	// must not replace anything.
+	SkipTestBinary SkipReason = "test-binary"
+	// SkipDevelBuild means the running binary is a development build.
+	SkipDevelBuild SkipReason = "devel-build"
+	// SkipAlreadyLatest means the running binary is already at the target
+	// version.
+	SkipAlreadyLatest SkipReason = "already-latest"
+	// SkipInstallInProgress means another install in this process is
+	// writing the install target.
+	SkipInstallInProgress SkipReason = "install-in-progress"
+	// SkipNoVCSInfo means WithRequireVCS is set and the running binary is
+	// not stamped with a VCS revision.
+	SkipNoVCSInfo SkipReason = "no-vcs-info"
+	// SkipNoAcceptableVersion means WithVersionFilter rejected every version
+	// newer than the current one.
+	SkipNoAcceptableVersion SkipReason = "no-acceptable-version"
+	// SkipBlockedByPolicy means a version other than the current one is
+	// available but a policy without a reason of its own, such as the
+	// downgrade guard, refused it. Decision.Blocked and BlockedBy name the
+	// version and policy; they are also set along with SkipCeilingReached,
+	// SkipNoAcceptableVersion, SkipToolchainTooOld and SkipTooFresh.
+	SkipBlockedByPolicy SkipReason = "blocked-by-policy"
+	// SkipCeilingReached means WithMaxVersion is set and every version
+	// newer than the current one is above the ceiling.
+	SkipCeilingReached SkipReason = "ceiling-reached"
+	// SkipTooFresh means WithMinReleaseAge is set and every version newer
+	// than the current one was published too recently.
+	SkipTooFresh SkipReason = "too-fresh"
+	// SkipToolchainTooOld means WithToolchainCompatibleOnly is set and every
+	// version newer than the current one requires a newer go than the local
+	// toolchain.
+	SkipToolchainTooOld SkipReason = "toolchain-too-old"
+	// SkipNoVersionFile means WithVersionFileRequired is set and the file
+	// set with WithVersionFile does not exist.
+	SkipNoVersionFile SkipReason = "no-version-file"
+	// SkipNoVersionSatisfiesConstraint means no version the proxy lists
+	// satisfies the expression set with WithConstraint.
+	SkipNoVersionSatisfiesConstraint SkipReason = "no-version-satisfies-constraint"
+	// SkipNotInGoBin means WithRequireInstalledInGoBin is set and the running
+	// executable is not the binary go install would replace.
+	SkipNotInGoBin SkipReason = "not-in-gobin"
+	// SkipSystemManaged means the install target is in a directory managed
+	// by the system or a package manager, and WithAllowSystemDir is not set.
+	SkipSystemManaged SkipReason = "system-managed"
+	// SkipToolDependency means the running binary was started with
+	// 'go tool' from a module that declares it as a tool dependency, whose
+	// version go install cannot change, and WithGoGetTool is not set.
+	// Decision.ToolGoMod names the go.mod file.
+	SkipToolDependency SkipReason = "tool-dependency"
+	// SkipBackoff means the last attempt failed within the window set with
+	// WithFailureBackoff.
+	SkipBackoff SkipReason = "backoff"
+	// SkipDowngrade means the target version is older than the current one.
+	SkipDowngrade SkipReason = "downgrade"
+	// SkipPrerelease means the target is a prerelease and the release
+	// channel does not accept prereleases.
+	SkipPrerelease SkipReason = "prerelease"
+	// SkipNotInChannel means the target version is not the one selected by
+	// the release channel.
+	SkipNotInChannel SkipReason = "not-in-channel"
+)
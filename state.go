@@ -0,0 +1,84 @@
+package autoupgrade
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// upgradeState is persisted in the file set with WithStateFile, so that short
+// lived processes can share what earlier runs learned.
+type upgradeState struct {
+	LastAttempt time.Time `json:"lastAttempt"`
+	Failed      bool      `json:"failed"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// readState reads the state file at path. A missing file is an empty state,
+// as is one that does not parse, such as after a crash mid-write by an older
+// version, so that a bad file cannot block upgrades for good.
+func readState(path string) (*upgradeState, error) {
+	st := &upgradeState{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, st); err != nil {
+		return &upgradeState{}, nil
+	}
+	return st, nil
+}
+
+// writeState replaces the state file at path.
+func writeState(path string, st *upgradeState) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic replaces the file at path with data, via a temporary file
+// so that a concurrent reader never sees a partial write.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".autoupgrade-tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// inBackoff reports whether the last attempt recorded in st failed less than
+// backoff before now.
+func (st *upgradeState) inBackoff(now time.Time, backoff time.Duration) bool {
+	return st.Failed && now.Sub(st.LastAttempt) < backoff
+}
+
+// record notes the outcome of an attempt finishing at now.
+func (st *upgradeState) record(now time.Time, err error) {
+	st.LastAttempt = now
+	st.Failed = err != nil
+	st.Error = ""
+	if err != nil {
+		st.Error = err.Error()
+	}
+}
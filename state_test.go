@@ -0,0 +1,67 @@
+package autoupgrade
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestState_roundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "state.json")
+	st, err := readState(path)
+	if err != nil {
+		t.Fatalf("readState() missing file error = %v", err)
+	}
+	if st.Failed || !st.LastAttempt.IsZero() {
+		t.Errorf("readState() missing file = %+v, want empty", st)
+	}
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	st.record(now, errors.New("boom"))
+	if err := writeState(path, st); err != nil {
+		t.Fatalf("writeState() error = %v", err)
+	}
+	got, err := readState(path)
+	if err != nil {
+		t.Fatalf("readState() error = %v", err)
+	}
+	if !got.Failed || got.Error != "boom" || !got.LastAttempt.Equal(now) {
+		t.Errorf("readState() = %+v, want failed attempt at %v", got, now)
+	}
+
+	got.record(now.Add(time.Minute), nil)
+	if got.Failed || got.Error != "" {
+		t.Errorf("record(nil) = %+v, want failure cleared", got)
+	}
+}
+
+func TestState_corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	writeFile(t, path, []byte(`{"lastAttempt":`))
+	st, err := readState(path)
+	if err != nil || st.Failed || !st.LastAttempt.IsZero() {
+		t.Errorf("readState() corrupt file = %+v, %v, want empty", st, err)
+	}
+}
+
+func TestState_inBackoff(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		st   upgradeState
+		want bool
+	}{
+		{"empty", upgradeState{}, false},
+		{"recent failure", upgradeState{LastAttempt: now.Add(-time.Minute), Failed: true}, true},
+		{"old failure", upgradeState{LastAttempt: now.Add(-2 * time.Hour), Failed: true}, false},
+		{"recent success", upgradeState{LastAttempt: now.Add(-time.Minute)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.st.inBackoff(now, time.Hour); got != tt.want {
+				t.Errorf("inBackoff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package autoupgrade
+
+import (
+	"debug/buildinfo"
+	"debug/elf"
+	"debug/macho"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// darwinSystemLibrary is the library every macOS binary links, Go's
+// included, since the kernel interface is not stable.
+const darwinSystemLibrary = "/usr/lib/libSystem.B.dylib"
+
+// checkStatic reports an error wrapping ErrNotStatic if the binary at path
+// depends on shared libraries, for WithRequireStatic. ELF binaries must have
+// neither an interpreter nor needed libraries, and Mach-O binaries may link
+// only libSystem. Other formats, such as Windows executables, which always
+// import system DLLs, are judged by their build settings: a cgo build counts
+// as dynamic unless it was linked with -static.
+func checkStatic(path string) error {
+	name := filepath.Base(path)
+	if f, err := elf.Open(path); err == nil {
+		defer f.Close()
+		for _, p := range f.Progs {
+			if p.Type == elf.PT_INTERP {
+				return fmt.Errorf("%w: %s has a dynamic loader", ErrNotStatic, name)
+			}
+		}
+		if libs, _ := f.ImportedLibraries(); len(libs) > 0 {
+			return fmt.Errorf("%w: %s needs %s", ErrNotStatic, name, strings.Join(libs, ", "))
+		}
+		return nil
+	}
+	if f, err := macho.Open(path); err == nil {
+		defer f.Close()
+		libs, _ := f.ImportedLibraries()
+		var extra []string
+		for _, lib := range libs {
+			if lib != darwinSystemLibrary {
+				extra = append(extra, lib)
+			}
+		}
+		if len(extra) > 0 {
+			return fmt.Errorf("%w: %s needs %s", ErrNotStatic, name, strings.Join(extra, ", "))
+		}
+		return nil
+	}
+	info, err := buildinfo.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("autoupgrade: reading installed binary: %w", err)
+	}
+	var cgo, static bool
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "CGO_ENABLED":
+			cgo = s.Value == "1"
+		case "-ldflags":
+			static = strings.Contains(s.Value, "-static")
+		}
+	}
+	if cgo && !static {
+		return fmt.Errorf("%w: %s was built with cgo", ErrNotStatic, name)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package autoupgrade
+
+import (
+	"context"
+	"debug/elf"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// dynamicELF returns a dynamically linked system binary, skipping the test
+// if there is none.
+func dynamicELF(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		t.Skip("needs a dynamically linked ELF binary")
+	}
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not found")
+	}
+	sh, _ = filepath.EvalSymlinks(sh)
+	f, err := elf.Open(sh)
+	if err != nil {
+		t.Skipf("%s is not ELF: %v", sh, err)
+	}
+	defer f.Close()
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_INTERP {
+			return sh
+		}
+	}
+	t.Skipf("%s is statically linked", sh)
+	return ""
+}
+
+func Test_checkStatic(t *testing.T) {
+	if err := checkStatic(dynamicELF(t)); !errors.Is(err, ErrNotStatic) {
+		t.Errorf("checkStatic(sh) error = %v, want %v", err, ErrNotStatic)
+	}
+	notBinary := filepath.Join(t.TempDir(), "script")
+	writeFile(t, notBinary, []byte("#!/bin/sh\n"))
+	if err := checkStatic(notBinary); err == nil || errors.Is(err, ErrNotStatic) {
+		t.Errorf("checkStatic(script) error = %v, want a read error", err)
+	}
+}
+
+func TestUpgrade_requireStatic(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+	res := Upgrade(context.Background(), "", append(m.options(), WithRequireStatic(true), WithEnv("CGO_ENABLED=0"))...)
+	if res.ExitError != nil || res.InstalledPath != m.binary() {
+		t.Fatalf("Upgrade() = %v, installed %q, want a static build installed", res.ExitError, res.InstalledPath)
+	}
+
+	// A go command that "builds" a copy of a dynamically linked binary
+	sh := dynamicELF(t)
+	dir, gobin := t.TempDir(), t.TempDir()
+	shim := filepath.Join(dir, "go")
+	script := "#!/bin/sh\ncase \"$1\" in\ninstall) cp " + sh + " \"$GOBIN/fake\" ;;\nesac\n"
+	if err := os.WriteFile(shim, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	res = Upgrade(context.Background(), "", append(m.options(),
+		WithGoBinary(shim), WithEnv("GOBIN="+gobin), WithSkipPreCheck(true), WithVerifyModulePath(false), WithRequireStatic(true))...)
+	if !errors.Is(res.ExitError, ErrNotStatic) {
+		t.Fatalf("Upgrade() error = %v, want %v", res.ExitError, ErrNotStatic)
+	}
+	if _, err := os.Stat(filepath.Join(gobin, "fake")); err == nil {
+		t.Error("dynamically linked binary was not rolled back")
+	}
+}
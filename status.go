@@ -0,0 +1,109 @@
+package autoupgrade
+
+import (
+	"context"
+	"debug/buildinfo"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+)
+
+// statusParallelism bounds how many tools Status checks at once.
+const statusParallelism = 8
+
+// ToolRef identifies an installed tool for Status.
+type ToolRef struct {
+	// ModulePath is the tool's module, such as "example.com/tool". It may
+	// be left empty if BinaryPath is set, to use the module the binary was
+	// built from.
+	ModulePath string
+	// PackagePath is the main package relative to the module root, as for
+	// Upgrade, used to locate the binary when BinaryPath is empty.
+	PackagePath string
+	// BinaryPath is the installed binary to read the current version from.
+	// When empty it is where go install would write the package, as
+	// reported by ResolveInstallPath.
+	BinaryPath string
+}
+
+// ToolStatus reports the installed and available versions of a tool.
+type ToolStatus struct {
+	Tool       ToolRef
+	ModulePath string // module checked against the proxy
+	BinaryPath string // binary the current version was read from
+	Installed  bool   // whether a binary was found at BinaryPath
+	Current    string // version of the installed binary, empty if not installed
+	Latest     string // version the proxy reports for @latest
+	// UpgradeAvailable reports whether Latest is newer than Current. It is
+	// false when the tool is not installed or is a "(devel)" build.
+	UpgradeAvailable bool
+	Err              error // why the status is incomplete, if it is
+}
+
+// Status reports the installed and latest available version of each tool,
+// for dashboards and tool managers. results[i] is the status of tools[i].
+// Proxies are queried concurrently, a few tools at a time, as configured by
+// opts as for ResolveLatest; opts such as WithEnv also locate the binaries.
+// Nothing is installed. A tool that is not installed is reported with
+// Installed false and no error; failures reading a binary or querying the
+// proxy are recorded in that tool's Err.
+func Status(ctx context.Context, tools []ToolRef, opts ...Option) []ToolStatus {
+	results := make([]ToolStatus, len(tools))
+	sem := make(chan struct{}, statusParallelism)
+	var wg sync.WaitGroup
+	for i, tool := range tools {
+		wg.Add(1)
+		go func(i int, tool ToolRef) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = toolStatus(ctx, newConfig(opts), tool)
+		}(i, tool)
+	}
+	wg.Wait()
+	return results
+}
+
+// toolStatus returns the status of one tool for Status.
+func toolStatus(ctx context.Context, cfg *config, tool ToolRef) ToolStatus {
+	st := ToolStatus{Tool: tool, ModulePath: tool.ModulePath, BinaryPath: tool.BinaryPath}
+	if st.ModulePath == "" && st.BinaryPath == "" {
+		st.Err = fmt.Errorf("%w: ToolRef needs a ModulePath or BinaryPath", ErrInvalidOption)
+		return st
+	}
+	if st.BinaryPath == "" {
+		if err := validatePackagePath(tool.PackagePath); err != nil {
+			st.Err = err
+			return st
+		}
+		path, err := installTarget(cfg, st.ModulePath, tool.PackagePath)
+		if err != nil {
+			st.Err = err
+			return st
+		}
+		st.BinaryPath = path
+	}
+	info, err := buildinfo.ReadFile(st.BinaryPath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		st.Err = fmt.Errorf("autoupgrade: reading %s: %w", st.BinaryPath, err)
+		return st
+	default:
+		st.Installed, st.Current = true, info.Main.Version
+		if st.ModulePath == "" {
+			st.ModulePath = info.Main.Path
+		}
+	}
+	if st.ModulePath == "" {
+		st.Err = fmt.Errorf("%w: %s has no main module path", ErrNoBuildInfo, st.BinaryPath)
+		return st
+	}
+	if st.Latest, err = latestVersion(ctx, cfg, st.ModulePath); err != nil {
+		st.Err = err
+		return st
+	}
+	st.UpgradeAvailable = st.Installed && semverValid(st.Current) && semverCompare(st.Latest, st.Current) > 0
+	return st
+}
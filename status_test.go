@@ -0,0 +1,44 @@
+package autoupgrade
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestStatus(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0")
+	fakeBuildInfo(t, m.path, "v0.9.0")
+	if res := Upgrade(context.Background(), "", m.options()...); res.ExitError != nil {
+		t.Fatalf("Upgrade() error = %v", res.ExitError)
+	}
+	// Publish a newer version after v1.0.0 was installed
+	newer := newFakeModule(t, m.path, "v1.0.0", "v1.1.0")
+	opts := append(m.options(), WithEnv("GOPROXY=file://"+filepath.ToSlash(newer.proxyDir)))
+
+	got := Status(context.Background(), []ToolRef{
+		{ModulePath: m.path},
+		{BinaryPath: m.binary()},
+		{ModulePath: "example.com/other"},
+		{ModulePath: m.path, BinaryPath: filepath.Join(t.TempDir(), "missing")},
+		{},
+	}, opts...)
+	if len(got) != 5 {
+		t.Fatalf("Status() returned %d results, want 5", len(got))
+	}
+	for i, st := range got[:2] {
+		if st.Err != nil || !st.Installed || st.Current != "v1.0.0" || st.Latest != "v1.1.0" || !st.UpgradeAvailable || st.ModulePath != m.path || st.BinaryPath != m.binary() {
+			t.Errorf("Status()[%d] = %+v, want v1.0.0 with v1.1.0 available", i, st)
+		}
+	}
+	if st := got[2]; !isNotFound(st.Err) || st.Installed {
+		t.Errorf("Status() for an unknown module = %+v, want not found", st)
+	}
+	if st := got[3]; st.Err != nil || st.Installed || st.Latest != "v1.1.0" || st.UpgradeAvailable {
+		t.Errorf("Status() for a missing binary = %+v, want not installed, v1.1.0 latest", st)
+	}
+	if st := got[4]; !errors.Is(st.Err, ErrInvalidOption) {
+		t.Errorf("Status() for an empty ToolRef error = %v, want %v", st.Err, ErrInvalidOption)
+	}
+}
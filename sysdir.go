@@ -0,0 +1,69 @@
+package autoupgrade
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// systemDirs returns the directories whose binaries are managed by the
+// operating system or a package manager such as apt, Homebrew, Nix or
+// Chocolatey, which Upgrade leaves alone unless WithAllowSystemDir is set.
+var systemDirs = func() []string {
+	switch runtime.GOOS {
+	case "windows":
+		var dirs []string
+		for _, key := range []string{"ProgramFiles", "ProgramFiles(x86)", "ProgramW6432", "SystemRoot"} {
+			if dir := os.Getenv(key); dir != "" {
+				dirs = append(dirs, dir)
+			}
+		}
+		if dir := os.Getenv("ProgramData"); dir != "" {
+			dirs = append(dirs, filepath.Join(dir, "chocolatey"))
+		}
+		return dirs
+	case "darwin":
+		return []string{
+			"/bin", "/sbin", "/usr/bin", "/usr/sbin", "/usr/libexec", "/System",
+			"/opt/homebrew", "/usr/local/Cellar", "/usr/local/Homebrew",
+			"/opt/local", "/nix/store",
+		}
+	default:
+		return []string{
+			"/bin", "/sbin", "/usr/bin", "/usr/sbin", "/usr/lib", "/usr/libexec",
+			"/usr/games", "/snap", "/nix/store", "/home/linuxbrew/.linuxbrew",
+		}
+	}
+}
+
+// systemManaged returns the first of paths that lies inside one of dirs,
+// after resolving symbolic links, or "" if none does. Paths are compared
+// without regard to case on Windows.
+func systemManaged(paths, dirs []string) string {
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		resolved := path
+		if r, err := filepath.EvalSymlinks(path); err == nil {
+			resolved = r
+		}
+		for _, p := range []string{path, resolved} {
+			for _, dir := range dirs {
+				if inDir(filepath.Clean(p), filepath.Clean(dir)) {
+					return path
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// inDir reports whether path is dir or lies beneath it.
+func inDir(path, dir string) bool {
+	if runtime.GOOS == "windows" {
+		path, dir = strings.ToLower(path), strings.ToLower(dir)
+	}
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
@@ -0,0 +1,96 @@
+package autoupgrade
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_systemManaged(t *testing.T) {
+	sys, home := t.TempDir(), t.TempDir()
+	tool := filepath.Join(sys, "tool")
+	writeFile(t, tool, []byte("tool"))
+	link := filepath.Join(home, "tool")
+	if err := os.Symlink(tool, link); err != nil {
+		t.Skip(err)
+	}
+	dirs := []string{sys}
+	tests := []struct {
+		paths []string
+		want  string
+	}{
+		{[]string{filepath.Join(home, "go", "bin", "tool")}, ""},
+		{[]string{"", tool}, tool},
+		{[]string{sys}, sys},
+		{[]string{sys + "-other"}, ""},
+		{[]string{link}, link},
+	}
+	for _, tt := range tests {
+		if got := systemManaged(tt.paths, dirs); got != tt.want {
+			t.Errorf("systemManaged(%q) = %q, want %q", tt.paths, got, tt.want)
+		}
+	}
+}
+
+func TestUpgrade_systemManaged(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+	orig := systemDirs
+	t.Cleanup(func() { systemDirs = orig })
+	systemDirs = func() []string { return []string{m.gobin} }
+
+	res := Upgrade(context.Background(), "", m.options()...)
+	if res.ExitError != nil || res.SkipReason != SkipSystemManaged {
+		t.Fatalf("Upgrade() = %q, %v, want %q", res.SkipReason, res.ExitError, SkipSystemManaged)
+	}
+
+	res = Upgrade(context.Background(), "", append(m.options(), WithAllowSystemDir(true))...)
+	if res.ExitError != nil || res.InstalledPath == "" {
+		t.Errorf("Upgrade() with WithAllowSystemDir = %q, %v, want an install", res.SkipReason, res.ExitError)
+	}
+
+	// Only the install target counts, not where the running copy lives.
+	exe := filepath.Join(t.TempDir(), "tool")
+	writeFile(t, exe, nil)
+	origExe := executable
+	t.Cleanup(func() { executable = origExe })
+	executable = func() (string, error) { return exe, nil }
+	systemDirs = func() []string { return []string{filepath.Dir(exe)} }
+	res = Upgrade(context.Background(), "", m.options()...)
+	if res.SkipReason == SkipSystemManaged {
+		t.Error("Upgrade() skipped for a running executable in a system directory")
+	}
+
+	// Nor is a build from a local checkout.
+	systemDirs = func() []string { return []string{m.gobin} }
+	fakeBuildInfo(t, m.path, "(devel)")
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "go.mod"), []byte("module "+m.path+"\n\ngo 1.21\n"))
+	writeFile(t, filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {}\n"))
+	res = Upgrade(context.Background(), "", append(m.options(), WithLocalModule(dir))...)
+	if res.ExitError != nil || res.SkipReason != "" {
+		t.Errorf("Upgrade() with WithLocalModule = %q, %v, want an install", res.SkipReason, res.ExitError)
+	}
+}
+
+func TestUpgrade_systemManagedGitHubRelease(t *testing.T) {
+	srv := newFakeGitHub(t, "v1.1.0", []byte("new"))
+	fakeBuildInfo(t, "github.com/melt-inc/autoupgrade", "v1.0.0")
+	exe := filepath.Join(t.TempDir(), "tool")
+	writeFile(t, exe, []byte("old"))
+	origExe, origDirs := executable, systemDirs
+	t.Cleanup(func() { executable, systemDirs = origExe, origDirs })
+	executable = func() (string, error) { return exe, nil }
+	systemDirs = func() []string { return []string{filepath.Dir(exe)} }
+
+	// Without WithExecutablePath the release replaces the running
+	// executable, which here lives in a system directory.
+	res := Upgrade(context.Background(), "", WithGitHubRelease("owner", "repo"), WithGitHubAPI(srv.URL))
+	if res.ExitError != nil || res.SkipReason != SkipSystemManaged {
+		t.Fatalf("Upgrade() = %q, %v, want %q", res.SkipReason, res.ExitError, SkipSystemManaged)
+	}
+	if got, _ := os.ReadFile(exe); string(got) != "old" {
+		t.Errorf("running executable = %q, want it untouched", got)
+	}
+}
@@ -0,0 +1,86 @@
+package autoupgrade
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+)
+
+// tailWriter splits the go command's output into lines for WithTail, passing
+// each complete line to onLine and keeping only the last n. Each output
+// stream writes through its own view from stream, so that a partial line on
+// standard output is not joined with one on standard error.
+type tailWriter struct {
+	n       int
+	onLine  func(string)
+	mu      sync.Mutex    // guards the fields below, written from both streams
+	streams []*tailStream // views handed out by stream
+	lines   []string      // ring of the last n lines
+	next    int           // index in lines of the oldest line once full
+}
+
+func newTailWriter(n int, onLine func(string)) *tailWriter {
+	return &tailWriter{n: n, onLine: onLine}
+}
+
+// stream returns a writer for one output stream of the go command.
+func (w *tailWriter) stream() io.Writer {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	s := &tailStream{w: w}
+	w.streams = append(w.streams, s)
+	return s
+}
+
+// tailStream is the view of a tailWriter for one output stream.
+type tailStream struct {
+	w       *tailWriter
+	partial []byte // start of a line not yet terminated
+}
+
+// Write splits p into lines, holding back a trailing partial line until the
+// rest of it arrives in a later write to the same stream.
+func (s *tailStream) Write(p []byte) (int, error) {
+	s.w.mu.Lock()
+	defer s.w.mu.Unlock()
+	data := p
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			s.partial = append(s.partial, data...)
+			return len(p), nil
+		}
+		line := append(s.partial, data[:i]...)
+		s.partial = s.partial[:0]
+		s.w.add(strings.TrimSuffix(string(line), "\r"))
+		data = data[i+1:]
+	}
+}
+
+// add records line and passes it to onLine.
+func (w *tailWriter) add(line string) {
+	if len(w.lines) < w.n {
+		w.lines = append(w.lines, line)
+	} else {
+		w.lines[w.next] = line
+		w.next = (w.next + 1) % w.n
+	}
+	if w.onLine != nil {
+		w.onLine(line)
+	}
+}
+
+// finish records the final unterminated line of each stream and returns the
+// last n lines, oldest first.
+func (w *tailWriter) finish() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, s := range w.streams {
+		if len(s.partial) > 0 {
+			w.add(strings.TrimSuffix(string(s.partial), "\r"))
+			s.partial = nil
+		}
+	}
+	return append(w.lines[w.next:len(w.lines):len(w.lines)], w.lines[:w.next]...)
+}
@@ -0,0 +1,71 @@
+package autoupgrade
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func Test_tailWriter(t *testing.T) {
+	var seen []string
+	w := newTailWriter(3, func(line string) { seen = append(seen, line) })
+	s := w.stream()
+	for _, chunk := range []string{"go: down", "loading a v1.0.0\nline 2\r\n", "", "line", " 3\nline 4\n", "partial"} {
+		if n, err := s.Write([]byte(chunk)); n != len(chunk) || err != nil {
+			t.Fatalf("Write(%q) = %d, %v", chunk, n, err)
+		}
+	}
+	wantSeen := []string{"go: downloading a v1.0.0", "line 2", "line 3", "line 4"}
+	if !slices.Equal(seen, wantSeen) {
+		t.Errorf("onLine got %q, want %q", seen, wantSeen)
+	}
+	if got, want := w.finish(), []string{"line 3", "line 4", "partial"}; !slices.Equal(got, want) {
+		t.Errorf("finish() = %q, want %q", got, want)
+	}
+	if got := newTailWriter(2, nil).finish(); len(got) != 0 {
+		t.Errorf("finish() without output = %q, want empty", got)
+	}
+
+	// Partial lines on different streams are not joined.
+	w = newTailWriter(4, nil)
+	stdout, stderr := w.stream(), w.stream()
+	stdout.Write([]byte("out "))
+	stderr.Write([]byte("err "))
+	stdout.Write([]byte("1\n"))
+	stderr.Write([]byte("1\nerr 2"))
+	if got, want := w.finish(), []string{"out 1", "err 1", "err 2"}; !slices.Equal(got, want) {
+		t.Errorf("finish() with two streams = %q, want %q", got, want)
+	}
+}
+
+func TestUpgrade_tail(t *testing.T) {
+	shim, _ := writeGoShim(t, "go1.21.5")
+	// Wrap the shim to print some progress before installing
+	dir := t.TempDir()
+	noisy := filepath.Join(dir, "go")
+	script := "#!/bin/sh\nfor i in 1 2 3 4 5; do echo \"step $i\" >&2; done\nexec " + shim + " \"$@\"\n"
+	if err := os.WriteFile(noisy, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	fakeBuildInfo(t, "example.com/fake", "v1.0.0")
+
+	var lines []string
+	res := Upgrade(context.Background(), "",
+		WithGoBinary(noisy),
+		WithEnv("GOBIN="+t.TempDir()),
+		WithSkipPreCheck(true),
+		WithVerifyModulePath(false),
+		WithTail(2, func(line string) { lines = append(lines, line) }),
+	)
+	if res.ExitError != nil {
+		t.Fatalf("Upgrade() error = %v", res.ExitError)
+	}
+	if want := []string{"step 1", "step 2", "step 3", "step 4", "step 5"}; !slices.Equal(lines, want) {
+		t.Errorf("onLine got %q, want %q", lines, want)
+	}
+	if want := []string{"step 4", "step 5"}; !slices.Equal(res.Tail, want) {
+		t.Errorf("Tail = %q, want %q", res.Tail, want)
+	}
+}
@@ -0,0 +1,138 @@
+package autoupgrade
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeModule is a main module published to a file:// GOPROXY, so that the real
+// go install path can be exercised without network access.
+type fakeModule struct {
+	path     string // module path
+	proxyDir string // root of the file proxy
+	gobin    string // GOBIN for installs
+	modcache string // GOMODCACHE for installs
+}
+
+// newFakeModule publishes a main package at the root of modulePath for each
+// of versions. The binary prints nothing and exits.
+func newFakeModule(t *testing.T, modulePath string, versions ...string) *fakeModule {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping go install test in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not available")
+	}
+	m := &fakeModule{
+		path:     modulePath,
+		proxyDir: t.TempDir(),
+		gobin:    t.TempDir(),
+		modcache: t.TempDir(),
+	}
+	escaped, err := escapeModulePath(modulePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(m.proxyDir, filepath.FromSlash(escaped), "@v")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	gomod := "module " + modulePath + "\n\ngo 1.21\n"
+	for i, v := range versions {
+		info, _ := json.Marshal(VersionInfo{
+			Version: v,
+			Time:    time.Date(2024, 1, 1+i, 0, 0, 0, 0, time.UTC),
+		})
+		writeFile(t, filepath.Join(dir, v+".info"), info)
+		writeFile(t, filepath.Join(dir, v+".mod"), []byte(gomod))
+		writeModuleZip(t, filepath.Join(dir, v+".zip"), modulePath+"@"+v, map[string]string{
+			"go.mod":  gomod,
+			"main.go": "package main\n\nfunc main() {}\n",
+		})
+	}
+	writeFile(t, filepath.Join(dir, "list"), []byte(strings.Join(versions, "\n")+"\n"))
+	if len(versions) > 0 {
+		// The go command derives @latest from the list, but the proxy
+		// helpers ask for it directly.
+		latest, _ := json.Marshal(VersionInfo{
+			Version: versions[len(versions)-1],
+			Time:    time.Date(2024, 1, len(versions), 0, 0, 0, 0, time.UTC),
+		})
+		writeFile(t, filepath.Join(m.proxyDir, filepath.FromSlash(escaped), "@latest"), latest)
+	}
+	return m
+}
+
+// options returns the options for installing from the fake proxy. The fake
+// module is unknown to the checksum database, so verification is skipped.
+func (m *fakeModule) options() []Option {
+	return []Option{
+		WithEnv(
+			"GOPROXY=file://"+filepath.ToSlash(m.proxyDir),
+			"GOBIN="+m.gobin,
+			"GOMODCACHE="+m.modcache,
+			"GOFLAGS=-modcacherw",
+			"GOTOOLCHAIN=local",
+		),
+		WithInsecureSkipChecksum(true),
+	}
+}
+
+// binary returns the path go install writes the module's binary to.
+func (m *fakeModule) binary() string {
+	name := m.path[strings.LastIndexByte(m.path, '/')+1:]
+	if strings.HasSuffix(os.Getenv("GOEXE"), ".exe") || filepath.Separator == '\\' {
+		name += ".exe"
+	}
+	return filepath.Join(m.gobin, name)
+}
+
+// fakeBuildInfo makes Upgrade see the running process as modulePath at
+// version, built with go build rather than go test, for the duration of the
+// test.
+func fakeBuildInfo(t *testing.T, modulePath, version string) {
+	t.Helper()
+	orig, origTest := readBuildInfo, isTestBinary
+	readBuildInfo = func() (*debug.BuildInfo, bool) {
+		return &debug.BuildInfo{Main: debug.Module{Path: modulePath, Version: version}}, true
+	}
+	isTestBinary = func() bool { return false }
+	t.Cleanup(func() { readBuildInfo, isTestBinary = orig, origTest })
+}
+
+func writeFile(t *testing.T, name string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(name, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeModuleZip(t *testing.T, name, prefix string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for file, content := range files {
+		w, err := zw.Create(prefix + "/" + file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,167 @@
+package autoupgrade
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// workingDir returns the directory 'go tool' was run from, where the go.mod
+// declaring the running binary as a tool is looked up.
+var workingDir = os.Getwd
+
+// runByGoCommand reports whether exe is an executable the go command built
+// and started itself: one cached under the build cache, as 'go tool' does
+// since Go 1.24, or one in a go-build temporary directory, as with 'go run'
+// and uncacheable tool builds. Installing with go install does not change
+// which binary such a command runs.
+func runByGoCommand(cfg *config, exe string) bool {
+	if exe == "" {
+		return false
+	}
+	if dir := buildCacheDir(cfg); dir != "" && inDir(exe, dir) {
+		return true
+	}
+	dir := filepath.Dir(exe)
+	if filepath.Base(dir) != "exe" {
+		return false
+	}
+	for d := filepath.Dir(dir); d != filepath.Dir(d); d = filepath.Dir(d) {
+		if strings.HasPrefix(filepath.Base(d), "go-build") {
+			return true
+		}
+	}
+	return false
+}
+
+// toolGoMod returns the go.mod file declaring pkg with a tool directive when
+// the running executable was started with 'go tool', or "" when it was not.
+func toolGoMod(cfg *config, pkg string) (string, error) {
+	exe, err := executable()
+	if err != nil || !runByGoCommand(cfg, exe) {
+		return "", nil
+	}
+	dir, err := workingDir()
+	if err != nil {
+		return "", nil
+	}
+	gomod := findGoMod(dir)
+	if gomod == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(gomod)
+	if err != nil {
+		return "", fmt.Errorf("autoupgrade: reading go.mod: %w", err)
+	}
+	if !hasToolDirective(data, pkg) {
+		return "", nil
+	}
+	return gomod, nil
+}
+
+// findGoMod returns the go.mod file of the module containing dir, found the
+// way the go command does by walking up the directory tree, or "" if there
+// is none.
+func findGoMod(dir string) string {
+	for {
+		name := filepath.Join(dir, "go.mod")
+		if fi, err := os.Stat(name); err == nil && !fi.IsDir() {
+			return name
+		} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return ""
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// hasToolDirective reports whether gomod declares pkg with a tool directive,
+// either as "tool pkg" or inside a "tool ( ... )" block.
+func hasToolDirective(gomod []byte, pkg string) bool {
+	block := false
+	for _, line := range bytes.Split(gomod, []byte("\n")) {
+		if i := bytes.Index(line, []byte("//")); i >= 0 {
+			line = line[:i]
+		}
+		f := strings.Fields(string(line))
+		switch {
+		case len(f) == 0:
+		case block && f[0] == ")":
+			block = false
+		case block:
+			if len(f) == 1 && unquote(f[0]) == pkg {
+				return true
+			}
+		case f[0] == "tool" && len(f) == 2 && f[1] == "(":
+			block = true
+		case f[0] == "tool" && len(f) == 2 && unquote(f[1]) == pkg:
+			return true
+		}
+	}
+	return false
+}
+
+// unquote strips the double quotes go.mod allows around a path.
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// getTool updates the tool dependency in the go.mod recorded on res.Decision
+// to target with 'go get -tool', as WithGoGetTool selects in place of go
+// install. The version go.mod then requires is recorded on res.
+func getTool(ctx context.Context, cfg *config, res *UpgradeResult, modulePath, packagePath, target string) {
+	goCmd, err := cfg.goCommand()
+	if err != nil {
+		res.ExitError = err
+		return
+	}
+	attr, err := cfg.procAttr()
+	if err != nil {
+		res.ExitError = err
+		return
+	}
+	cfg.mutex.Lock()
+	defer cfg.mutex.Unlock()
+	dir := filepath.Dir(res.Decision.ToolGoMod)
+	env := cfg.environ()
+	arg := fullPath(modulePath, packagePath, target)
+	res.installArg = arg
+	res.Backend = BackendGoGetTool
+	cfg.logf("running %s get -tool %s in %s", goCmd, arg, dir)
+	endInstall := res.phase("install")
+	stderr, err := runInstall(ctx, goCmd, dir, env, []string{"get", "-tool", arg}, attr, cfg.installOutput, nil)
+	endInstall()
+	res.setToolchainDownload(stderr)
+	if err != nil {
+		if ctx.Err() != nil {
+			res.ExitError = fmt.Errorf("autoupgrade: go get stopped: %w", ctx.Err())
+			return
+		}
+		res.ExitError = classifyInstallError(err, stderr)
+		return
+	}
+	cmd, err := cfg.command(ctx, goCmd, "list", "-m", "-f", "{{.Version}}", modulePath)
+	if err != nil {
+		res.ExitError = err
+		return
+	}
+	cmd.Dir, cmd.Env = dir, env
+	out, err := cmd.Output()
+	if err != nil {
+		res.ExitError = fmt.Errorf("autoupgrade: reading updated tool version: %w", err)
+		return
+	}
+	res.installedVersion = strings.TrimSpace(string(out))
+	cfg.logf("%s now requires %s %s", res.Decision.ToolGoMod, modulePath, res.installedVersion)
+}
@@ -0,0 +1,117 @@
+package autoupgrade
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func Test_hasToolDirective(t *testing.T) {
+	tests := []struct {
+		gomod string
+		want  bool
+	}{
+		{"module example.com/app\n\ngo 1.24\n\ntool example.com/fake\n", true},
+		{"module example.com/app\n\ntool (\n\texample.com/other\n\t\"example.com/fake\" // linter\n)\n", true},
+		{"module example.com/app\n\ntool example.com/fake/cmd/fake\n", false},
+		{"module example.com/app\n\nrequire example.com/fake v1.0.0\n", false},
+		{"module example.com/app\n\n// tool example.com/fake\n", false},
+	}
+	for _, tt := range tests {
+		if got := hasToolDirective([]byte(tt.gomod), "example.com/fake"); got != tt.want {
+			t.Errorf("hasToolDirective(%q) = %v, want %v", tt.gomod, got, tt.want)
+		}
+	}
+}
+
+func Test_runByGoCommand(t *testing.T) {
+	cache, tmp := t.TempDir(), t.TempDir()
+	cfg := newConfig([]Option{WithEnv("GOCACHE=" + cache)})
+	tests := []struct {
+		exe  string
+		want bool
+	}{
+		{filepath.Join(cache, "a1", "tool"), true},
+		{filepath.Join(tmp, "go-build123", "b001", "exe", "tool"), true},
+		{filepath.Join(tmp, "go-build123", "b001", "tool.test"), false},
+		{filepath.Join(tmp, "bin", "exe", "tool"), false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := runByGoCommand(cfg, tt.exe); got != tt.want {
+			t.Errorf("runByGoCommand(%q) = %v, want %v", tt.exe, got, tt.want)
+		}
+	}
+}
+
+// fakeGoTool makes the running executable look like it was started with
+// 'go tool' from a module whose go.mod declares modulePath as a tool, and
+// returns that module's directory.
+func fakeGoTool(t *testing.T, modulePath, version string) string {
+	t.Helper()
+	app := t.TempDir()
+	writeFile(t, filepath.Join(app, "go.mod"), []byte("module example.com/app\n\ngo 1.24\n\ntool "+modulePath+"\n\nrequire "+modulePath+" "+version+"\n"))
+	sub := filepath.Join(app, "sub")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	exe := filepath.Join(t.TempDir(), "go-build123", "b001", "exe", "fake")
+	origExe, origWd := executable, workingDir
+	executable = func() (string, error) { return exe, nil }
+	workingDir = func() (string, error) { return sub, nil }
+	t.Cleanup(func() { executable, workingDir = origExe, origWd })
+	return app
+}
+
+func TestUpgrade_toolDependency(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+	app := fakeGoTool(t, m.path, "v1.0.0")
+
+	res := Upgrade(context.Background(), "", m.options()...)
+	if res.ExitError != nil || res.SkipReason != SkipToolDependency {
+		t.Fatalf("Upgrade() = %q, %v, want %q", res.SkipReason, res.ExitError, SkipToolDependency)
+	}
+	if want := filepath.Join(app, "go.mod"); res.Decision.ToolGoMod != want {
+		t.Errorf("Decision.ToolGoMod = %q, want %q", res.Decision.ToolGoMod, want)
+	}
+	if _, err := os.Stat(m.binary()); err == nil {
+		t.Error("go install ran for a tool dependency")
+	}
+}
+
+func TestUpgrade_goGetTool(t *testing.T) {
+	if compareGoVersion(strings.TrimPrefix(runtime.Version(), "go"), "1.24") < 0 {
+		t.Skip("tool directives need go 1.24")
+	}
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+	app := fakeGoTool(t, m.path, "v1.0.0")
+
+	res := Upgrade(context.Background(), "", append(m.options(), WithGoGetTool(true))...)
+	if res.ExitError != nil {
+		t.Fatalf("Upgrade() error = %v", res.ExitError)
+	}
+	if res.Backend != BackendGoGetTool || res.InstalledPath != "" {
+		t.Errorf("Backend, InstalledPath = %q, %q, want %q with nothing installed", res.Backend, res.InstalledPath, BackendGoGetTool)
+	}
+	if got, want := res.Target(), "example.com/fake@latest"; got != want {
+		t.Errorf("Target() = %q, want %q", got, want)
+	}
+	if !res.DidUpgrade() {
+		t.Error("DidUpgrade() = false, want true")
+	}
+	gomod, err := os.ReadFile(filepath.Join(app, "go.mod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(gomod), m.path+" v1.1.0") {
+		t.Errorf("go.mod not updated:\n%s", gomod)
+	}
+	if _, err := os.Stat(m.binary()); err == nil {
+		t.Error("go install ran for a tool dependency")
+	}
+}
@@ -0,0 +1,215 @@
+package autoupgrade
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// errToolchainTooOld is returned by toolchainCompatible when every version
+// newer than the current one requires a newer go than the local toolchain.
+var errToolchainTooOld = errors.New("autoupgrade: no version compatible with the local toolchain")
+
+// toolchainCompatible returns target, or for WithToolchainCompatibleOnly the
+// newest older version whose go.mod go directive the local toolchain
+// satisfies when target's does not. Only versions fallbackAllowed admits are
+// considered. The version passed over and the reason are recorded on
+// res.Decision.
+func toolchainCompatible(ctx context.Context, cfg *config, res *UpgradeResult, modulePath, current, target string, allow func(string) bool) (string, error) {
+	local, err := localGoVersion(ctx, cfg)
+	if err != nil {
+		return "", err
+	}
+	preferred := target
+	if preferred == "latest" {
+		if preferred, err = latestVersion(ctx, cfg, modulePath); err != nil {
+			return "", err
+		}
+	}
+	need, err := requiredGo(ctx, cfg, modulePath, preferred)
+	if err != nil {
+		return "", err
+	}
+	if compareGoVersion(local, need) >= 0 {
+		return target, nil
+	}
+	d := &res.Decision
+	d.PreferredTarget, d.PreferredGoVersion, d.LocalGoVersion = preferred, need, local
+	d.block(preferred, PolicyToolchain)
+	cfg.logf("%s requires go %s, newer than the local go %s", preferred, need, local)
+
+	versions, _, err := listVersions(ctx, cfg, modulePath)
+	if err != nil {
+		return "", err
+	}
+	for i := len(versions) - 1; i >= 0; i-- {
+		v := versions[i]
+		if semverCompare(v, preferred) >= 0 || !fallbackAllowed(allow, preferred, v) {
+			continue
+		}
+		if semverValid(current) && semverCompare(v, current) <= 0 {
+			break
+		}
+		if cfg.versionFilter != nil && !cfg.versionFilter(v) {
+			continue
+		}
+		need, err := requiredGo(ctx, cfg, modulePath, v)
+		if err != nil {
+			return "", err
+		}
+		if compareGoVersion(local, need) >= 0 {
+			cfg.logf("installing %s instead, the newest version compatible with go %s", v, local)
+			return v, nil
+		}
+	}
+	return "", errToolchainTooOld
+}
+
+// fallbackAllowed reports whether v may be installed in place of preferred
+// when falling back to an older version: allow, as returned by
+// resolveTarget, must admit it if set, so a channel or constraint holds, and
+// otherwise it must be a release of the kind @latest chooses from, a
+// prerelease only if preferred is one. Pseudo-versions never are.
+func fallbackAllowed(allow func(string) bool, preferred, v string) bool {
+	if isPseudoVersion(v) {
+		return false
+	}
+	if allow != nil {
+		return allow(v)
+	}
+	return !isPrerelease(v) || isPrerelease(preferred)
+}
+
+// localGoVersion returns the version of the go command Upgrade runs, such as
+// "1.22.5", as reported by 'go env GOVERSION'.
+func localGoVersion(ctx context.Context, cfg *config) (string, error) {
+	goCmd, err := cfg.goCommand()
+	if err != nil {
+		return "", err
+	}
+	cmd, err := cfg.command(ctx, goCmd, "env", "GOVERSION")
+	if err != nil {
+		return "", err
+	}
+	cmd.Env = cfg.environ()
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("autoupgrade: reading go version: %w", err)
+	}
+	// Release builds report "go1.22.5", possibly followed by experiment
+	// settings such as " X:loopvar".
+	v, _, _ := strings.Cut(strings.TrimSpace(string(out)), " ")
+	if _, ok := parseGoVersion(strings.TrimPrefix(v, "go")); !ok {
+		return "", fmt.Errorf("autoupgrade: unrecognized go version %q", v)
+	}
+	return strings.TrimPrefix(v, "go"), nil
+}
+
+// requiredGo returns the go directive of modulePath's go.mod at version, or
+// "" if it has none.
+func requiredGo(ctx context.Context, cfg *config, modulePath, version string) (string, error) {
+	name, err := versionFile(modulePath, version, ".mod")
+	if err != nil {
+		return "", err
+	}
+	body, _, err := proxyGet(ctx, cfg, name)
+	if err != nil {
+		return "", err
+	}
+	return goDirective(body), nil
+}
+
+// goDirective returns the version in the go directive of a go.mod file, such
+// as "1.21" or "1.22.5", or "" if there is none.
+func goDirective(gomod []byte) string {
+	for _, line := range bytes.Split(gomod, []byte("\n")) {
+		if i := bytes.Index(line, []byte("//")); i >= 0 {
+			line = line[:i]
+		}
+		f := strings.Fields(string(line))
+		if len(f) == 2 && f[0] == "go" {
+			return f[1]
+		}
+	}
+	return ""
+}
+
+// goVersion is a parsed Go release version: a language version such as
+// "1.21", a prerelease such as "1.21rc2", or a release such as "1.21.3".
+type goVersion struct {
+	major, minor int
+	kind         int // 0 for a language version, then beta, rc and release
+	n            int // prerelease or patch number
+}
+
+const (
+	goLanguage = iota
+	goBeta
+	goRC
+	goRelease
+)
+
+// parseGoVersion parses a Go version without the "go" prefix.
+func parseGoVersion(v string) (goVersion, bool) {
+	var g goVersion
+	major, rest, ok := strings.Cut(v, ".")
+	if !ok {
+		return g, false
+	}
+	var err error
+	if g.major, err = strconv.Atoi(major); err != nil {
+		return g, false
+	}
+	i := 0
+	for i < len(rest) && '0' <= rest[i] && rest[i] <= '9' {
+		i++
+	}
+	if g.minor, err = strconv.Atoi(rest[:i]); err != nil {
+		return g, false
+	}
+	rest = rest[i:]
+	switch {
+	case rest == "":
+		return g, true
+	case rest[0] == '.':
+		g.kind, rest = goRelease, rest[1:]
+	case strings.HasPrefix(rest, "rc"):
+		g.kind, rest = goRC, rest[2:]
+	case strings.HasPrefix(rest, "beta"):
+		g.kind, rest = goBeta, rest[4:]
+	default:
+		return g, false
+	}
+	if g.n, err = strconv.Atoi(rest); err != nil {
+		return g, false
+	}
+	return g, true
+}
+
+// compareGoVersion returns -1, 0 or +1 as Go version x is older than, equal
+// to or newer than y, following the go command: "1.21" < "1.21rc1" <
+// "1.21.0". An empty or invalid version is older than any valid one.
+func compareGoVersion(x, y string) int {
+	gx, okx := parseGoVersion(x)
+	gy, oky := parseGoVersion(y)
+	switch {
+	case !okx && !oky:
+		return 0
+	case !okx:
+		return -1
+	case !oky:
+		return +1
+	}
+	for _, c := range [][2]int{{gx.major, gy.major}, {gx.minor, gy.minor}, {gx.kind, gy.kind}, {gx.n, gy.n}} {
+		if c[0] != c[1] {
+			if c[0] < c[1] {
+				return -1
+			}
+			return +1
+		}
+	}
+	return 0
+}
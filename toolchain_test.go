@@ -0,0 +1,90 @@
+package autoupgrade
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func Test_compareGoVersion(t *testing.T) {
+	tests := []struct {
+		x, y string
+		want int
+	}{
+		{"1.21.3", "1.21", +1},
+		{"1.21", "1.21rc1", -1},
+		{"1.21rc1", "1.21.0", -1},
+		{"1.21beta1", "1.21rc1", -1},
+		{"1.21.0", "1.21.0", 0},
+		{"1.22.0", "1.21.10", +1},
+		{"1.9", "1.10", -1},
+		{"2.0", "1.99.1", +1},
+		{"1.21", "", +1},
+		{"", "bogus", 0},
+	}
+	for _, tt := range tests {
+		if got := compareGoVersion(tt.x, tt.y); got != tt.want {
+			t.Errorf("compareGoVersion(%q, %q) = %d, want %d", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func Test_goDirective(t *testing.T) {
+	tests := []struct {
+		gomod string
+		want  string
+	}{
+		{"module example.com/m\n\ngo 1.22.5\n", "1.22.5"},
+		{"module example.com/m\n\ngo 1.21 // minimum\ntoolchain go1.22.0\n", "1.21"},
+		{"module example.com/m\n", ""},
+	}
+	for _, tt := range tests {
+		if got := goDirective([]byte(tt.gomod)); got != tt.want {
+			t.Errorf("goDirective(%q) = %q, want %q", tt.gomod, got, tt.want)
+		}
+	}
+}
+
+func TestUpgrade_toolchainCompatibleOnly(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0", "v1.2.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+	dir := filepath.Join(m.proxyDir, "example.com", "fake", "@v")
+	writeFile(t, filepath.Join(dir, "v1.2.0.mod"), []byte("module example.com/fake\n\ngo 1.999\n"))
+
+	res := Upgrade(context.Background(), "", append(m.options(), WithToolchainCompatibleOnly(true))...)
+	if res.ExitError != nil {
+		t.Fatalf("Upgrade() error = %v", res.ExitError)
+	}
+	d := res.Decision
+	if d.Target != "v1.1.0" || d.PreferredTarget != "v1.2.0" || d.PreferredGoVersion != "1.999" || d.LocalGoVersion == "" || d.BlockedBy != PolicyToolchain {
+		t.Errorf("Decision = %+v, want v1.1.0 in place of v1.2.0", d)
+	}
+	if res.InstalledPath == "" {
+		t.Error("nothing installed")
+	}
+}
+
+func TestUpgrade_toolchainTooOld(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+	dir := filepath.Join(m.proxyDir, "example.com", "fake", "@v")
+	writeFile(t, filepath.Join(dir, "v1.1.0.mod"), []byte("module example.com/fake\n\ngo 1.999\n"))
+
+	res := Upgrade(context.Background(), "", append(m.options(), WithToolchainCompatibleOnly(true))...)
+	if res.ExitError != nil || res.SkipReason != SkipToolchainTooOld {
+		t.Fatalf("Upgrade() = %q, %v, want %q", res.SkipReason, res.ExitError, SkipToolchainTooOld)
+	}
+}
+
+func TestUpgrade_toolchainCompatibleConstraint(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0", "v1.2.0", "v1.3.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+	dir := filepath.Join(m.proxyDir, "example.com", "fake", "@v")
+	writeFile(t, filepath.Join(dir, "v1.3.0.mod"), []byte("module example.com/fake\n\ngo 1.999\n"))
+
+	// The fallback must still satisfy the constraint that excluded v1.2.0.
+	res := Upgrade(context.Background(), "", append(m.options(), WithConstraint(">=1.0.0, !=1.2.0"), WithToolchainCompatibleOnly(true))...)
+	if res.ExitError != nil || res.Decision.Target != "v1.1.0" {
+		t.Errorf("Upgrade() = %q, %v, want target v1.1.0", res.Decision.Target, res.ExitError)
+	}
+}
@@ -0,0 +1,106 @@
+package autoupgrade
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// insecureClient is used for proxies matched by WithInsecureModules. It does
+// not verify TLS certificates.
+var insecureClient = &http.Client{
+	Transport: func() http.RoundTripper {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		return t
+	}(),
+}
+
+// client returns the HTTP client for requests to u: the one set with
+// WithHTTPClient, or else one honouring WithProxyTimeouts and
+// WithInsecureModules.
+func (c *config) client(u *url.URL) *http.Client {
+	if c.httpClient != nil {
+		return c.httpClient
+	}
+	insecure := matchPrefixPatterns(c.insecureModules, u.Hostname()+u.Path)
+	if c.connectTimeout <= 0 {
+		if insecure {
+			return insecureClient
+		}
+		return http.DefaultClient
+	}
+	// The transport lives only as long as the request, so keep-alives would
+	// just leave idle connections behind.
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DisableKeepAlives = true
+	t.DialContext = (&net.Dialer{Timeout: c.connectTimeout}).DialContext
+	t.TLSHandshakeTimeout = c.connectTimeout
+	if insecure {
+		t.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &http.Client{Transport: t}
+}
+
+// send issues req. With a read timeout set by WithProxyTimeouts, the request
+// is abandoned when no response, or no further response body, arrives within
+// the timeout, so a slow but progressing download is not cut off.
+func send(cfg *config, req *http.Request) (*http.Response, error) {
+	if id := cfg.correlationID(req.Context()); id != "" {
+		req.Header.Set(correlationHeader, id)
+	}
+	client := cfg.client(req.URL)
+	if cfg.readTimeout <= 0 {
+		return client.Do(req)
+	}
+	ctx, cancel := context.WithCancelCause(req.Context())
+	stalled := fmt.Errorf("autoupgrade: no data from %s for %v: %w", req.URL.Host, cfg.readTimeout, os.ErrDeadlineExceeded)
+	timer := time.AfterFunc(cfg.readTimeout, func() { cancel(stalled) })
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		timer.Stop()
+		cancel(nil)
+		if context.Cause(ctx) == stalled {
+			err = stalled
+		}
+		return nil, err
+	}
+	resp.Body = &stallReader{ReadCloser: resp.Body, ctx: ctx, cancel: cancel, timer: timer, timeout: cfg.readTimeout}
+	return resp, nil
+}
+
+// stallReader extends the read deadline of a response body each time data
+// arrives.
+type stallReader struct {
+	io.ReadCloser
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (r *stallReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+	if err != nil && err != io.EOF {
+		if cause := context.Cause(r.ctx); cause != nil && cause != context.Canceled {
+			err = cause
+		}
+	}
+	return n, err
+}
+
+func (r *stallReader) Close() error {
+	r.timer.Stop()
+	err := r.ReadCloser.Close()
+	r.cancel(nil)
+	return err
+}
@@ -0,0 +1,75 @@
+package autoupgrade
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_fetch_readTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pause := 20 * time.Millisecond
+		if r.URL.Path == "/stalled" {
+			pause = time.Second
+		}
+		for i := 0; i < 5; i++ {
+			w.Write([]byte("v1.0.0\n"))
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(pause):
+			}
+		}
+	}))
+	defer srv.Close()
+	cfg := newConfig([]Option{WithProxyTimeouts(time.Second, 200*time.Millisecond)})
+
+	// The whole response takes longer than the read timeout, but data keeps
+	// arriving.
+	body, err := fetch(context.Background(), cfg, srv.URL+"/slow")
+	if err != nil {
+		t.Fatalf("fetch() error = %v", err)
+	}
+	if got := strings.Count(string(body), "\n"); got != 5 {
+		t.Errorf("fetch() read %d lines, want 5", got)
+	}
+
+	_, err = fetch(context.Background(), cfg, srv.URL+"/stalled")
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("fetch() error = %v, want %v", err, os.ErrDeadlineExceeded)
+	}
+	if c := Classify(err); c != FailureNetwork {
+		t.Errorf("Classify() = %v, want %v", c, FailureNetwork)
+	}
+}
+
+type countingTransport struct {
+	n int
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.n++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func Test_fetch_httpClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Version":"v1.2.3"}`))
+	}))
+	defer srv.Close()
+
+	rt := &countingTransport{}
+	cfg := newConfig([]Option{WithHTTPClient(&http.Client{Transport: rt})})
+	if _, err := fetch(context.Background(), cfg, srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	if rt.n != 1 {
+		t.Errorf("custom transport used %d times, want 1", rt.n)
+	}
+}
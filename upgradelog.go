@@ -0,0 +1,66 @@
+package autoupgrade
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// maxUpgradeLogSize bounds the file set with WithUpgradeLog. Once an entry
+// would take it past this size, the file is moved aside to "<path>.1",
+// replacing any earlier one, and a new file is started.
+const maxUpgradeLogSize = 64 << 10
+
+// upgradeLogEntry is one line of the file set with WithUpgradeLog.
+type upgradeLogEntry struct {
+	Time   time.Time `json:"time"`
+	Module string    `json:"module"`
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Target string    `json:"target,omitempty"` // go install argument
+	Path   string    `json:"path"`             // installed binary
+}
+
+// newUpgradeLogEntry describes the successful upgrade recorded in res.
+func newUpgradeLogEntry(now time.Time, res *UpgradeResult) upgradeLogEntry {
+	to := res.installedVersion
+	if to == "" {
+		to = res.Decision.Target
+	}
+	return upgradeLogEntry{
+		Time:   now,
+		Module: res.ModulePath,
+		From:   res.CurrentInfo.Main.Version,
+		To:     to,
+		Target: res.installArg,
+		Path:   res.InstalledPath,
+	}
+}
+
+// appendUpgradeLog appends e to the log at path as a line of JSON, rotating
+// the file first if it would grow past maxUpgradeLogSize.
+func appendUpgradeLog(path string, e upgradeLogEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(path); err == nil && fi.Size()+int64(len(line)) > maxUpgradeLogSize {
+		if err := os.Rename(path, path+".1"); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(line)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,80 @@
+package autoupgrade
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_appendUpgradeLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "upgrades.jsonl")
+	e := upgradeLogEntry{Time: time.Now(), Module: "example.com/fake", From: "v1.0.0", To: "v1.1.0", Path: "/bin/fake"}
+	for i := 0; i < 2; i++ {
+		if err := appendUpgradeLog(path, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(data, []byte("\n")); n != 2 {
+		t.Errorf("log has %d lines, want 2", n)
+	}
+
+	// Fill the log so the next entry rotates it
+	writeFile(t, path, bytes.Repeat([]byte("x"), maxUpgradeLogSize-10))
+	if err := appendUpgradeLog(path, e); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(path + ".1"); err != nil || fi.Size() != maxUpgradeLogSize-10 {
+		t.Errorf("rotated log = %v, %v", fi, err)
+	}
+	if data, _ = os.ReadFile(path); bytes.Count(data, []byte("\n")) != 1 {
+		t.Errorf("log after rotation = %q, want one entry", data)
+	}
+}
+
+func TestUpgrade_upgradeLog(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+	path := filepath.Join(t.TempDir(), "upgrades.jsonl")
+
+	res := Upgrade(context.Background(), "", append(m.options(), WithUpgradeLog(path))...)
+	if res.ExitError != nil {
+		t.Fatalf("Upgrade() error = %v", res.ExitError)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e upgradeLogEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Module != m.path || e.From != "v1.0.0" || e.To != "v1.1.0" || e.Target != m.path+"@latest" || e.Path != m.binary() || e.Time.IsZero() {
+		t.Errorf("log entry = %+v", e)
+	}
+
+	// Skipped attempts, here while another install writes the binary, are
+	// not logged
+	release, _ := claimInstall(m.binary())
+	res = Upgrade(context.Background(), "", append(m.options(), WithUpgradeLog(path))...)
+	release()
+	if res.SkipReason != SkipInstallInProgress {
+		t.Fatalf("SkipReason = %q, want %q", res.SkipReason, SkipInstallInProgress)
+	}
+	if again, _ := os.ReadFile(path); !bytes.Equal(again, data) {
+		t.Errorf("log after skipped upgrade = %q", again)
+	}
+
+	// An unwritable log does not fail the upgrade
+	res = Upgrade(context.Background(), "", append(m.options(), WithUpgradeLog(filepath.Join(path, "not-a-dir")))...)
+	if res.ExitError != nil || res.InstalledPath != m.binary() {
+		t.Errorf("Upgrade() with unwritable log = %v, %q", res.ExitError, res.InstalledPath)
+	}
+}
@@ -0,0 +1,73 @@
+package autoupgrade
+
+import (
+	"context"
+	"sync"
+)
+
+// Upgrading is a handle on an upgrade started with StartUpgrade, which can be
+// polled from a UI loop and canceled.
+type Upgrading struct {
+	done   chan struct{}
+	cancel context.CancelFunc
+
+	mu    sync.Mutex
+	phase Phase
+	res   *UpgradeResult
+}
+
+// StartUpgrade starts Upgrade in a goroutine and returns a handle on it at
+// once, for interactive tools that show progress and let the user cancel.
+// Unlike UpgradeBackground, the handle reports the step in progress. If ctx
+// is already done, the upgrade ends at once as for UpgradeBackground.
+func StartUpgrade(ctx context.Context, packagePath string, opts ...Option) *Upgrading {
+	ctx, cancel := context.WithCancel(ctx)
+	u := &Upgrading{done: make(chan struct{}), cancel: cancel}
+	opts = append(opts[:len(opts):len(opts)], func(c *config) { c.onPhase = u.setPhase })
+	ch := UpgradeBackground(ctx, packagePath, opts...)
+	go func() {
+		defer cancel()
+		res := <-ch
+		u.mu.Lock()
+		u.res = res
+		u.mu.Unlock()
+		close(u.done)
+	}()
+	return u
+}
+
+// Done returns a channel that is closed when the upgrade has ended.
+func (u *Upgrading) Done() <-chan struct{} {
+	return u.done
+}
+
+// Result returns the result of the upgrade once Done is closed, and nil
+// before.
+func (u *Upgrading) Result() *UpgradeResult {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.res
+}
+
+// Phase returns the step most recently started: "resolve", "install" or
+// "verify", with End zero while it is running. It is the zero Phase before
+// the first step starts, and after Done the last step that ran.
+func (u *Upgrading) Phase() Phase {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.phase
+}
+
+// Cancel stops the upgrade, killing go install if it is running, as
+// canceling the context given to Upgrade does. The result then reports the
+// cancellation. Cancel does not wait for the upgrade to end; wait on Done.
+func (u *Upgrading) Cancel() {
+	u.cancel()
+}
+
+// setPhase records p as the step in progress, or its end.
+func (u *Upgrading) setPhase(p Phase) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.phase = p
+}
@@ -0,0 +1,65 @@
+package autoupgrade
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestStartUpgrade(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+
+	u := StartUpgrade(context.Background(), "", m.options()...)
+	select {
+	case <-u.Done():
+	case <-time.After(time.Minute):
+		t.Fatal("timed out waiting for the upgrade")
+	}
+	res := u.Result()
+	if res == nil || res.ExitError != nil || res.InstalledPath != m.binary() {
+		t.Fatalf("Result() = %+v, want v1.1.0 installed", res)
+	}
+	if p := u.Phase(); p.Name != "verify" || p.End.IsZero() {
+		t.Errorf("Phase() after Done = %+v, want the finished verify step", p)
+	}
+}
+
+func TestStartUpgrade_cancel(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script shim not supported on windows")
+	}
+	shim := filepath.Join(t.TempDir(), "go")
+	if err := os.WriteFile(shim, []byte("#!/bin/sh\nexec sleep 30\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	fakeBuildInfo(t, "example.com/fake", "v1.0.0")
+
+	u := StartUpgrade(context.Background(), "", WithGoBinary(shim), WithEnv("GOBIN="+t.TempDir()), WithSkipPreCheck(true))
+	deadline := time.Now().Add(10 * time.Second)
+	for u.Phase().Name != "install" {
+		if time.Now().After(deadline) {
+			t.Fatalf("Phase() = %+v, never reached install", u.Phase())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if u.Result() != nil {
+		t.Error("Result() before Done is not nil")
+	}
+	if p := u.Phase(); !p.End.IsZero() {
+		t.Errorf("Phase() while installing = %+v, want no end", p)
+	}
+	u.Cancel()
+	select {
+	case <-u.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("Cancel() did not stop the upgrade")
+	}
+	if res := u.Result(); !errors.Is(res.ExitError, context.Canceled) {
+		t.Errorf("ExitError = %v, want %v", res.ExitError, context.Canceled)
+	}
+}
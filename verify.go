@@ -0,0 +1,217 @@
+package autoupgrade
+
+import (
+	"bytes"
+	"context"
+	"debug/buildinfo"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// backup holds a copy of the binary in place before an install, so that a
+// rejected upgrade can be rolled back.
+type backup struct {
+	target string
+	path   string // empty if there was no binary to back up
+	// elevate is the WithPrivilegeElevation command the backup is made,
+	// restored and removed with, for a directory the process cannot write.
+	elevate []string
+}
+
+// backupBinary copies the binary at target to a hidden file alongside it.
+func backupBinary(target string) (*backup, error) {
+	b := &backup{target: target}
+	src, err := os.Open(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("autoupgrade: backing up binary: %w", err)
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("autoupgrade: backing up binary: %w", err)
+	}
+	dst, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".autoupgrade-*")
+	if err != nil {
+		return nil, fmt.Errorf("autoupgrade: backing up binary: %w", err)
+	}
+	b.path = dst.Name()
+	_, err = io.Copy(dst, src)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(b.path, fi.Mode().Perm())
+	}
+	if err != nil {
+		os.Remove(b.path)
+		return nil, fmt.Errorf("autoupgrade: backing up binary: %w", err)
+	}
+	return b, nil
+}
+
+// restore puts the backed up binary back in place, or removes the new binary
+// if there was none before.
+func (b *backup) restore() error {
+	if b.elevate != nil {
+		if b.path == "" {
+			return b.run("rm", "-f", b.target)
+		}
+		err := b.run("mv", "-f", b.path, b.target)
+		if err == nil {
+			b.path = ""
+		}
+		return err
+	}
+	if b.path == "" {
+		return os.Remove(b.target)
+	}
+	err := os.Rename(b.path, b.target)
+	if err == nil {
+		b.path = ""
+	}
+	return err
+}
+
+// discard removes the backup copy, if it is still present.
+func (b *backup) discard() {
+	if b.path == "" {
+		return
+	}
+	if b.elevate != nil {
+		_ = b.run("rm", "-f", b.path)
+		return
+	}
+	os.Remove(b.path)
+}
+
+// verifyModulePath checks that the binary at path was built from modulePath,
+// guarding against a proxy serving a different module.
+func verifyModulePath(path, modulePath string) error {
+	info, err := buildinfo.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("autoupgrade: reading installed binary: %w", err)
+	}
+	if info.Main.Path != modulePath {
+		return fmt.Errorf("%w: installed %q, want %q", ErrModulePathMismatch, info.Main.Path, modulePath)
+	}
+	return nil
+}
+
+// verifyModuleHash checks the module cache's hash of the module zip that
+// the binary at path was built from against the one given to
+// WithExpectedHash for its version. A version without an expected hash is
+// rejected.
+func verifyModuleHash(cfg *config, path, modulePath string) error {
+	info, err := buildinfo.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("autoupgrade: reading installed binary: %w", err)
+	}
+	version := info.Main.Version
+	want, ok := cfg.expectedHashes[version]
+	if !ok {
+		return fmt.Errorf("%w: no expected hash for %s@%s", ErrHashMismatch, modulePath, version)
+	}
+	modCache, err := modCacheDir(cfg)
+	if err != nil {
+		return err
+	}
+	name, err := versionFile(modulePath, version, ".ziphash")
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(filepath.Join(modCache, "cache", "download", filepath.FromSlash(name)))
+	if err != nil {
+		return fmt.Errorf("autoupgrade: reading module hash: %w", err)
+	}
+	if got := strings.TrimSpace(string(data)); got != want {
+		return fmt.Errorf("%w: %s@%s has %s, want %s", ErrHashMismatch, modulePath, version, got, want)
+	}
+	return nil
+}
+
+// verifies reports whether verifyInstalled checks anything, in which case
+// the binary it replaces is backed up first.
+func (c *config) verifies() bool {
+	return c.verifyModulePath || len(c.expectedHashes) > 0 || c.requireStatic || len(c.verifyCommand) > 0 || c.verifyFunc != nil
+}
+
+// verifyInstalled checks the new binary at path as configured: its module
+// path with WithVerifyModulePath, the module hash with WithExpectedHash for
+// go install, static linking with WithRequireStatic, then a run with
+// WithVerifyCommand and the WithVerifyFunc check.
+func verifyInstalled(ctx context.Context, cfg *config, res *UpgradeResult, path, modulePath string) error {
+	if !cfg.verifies() {
+		return nil
+	}
+	defer res.phase("verify")()
+	if cfg.verifyModulePath {
+		if err := verifyModulePath(path, modulePath); err != nil {
+			return err
+		}
+	}
+	if len(cfg.expectedHashes) > 0 && res.Backend == BackendGoInstall {
+		if err := verifyModuleHash(cfg, path, modulePath); err != nil {
+			return err
+		}
+	}
+	if cfg.requireStatic {
+		if err := checkStatic(path); err != nil {
+			return err
+		}
+	}
+	if len(cfg.verifyCommand) > 0 {
+		inconclusive, err := runVerifyCommand(ctx, cfg, path)
+		res.VerifyInconclusive = inconclusive
+		if err != nil {
+			return err
+		}
+	}
+	if cfg.verifyFunc != nil {
+		if err := cfg.verifyFunc(path); err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrVerifyFailed, filepath.Base(path), err)
+		}
+	}
+	return nil
+}
+
+// runVerifyCommand runs the new binary at path with the WithVerifyCommand
+// arguments and reports an error wrapping ErrVerifyFailed if it fails. The
+// run is limited by WithVerifyTimeout rather than only by ctx, so that a
+// binary that hangs on startup does not hold up the caller. A timeout is
+// inconclusive: it is an error only if WithVerifyTimeout asked to roll back.
+func runVerifyCommand(ctx context.Context, cfg *config, path string) (inconclusive bool, err error) {
+	vctx := ctx
+	if cfg.verifyTimeout > 0 {
+		var cancel context.CancelFunc
+		vctx, cancel = context.WithTimeout(ctx, cfg.verifyTimeout)
+		defer cancel()
+	}
+	cmd, err := cfg.command(vctx, path, cfg.verifyCommand...)
+	if err != nil {
+		return false, err
+	}
+	// Don't wait on output held open by children of a killed binary
+	cmd.WaitDelay = time.Second
+	out, err := cmd.CombinedOutput()
+	switch {
+	case err == nil:
+		return false, nil
+	case ctx.Err() != nil:
+		return false, fmt.Errorf("autoupgrade: verification stopped: %w", ctx.Err())
+	case vctx.Err() != nil:
+		if cfg.keepOnVerifyTimeout {
+			return true, nil
+		}
+		return true, fmt.Errorf("%w: %s %s did not finish within %v: %w", ErrVerifyFailed, filepath.Base(path), strings.Join(cfg.verifyCommand, " "), cfg.verifyTimeout, vctx.Err())
+	}
+	return false, fmt.Errorf("%w: %s %s: %w: %s", ErrVerifyFailed, filepath.Base(path), strings.Join(cfg.verifyCommand, " "), err, bytes.TrimSpace(out))
+}
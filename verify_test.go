@@ -0,0 +1,165 @@
+package autoupgrade
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_verifyModulePath(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	if err := verifyModulePath(exe, "github.com/melt-inc/autoupgrade"); err != nil {
+		t.Errorf("verifyModulePath() error = %v", err)
+	}
+	if err := verifyModulePath(exe, "example.com/other"); !errors.Is(err, ErrModulePathMismatch) {
+		t.Errorf("verifyModulePath() error = %v, want %v", err, ErrModulePathMismatch)
+	}
+}
+
+func Test_backup(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "tool")
+	writeFile(t, target, []byte("old"))
+
+	b, err := backupBinary(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, target, []byte("new"))
+	if err := b.restore(); err != nil {
+		t.Fatal(err)
+	}
+	b.discard()
+	if data, _ := os.ReadFile(target); !bytes.Equal(data, []byte("old")) {
+		t.Errorf("restored %q, want %q", data, "old")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("backup left behind: %v", entries)
+	}
+
+	// Without a previous binary, restoring removes the new one.
+	missing := filepath.Join(dir, "missing")
+	b, err = backupBinary(missing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, missing, []byte("new"))
+	if err := b.restore(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(missing); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("new binary not removed: %v", err)
+	}
+}
+
+func Test_runVerifyCommand(t *testing.T) {
+	args := []string{"-test.run=^TestHelperProcess$"}
+	tests := []struct {
+		mode             string
+		opts             []Option
+		wantInconclusive bool
+		wantErr          error
+	}{
+		{"ok", nil, false, nil},
+		{"fail", nil, false, ErrVerifyFailed},
+		{"hang", []Option{WithVerifyTimeout(100*time.Millisecond, true)}, true, nil},
+		{"hang", []Option{WithVerifyTimeout(100*time.Millisecond, false)}, true, ErrVerifyFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			t.Setenv("AUTOUPGRADE_HELPER_PROCESS", tt.mode)
+			cfg := newConfig(append([]Option{WithVerifyCommand(args...)}, tt.opts...))
+			inconclusive, err := runVerifyCommand(context.Background(), cfg, os.Args[0])
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Errorf("runVerifyCommand() error = %v, want %v", err, tt.wantErr)
+			}
+			if inconclusive != tt.wantInconclusive {
+				t.Errorf("inconclusive = %v, want %v", inconclusive, tt.wantInconclusive)
+			}
+		})
+	}
+}
+
+func TestUpgrade_verifyCommand(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+
+	res := Upgrade(context.Background(), "", append(m.options(), WithVerifyCommand("--version"), WithVerifyTimeout(time.Minute, false))...)
+	if res.ExitError != nil || res.VerifyInconclusive {
+		t.Fatalf("Upgrade() = %v, inconclusive %v", res.ExitError, res.VerifyInconclusive)
+	}
+	if res.InstalledPath != m.binary() {
+		t.Errorf("InstalledPath = %q, want %q", res.InstalledPath, m.binary())
+	}
+}
+
+func TestUpgrade_verifyFunc(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+
+	unhealthy := errors.New("health check failed")
+	var checked string
+	res := Upgrade(context.Background(), "", append(m.options(), WithVerifyFunc(func(path string) error {
+		checked = path
+		return unhealthy
+	}))...)
+	if !errors.Is(res.ExitError, ErrVerifyFailed) || !errors.Is(res.ExitError, unhealthy) {
+		t.Fatalf("Upgrade() error = %v, want ErrVerifyFailed wrapping the check's error", res.ExitError)
+	}
+	if checked != m.binary() {
+		t.Errorf("verify func called with %q, want %q", checked, m.binary())
+	}
+	if _, err := os.Stat(m.binary()); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("binary left in place after failed check: %v", err)
+	}
+
+	res = Upgrade(context.Background(), "", append(m.options(), WithVerifyFunc(func(string) error { return nil }))...)
+	if res.ExitError != nil || res.InstalledPath != m.binary() {
+		t.Errorf("Upgrade() with passing check = %q, %v, want %q", res.InstalledPath, res.ExitError, m.binary())
+	}
+}
+
+func TestUpgrade_expectedHash(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+
+	res := Upgrade(context.Background(), "", append(m.options(), WithExpectedHash("v1.1.0", "h1:bogus="))...)
+	if !errors.Is(res.ExitError, ErrHashMismatch) {
+		t.Fatalf("Upgrade() with wrong hash error = %v, want ErrHashMismatch", res.ExitError)
+	}
+	if _, err := os.Stat(m.binary()); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("binary left in place after hash mismatch: %v", err)
+	}
+
+	hash, err := os.ReadFile(filepath.Join(m.modcache, "cache", "download", "example.com", "fake", "@v", "v1.1.0.ziphash"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res = Upgrade(context.Background(), "", append(m.options(), WithExpectedHash("v1.1.0", strings.TrimSpace(string(hash))))...)
+	if res.ExitError != nil {
+		t.Fatalf("Upgrade() with expected hash error = %v", res.ExitError)
+	}
+	if res.InstalledPath != m.binary() {
+		t.Errorf("InstalledPath = %q, want %q", res.InstalledPath, m.binary())
+	}
+
+	res = Upgrade(context.Background(), "", append(m.options(), WithExpectedHash("v1.0.0", "h1:other="))...)
+	if !errors.Is(res.ExitError, ErrHashMismatch) {
+		t.Errorf("Upgrade() without a hash for v1.1.0 error = %v, want ErrHashMismatch", res.ExitError)
+	}
+
+	rewrite := WithTargetRewriter(func(target string) (string, error) { return target, nil })
+	res = Upgrade(context.Background(), "", append(m.options(), WithExpectedHash("v1.1.0", "h1:bogus="), rewrite)...)
+	if !errors.Is(res.ExitError, ErrInvalidOption) {
+		t.Errorf("Upgrade() with WithTargetRewriter error = %v, want ErrInvalidOption", res.ExitError)
+	}
+}
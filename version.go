@@ -0,0 +1,212 @@
+package autoupgrade
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// Version is a parsed module version such as "v1.2.3", "v2.0.0-rc.1",
+// "v3.0.0+incompatible" or a pseudo-version. It is built on
+// golang.org/x/mod/semver and golang.org/x/mod/module, so parsing, ordering
+// and pseudo-version detection agree with the go command. The zero Version is
+// invalid and orders before every valid one.
+type Version struct {
+	raw                 string
+	major, minor, patch int
+}
+
+// ParseVersion parses a "v"-prefixed semantic version, following the rules of
+// the go command. Shorthands such as "v1" and "v1.2" are accepted. The error
+// wraps ErrInvalidVersion.
+func ParseVersion(v string) (Version, error) {
+	if !semver.IsValid(v) {
+		return Version{}, fmt.Errorf("%w: %q", ErrInvalidVersion, v)
+	}
+	major, minor, patch := versionNumbers(v)
+	return Version{raw: v, major: number(major), minor: number(minor), patch: number(patch)}, nil
+}
+
+// versionNumbers returns the decimal digits of the major, minor and patch
+// numbers of valid version v, with "0" for those a shorthand such as "v1.2"
+// leaves out.
+func versionNumbers(v string) (major, minor, patch string) {
+	c := strings.TrimSuffix(semver.Canonical(v), semver.Prerelease(v))
+	major, rest, _ := strings.Cut(c[1:], ".")
+	minor, patch, _ = strings.Cut(rest, ".")
+	return major, minor, patch
+}
+
+// number returns the decimal digits n as an int, or math.MaxInt if it does
+// not fit. Such versions are still valid: Compare orders them by their
+// digits, as the go command does.
+func number(n string) int {
+	i, err := strconv.Atoi(n)
+	if err != nil {
+		return math.MaxInt
+	}
+	return i
+}
+
+// NormalizeVersion returns a user-supplied version in the form the go
+// command expects: surrounding space trimmed and the "v" prefix added when
+// missing, so "1.2.3", "v1.2.3" and "1.2.3\n" all become "v1.2.3" and
+// "2.0.0+incompatible" becomes "v2.0.0+incompatible". The error wraps
+// ErrInvalidVersion if the result is not a valid semantic version, or carries
+// build metadata other than "+incompatible", which module versions cannot.
+func NormalizeVersion(v string) (string, error) {
+	v = normalizeVersion(strings.TrimSpace(v))
+	pv, err := ParseVersion(v)
+	if err != nil {
+		return "", err
+	}
+	if b := pv.Build(); b != "" && b != "+incompatible" {
+		return "", fmt.Errorf("%w: %q: module versions cannot carry build metadata %q", ErrInvalidVersion, v, b)
+	}
+	return v, nil
+}
+
+// String returns the version as it was parsed.
+func (v Version) String() string { return v.raw }
+
+// Major returns the major version number, or math.MaxInt if it is too large
+// for an int.
+func (v Version) Major() int { return v.major }
+
+// Minor returns the minor version number, or math.MaxInt if it is too large
+// for an int.
+func (v Version) Minor() int { return v.minor }
+
+// Patch returns the patch version number, or math.MaxInt if it is too large
+// for an int.
+func (v Version) Patch() int { return v.patch }
+
+// Prerelease returns the prerelease suffix including its leading '-', such as
+// "-rc.1", or "" if there is none.
+func (v Version) Prerelease() string { return semver.Prerelease(v.raw) }
+
+// Build returns the build metadata including its leading '+', such as
+// "+incompatible", or "" if there is none.
+func (v Version) Build() string { return semver.Build(v.raw) }
+
+// IsPrerelease reports whether v has a prerelease suffix. Pseudo-versions are
+// prereleases.
+func (v Version) IsPrerelease() bool { return v.Prerelease() != "" }
+
+// IsPseudo reports whether v is a pseudo-version, which encodes a commit time
+// and revision rather than a tag, such as "v0.0.0-20240101000000-abcdef123456".
+func (v Version) IsPseudo() bool {
+	return module.IsPseudoVersion(v.raw)
+}
+
+// Compare returns -1, 0 or +1 as v sorts before, with or after w in semantic
+// version precedence. Build metadata is ignored.
+func (v Version) Compare(w Version) int {
+	return semver.Compare(v.raw, w.raw)
+}
+
+// semverValid reports whether v is a valid semantic version.
+func semverValid(v string) bool {
+	return semver.IsValid(v)
+}
+
+// semverMajor returns the major version number of v as an integer, or -1 if v
+// is not a valid semantic version.
+func semverMajor(v string) int {
+	ver, err := ParseVersion(v)
+	if err != nil {
+		return -1
+	}
+	return ver.Major()
+}
+
+// semverCompare returns an integer comparing two versions according to
+// semantic version precedence. An invalid version is considered less than
+// all valid versions, and equal to other invalid versions.
+func semverCompare(v, w string) int {
+	return semver.Compare(v, w)
+}
+
+// pathMajor returns the major version encoded in a module path's suffix, such
+// as 3 for "example.com/mod/v3" or "gopkg.in/yaml.v3". It returns -1 when the
+// path carries no major version suffix.
+func pathMajor(modulePath string) int {
+	i := len(modulePath)
+	for i > 0 && '0' <= modulePath[i-1] && modulePath[i-1] <= '9' {
+		i--
+	}
+	if i == len(modulePath) || i < 2 || modulePath[i-1] != 'v' {
+		return -1
+	}
+	sep := modulePath[i-2]
+	if sep != '/' && !(sep == '.' && strings.HasPrefix(modulePath, "gopkg.in/")) {
+		return -1
+	}
+	n, err := strconv.Atoi(modulePath[i:])
+	if err != nil || (sep == '/' && n < 2) || modulePath[i] == '0' && n != 0 {
+		return -1
+	}
+	return n
+}
+
+// moduleMajor returns the effective major version of a module at a version.
+// The path suffix takes precedence since that is how Go encodes majors of two
+// and above; otherwise the leading semver digit is used (v0, v1, or a
+// "+incompatible" major).
+func moduleMajor(modulePath, version string) int {
+	if n := pathMajor(modulePath); n >= 0 {
+		return n
+	}
+	return semverMajor(version)
+}
+
+// isPseudoVersion reports whether v is a pseudo-version.
+func isPseudoVersion(v string) bool {
+	return module.IsPseudoVersion(v)
+}
+
+// pseudoVersionTime returns the commit time encoded in pseudo-version v.
+func pseudoVersionTime(v string) (time.Time, bool) {
+	t, err := module.PseudoVersionTime(v)
+	return t, err == nil
+}
+
+// isPrerelease reports whether v is a valid semantic version with a
+// prerelease suffix.
+func isPrerelease(v string) bool {
+	ver, err := ParseVersion(v)
+	return err == nil && ver.IsPrerelease()
+}
+
+// prereleaseChannel returns the channel a prerelease belongs to: the leading
+// letters of its first identifier, such as "beta" for "v1.3.0-beta.2" or "rc"
+// for "v2.0.0-rc1". It returns "" for releases, pseudo-versions and
+// prereleases that start with a number.
+func prereleaseChannel(v string) string {
+	ver, err := ParseVersion(v)
+	if err != nil || !ver.IsPrerelease() || ver.IsPseudo() {
+		return ""
+	}
+	pre := ver.Prerelease()[1:]
+	i := 0
+	for i < len(pre) && ('a' <= pre[i] && pre[i] <= 'z' || 'A' <= pre[i] && pre[i] <= 'Z') {
+		i++
+	}
+	return pre[:i]
+}
+
+// isCleanTag reports whether v is a tagged release: a valid semantic version
+// that is not a pseudo-version and carries no build metadata other than
+// "+incompatible" (in particular, not "+dirty").
+func isCleanTag(v string) bool {
+	ver, err := ParseVersion(v)
+	if err != nil || ver.IsPseudo() {
+		return false
+	}
+	return ver.Build() == "" || ver.Build() == "+incompatible"
+}
@@ -0,0 +1,168 @@
+package autoupgrade
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func Test_semverCompare(t *testing.T) {
+	tests := []struct {
+		v, w string
+		want int
+	}{
+		{"v1.0.0", "v1.0.0", 0},
+		{"v1.0.0", "v1.0.1", -1},
+		{"v1.10.0", "v1.9.0", 1},
+		{"v1.0.0-beta.2", "v1.0.0-beta.10", -1},
+		{"v1.0.0-beta", "v1.0.0", -1},
+		{"v1.0.0+meta", "v1.0.0", 0},
+		{"v2", "v2.0.0", 0},
+		{"bad", "v0.0.1", -1},
+	}
+	for _, tt := range tests {
+		if got := semverCompare(tt.v, tt.w); got != tt.want {
+			t.Errorf("semverCompare(%q, %q) = %d, want %d", tt.v, tt.w, got, tt.want)
+		}
+	}
+}
+
+func Test_moduleMajor(t *testing.T) {
+	tests := []struct {
+		path, version string
+		want          int
+	}{
+		{"example.com/mod", "v0.3.1", 0},
+		{"example.com/mod", "v1.2.3", 1},
+		{"example.com/mod/v2", "v2.0.0", 2},
+		{"example.com/mod/v10", "v10.1.0", 10},
+		{"example.com/mod", "v3.0.0+incompatible", 3},
+		{"example.com/v1", "v1.0.0", 1},
+		{"gopkg.in/yaml.v3", "v3.0.1", 3},
+		{"example.com/mod.v3", "v1.0.0", 1},
+		{"example.com/mod", "(devel)", -1},
+	}
+	for _, tt := range tests {
+		if got := moduleMajor(tt.path, tt.version); got != tt.want {
+			t.Errorf("moduleMajor(%q, %q) = %d, want %d", tt.path, tt.version, got, tt.want)
+		}
+	}
+}
+
+func Test_isCleanTag(t *testing.T) {
+	tests := map[string]bool{
+		"v1.2.3":                                 true,
+		"v1.2.3-rc.1":                            true,
+		"v2.0.0+incompatible":                    true,
+		"v1.2.3+dirty":                           false,
+		"v0.0.0-20240101000000-abcdefabcdef":     false,
+		"v1.2.4-0.20240101000000-abcdefabcdef":   false,
+		"v1.2.3-pre.0.20240101000000-abcdefabcd": false,
+		"v1.2.3-pre.20240101000000-abcdefabcdef": true,
+		"(devel)":                                false,
+		"":                                       false,
+	}
+	for v, want := range tests {
+		if got := isCleanTag(v); got != want {
+			t.Errorf("isCleanTag(%q) = %v, want %v", v, got, want)
+		}
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in                  string
+		major, minor, patch int
+		pre, build          string
+		prerelease, pseudo  bool
+	}{
+		{"v1.2.3", 1, 2, 3, "", "", false, false},
+		{"v2", 2, 0, 0, "", "", false, false},
+		{"v1.0.0-rc.1+meta", 1, 0, 0, "-rc.1", "+meta", true, false},
+		{"v3.0.0+incompatible", 3, 0, 0, "", "+incompatible", false, false},
+		{"v0.0.0-20240101000000-abcdef123456", 0, 0, 0, "-20240101000000-abcdef123456", "", true, true},
+		{"v1.2.4-0.20240101000000-abcdef123456", 1, 2, 4, "-0.20240101000000-abcdef123456", "", true, true},
+	}
+	for _, tt := range tests {
+		v, err := ParseVersion(tt.in)
+		if err != nil {
+			t.Errorf("ParseVersion(%q) error = %v", tt.in, err)
+			continue
+		}
+		if v.Major() != tt.major || v.Minor() != tt.minor || v.Patch() != tt.patch {
+			t.Errorf("ParseVersion(%q) = %d.%d.%d, want %d.%d.%d", tt.in, v.Major(), v.Minor(), v.Patch(), tt.major, tt.minor, tt.patch)
+		}
+		if v.Prerelease() != tt.pre || v.Build() != tt.build {
+			t.Errorf("ParseVersion(%q) prerelease, build = %q, %q, want %q, %q", tt.in, v.Prerelease(), v.Build(), tt.pre, tt.build)
+		}
+		if v.IsPrerelease() != tt.prerelease || v.IsPseudo() != tt.pseudo {
+			t.Errorf("ParseVersion(%q) IsPrerelease, IsPseudo = %v, %v, want %v, %v", tt.in, v.IsPrerelease(), v.IsPseudo(), tt.prerelease, tt.pseudo)
+		}
+		if v.String() != tt.in {
+			t.Errorf("ParseVersion(%q).String() = %q", tt.in, v.String())
+		}
+	}
+
+	// Numbers too large for an int are valid, and still ordered by value
+	huge, err := ParseVersion("v1.0.99999999999999999999")
+	if err != nil || huge.Patch() != math.MaxInt {
+		t.Errorf("ParseVersion(v1.0.99999999999999999999) = %d, %v, want math.MaxInt", huge.Patch(), err)
+	}
+	if c := semverCompare("v1.0.99999999999999999999", "v1.0.100000000000000000000"); c != -1 {
+		t.Errorf("semverCompare() of huge patch versions = %d, want -1", c)
+	}
+
+	for _, in := range []string{"", "1.2.3", "v1.02.3", "v1.2.3-", "(devel)"} {
+		if _, err := ParseVersion(in); !errors.Is(err, ErrInvalidVersion) {
+			t.Errorf("ParseVersion(%q) error = %v, want ErrInvalidVersion", in, err)
+		}
+	}
+}
+
+func TestNormalizeVersion(t *testing.T) {
+	for in, want := range map[string]string{
+		"1.2.3":               "v1.2.3",
+		"v1.2.3":              "v1.2.3",
+		" 1.2.3\n":            "v1.2.3",
+		"1.2":                 "v1.2",
+		"1.0.0-rc.1":          "v1.0.0-rc.1",
+		"2.0.0+incompatible":  "v2.0.0+incompatible",
+		"v2.0.0+incompatible": "v2.0.0+incompatible",
+	} {
+		if got, err := NormalizeVersion(in); err != nil || got != want {
+			t.Errorf("NormalizeVersion(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "latest", "V1.2.3", "1.2.3.4", "v1.2.3+meta", "1.02.3"} {
+		if _, err := NormalizeVersion(in); !errors.Is(err, ErrInvalidVersion) {
+			t.Errorf("NormalizeVersion(%q) error = %v, want ErrInvalidVersion", in, err)
+		}
+	}
+}
+
+func TestVersion_Compare(t *testing.T) {
+	a, _ := ParseVersion("v1.2.3")
+	b, _ := ParseVersion("v1.10.0")
+	if a.Compare(b) != -1 || b.Compare(a) != 1 || a.Compare(a) != 0 {
+		t.Errorf("Compare(v1.2.3, v1.10.0) not ordered")
+	}
+	if (Version{}).Compare(a) != -1 || a.Compare(Version{}) != 1 || (Version{}).Compare(Version{}) != 0 {
+		t.Errorf("zero Version does not sort first")
+	}
+}
+
+func Test_prereleaseChannel(t *testing.T) {
+	tests := map[string]string{
+		"v1.3.0-beta.2":                      "beta",
+		"v2.0.0-rc1":                         "rc",
+		"v1.0.0-alpha":                       "alpha",
+		"v1.0.0":                             "",
+		"v1.0.0-0.3":                         "",
+		"v0.0.0-20240101000000-abcdef123456": "",
+	}
+	for v, want := range tests {
+		if got := prereleaseChannel(v); got != want {
+			t.Errorf("prereleaseChannel(%q) = %q, want %q", v, got, want)
+		}
+	}
+}
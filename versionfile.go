@@ -0,0 +1,41 @@
+package autoupgrade
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// errNoVersionFile is returned by readVersionFile when the file set with
+// WithVersionFile is missing and WithVersionFileRequired is set.
+var errNoVersionFile = errors.New("autoupgrade: version file missing")
+
+// readVersionFile returns what the file set with WithVersionFile selects, in
+// the form of a channel config entry. A missing file selects "latest" unless
+// WithVersionFileRequired is set.
+func readVersionFile(cfg *config) (string, error) {
+	data, err := os.ReadFile(cfg.versionFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		if cfg.versionFileRequired {
+			return "", errNoVersionFile
+		}
+		cfg.logf("no version file at %s, installing latest", cfg.versionFile)
+		return "latest", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidVersionFile, err)
+	}
+	spec := strings.TrimSpace(string(data))
+	if spec == "" || strings.ContainsAny(spec, "\n\r") {
+		return "", fmt.Errorf("%w: %s must hold a single version", ErrInvalidVersionFile, cfg.versionFile)
+	}
+	if spec != "latest" && !semverValid(normalizeVersion(spec)) {
+		if _, err := parseConstraint(spec); err != nil {
+			return "", fmt.Errorf("%w: %s: %w", ErrInvalidVersionFile, cfg.versionFile, err)
+		}
+	}
+	cfg.logf("version file %s selected %s", cfg.versionFile, spec)
+	return spec, nil
+}
@@ -0,0 +1,73 @@
+package autoupgrade
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpgrade_versionFile(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0", "v1.2.0")
+	fakeBuildInfo(t, m.path, "v1.2.0")
+	file := filepath.Join(t.TempDir(), "VERSION")
+	writeFile(t, file, []byte("v1.1.0\n"))
+
+	res := Upgrade(context.Background(), "", append(m.options(), WithVersionFile(file))...)
+	if res.ExitError != nil {
+		t.Fatalf("Upgrade() error = %v", res.ExitError)
+	}
+	if res.Decision.Target != "v1.1.0" || res.InstalledPath == "" {
+		t.Errorf("Upgrade() installed %q at %q, want v1.1.0", res.Decision.Target, res.InstalledPath)
+	}
+
+	// The file is read again on every call.
+	writeFile(t, file, []byte("v1.2.0"))
+	res = Upgrade(context.Background(), "", append(m.options(), WithVersionFile(file))...)
+	if res.SkipReason != SkipAlreadyLatest {
+		t.Errorf("Upgrade() after the file changed = %q, %v, want %q", res.SkipReason, res.ExitError, SkipAlreadyLatest)
+	}
+}
+
+func TestUpgrade_versionFileMissing(t *testing.T) {
+	m := newFakeModule(t, "example.com/fake", "v1.0.0", "v1.1.0")
+	fakeBuildInfo(t, m.path, "v1.0.0")
+	file := filepath.Join(t.TempDir(), "VERSION")
+
+	res := Upgrade(context.Background(), "", append(m.options(), WithVersionFile(file), WithVersionFileRequired(true))...)
+	if res.ExitError != nil || res.SkipReason != SkipNoVersionFile {
+		t.Errorf("Upgrade() with required file = %q, %v, want %q", res.SkipReason, res.ExitError, SkipNoVersionFile)
+	}
+
+	res = Upgrade(context.Background(), "", append(m.options(), WithVersionFile(file))...)
+	if res.ExitError != nil || res.Target() != m.path+"@latest" || res.InstalledPath == "" {
+		t.Errorf("Upgrade() without file installed %q, %v, want latest", res.Target(), res.ExitError)
+	}
+}
+
+func Test_readVersionFile(t *testing.T) {
+	dir := t.TempDir()
+	for content, ok := range map[string]bool{
+		"v1.2.3\n":        true,
+		"1.2.3":           true,
+		"latest":          true,
+		">=1.2.0, <2.0.0": true,
+		"":                false,
+		"v1.2.3\nv2":      false,
+		"not a ver!":      false,
+	} {
+		file := filepath.Join(dir, "VERSION")
+		writeFile(t, file, []byte(content))
+		_, err := readVersionFile(newConfig([]Option{WithVersionFile(file)}))
+		if ok && err != nil || !ok && !errors.Is(err, ErrInvalidVersionFile) {
+			t.Errorf("readVersionFile(%q) error = %v, want ok %v", content, err, ok)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "dir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readVersionFile(newConfig([]Option{WithVersionFile(filepath.Join(dir, "dir"))})); !errors.Is(err, ErrInvalidVersionFile) {
+		t.Errorf("readVersionFile(directory) error = %v, want %v", err, ErrInvalidVersionFile)
+	}
+}
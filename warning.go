@@ -0,0 +1,59 @@
+package autoupgrade
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Warning flags something about a completed upgrade that may need the user's
+// attention, without failing it.
+type Warning string
+
+const (
+	// WarnInstallDirNotOnPath means go install wrote the new binary,
+	// InstalledPath, to a directory that is not on PATH, so running the
+	// tool by name still finds an older copy elsewhere, or nothing.
+	WarnInstallDirNotOnPath Warning = "install-dir-not-on-path"
+)
+
+// onPath reports whether dir is one of the directories in the PATH list,
+// comparing cleaned paths with symbolic links resolved, and without regard
+// to case on Windows.
+func onPath(dir, path string) bool {
+	want := resolvedDir(dir)
+	for _, d := range filepath.SplitList(path) {
+		if d == "" {
+			continue
+		}
+		got := resolvedDir(d)
+		if got == want || runtime.GOOS == "windows" && strings.EqualFold(got, want) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvedDir returns dir cleaned and with symbolic links resolved where
+// possible.
+func resolvedDir(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	if r, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = r
+	}
+	return filepath.Clean(dir)
+}
+
+// checkOnPath adds WarnInstallDirNotOnPath to res when the directory of the
+// installed binary is not on the process's PATH.
+func checkOnPath(cfg *config, res *UpgradeResult) {
+	dir := filepath.Dir(res.InstalledPath)
+	if onPath(dir, os.Getenv("PATH")) {
+		return
+	}
+	cfg.logf("installed %s, but %s is not on PATH; add it to run the new version by name", res.InstalledPath, dir)
+	res.Warnings = append(res.Warnings, WarnInstallDirNotOnPath)
+}
@@ -0,0 +1,59 @@
+package autoupgrade
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func Test_onPath(t *testing.T) {
+	dir, other := t.TempDir(), t.TempDir()
+	link := filepath.Join(other, "link")
+	if err := os.Symlink(dir, link); err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{dir, true},
+		{other + string(filepath.ListSeparator) + dir + string(filepath.Separator), true},
+		{link, true},
+		{other, false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := onPath(dir, tt.path); got != tt.want {
+			t.Errorf("onPath(%q, %q) = %v, want %v", dir, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestUpgrade_installDirNotOnPath(t *testing.T) {
+	fakeBuildInfo(t, "example.com/fake", "v1.0.0")
+	shim, _ := writeGoShim(t, "go1.21.5")
+	upgrade := func(gobin string) *UpgradeResult {
+		return Upgrade(context.Background(), "",
+			WithGoBinary(shim),
+			WithEnv("GOBIN="+gobin),
+			WithSkipPreCheck(true),
+			WithVerifyModulePath(false),
+		)
+	}
+
+	gobin := t.TempDir()
+	t.Setenv("PATH", t.TempDir())
+	res := upgrade(gobin)
+	if res.ExitError != nil || !slices.Contains(res.Warnings, WarnInstallDirNotOnPath) {
+		t.Errorf("Upgrade() = %v, warnings %q, want %q", res.ExitError, res.Warnings, WarnInstallDirNotOnPath)
+	}
+
+	gobin = t.TempDir()
+	t.Setenv("PATH", gobin)
+	res = upgrade(gobin)
+	if res.ExitError != nil || len(res.Warnings) != 0 {
+		t.Errorf("Upgrade() with GOBIN on PATH = %v, warnings %q, want none", res.ExitError, res.Warnings)
+	}
+}
@@ -0,0 +1,183 @@
+package autoupgrade
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Watcher periodically runs Upgrade for long-running processes.
+type Watcher struct {
+	packagePath string
+	interval    time.Duration
+	opts        []Option
+	cfg         *config
+}
+
+// NewWatcher returns a Watcher that upgrades packagePath every interval. The
+// options are passed to each Upgrade call.
+func NewWatcher(packagePath string, interval time.Duration, opts ...Option) *Watcher {
+	return &Watcher{
+		packagePath: packagePath,
+		interval:    interval,
+		opts:        opts,
+		cfg:         newConfig(opts),
+	}
+}
+
+// Run starts checking for upgrades in a goroutine and returns a channel that
+// receives the result of each attempt. The first check happens immediately,
+// delayed only by any configured jitter. Run stops once an upgrade succeeds,
+// since the running process is then out of date, or when ctx is done. The
+// channel is closed when Run stops.
+func (w *Watcher) Run(ctx context.Context) <-chan *UpgradeResult {
+	return w.run(ctx, (*UpgradeResult).DidUpgrade)
+}
+
+// UpgradeUntilSuccess keeps running Upgrade until it succeeds, for
+// environments where installs fail intermittently. It returns a channel that
+// receives the result of each attempt, and is closed once an attempt neither
+// fails nor finds another install in progress: the upgrade was installed, or
+// skipped for a reason such as SkipAlreadyLatest or SkipNoBuildInfo that
+// retrying would not change. Attempts are retryInterval apart, plus any
+// WithJitter delay, and stop when ctx is done. Unlike WithRetry, which
+// retries go install within a single Upgrade, each attempt starts over from
+// resolving the target.
+func UpgradeUntilSuccess(ctx context.Context, packagePath string, retryInterval time.Duration, opts ...Option) <-chan *UpgradeResult {
+	return NewWatcher(packagePath, retryInterval, opts...).run(ctx, func(res *UpgradeResult) bool {
+		if res.SkipReason == SkipNoBuildInfo {
+			return true
+		}
+		return res.ExitError == nil && res.SkipReason != SkipInstallInProgress
+	})
+}
+
+// run calls Upgrade every interval, sending each result on the returned
+// channel, until done reports true for a result or ctx is done.
+func (w *Watcher) run(ctx context.Context, done func(*UpgradeResult) bool) <-chan *UpgradeResult {
+	ch := make(chan *UpgradeResult)
+	go func() {
+		defer close(ch)
+		delay, interval := w.jitter(), w.interval
+		for {
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			res := Upgrade(ctx, w.packagePath, w.opts...)
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- res:
+			}
+			if done(res) {
+				return
+			}
+			interval = w.nextInterval(interval, res)
+			delay = interval + w.jitter()
+		}
+	}()
+	return ch
+}
+
+// nextInterval returns the wait before the check after res, which followed
+// a wait of interval: always the Watcher's interval, or with
+// WithAdaptiveInterval, longer after a check that found nothing to do and
+// the minimum after an upgrade or a failure worth retrying soon.
+func (w *Watcher) nextInterval(interval time.Duration, res *UpgradeResult) time.Duration {
+	lo, hi := w.cfg.adaptiveMin, w.cfg.adaptiveMax
+	if lo <= 0 || hi < lo {
+		return w.interval
+	}
+	switch {
+	case res.ExitError != nil:
+		if c := Classify(res.ExitError); c == FailureTransient || c == FailureNetwork {
+			interval = lo
+		}
+	case res.Decision.AlreadyLatest:
+		interval *= 2
+	case res.InstalledPath != "":
+		interval = lo
+	}
+	return min(max(interval, lo), hi)
+}
+
+// jitter returns a random duration in [0, max) for the configured maximum.
+func (w *Watcher) jitter() time.Duration {
+	return randomDelay(w.cfg.jitter)
+}
+
+// randomDelay returns a random duration in [0, max), or 0 if max is not
+// positive.
+func randomDelay(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+// Notifier periodically checks the module proxy for a newer stable release
+// of the running binary, for tools that prefer to tell users rather than
+// upgrade themselves. It never installs anything.
+type Notifier struct {
+	packagePath string
+	interval    time.Duration
+	onUpdate    func(current, latest string)
+	cfg         *config
+}
+
+// NewNotifier returns a Notifier that checks every interval and calls
+// onUpdate with the current and latest versions when a newer stable release
+// appears. onUpdate is called once per release, not on every check that
+// finds it. The options configure the proxy queries, as for CheckLatest.
+func NewNotifier(packagePath string, interval time.Duration, onUpdate func(current, latest string), opts ...Option) *Notifier {
+	return &Notifier{
+		packagePath: packagePath,
+		interval:    interval,
+		onUpdate:    onUpdate,
+		cfg:         newConfig(opts),
+	}
+}
+
+// Run checks for a newer release until ctx is done, then returns ctx.Err().
+// The first check happens immediately, delayed only by any configured
+// jitter. Failed checks are logged with WithLogger and retried at the next
+// interval. Run returns ErrNoBuildInfo at once if the running binary has no
+// module build information.
+func (n *Notifier) Run(ctx context.Context) error {
+	info, ok := CurrentBuildInfo()
+	if !ok || info.Main.Path == "" {
+		return ErrNoBuildInfo
+	}
+	current, notified := info.Main.Version, ""
+	delay := randomDelay(n.cfg.jitter)
+	for {
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		latest, err := latestVersion(ctx, n.cfg, info.Main.Path)
+		switch {
+		case err != nil:
+			n.cfg.logf("checking for a newer release: %v", err)
+		case latest != notified && newerStable(latest, current):
+			notified = latest
+			n.onUpdate(current, latest)
+		}
+		delay = n.interval + randomDelay(n.cfg.jitter)
+	}
+}
+
+// newerStable reports whether latest is a tagged release, not a prerelease,
+// newer than the valid version current.
+func newerStable(latest, current string) bool {
+	return semverValid(current) && isCleanTag(latest) && !isPrerelease(latest) && semverCompare(latest, current) > 0
+}
@@ -0,0 +1,176 @@
+package autoupgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatcher_Run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := NewWatcher("", time.Millisecond, WithJitter(time.Millisecond))
+	ch := w.Run(ctx)
+	for i := 0; i < 3; i++ {
+		select {
+		case res := <-ch:
+			if res.DidUpgrade() {
+				t.Fatal("test binary upgraded")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for check")
+		}
+	}
+	cancel()
+	for range ch {
+	}
+}
+
+func TestWatcher_jitter(t *testing.T) {
+	w := NewWatcher("", time.Minute, WithJitter(10*time.Millisecond))
+	for i := 0; i < 100; i++ {
+		if d := w.jitter(); d < 0 || d >= 10*time.Millisecond {
+			t.Fatalf("jitter() = %v, want [0, 10ms)", d)
+		}
+	}
+	if d := NewWatcher("", time.Minute).jitter(); d != 0 {
+		t.Errorf("jitter() without WithJitter = %v, want 0", d)
+	}
+}
+
+func TestWatcher_nextInterval(t *testing.T) {
+	latest := &UpgradeResult{Decision: Decision{AlreadyLatest: true}}
+	upgraded := &UpgradeResult{InstalledPath: "/go/bin/tool"}
+	transient := &UpgradeResult{ExitError: fmt.Errorf("go install: %w", ErrProxyUnavailable)}
+	permanent := &UpgradeResult{ExitError: ErrNotFound}
+	skipped := &UpgradeResult{SkipReason: SkipBackoff}
+
+	w := NewWatcher("", 10*time.Minute, WithAdaptiveInterval(time.Minute, time.Hour))
+	tests := []struct {
+		interval time.Duration
+		res      *UpgradeResult
+		want     time.Duration
+	}{
+		{10 * time.Minute, latest, 20 * time.Minute},
+		{40 * time.Minute, latest, time.Hour},
+		{time.Hour, latest, time.Hour},
+		{time.Hour, upgraded, time.Minute},
+		{time.Hour, transient, time.Minute},
+		{20 * time.Minute, permanent, 20 * time.Minute},
+		{20 * time.Minute, skipped, 20 * time.Minute},
+		{2 * time.Hour, skipped, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := w.nextInterval(tt.interval, tt.res); got != tt.want {
+			t.Errorf("nextInterval(%v, %+v) = %v, want %v", tt.interval, tt.res, got, tt.want)
+		}
+	}
+	if got := NewWatcher("", 10*time.Minute).nextInterval(time.Hour, latest); got != 10*time.Minute {
+		t.Errorf("nextInterval() without WithAdaptiveInterval = %v, want 10m", got)
+	}
+
+	fakeBuildInfo(t, "example.com/fake", "v1.0.0")
+	res := Upgrade(context.Background(), "", WithAdaptiveInterval(time.Hour, time.Minute))
+	if !errors.Is(res.ExitError, ErrInvalidOption) {
+		t.Errorf("Upgrade() with inverted bounds error = %v, want %v", res.ExitError, ErrInvalidOption)
+	}
+}
+
+func TestUpgradeUntilSuccess(t *testing.T) {
+	fakeBuildInfo(t, "example.com/fake", "v1.0.0")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// An unsupported platform fails every attempt, so it keeps retrying.
+	ch := UpgradeUntilSuccess(ctx, "", time.Millisecond, WithTargetPlatform("plan10", "amd64"))
+	for i := 0; i < 3; i++ {
+		select {
+		case res, ok := <-ch:
+			if !ok {
+				t.Fatal("channel closed after a failed attempt")
+			}
+			if res.ExitError == nil {
+				t.Fatal("ExitError = nil, want an error")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for attempt")
+		}
+	}
+	cancel()
+	for range ch {
+	}
+
+	// A skip is final.
+	fakeBuildInfo(t, "example.com/fake", "(devel)")
+	var n int
+	for res := range UpgradeUntilSuccess(context.Background(), "", time.Millisecond) {
+		if res.SkipReason != SkipDevelBuild {
+			t.Errorf("SkipReason = %q, want %q", res.SkipReason, SkipDevelBuild)
+		}
+		n++
+	}
+	if n != 1 {
+		t.Errorf("got %d attempts, want 1", n)
+	}
+}
+
+func TestNotifier_Run(t *testing.T) {
+	fakeBuildInfo(t, "example.com/fake", "v1.0.0")
+	var latest atomic.Value
+	latest.Store("v1.0.0")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"Version":%q}`, latest.Load())
+	}))
+	defer srv.Close()
+
+	updates := make(chan string, 10)
+	n := NewNotifier("", time.Millisecond, func(current, latest string) {
+		if current != "v1.0.0" {
+			t.Errorf("onUpdate current = %q, want v1.0.0", current)
+		}
+		updates <- latest
+	}, WithProxy(srv.URL))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- n.Run(ctx) }()
+
+	wait := func(want string) {
+		t.Helper()
+		select {
+		case got := <-updates:
+			if got != want {
+				t.Errorf("onUpdate latest = %q, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s", want)
+		}
+	}
+	latest.Store("v1.1.0")
+	wait("v1.1.0")
+	latest.Store("v1.2.0-rc.1")
+	time.Sleep(20 * time.Millisecond)
+	latest.Store("v1.2.0")
+	wait("v1.2.0")
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() = %v, want context.Canceled", err)
+	}
+	if len(updates) != 0 {
+		t.Errorf("onUpdate called again for %q", <-updates)
+	}
+}
+
+func TestNotifier_noBuildInfo(t *testing.T) {
+	fakeBuildInfo(t, "", "")
+	n := NewNotifier("", time.Millisecond, func(current, latest string) { t.Error("onUpdate called") })
+	if err := n.Run(context.Background()); !errors.Is(err, ErrNoBuildInfo) {
+		t.Errorf("Run() = %v, want ErrNoBuildInfo", err)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !(linux || darwin || freebsd || dragonfly)
+
+package autoupgrade
+
+import "os"
+
+// canWrite reports whether the existing directory dir looks writable from
+// its permission bits, without writing anything.
+func canWrite(dir string) bool {
+	fi, err := os.Stat(dir)
+	return err == nil && fi.IsDir() && fi.Mode().Perm()&0o200 != 0
+}
@@ -0,0 +1,14 @@
+//go:build linux || darwin || freebsd || dragonfly
+
+package autoupgrade
+
+import "syscall"
+
+// wOK is the access(2) mode asking for write permission.
+const wOK = 0x2
+
+// canWrite reports whether the process may create files in the existing
+// directory dir, without writing anything.
+func canWrite(dir string) bool {
+	return syscall.Access(dir, wOK) == nil
+}